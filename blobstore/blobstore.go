@@ -0,0 +1,63 @@
+// Package blobstore stores attachment contents outside of MongoDB, on the local
+// filesystem or in any S3-compatible object store.
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+var (
+	ErrNotFound   = errors.New("blobstore: blob not found")
+	ErrInvalidKey = errors.New("blobstore: invalid key")
+)
+
+// BlobStore - content addressed storage for attachment files
+type BlobStore interface {
+	// Put - stores size bytes read from r under key, overwriting any existing blob
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get - returns the contents of the blob, ErrNotFound if it doesn't exist. The caller closes the reader.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete - removes the blob, deleting a missing blob is not an error
+	Delete(ctx context.Context, key string) error
+	// Exists - reports whether a blob is stored under key
+	Exists(ctx context.Context, key string) (bool, error)
+}
+
+// FromEnv - builds the store selected by BLOB_STORE ("local", the default, or "s3")
+func FromEnv() (BlobStore, error) {
+	switch kind := os.Getenv("BLOB_STORE"); kind {
+	case "", "local":
+		dir := os.Getenv("BLOB_LOCAL_DIR")
+		if dir == "" {
+			dir = "data/blobs"
+		}
+		return NewLocalStore(dir)
+	case "s3":
+		return NewS3Store(S3Config{
+			Endpoint:  os.Getenv("S3_ENDPOINT"),
+			Region:    os.Getenv("S3_REGION"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("S3_SECRET_KEY"),
+		})
+	default:
+		return nil, fmt.Errorf("blobstore: unknown BLOB_STORE %q", kind)
+	}
+}
+
+// validKey - keys are used as file names and URL path segments, keep them to a safe alphabet
+func validKey(key string) bool {
+	if key == "" || len(key) > 256 {
+		return false
+	}
+	for _, r := range key {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
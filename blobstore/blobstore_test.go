@@ -0,0 +1,34 @@
+package blobstore
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidKey(t *testing.T) {
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{"5f1c0e7a9b2d4c6e8a0b1c2d", true},
+		{"report_2026-03-11", true},
+		{"a", true},
+		{strings.Repeat("a", 256), true},
+		{strings.Repeat("a", 257), false},
+		{"", false},
+		{"..", false},
+		{"../etc/passwd", false},
+		{"a/b", false},
+		{`a\b`, false},
+		{"a.pdf", false},
+		{"a b", false},
+		{"a%2Fb", false},
+		{"é", false},
+	}
+
+	for _, test := range tests {
+		if got := validKey(test.key); got != test.want {
+			t.Errorf("validKey(%q) = %v, want %v", test.key, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLocalStore(t *testing.T) {
+	ctx := context.Background()
+	root := filepath.Join(t.TempDir(), "blobs")
+	store, err := NewLocalStore(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if exists, err := store.Exists(ctx, "abc123"); err != nil || exists {
+		t.Fatalf("Exists() before Put = %v, %v, want false", exists, err)
+	}
+	if _, err := store.Get(ctx, "abc123"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get() before Put error = %v, want ErrNotFound", err)
+	}
+
+	// Only size bytes are stored
+	if err := store.Put(ctx, "abc123", strings.NewReader("hello world"), 5, "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	if got := readBlob(t, store, "abc123"); got != "hello" {
+		t.Errorf("Get() = %q, want %q", got, "hello")
+	}
+	if _, err := os.Stat(filepath.Join(root, "ab", "abc123")); err != nil {
+		t.Errorf("the blob isn't stored in its shard: %v", err)
+	}
+	if exists, err := store.Exists(ctx, "abc123"); err != nil || !exists {
+		t.Errorf("Exists() after Put = %v, %v, want true", exists, err)
+	}
+
+	if err := store.Put(ctx, "abc123", strings.NewReader("bye"), 3, "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	if got := readBlob(t, store, "abc123"); got != "bye" {
+		t.Errorf("Get() after overwriting = %q, want %q", got, "bye")
+	}
+	entries, err := os.ReadDir(filepath.Join(root, "ab"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("the shard holds %d files, want only the blob", len(entries))
+	}
+
+	if err := store.Delete(ctx, "abc123"); err != nil {
+		t.Fatal(err)
+	}
+	if exists, err := store.Exists(ctx, "abc123"); err != nil || exists {
+		t.Errorf("Exists() after Delete = %v, %v, want false", exists, err)
+	}
+	if err := store.Delete(ctx, "abc123"); err != nil {
+		t.Errorf("Delete() of a missing blob error = %v", err)
+	}
+}
+
+func TestLocalStoreShortKey(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Put(ctx, "a", strings.NewReader("x"), 1, ""); err != nil {
+		t.Fatal(err)
+	}
+	if got := readBlob(t, store, "a"); got != "x" {
+		t.Errorf("Get() = %q, want %q", got, "x")
+	}
+}
+
+func TestLocalStoreInvalidKey(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store, err := NewLocalStore(filepath.Join(dir, "blobs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"", "../outside", "ab/../../outside", "a.b"} {
+		if err := store.Put(ctx, key, strings.NewReader("x"), 1, ""); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Put(%q) error = %v, want ErrInvalidKey", key, err)
+		}
+		if _, err := store.Get(ctx, key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Get(%q) error = %v, want ErrInvalidKey", key, err)
+		}
+		if err := store.Delete(ctx, key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Delete(%q) error = %v, want ErrInvalidKey", key, err)
+		}
+		if _, err := store.Exists(ctx, key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Exists(%q) error = %v, want ErrInvalidKey", key, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "outside")); !os.IsNotExist(err) {
+		t.Errorf("a file was written outside the root: %v", err)
+	}
+}
+
+func readBlob(t *testing.T, store BlobStore, key string) string {
+	t.Helper()
+	r, err := store.Get(context.Background(), key)
+	if err != nil {
+		t.Fatalf("Get(%q) error = %v", key, err)
+	}
+	defer r.Close()
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
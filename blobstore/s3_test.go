@@ -0,0 +1,226 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeS3 - an in-memory stand-in for one bucket of an S3-compatible API, which refuses requests that aren't signed
+type fakeS3 struct {
+	t      *testing.T
+	signer *S3Store // Holds the credentials of the bucket
+	mu     sync.Mutex
+	blobs  map[string]string
+	types  map[string]string
+	status int // Returned instead of handling the request when set
+}
+
+func newFakeS3(t *testing.T) (*fakeS3, *S3Store) {
+	fake := &fakeS3{t: t, blobs: map[string]string{}, types: map[string]string{}}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	store, err := NewS3Store(S3Config{
+		Endpoint:  server.URL + "/",
+		Region:    "eu-west-1",
+		Bucket:    "attachments",
+		AccessKey: "AKIDEXAMPLE",
+		SecretKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake.signer = &S3Store{config: store.config}
+	return fake, store
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !f.signed(r) {
+		w.WriteHeader(http.StatusForbidden)
+		io.WriteString(w, "<Error><Code>SignatureDoesNotMatch</Code></Error>")
+		return
+	}
+	if f.status != 0 {
+		w.WriteHeader(f.status)
+		io.WriteString(w, "<Error><Code>InternalError</Code></Error>")
+		return
+	}
+
+	key, ok := strings.CutPrefix(r.URL.Path, "/attachments/")
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		body, _ := io.ReadAll(r.Body)
+		if int64(len(body)) != r.ContentLength {
+			f.t.Errorf("PUT sent %d bytes with Content-Length %d", len(body), r.ContentLength)
+		}
+		f.blobs[key] = string(body)
+		f.types[key] = r.Header.Get("Content-Type")
+	case http.MethodGet, http.MethodHead:
+		blob, ok := f.blobs[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		io.WriteString(w, blob)
+	case http.MethodDelete:
+		// S3 doesn't tell whether the object existed, some compatible stores answer 404
+		if _, ok := f.blobs[key]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(f.blobs, key)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// signed - re-signs the request as received, so a signature over anything but what was sent doesn't match
+func (f *fakeS3) signed(r *http.Request) bool {
+	signedAt, err := time.Parse("20060102T150405Z", r.Header.Get("x-amz-date"))
+	if err != nil || time.Since(signedAt).Abs() > 15*time.Minute {
+		return false
+	}
+
+	received, _ := http.NewRequest(r.Method, "http://"+r.Host+r.URL.RequestURI(), nil)
+	f.signer.sign(received, signedAt)
+	want := received.Header.Get("Authorization")
+	return want != "" && r.Header.Get("Authorization") == want
+}
+
+func TestS3Sign(t *testing.T) {
+	store, err := NewS3Store(S3Config{
+		Endpoint:  "http://localhost:9000",
+		Bucket:    "attachments",
+		AccessKey: "AKIDEXAMPLE",
+		SecretKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, "http://localhost:9000/attachments/abc123", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.sign(req, time.Date(2026, time.March, 11, 10, 0, 0, 0, time.UTC))
+
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20260311/us-east-1/s3/aws4_request, " +
+		"SignedHeaders=host;x-amz-content-sha256;x-amz-date, " +
+		"Signature=96d1b44479e94261971e87e81d9f5f350e0b7fb73bd3bd65d50a687c1da5b940"
+	if got := req.Header.Get("Authorization"); got != want {
+		t.Errorf("Authorization = %q, want %q", got, want)
+	}
+	if req.Header.Get("x-amz-date") != "20260311T100000Z" || req.Header.Get("x-amz-content-sha256") != unsignedPayload {
+		t.Errorf("x-amz-date = %q, x-amz-content-sha256 = %q", req.Header.Get("x-amz-date"), req.Header.Get("x-amz-content-sha256"))
+	}
+}
+
+func TestS3Store(t *testing.T) {
+	ctx := context.Background()
+	fake, store := newFakeS3(t)
+
+	if exists, err := store.Exists(ctx, "abc123"); err != nil || exists {
+		t.Fatalf("Exists() before Put = %v, %v, want false", exists, err)
+	}
+	if _, err := store.Get(ctx, "abc123"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get() before Put error = %v, want ErrNotFound", err)
+	}
+
+	// Only size bytes are sent
+	if err := store.Put(ctx, "abc123", strings.NewReader("hello world"), 5, "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	if fake.blobs["abc123"] != "hello" || fake.types["abc123"] != "text/plain" {
+		t.Errorf("stored %q as %q, want %q as text/plain", fake.blobs["abc123"], fake.types["abc123"], "hello")
+	}
+	if got := readBlob(t, store, "abc123"); got != "hello" {
+		t.Errorf("Get() = %q, want %q", got, "hello")
+	}
+	if exists, err := store.Exists(ctx, "abc123"); err != nil || !exists {
+		t.Errorf("Exists() after Put = %v, %v, want true", exists, err)
+	}
+
+	if err := store.Delete(ctx, "abc123"); err != nil {
+		t.Fatal(err)
+	}
+	if exists, err := store.Exists(ctx, "abc123"); err != nil || exists {
+		t.Errorf("Exists() after Delete = %v, %v, want false", exists, err)
+	}
+	if err := store.Delete(ctx, "abc123"); err != nil {
+		t.Errorf("Delete() of a missing blob error = %v", err)
+	}
+}
+
+func TestS3StoreErrors(t *testing.T) {
+	ctx := context.Background()
+	fake, store := newFakeS3(t)
+	fake.status = http.StatusInternalServerError
+
+	if err := store.Put(ctx, "abc123", strings.NewReader("x"), 1, ""); err == nil || !strings.Contains(err.Error(), "500") {
+		t.Errorf("Put() error = %v, want the status", err)
+	}
+	if _, err := store.Get(ctx, "abc123"); err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() error = %v, want a failure other than ErrNotFound", err)
+	}
+	if err := store.Delete(ctx, "abc123"); err == nil {
+		t.Error("Delete() succeeded on a server error")
+	}
+	if exists, err := store.Exists(ctx, "abc123"); err == nil || exists {
+		t.Errorf("Exists() = %v, %v, want an error", exists, err)
+	}
+
+	// A wrong secret is refused by the server
+	fake.status = 0
+	store.config.SecretKey = "not the secret"
+	if err := store.Put(ctx, "abc123", strings.NewReader("x"), 1, ""); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("Put() with a wrong secret error = %v, want 403", err)
+	}
+}
+
+func TestS3StoreInvalidKey(t *testing.T) {
+	ctx := context.Background()
+	fake, store := newFakeS3(t)
+	fake.status = http.StatusTeapot
+
+	for _, key := range []string{"", "../attachments-other/abc", "abc?acl", "a.b"} {
+		if err := store.Put(ctx, key, strings.NewReader("x"), 1, ""); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Put(%q) error = %v, want ErrInvalidKey", key, err)
+		}
+		if _, err := store.Get(ctx, key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Get(%q) error = %v, want ErrInvalidKey", key, err)
+		}
+		if err := store.Delete(ctx, key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Delete(%q) error = %v, want ErrInvalidKey", key, err)
+		}
+		if _, err := store.Exists(ctx, key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Exists(%q) error = %v, want ErrInvalidKey", key, err)
+		}
+	}
+}
+
+func TestNewS3Store(t *testing.T) {
+	if _, err := NewS3Store(S3Config{Endpoint: "http://localhost:9000", Bucket: "attachments"}); err == nil {
+		t.Error("NewS3Store() without credentials succeeded")
+	}
+
+	store, err := NewS3Store(S3Config{Endpoint: "http://localhost:9000/", Bucket: "attachments", AccessKey: "a", SecretKey: "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if store.config.Region != "us-east-1" {
+		t.Errorf("region = %q, want us-east-1 by default", store.config.Region)
+	}
+}
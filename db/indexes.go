@@ -0,0 +1,43 @@
+package db
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// indexes - the indexes the handlers rely on, by collection; the unique ones keep upserts from racing
+var indexes = map[string][]mongo.IndexModel{
+	"pomodoros": {{
+		// A work phase is recorded once, see PomodoroHandler.record
+		Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "workspace_id", Value: 1}, {Key: "start", Value: 1}},
+		Options: options.Index().SetName("user_workspace_start").SetUnique(true),
+	}},
+	"webhook_deliveries": {{
+		// A webhook gets one delivery per task change, see WebhooksHandler.enqueue; test deliveries have no change
+		Keys: bson.D{{Key: "webhook_id", Value: 1}, {Key: "change_id", Value: 1}},
+		Options: options.Index().SetName("webhook_change").SetUnique(true).
+			SetPartialFilterExpression(bson.M{"change_id": bson.M{"$exists": true}}),
+	}},
+}
+
+// EnsureIndexes - creates the indexes which don't exist yet
+func EnsureIndexes(ctx context.Context, database *mongo.Database) error {
+	for collection, models := range indexes {
+		if _, err := database.Collection(collection).Indexes().CreateMany(ctx, models); err != nil {
+			return &indexError{collection, err}
+		}
+	}
+	return nil
+}
+
+type indexError struct {
+	collection string
+	err        error
+}
+
+func (e *indexError) Error() string {
+	return "Failed to create the indexes of " + e.collection + ": " + e.err.Error()
+}
@@ -0,0 +1,159 @@
+// Package domain defines the events describing what happened to tasks. TasksHandler stores them in the outbox
+// in the transaction of the change, the outbox relay publishes them to the Stream, and other subsystems
+// subscribe to them with Subscribe.
+package domain
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/utpal74/track-my-tasks-backend/model"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// event types
+const (
+	TypeTaskCreated   = "task.created"
+	TypeTaskUpdated   = "task.updated"
+	TypeTaskCompleted = "task.completed"
+	TypeTaskReopened  = "task.reopened"
+	TypeTaskDeleted   = "task.deleted" // Moved to the trash
+	TypeTaskRestored  = "task.restored"
+	TypeTaskPurged    = "task.purged" // Deleted for good
+)
+
+// Event - one of the event types below
+type Event interface {
+	EventType() string
+}
+
+// TaskEvent - what every task event carries
+type TaskEvent struct {
+	ChangeID    primitive.ObjectID `json:"change_id"` // The history entry of the change, the same for all events of a change
+	TaskID      primitive.ObjectID `json:"task_id"`
+	WorkspaceID primitive.ObjectID `json:"workspace_id"`
+	Action      string             `json:"action"` // The model.TaskAction* of the change, e.g. moved for an update
+	Actor       string             `json:"actor,omitempty"`
+	Task        model.Task         `json:"task"`               // After the change
+	Previous    *model.Task        `json:"previous,omitempty"` // Before the change, nil for new tasks
+	OccurredAt  time.Time          `json:"occurred_at"`
+}
+
+// Base - the fields shared by all task events
+func (event TaskEvent) Base() TaskEvent {
+	return event
+}
+
+type TaskCreated struct{ TaskEvent }
+
+type TaskUpdated struct {
+	TaskEvent
+	Changes []model.FieldChange `json:"changes"`
+}
+
+// TaskCompleted - follows the TaskUpdated of the change which finished the task
+type TaskCompleted struct{ TaskEvent }
+
+// TaskReopened - follows the TaskUpdated of the change which took a finished task up again
+type TaskReopened struct{ TaskEvent }
+
+type TaskDeleted struct{ TaskEvent }
+
+type TaskRestored struct{ TaskEvent }
+
+// TaskPurged - Task is the last state of the task, Previous is nil
+type TaskPurged struct{ TaskEvent }
+
+func (TaskCreated) EventType() string   { return TypeTaskCreated }
+func (TaskUpdated) EventType() string   { return TypeTaskUpdated }
+func (TaskCompleted) EventType() string { return TypeTaskCompleted }
+func (TaskReopened) EventType() string  { return TypeTaskReopened }
+func (TaskDeleted) EventType() string   { return TypeTaskDeleted }
+func (TaskRestored) EventType() string  { return TypeTaskRestored }
+func (TaskPurged) EventType() string    { return TypeTaskPurged }
+
+// TaskOf - the shared fields of a task event
+func TaskOf(event Event) (TaskEvent, bool) {
+	task, ok := event.(interface{ Base() TaskEvent })
+	if !ok {
+		return TaskEvent{}, false
+	}
+	return task.Base(), true
+}
+
+// FromChange - the events of a change of a task. Creating, deleting and restoring a task have their own event,
+// anything else is an update, followed by TaskCompleted or TaskReopened when it flipped done.
+func FromChange(base TaskEvent, changes []model.FieldChange) []Event {
+	switch base.Action {
+	case model.TaskActionCreated:
+		return []Event{TaskCreated{base}}
+	case model.TaskActionDeleted:
+		return []Event{TaskDeleted{base}}
+	case model.TaskActionRestored:
+		return []Event{TaskRestored{base}}
+	}
+
+	events := []Event{TaskUpdated{TaskEvent: base, Changes: changes}}
+	if base.Previous != nil && base.Previous.Done != base.Task.Done {
+		if base.Task.Done {
+			events = append(events, TaskCompleted{base})
+		} else {
+			events = append(events, TaskReopened{base})
+		}
+	}
+	return events
+}
+
+// Encode - the JSON of an event
+func Encode(event Event) ([]byte, error) {
+	return json.Marshal(event)
+}
+
+// Decode - the event of the type from its JSON
+func Decode(eventType string, data []byte) (Event, error) {
+	var event Event
+	switch eventType {
+	case TypeTaskCreated:
+		event = &TaskCreated{}
+	case TypeTaskUpdated:
+		event = &TaskUpdated{}
+	case TypeTaskCompleted:
+		event = &TaskCompleted{}
+	case TypeTaskReopened:
+		event = &TaskReopened{}
+	case TypeTaskDeleted:
+		event = &TaskDeleted{}
+	case TypeTaskRestored:
+		event = &TaskRestored{}
+	case TypeTaskPurged:
+		event = &TaskPurged{}
+	default:
+		return nil, fmt.Errorf("domain: unknown event type %q", eventType)
+	}
+	if err := json.Unmarshal(data, event); err != nil {
+		return nil, err
+	}
+	return derefEvent(event), nil
+}
+
+// derefEvent - subscribers switch on the value types
+func derefEvent(event Event) Event {
+	switch e := event.(type) {
+	case *TaskCreated:
+		return *e
+	case *TaskUpdated:
+		return *e
+	case *TaskCompleted:
+		return *e
+	case *TaskReopened:
+		return *e
+	case *TaskDeleted:
+		return *e
+	case *TaskRestored:
+		return *e
+	case *TaskPurged:
+		return *e
+	}
+	return event
+}
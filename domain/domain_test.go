@@ -0,0 +1,106 @@
+package domain
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/utpal74/track-my-tasks-backend/model"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func eventTypes(events []Event) []string {
+	types := make([]string, 0, len(events))
+	for _, event := range events {
+		types = append(types, event.EventType())
+	}
+	return types
+}
+
+func TestFromChange(t *testing.T) {
+	open := model.Task{ID: primitive.NewObjectID(), Title: "Buy milk"}
+	done := open
+	done.Done = true
+	changes := []model.FieldChange{{Field: "done", Old: false, New: true}}
+
+	tests := []struct {
+		name     string
+		action   string
+		task     model.Task
+		previous *model.Task
+		want     []string
+	}{
+		{name: "created", action: model.TaskActionCreated, task: open, want: []string{TypeTaskCreated}},
+		{name: "deleted", action: model.TaskActionDeleted, task: open, previous: &open, want: []string{TypeTaskDeleted}},
+		{name: "restored", action: model.TaskActionRestored, task: open, previous: &open, want: []string{TypeTaskRestored}},
+		{name: "updated", action: model.TaskActionUpdated, task: open, previous: &open, want: []string{TypeTaskUpdated}},
+		{name: "completed", action: model.TaskActionUpdated, task: done, previous: &open, want: []string{TypeTaskUpdated, TypeTaskCompleted}},
+		{name: "reopened", action: model.TaskActionUndo, task: open, previous: &done, want: []string{TypeTaskUpdated, TypeTaskReopened}},
+		{name: "other actions are updates", action: model.TaskActionStatus, task: done, previous: &open, want: []string{TypeTaskUpdated, TypeTaskCompleted}},
+		{name: "update without a previous version", action: model.TaskActionUpdated, task: done, want: []string{TypeTaskUpdated}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base := TaskEvent{ChangeID: primitive.NewObjectID(), TaskID: open.ID, Action: tt.action, Task: tt.task, Previous: tt.previous}
+			events := FromChange(base, changes)
+			if got := eventTypes(events); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("FromChange() = %v, want %v", got, tt.want)
+			}
+			for _, event := range events {
+				if got, ok := TaskOf(event); !ok || got.ChangeID != base.ChangeID {
+					t.Errorf("%s doesn't carry the change", event.EventType())
+				}
+			}
+			if updated, ok := events[0].(TaskUpdated); ok && !reflect.DeepEqual(updated.Changes, changes) {
+				t.Errorf("TaskUpdated changes = %v, want %v", updated.Changes, changes)
+			}
+		})
+	}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	base := TaskEvent{
+		ChangeID:    primitive.NewObjectID(),
+		TaskID:      primitive.NewObjectID(),
+		WorkspaceID: primitive.NewObjectID(),
+		Action:      model.TaskActionUpdated,
+		Actor:       "alice",
+		Task:        model.Task{Title: "Buy milk", Done: true},
+		Previous:    &model.Task{Title: "Buy milk"},
+		OccurredAt:  time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+	}
+
+	tests := []Event{
+		TaskCreated{base},
+		TaskUpdated{TaskEvent: base, Changes: []model.FieldChange{{Field: "title", Old: "Milk", New: "Buy milk"}}},
+		TaskCompleted{base},
+		TaskReopened{base},
+		TaskDeleted{base},
+		TaskRestored{base},
+		TaskPurged{base},
+	}
+
+	for _, event := range tests {
+		t.Run(event.EventType(), func(t *testing.T) {
+			data, err := Encode(event)
+			if err != nil {
+				t.Fatal(err)
+			}
+			decoded, err := Decode(event.EventType(), data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(decoded, event) {
+				t.Errorf("Decode(Encode()) = %+v, want %+v", decoded, event)
+			}
+		})
+	}
+
+	if _, err := Decode("task.moved", []byte(`{}`)); err == nil {
+		t.Error("Decode() accepted an unknown type")
+	}
+	if _, err := Decode(TypeTaskCreated, []byte(`{"task_id": 1}`)); err == nil {
+		t.Error("Decode() accepted invalid data")
+	}
+}
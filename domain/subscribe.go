@@ -0,0 +1,137 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/utpal74/track-my-tasks-backend/logger"
+	"go.uber.org/zap"
+)
+
+const (
+	// Stream - the Redis stream the outbox relay publishes to, its entries have the fields below
+	Stream = "domain-events"
+	// StreamLength - entries kept in the stream, roughly
+	StreamLength = 100000
+
+	FieldType     = "type"
+	FieldData     = "data"      // The JSON of the event
+	FieldOutboxID = "outbox_id" // The outbox entry the event was published from
+
+	readCount = 32
+	readBlock = 5 * time.Second
+	// pendingTimeout - how long an event read by a consumer may stay unacknowledged before another one takes it
+	pendingTimeout = time.Minute
+	handleTimeout  = 30 * time.Second
+)
+
+// Handler - handles one event. Returning an error leaves the event pending, it is handled again after a while.
+type Handler func(ctx context.Context, event Event) error
+
+// Consumer - a name for this process within consumer groups
+func Consumer() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
+// Subscribe - hands the events published from now on to handle, until ctx is done. Every consumer group gets
+// every event once: the instances subscribing with the same group share its events, and an event is
+// acknowledged when handle succeeds. Events a consumer left unacknowledged for pendingTimeout, because handle
+// failed or the process died, are claimed and handled again, so handlers must cope with seeing an event twice.
+func Subscribe(ctx context.Context, redisClient *redis.Client, group, consumer string, handle Handler) {
+	log := logger.FromCtx(ctx).With(zap.String("group", group), zap.String("consumer", consumer))
+	ctx = logger.WithLogger(ctx, log)
+
+	lastClaim := time.Time{}
+	for ctx.Err() == nil {
+		err := redisClient.XGroupCreateMkStream(ctx, Stream, group, "$").Err()
+		if err == nil || strings.HasPrefix(err.Error(), "BUSYGROUP") {
+			break
+		}
+		log.Error("unable to create the consumer group", zap.Error(err))
+		sleep(ctx, readBlock)
+	}
+
+	for ctx.Err() == nil {
+		if time.Since(lastClaim) >= pendingTimeout/2 {
+			lastClaim = time.Now()
+			messages, _, err := redisClient.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+				Stream:   Stream,
+				Group:    group,
+				Consumer: consumer,
+				MinIdle:  pendingTimeout,
+				Start:    "0-0",
+				Count:    readCount,
+			}).Result()
+			if err != nil && ctx.Err() == nil {
+				log.Error("unable to claim pending domain events", zap.Error(err))
+			}
+			for _, message := range messages {
+				process(ctx, redisClient, group, message, handle)
+			}
+		}
+
+		streams, err := redisClient.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    group,
+			Consumer: consumer,
+			Streams:  []string{Stream, ">"},
+			Count:    readCount,
+			Block:    readBlock,
+		}).Result()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Error("unable to read domain events", zap.Error(err))
+				sleep(ctx, time.Second)
+			}
+			continue
+		}
+		for _, stream := range streams {
+			for _, message := range stream.Messages {
+				process(ctx, redisClient, group, message, handle)
+			}
+		}
+	}
+}
+
+// process - handles the message and acknowledges it. Messages which aren't events are acknowledged and dropped,
+// they would fail every time.
+func process(ctx context.Context, redisClient *redis.Client, group string, message redis.XMessage, handle Handler) {
+	log := logger.FromCtx(ctx).With(zap.String("id", message.ID))
+
+	eventType, _ := message.Values[FieldType].(string)
+	data, _ := message.Values[FieldData].(string)
+	event, err := Decode(eventType, []byte(data))
+	if err != nil {
+		log.Error("dropping invalid domain event", zap.Error(err))
+	} else {
+		handleCtx, cancel := context.WithTimeout(ctx, handleTimeout)
+		err = handle(handleCtx, event)
+		cancel()
+		if err != nil {
+			log.Error("unable to handle domain event", zap.String("type", eventType), zap.Error(err))
+			return
+		}
+	}
+
+	if err := redisClient.XAck(ctx, Stream, group, message.ID).Err(); err != nil {
+		log.Error("unable to acknowledge domain event", zap.Error(err))
+	}
+}
+
+func sleep(ctx context.Context, duration time.Duration) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(duration):
+	}
+}
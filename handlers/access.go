@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/utpal74/track-my-tasks-backend/model"
+	"github.com/utpal74/track-my-tasks-backend/tenant"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// visibleTasksFilter - matches the tasks (not in the trash) which the user owns, is assigned to or which are
+// shared with them, directly or through a shared project
+func visibleTasksFilter(ctx context.Context, projectsColl *tenant.Collection, userID primitive.ObjectID) (bson.M, error) {
+	projectIDs, err := projectsColl.Distinct(ctx, "_id", bson.M{"collaborators.user_id": userID})
+	if err != nil {
+		return nil, err
+	}
+
+	or := []bson.M{{"user_id": userID}, {"collaborators.user_id": userID}, {"assignees.user_id": userID}}
+	if len(projectIDs) > 0 {
+		or = append(or, bson.M{"project_id": bson.M{"$in": projectIDs}})
+	}
+	return activeTask(bson.M{"$or": or}), nil
+}
+
+// loadAccessibleTask - returns a task (not in the trash) which the user is allowed to see.
+// Returns mongo.ErrNoDocuments otherwise.
+func loadAccessibleTask(ctx context.Context, tasksColl *tenant.Collection, projectsColl *tenant.Collection, userID, taskID primitive.ObjectID) (model.Task, error) {
+	var task model.Task
+	filter, err := visibleTasksFilter(ctx, projectsColl, userID)
+	if err != nil {
+		return task, err
+	}
+
+	filter["_id"] = taskID
+	err = tasksColl.FindOne(ctx, filter).Decode(&task)
+	return task, err
+}
+
+// taskRole - returns model.RoleOwner, model.RoleEditor or model.RoleViewer for the user on the task,
+// the strongest of the direct and the project share. Empty without access.
+func taskRole(ctx context.Context, projectsColl *tenant.Collection, task model.Task, userID primitive.ObjectID) (string, error) {
+	if task.UserID == userID {
+		return model.RoleOwner, nil
+	}
+
+	collaborators, err := taskCollaborators(ctx, projectsColl, task)
+	if err != nil {
+		return "", err
+	}
+
+	role := ""
+	for _, collaborator := range collaborators {
+		if collaborator.UserID == userID && role != model.RoleEditor {
+			role = collaborator.Role
+		}
+	}
+	return role, nil
+}
+
+// taskCollaborators - the users a task is shared with, directly or through its project.
+// Assignees are included as editors, they need to be able to work on the task.
+func taskCollaborators(ctx context.Context, projectsColl *tenant.Collection, task model.Task) ([]model.Collaborator, error) {
+	collaborators := append([]model.Collaborator{}, task.Collaborators...)
+	for _, assignee := range task.Assignees {
+		collaborators = append(collaborators, model.Collaborator{UserID: assignee.UserID, Username: assignee.Username, Role: model.RoleEditor})
+	}
+	if task.ProjectID == nil {
+		return collaborators, nil
+	}
+
+	var project model.Project
+	err := projectsColl.FindOne(ctx, bson.M{"_id": *task.ProjectID}).Decode(&project)
+	if err == mongo.ErrNoDocuments {
+		return collaborators, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return append(collaborators, project.Collaborators...), nil
+}
+
+// taskMemberNames - returns the usernames of everyone with access to the task
+func taskMemberNames(ctx context.Context, usersColl *mongo.Collection, projectsColl *tenant.Collection, task model.Task) ([]string, error) {
+	var owner model.User
+	if err := usersColl.FindOne(ctx, bson.M{"_id": task.UserID}).Decode(&owner); err != nil {
+		return nil, err
+	}
+
+	collaborators, err := taskCollaborators(ctx, projectsColl, task)
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{owner.Username}
+	for _, collaborator := range collaborators {
+		names = append(names, collaborator.Username)
+	}
+	return names, nil
+}
+
+// invalidateMemberCaches - removes the cached task lists of everyone who can see the task
+func invalidateMemberCaches(ctx context.Context, redisClient *redis.Client, projectsColl *tenant.Collection, task model.Task) {
+	log.Println("remove data from redis")
+	redisClient.Del(ctx, memberCacheKeys(ctx, projectsColl, task)...)
+}
+
+// memberCacheKeys - the cache keys of everyone who can see the task
+func memberCacheKeys(ctx context.Context, projectsColl *tenant.Collection, task model.Task) []string {
+	keys := userCacheKeys(task.UserID)
+
+	collaborators, err := taskCollaborators(ctx, projectsColl, task)
+	if err != nil {
+		log.Printf("Failed to load collaborators of task %s: %v", task.ID.Hex(), err)
+	}
+	for _, collaborator := range collaborators {
+		keys = append(keys, userCacheKeys(collaborator.UserID)...)
+	}
+	return keys
+}
+
+// taskFromPath - loads the accessible task named by the "id" path parameter, responding with 400/404 when it can't be used
+func taskFromPath(ctx context.Context, c *gin.Context, tasksColl *tenant.Collection, projectsColl *tenant.Collection, user model.User) (model.Task, bool) {
+	taskID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id format"})
+		return model.Task{}, false
+	}
+
+	task, err := loadAccessibleTask(ctx, tasksColl, projectsColl, user.ID, taskID)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "task not found"})
+		return task, false
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return task, false
+	}
+	return task, true
+}
@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/utpal74/track-my-tasks-backend/model"
+	"github.com/utpal74/track-my-tasks-backend/tenant"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type assigneesRequest struct {
+	Usernames []string `json:"usernames"` // Replaces the current assignees, empty unassigns everyone
+}
+
+// SetAssigneesHandler - replace the assignees of a task, every one of them must be a member of the workspace.
+// Newly assigned users are notified.
+func (handler *TasksHandler) SetAssigneesHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	user, ok := handler.currentUser(ctx, c)
+	if !ok {
+		return
+	}
+
+	taskID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id format"})
+		return
+	}
+
+	var req assigneesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	task, ok := handler.editableTask(ctx, c, user, taskID)
+	if !ok {
+		return
+	}
+
+	// Keep the assignment date of users who stay assigned
+	current := make(map[primitive.ObjectID]model.Assignee, len(task.Assignees))
+	for _, assignee := range task.Assignees {
+		current[assignee.UserID] = assignee
+	}
+
+	workspace, _ := tenant.Workspace(ctx)
+	now := time.Now()
+	assignees := make([]model.Assignee, 0, len(req.Usernames))
+	added := make([]model.Assignee, 0)
+	seen := make(map[primitive.ObjectID]bool, len(req.Usernames))
+	for _, username := range req.Usernames {
+		member, found := workspaceMemberByName(workspace, username)
+		if !found {
+			c.JSON(http.StatusBadRequest, gin.H{"error": username + " is not a member of this workspace"})
+			return
+		}
+		if seen[member.UserID] {
+			continue
+		}
+		seen[member.UserID] = true
+
+		if existing, assigned := current[member.UserID]; assigned {
+			assignees = append(assignees, existing)
+			continue
+		}
+
+		assignee := model.Assignee{UserID: member.UserID, Username: member.Username, AssignedAt: now}
+		assignees = append(assignees, assignee)
+		added = append(added, assignee)
+	}
+
+	before, err := handler.taskSnapshot(ctx, taskID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = handler.commitChange(ctx, c, model.TaskActionAssigned, taskID, before, func(ctx context.Context) error {
+		_, err := handler.tasksColl.UpdateOne(ctx, bson.M{"_id": taskID}, bson.M{"$set": bson.M{
+			"assignees":  assignees,
+			"updated_at": now,
+		}})
+		if err != nil {
+			return fmt.Errorf("unable to update: %w", err)
+		}
+
+		_, err = handler.usersColl.UpdateOne(ctx, bson.M{"_id": task.UserID, "task._id": taskID}, bson.M{"$set": bson.M{
+			"task.$.assignees":  assignees,
+			"task.$.updated_at": now,
+		}})
+		if err != nil {
+			return fmt.Errorf("Failed to update task in user collection: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	notifications := make([]model.Notification, 0, len(added))
+	for _, assignee := range added {
+		if assignee.UserID == user.ID {
+			continue
+		}
+		notifications = append(notifications, model.Notification{
+			ID:          primitive.NewObjectID(),
+			UserID:      assignee.UserID,
+			WorkspaceID: workspace.ID,
+			Kind:        model.NotificationAssigned,
+			TaskID:      taskID,
+			Actor:       user.Username,
+			Message:     fmt.Sprintf("%s assigned you to %q", user.Username, task.Title),
+			CreatedAt:   now,
+		})
+	}
+	notify(ctx, handler.notificationsColl, notifications)
+
+	// Both the previous and the new assignees see a different task now
+	affected := task
+	affected.Assignees = append(append([]model.Assignee{}, task.Assignees...), added...)
+	invalidateMemberCaches(ctx, handler.redisClient, handler.projectsColl, affected)
+
+	task.Assignees = assignees
+	task.UpdatedAt = now
+	c.JSON(http.StatusOK, task)
+}
+
+// AssignedToMeHandler - the tasks of the workspace assigned to the signed in user, across all projects.
+// Accepts the filter and sort query parameters of the task list.
+func (handler *TasksHandler) AssignedToMeHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	user, ok := handler.currentUser(ctx, c)
+	if !ok {
+		return
+	}
+
+	cur, err := handler.tasksColl.Find(ctx, activeTask(bson.M{"assignees.user_id": user.ID}))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer cur.Close(ctx)
+
+	tasks := make([]model.Task, 0)
+	if err := cur.All(ctx, &tasks); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to decode tasks"})
+		return
+	}
+	fillLegacyStatus(tasks)
+
+	respondWithTasks(c, tasks)
+}
+
+// unassignMember - removes a user leaving the workspace from every task of it they are assigned to
+func unassignMember(ctx context.Context, tasksColl *tenant.Collection, usersColl *mongo.Collection, projectsColl *tenant.Collection, redisClient *redis.Client, memberID primitive.ObjectID) error {
+	filter := bson.M{"assignees.user_id": memberID}
+	cur, err := tasksColl.Find(ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	tasks := make([]model.Task, 0)
+	if err := cur.All(ctx, &tasks); err != nil {
+		return err
+	}
+	if len(tasks) == 0 {
+		return nil
+	}
+
+	pull := bson.M{"user_id": memberID}
+	if _, err := tasksColl.UpdateMany(ctx, filter, bson.M{"$pull": bson.M{"assignees": pull}}); err != nil {
+		return err
+	}
+
+	// The embedded copies of tasks in other workspaces keep their assignees
+	_, err = usersColl.UpdateMany(ctx, bson.M{"task.assignees.user_id": memberID},
+		bson.M{"$pull": bson.M{"task.$[t].assignees": pull}},
+		options.Update().SetArrayFilters(options.ArrayFilters{Filters: []interface{}{
+			bson.M{"t.workspace_id": workspaceID(ctx)},
+		}}),
+	)
+	if err != nil {
+		return err
+	}
+
+	for _, task := range tasks {
+		invalidateMemberCaches(ctx, redisClient, projectsColl, task)
+	}
+	return nil
+}
+
+// notify - stores notifications, failures are only logged as they must not fail the change causing them
+func notify(ctx context.Context, notificationsColl *mongo.Collection, notifications []model.Notification) {
+	if len(notifications) == 0 {
+		return
+	}
+
+	documents := make([]interface{}, 0, len(notifications))
+	for _, notification := range notifications {
+		documents = append(documents, notification)
+	}
+
+	if _, err := notificationsColl.InsertMany(ctx, documents); err != nil {
+		log.Printf("Failed to store %d notifications: %v", len(notifications), err)
+	}
+}
+
+func workspaceMemberByName(workspace model.Workspace, username string) (model.WorkspaceMember, bool) {
+	for _, member := range workspace.Members {
+		if member.Username == username {
+			return member, true
+		}
+	}
+	return model.WorkspaceMember{}, false
+}
+
+func assignedTo(task model.Task, username string) bool {
+	for _, assignee := range task.Assignees {
+		if assignee.Username == username {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,411 @@
+package handlers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/utpal74/track-my-tasks-backend/blobstore"
+	"github.com/utpal74/track-my-tasks-backend/model"
+	"github.com/utpal74/track-my-tasks-backend/tenant"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	defaultMaxAttachmentSize = 10 << 20
+	downloadURLLifetime      = 5 * time.Minute
+)
+
+var errAttachmentType = errors.New("file type not allowed")
+
+// content types accepted for attachments, as sniffed from the file contents
+var allowedAttachmentTypes = map[string]bool{
+	"image/png":       true,
+	"image/jpeg":      true,
+	"image/gif":       true,
+	"image/webp":      true,
+	"application/pdf": true,
+	"text/plain":      true,
+	"text/csv":        true,
+	"application/zip": true, // also covers docx, xlsx and pptx
+}
+
+type AttachmentsHandler struct {
+	ctx             context.Context
+	attachmentsColl *mongo.Collection
+	tasksColl       *tenant.Collection
+	projectsColl    *tenant.Collection
+	usersColl       *mongo.Collection
+	store           blobstore.BlobStore
+	signingKey      []byte
+}
+
+func NewAttachmentsHandler(ctx context.Context, attachmentsColl *mongo.Collection, tasksColl *tenant.Collection, projectsColl *tenant.Collection, usersColl *mongo.Collection, store blobstore.BlobStore) *AttachmentsHandler {
+	// Without a configured key, download links only stay valid for the lifetime of this process
+	signingKey := []byte(os.Getenv("ATTACHMENT_SIGNING_KEY"))
+	if len(signingKey) == 0 {
+		signingKey = make([]byte, 32)
+		rand.Read(signingKey)
+	}
+
+	return &AttachmentsHandler{
+		ctx:             ctx,
+		attachmentsColl: attachmentsColl,
+		tasksColl:       tasksColl,
+		projectsColl:    projectsColl,
+		usersColl:       usersColl,
+		store:           store,
+		signingKey:      signingKey,
+	}
+}
+
+// UploadAttachmentHandler - attach the multipart "file" to a task
+func (handler *AttachmentsHandler) UploadAttachmentHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 60*time.Second)
+	defer cancel()
+
+	user, ok := currentUser(ctx, c, handler.usersColl)
+	if !ok {
+		return
+	}
+
+	task, ok := handler.attachableTask(ctx, c, user)
+	if !ok {
+		return
+	}
+
+	maxSize := maxAttachmentSize()
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSize+1<<20)
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file is required: " + err.Error()})
+		return
+	}
+
+	if header.Size > maxSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("file is larger than %d bytes", maxSize)})
+		return
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer file.Close()
+
+	attachment, err := handler.saveAttachment(ctx, task, user, header.Filename, file, header.Size)
+	if errors.Is(err, errAttachmentType) {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, attachment)
+}
+
+// saveAttachment - stores the file and attaches it to the task. Fails with errAttachmentType when its content
+// isn't one of the allowed types.
+func (handler *AttachmentsHandler) saveAttachment(ctx context.Context, task model.Task, user model.User, fileName string, file io.ReadSeeker, size int64) (model.Attachment, error) {
+	var attachment model.Attachment
+
+	// Trust the content, not the file name or the client supplied type
+	sniff := make([]byte, 512)
+	n, err := io.ReadFull(file, sniff)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return attachment, err
+	}
+
+	contentType := http.DetectContentType(sniff[:n])
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if mediaType == "text/plain" && filepath.Ext(fileName) == ".csv" {
+		mediaType = "text/csv"
+	}
+	if !allowedAttachmentTypes[mediaType] {
+		return attachment, fmt.Errorf("%w: %s", errAttachmentType, mediaType)
+	}
+
+	hasher := sha256.New()
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return attachment, err
+	}
+	if _, err := io.Copy(hasher, file); err != nil {
+		return attachment, err
+	}
+	hash := hex.EncodeToString(hasher.Sum(nil))
+
+	// Identical content is stored only once
+	exists, err := handler.store.Exists(ctx, hash)
+	if err != nil {
+		return attachment, fmt.Errorf("unable to check blob: %w", err)
+	}
+
+	if !exists {
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return attachment, err
+		}
+		if err := handler.store.Put(ctx, hash, file, size, mediaType); err != nil {
+			return attachment, fmt.Errorf("unable to store file: %w", err)
+		}
+	}
+
+	attachment = model.Attachment{
+		ID:          primitive.NewObjectID(),
+		TaskID:      task.ID,
+		UserID:      user.ID,
+		FileName:    filepath.Base(fileName),
+		ContentType: mediaType,
+		Size:        size,
+		Hash:        hash,
+		CreatedAt:   time.Now(),
+	}
+
+	_, err = handler.attachmentsColl.InsertOne(ctx, attachment)
+	return attachment, err
+}
+
+// GetAttachmentsHandler - list the attachments of a task
+func (handler *AttachmentsHandler) GetAttachmentsHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	user, ok := currentUser(ctx, c, handler.usersColl)
+	if !ok {
+		return
+	}
+
+	task, ok := taskFromPath(ctx, c, handler.tasksColl, handler.projectsColl, user)
+	if !ok {
+		return
+	}
+
+	cur, err := handler.attachmentsColl.Find(ctx, bson.M{"task_id": task.ID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer cur.Close(ctx)
+
+	attachments := make([]model.Attachment, 0)
+	if err := cur.All(ctx, &attachments); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to decode attachments"})
+		return
+	}
+
+	c.JSON(http.StatusOK, attachments)
+}
+
+// AttachmentURLHandler - returns a short-lived signed URL to download an attachment without a session
+func (handler *AttachmentsHandler) AttachmentURLHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	user, ok := currentUser(ctx, c, handler.usersColl)
+	if !ok {
+		return
+	}
+
+	task, ok := taskFromPath(ctx, c, handler.tasksColl, handler.projectsColl, user)
+	if !ok {
+		return
+	}
+
+	attachment, ok := handler.taskAttachment(ctx, c, task)
+	if !ok {
+		return
+	}
+
+	expires := time.Now().Add(downloadURLLifetime).Unix()
+	url := fmt.Sprintf("/attachments/%s/download?expires=%d&signature=%s",
+		attachment.ID.Hex(), expires, handler.downloadSignature(attachment.ID, expires))
+
+	c.JSON(http.StatusOK, gin.H{"url": url, "expires_at": time.Unix(expires, 0).UTC()})
+}
+
+// DownloadAttachmentHandler - streams an attachment, authorized by the signature of AttachmentURLHandler
+func (handler *AttachmentsHandler) DownloadAttachmentHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 60*time.Second)
+	defer cancel()
+
+	attachmentID, err := primitive.ObjectIDFromHex(c.Param("attachmentId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id format"})
+		return
+	}
+
+	expires, err := strconv.ParseInt(c.Query("expires"), 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		c.JSON(http.StatusForbidden, gin.H{"error": "download link expired"})
+		return
+	}
+
+	expected := handler.downloadSignature(attachmentID, expires)
+	if !hmac.Equal([]byte(expected), []byte(c.Query("signature"))) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "invalid signature"})
+		return
+	}
+
+	var attachment model.Attachment
+	if err := handler.attachmentsColl.FindOne(ctx, bson.M{"_id": attachmentID}).Decode(&attachment); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "attachment not found"})
+		return
+	}
+
+	blob, err := handler.store.Get(ctx, attachment.Hash)
+	if err == blobstore.ErrNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "attachment content not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer blob.Close()
+
+	c.DataFromReader(http.StatusOK, attachment.Size, attachment.ContentType, blob, map[string]string{
+		"Content-Disposition":    mime.FormatMediaType("attachment", map[string]string{"filename": attachment.FileName}),
+		"X-Content-Type-Options": "nosniff",
+		"Cache-Control":          "private, max-age=300",
+	})
+}
+
+// DeleteAttachmentHandler - remove an attachment from a task
+func (handler *AttachmentsHandler) DeleteAttachmentHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	user, ok := currentUser(ctx, c, handler.usersColl)
+	if !ok {
+		return
+	}
+
+	task, ok := handler.attachableTask(ctx, c, user)
+	if !ok {
+		return
+	}
+
+	attachment, ok := handler.taskAttachment(ctx, c, task)
+	if !ok {
+		return
+	}
+
+	if attachment.UserID != user.ID && task.UserID != user.ID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only the uploader or the owner of the task can delete an attachment"})
+		return
+	}
+
+	if err := handler.deleteAttachment(ctx, attachment); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Attachment deleted", "id": attachment.ID})
+}
+
+// DeleteTaskAttachments - purge hook, removes the attachments of a permanently deleted task
+func (handler *AttachmentsHandler) DeleteTaskAttachments(ctx context.Context, task model.Task) error {
+	cur, err := handler.attachmentsColl.Find(ctx, bson.M{"task_id": task.ID})
+	if err != nil {
+		return err
+	}
+	defer cur.Close(ctx)
+
+	var attachments []model.Attachment
+	if err := cur.All(ctx, &attachments); err != nil {
+		return err
+	}
+
+	for _, attachment := range attachments {
+		if err := handler.deleteAttachment(ctx, attachment); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteAttachment - removes the attachment, and its blob once no other attachment shares the content
+func (handler *AttachmentsHandler) deleteAttachment(ctx context.Context, attachment model.Attachment) error {
+	if _, err := handler.attachmentsColl.DeleteOne(ctx, bson.M{"_id": attachment.ID}); err != nil {
+		return err
+	}
+
+	remaining, err := handler.attachmentsColl.CountDocuments(ctx, bson.M{"hash": attachment.Hash})
+	if err != nil {
+		return err
+	}
+
+	if remaining == 0 {
+		if err := handler.store.Delete(ctx, attachment.Hash); err != nil {
+			log.Printf("Failed to delete blob %s: %v", attachment.Hash, err)
+			return err
+		}
+	}
+	return nil
+}
+
+// attachableTask - loads the task in the path for adding or removing attachments, which viewers can't
+func (handler *AttachmentsHandler) attachableTask(ctx context.Context, c *gin.Context, user model.User) (model.Task, bool) {
+	task, ok := taskFromPath(ctx, c, handler.tasksColl, handler.projectsColl, user)
+	if !ok {
+		return task, false
+	}
+
+	role, err := taskRole(ctx, handler.projectsColl, task, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return task, false
+	}
+	if role == model.RoleViewer {
+		c.JSON(http.StatusForbidden, gin.H{"error": "viewers can't change attachments"})
+		return task, false
+	}
+	return task, true
+}
+
+// taskAttachment - loads the attachment in the path, which must belong to the task
+func (handler *AttachmentsHandler) taskAttachment(ctx context.Context, c *gin.Context, task model.Task) (model.Attachment, bool) {
+	var attachment model.Attachment
+	attachmentID, err := primitive.ObjectIDFromHex(c.Param("attachmentId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid attachment id format"})
+		return attachment, false
+	}
+
+	if err := handler.attachmentsColl.FindOne(ctx, bson.M{"_id": attachmentID, "task_id": task.ID}).Decode(&attachment); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "attachment not found"})
+		return attachment, false
+	}
+	return attachment, true
+}
+
+func (handler *AttachmentsHandler) downloadSignature(attachmentID primitive.ObjectID, expires int64) string {
+	mac := hmac.New(sha256.New, handler.signingKey)
+	fmt.Fprintf(mac, "%s:%d", attachmentID.Hex(), expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// maxAttachmentSize - reads ATTACHMENT_MAX_BYTES, falling back to the default
+func maxAttachmentSize() int64 {
+	size, err := strconv.ParseInt(os.Getenv("ATTACHMENT_MAX_BYTES"), 10, 64)
+	if err != nil || size <= 0 {
+		return defaultMaxAttachmentSize
+	}
+	return size
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"context"
+	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
@@ -20,13 +21,15 @@ import (
 type AuthHandler struct {
 	ctx         context.Context
 	collections *mongo.Collection
+	tokensColl  *mongo.Collection
 	redisClient *redis.Client
 }
 
-func NewAuthHandler(ctx context.Context, collections *mongo.Collection, redisClient *redis.Client) *AuthHandler {
+func NewAuthHandler(ctx context.Context, collections *mongo.Collection, tokensColl *mongo.Collection, redisClient *redis.Client) *AuthHandler {
 	return &AuthHandler{
 		ctx:         ctx,
 		collections: collections,
+		tokensColl:  tokensColl,
 		redisClient: redisClient,
 	}
 }
@@ -137,8 +140,8 @@ func (handler *AuthHandler) SignOutHandler(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	// Delete the session token from Redis
-	err := handler.redisClient.Del(ctx, sessionToken).Err()
+	// Delete the session token, and the workspace selected in the session, from Redis
+	err := handler.redisClient.Del(ctx, sessionToken, sessionWorkspaceKey(sessionToken)).Err()
 	if err == redis.Nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Session not found"})
 		return
@@ -177,10 +180,20 @@ func (handler *AuthHandler) RefreshHandler(c *gin.Context) {
 	// Generate a new session token
 	newToken := xid.New().String()
 
+	// Keep the workspace selected in the session
+	workspaceID, err := handler.redisClient.Get(ctx, sessionWorkspaceKey(oldToken)).Result()
+	if err != nil && err != redis.Nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking session"})
+		return
+	}
+
 	// Delete the old session and set the new one with an extended expiration
 	_, err = handler.redisClient.Pipelined(ctx, func(pipe redis.Pipeliner) error {
-		pipe.Del(ctx, oldToken)
+		pipe.Del(ctx, oldToken, sessionWorkspaceKey(oldToken))
 		pipe.Set(ctx, newToken, username, 10*time.Minute)
+		if workspaceID != "" {
+			pipe.Set(ctx, sessionWorkspaceKey(newToken), workspaceID, 10*time.Minute)
+		}
 		return nil
 	})
 
@@ -227,3 +240,63 @@ func (handler *AuthHandler) AuthMiddleware() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// streamTicketTTL - how long a stream ticket may wait to be used
+const streamTicketTTL = 30 * time.Second
+
+// streamTicketKey - Redis key of a stream ticket, holding the username it was issued to
+func streamTicketKey(ticket string) string {
+	return "stream-ticket:" + ticket
+}
+
+// StreamTicketHandler - a ticket to open the event stream with, for browsers: EventSource and WebSocket can't
+// set the Authorization header, and a session token in the URL would end up in access logs. The ticket works
+// once, within streamTicketTTL.
+func (handler *AuthHandler) StreamTicketHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "unable to create ticket: " + err.Error()})
+		return
+	}
+	ticket := hex.EncodeToString(secret)
+
+	if err := handler.redisClient.Set(ctx, streamTicketKey(ticket), c.GetString("username"), streamTicketTTL).Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("could not save ticket in Redis: %v", err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"ticket": ticket, "expires_in": int(streamTicketTTL.Seconds())})
+}
+
+// StreamTicketMiddleware - AuthMiddleware, also accepting a ticket from StreamTicketHandler as ?ticket=
+func (handler *AuthHandler) StreamTicketMiddleware() gin.HandlerFunc {
+	authenticate := handler.AuthMiddleware()
+	return func(c *gin.Context) {
+		ticket := c.Query("ticket")
+		if ticket == "" || c.Request.Header.Get("Authorization") != "" {
+			authenticate(c)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+		defer cancel()
+
+		// Used up right away, a ticket opens one stream
+		username, err := handler.redisClient.GetDel(ctx, streamTicketKey(ticket)).Result()
+		if err == redis.Nil {
+			c.JSON(http.StatusForbidden, gin.H{"message": "Invalid or expired ticket"})
+			c.Abort()
+			return
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error checking ticket: %v", err.Error())})
+			c.Abort()
+			return
+		}
+
+		c.Set("username", username)
+		c.Next()
+	}
+}
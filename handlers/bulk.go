@@ -0,0 +1,681 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/utpal74/track-my-tasks-backend/model"
+	"github.com/utpal74/track-my-tasks-backend/tenant"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const maxBulkOperations = 100
+
+// bulk operations
+const (
+	bulkCreate   = "create"
+	bulkUpdate   = "update"
+	bulkComplete = "complete"
+	bulkDelete   = "delete"
+	bulkMove     = "move"
+)
+
+// bulk result states
+const (
+	bulkOK      = "ok"
+	bulkFailed  = "failed"
+	bulkSkipped = "skipped" // Not attempted because another operation of an atomic batch failed
+)
+
+type bulkOperation struct {
+	Op        string          `json:"op"`                   // One of the bulk* operations
+	ID        string          `json:"id"`                   // The task to change, unused by create
+	Task      json.RawMessage `json:"task"`                 // create and update: the body of /tasks/create and /tasks/update/:id
+	Status    string          `json:"status"`               // move: the column to move to
+	ProjectID *string         `json:"project_id,omitempty"` // move: the project to move to, "" for none
+	Force     bool            `json:"force"`                // complete and move: ignore open blockers
+
+	taskID primitive.ObjectID // create: the ID chosen by a syncing client, a new one otherwise
+}
+
+// bulkRequest - with atomic set either all operations are applied, in a transaction, or none
+type bulkRequest struct {
+	Atomic     bool            `json:"atomic"`
+	Operations []bulkOperation `json:"operations" binding:"required"`
+}
+
+type bulkResult struct {
+	Index  int    `json:"index"`
+	Op     string `json:"op"`
+	ID     string `json:"id,omitempty"`
+	Status string `json:"status"` // One of the bulk result states
+	Error  string `json:"error,omitempty"`
+}
+
+// bulkBatch - what the operations of one request share while they are planned
+type bulkBatch struct {
+	user       model.User
+	tasks      map[primitive.ObjectID]model.Task // Visible tasks named by the operations
+	snapshots  map[primitive.ObjectID]bson.M     // The same tasks, for the history
+	workflows  map[string][]model.StatusColumn
+	planned    map[string]int              // Tasks added to a column by earlier operations, for WIP limits
+	completing map[primitive.ObjectID]bool // Tasks completed by the batch don't block others
+}
+
+// bulkStep - the writes planned for one operation
+type bulkStep struct {
+	index     int
+	action    string
+	task      model.Task
+	before    bson.M
+	project   *primitive.ObjectID // The project of the task once written, may differ after a move
+	taskWrite mongo.WriteModel
+	userWrite mongo.WriteModel
+}
+
+// BulkTasksHandler - apply up to 100 create, update, complete, delete and move operations in one request.
+// Each operation gets a result, the caches are invalidated once at the end.
+func (handler *TasksHandler) BulkTasksHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+	defer cancel()
+
+	var req bulkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(req.Operations) == 0 || len(req.Operations) > maxBulkOperations {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "between 1 and 100 operations are required"})
+		return
+	}
+
+	user, ok := handler.currentUser(ctx, c)
+	if !ok {
+		return
+	}
+
+	batch, err := handler.newBulkBatch(ctx, user, req.Operations)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	results := make([]bulkResult, len(req.Operations))
+	steps := make([]bulkStep, 0, len(req.Operations))
+	for i, op := range req.Operations {
+		results[i] = bulkResult{Index: i, Op: op.Op, ID: op.ID}
+		step, err := handler.planBulkOperation(ctx, batch, op)
+		if err != nil {
+			results[i].Status = bulkFailed
+			results[i].Error = err.Error()
+			continue
+		}
+		step.index = i
+		results[i].ID = step.task.ID.Hex()
+		steps = append(steps, step)
+	}
+
+	if req.Atomic && len(steps) < len(req.Operations) {
+		for i := range results {
+			if results[i].Status == "" {
+				results[i].Status = bulkSkipped
+			}
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "some operations are invalid, nothing was changed", "results": results})
+		return
+	}
+
+	var written []bulkStep
+	failures := make(map[int]error)
+	if req.Atomic {
+		if err := handler.writeBulkAtomically(ctx, c.GetString("username"), steps); err != nil {
+			if errors.Is(err, errAtomicUnavailable) {
+				c.JSON(http.StatusNotImplemented, gin.H{"error": err.Error()})
+				return
+			}
+			status := http.StatusInternalServerError
+			if errors.Is(err, tenant.ErrQuotaExceeded) {
+				status = http.StatusForbidden
+			}
+			for i := range results {
+				results[i].Status = bulkFailed
+				results[i].Error = err.Error()
+			}
+			c.JSON(status, gin.H{"error": "the transaction failed, nothing was changed", "results": results})
+			return
+		}
+		written = steps
+	} else {
+		written, failures = handler.writeBulk(ctx, c.GetString("username"), steps)
+	}
+
+	for index, err := range failures {
+		results[index].Status = bulkFailed
+		results[index].Error = err.Error()
+	}
+
+	keys := make(map[string]bool)
+	for _, step := range written {
+		results[step.index].Status = bulkOK
+
+		for _, key := range memberCacheKeys(ctx, handler.projectsColl, step.task) {
+			keys[key] = true
+		}
+		if !sameProject(step.project, step.task.ProjectID) {
+			moved := step.task
+			moved.ProjectID = step.project
+			for _, key := range memberCacheKeys(ctx, handler.projectsColl, moved) {
+				keys[key] = true
+			}
+		}
+	}
+
+	if len(keys) > 0 {
+		cacheKeys := make([]string, 0, len(keys))
+		for key := range keys {
+			cacheKeys = append(cacheKeys, key)
+		}
+		log.Println("remove data from redis")
+		handler.redisClient.Del(ctx, cacheKeys...)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"results": results, "succeeded": len(written), "failed": len(results) - len(written)})
+}
+
+// newBulkBatch - loads the visible tasks named by the operations with a single query
+func (handler *TasksHandler) newBulkBatch(ctx context.Context, user model.User, operations []bulkOperation) (*bulkBatch, error) {
+	batch := &bulkBatch{
+		user:       user,
+		tasks:      make(map[primitive.ObjectID]model.Task),
+		snapshots:  make(map[primitive.ObjectID]bson.M),
+		workflows:  make(map[string][]model.StatusColumn),
+		planned:    make(map[string]int),
+		completing: make(map[primitive.ObjectID]bool),
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(operations))
+	for _, op := range operations {
+		if id, err := primitive.ObjectIDFromHex(op.ID); err == nil {
+			ids = append(ids, id)
+			if op.Op == bulkComplete {
+				batch.completing[id] = true
+			}
+		}
+	}
+	if len(ids) == 0 {
+		return batch, nil
+	}
+
+	filter, err := visibleTasksFilter(ctx, handler.projectsColl, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	filter["_id"] = bson.M{"$in": ids}
+
+	cur, err := handler.tasksColl.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	for cur.Next(ctx) {
+		var task model.Task
+		var snapshot bson.M
+		if err := cur.Decode(&task); err != nil {
+			return nil, err
+		}
+		if err := cur.Decode(&snapshot); err != nil {
+			return nil, err
+		}
+		batch.tasks[task.ID] = task
+		batch.snapshots[task.ID] = snapshot
+	}
+	return batch, cur.Err()
+}
+
+// planBulkOperation - validates an operation against the state before the batch and prepares its writes
+func (handler *TasksHandler) planBulkOperation(ctx context.Context, batch *bulkBatch, op bulkOperation) (bulkStep, error) {
+	if op.Op == bulkCreate {
+		return handler.planBulkCreate(ctx, batch, op)
+	}
+
+	id, err := primitive.ObjectIDFromHex(op.ID)
+	if err != nil {
+		return bulkStep{}, errors.New("invalid id format")
+	}
+	task, found := batch.tasks[id]
+	if !found {
+		return bulkStep{}, errors.New("task not found")
+	}
+
+	role, err := taskRole(ctx, handler.projectsColl, task, batch.user.ID)
+	if err != nil {
+		return bulkStep{}, err
+	}
+
+	step := bulkStep{task: task, before: batch.snapshots[id], project: task.ProjectID}
+	now := time.Now()
+
+	switch op.Op {
+	case bulkUpdate:
+		if role == model.RoleViewer {
+			return step, errors.New("viewers can't change the task")
+		}
+
+		var update model.Task
+		var patch taskPatch
+		if err := json.Unmarshal(op.Task, &update); err != nil {
+			return step, errors.New("invalid task: " + err.Error())
+		}
+		if err := json.Unmarshal(op.Task, &patch); err != nil {
+			return step, errors.New("invalid task: " + err.Error())
+		}
+		if update.Done {
+			return step, errors.New("use the complete operation to finish tasks")
+		}
+
+		fields, err := taskUpdateFields(update, patch)
+		if err != nil {
+			return step, err
+		}
+		if len(fields) == 0 {
+			return step, errors.New("no fields to update")
+		}
+		fields["updated_at"] = now
+
+		step.action = model.TaskActionUpdated
+		step.taskWrite, step.userWrite = mirroredTaskUpdate(task, fields, nil)
+
+	case bulkComplete:
+		if role == model.RoleViewer {
+			return step, errors.New("viewers can't change the task")
+		}
+
+		columns, err := handler.batchWorkflow(ctx, batch, task.UserID, task.ProjectID)
+		if err != nil {
+			return step, err
+		}
+		if err := handler.checkBatchBlockers(ctx, batch, task.ID, op.Force); err != nil {
+			return step, err
+		}
+
+		column := model.FirstStatus(columns, model.StatusCategoryClosed)
+		if column.Key != task.Status {
+			if err := handler.batchWIPLimit(ctx, batch, task.UserID, task.ProjectID, column); err != nil {
+				return step, err
+			}
+		}
+
+		step.action = model.TaskActionStatus
+		step.taskWrite, step.userWrite = mirroredTaskUpdate(task, bson.M{
+			"status":     column.Key,
+			"done":       true,
+			"updated_at": now,
+		}, nil)
+
+	case bulkDelete:
+		if task.UserID != batch.user.ID {
+			return step, errors.New("only the owner can delete the task")
+		}
+
+		step.action = model.TaskActionDeleted
+		step.taskWrite, step.userWrite = mirroredTaskUpdate(task, bson.M{"deleted_at": now, "updated_at": now}, nil)
+
+	case bulkMove:
+		if role == model.RoleViewer {
+			return step, errors.New("viewers can't change the task")
+		}
+		if op.Status == "" && op.ProjectID == nil {
+			return step, errors.New("status or project_id is required")
+		}
+
+		if op.ProjectID != nil {
+			// Projects belong to the owner of the task
+			if task.UserID != batch.user.ID {
+				return step, errors.New("only the owner can move the task to another project")
+			}
+			step.project = nil
+			if *op.ProjectID != "" {
+				projectID, err := primitive.ObjectIDFromHex(*op.ProjectID)
+				if err != nil {
+					return step, errors.New("invalid project id format")
+				}
+				step.project = &projectID
+			}
+		}
+
+		columns, err := handler.batchWorkflow(ctx, batch, task.UserID, step.project)
+		if err != nil {
+			return step, err
+		}
+
+		// Without a status the task keeps its column, or the first one of the same category
+		status := op.Status
+		if status == "" {
+			status = task.Status
+		}
+		column, found := model.FindStatus(columns, status)
+		if !found && op.Status != "" {
+			return step, errors.New("unknown status: " + op.Status)
+		}
+		if !found {
+			category := model.StatusCategoryOpen
+			if task.Done {
+				category = model.StatusCategoryClosed
+			}
+			column = model.FirstStatus(columns, category)
+		}
+
+		projectChanged := !sameProject(step.project, task.ProjectID)
+		if column.Key != task.Status || projectChanged {
+			if err := handler.batchWIPLimit(ctx, batch, task.UserID, step.project, column); err != nil {
+				return step, err
+			}
+		}
+
+		done := column.Category == model.StatusCategoryClosed
+		if done && !task.Done {
+			if err := handler.checkBatchBlockers(ctx, batch, task.ID, op.Force); err != nil {
+				return step, err
+			}
+		}
+
+		set := bson.M{"status": column.Key, "done": done, "updated_at": now}
+		var unset bson.M
+		if projectChanged && step.project == nil {
+			unset = bson.M{"project_id": ""}
+		} else if projectChanged {
+			set["project_id"] = *step.project
+		}
+
+		step.action = model.TaskActionStatus
+		if projectChanged {
+			step.action = model.TaskActionUpdated
+		}
+		step.taskWrite, step.userWrite = mirroredTaskUpdate(task, set, unset)
+
+	default:
+		return step, errors.New("unknown operation: " + op.Op)
+	}
+	return step, nil
+}
+
+// planBulkCreate - a new task as NewTaskHandler creates it
+func (handler *TasksHandler) planBulkCreate(ctx context.Context, batch *bulkBatch, op bulkOperation) (bulkStep, error) {
+	var task model.Task
+	if err := json.Unmarshal(op.Task, &task); err != nil {
+		return bulkStep{}, errors.New("invalid task: " + err.Error())
+	}
+
+	if task.ParentID != nil {
+		if _, found := batch.tasks[*task.ParentID]; !found {
+			if _, err := loadAccessibleTask(ctx, handler.tasksColl, handler.projectsColl, batch.user.ID, *task.ParentID); err == mongo.ErrNoDocuments {
+				return bulkStep{}, errors.New("parent task not found")
+			} else if err != nil {
+				return bulkStep{}, err
+			}
+		}
+	}
+
+	if task.Recurrence != nil && !model.ValidRecurrence(*task.Recurrence) {
+		return bulkStep{}, errors.New("invalid recurrence")
+	}
+
+	if task.Priority == "" {
+		task.Priority = model.PriorityNone
+	}
+	if !model.ValidPriority(task.Priority) {
+		return bulkStep{}, errors.New("unknown priority: " + task.Priority)
+	}
+
+	columns, err := handler.batchWorkflow(ctx, batch, batch.user.ID, task.ProjectID)
+	if err != nil {
+		return bulkStep{}, err
+	}
+
+	column, found := model.FindStatus(columns, task.Status)
+	if task.Status == "" {
+		category := model.StatusCategoryOpen
+		if task.Done {
+			category = model.StatusCategoryClosed
+		}
+		column, found = model.FirstStatus(columns, category), true
+	}
+	if !found {
+		return bulkStep{}, errors.New("unknown status: " + task.Status)
+	}
+
+	if err := handler.batchWIPLimit(ctx, batch, batch.user.ID, task.ProjectID, column); err != nil {
+		return bulkStep{}, err
+	}
+
+	// New tasks go to the bottom of the manual order, in the order of the operations
+	if task.Rank, err = handler.nextRank(ctx, batch.user.ID); err != nil {
+		return bulkStep{}, errors.New("unable to compute rank: " + err.Error())
+	}
+
+	initNewTask(ctx, &task, batch.user, column)
+	if !op.taskID.IsZero() {
+		task.ID = op.taskID
+	}
+
+	return bulkStep{
+		action:    model.TaskActionCreated,
+		task:      task,
+		project:   task.ProjectID,
+		taskWrite: mongo.NewInsertOneModel().SetDocument(task),
+		userWrite: mongo.NewUpdateOneModel().SetFilter(bson.M{"_id": batch.user.ID}).SetUpdate(bson.M{"$push": bson.M{"task": task}}),
+	}, nil
+}
+
+// batchWorkflow - workflowFor, loading each project once per batch
+func (handler *TasksHandler) batchWorkflow(ctx context.Context, batch *bulkBatch, ownerID primitive.ObjectID, projectID *primitive.ObjectID) ([]model.StatusColumn, error) {
+	key := columnKey(ownerID, projectID, "")
+	if columns, found := batch.workflows[key]; found {
+		return columns, nil
+	}
+
+	columns, err := handler.workflowFor(ctx, ownerID, projectID)
+	if err == mongo.ErrNoDocuments {
+		return nil, errors.New("project not found")
+	} else if err != nil {
+		return nil, err
+	}
+	batch.workflows[key] = columns
+	return columns, nil
+}
+
+// batchWIPLimit - checkWIPLimit, counting the tasks which earlier operations of the batch add to the column
+func (handler *TasksHandler) batchWIPLimit(ctx context.Context, batch *bulkBatch, ownerID primitive.ObjectID, projectID *primitive.ObjectID, column model.StatusColumn) error {
+	key := columnKey(ownerID, projectID, column.Key)
+	if err := handler.checkWIPLimit(ctx, ownerID, projectID, column, batch.planned[key]+1); err != nil {
+		return err
+	}
+	batch.planned[key]++
+	return nil
+}
+
+// checkBatchBlockers - fails while the task has open blockers which the batch doesn't complete, unless forced
+func (handler *TasksHandler) checkBatchBlockers(ctx context.Context, batch *bulkBatch, taskID primitive.ObjectID, force bool) error {
+	if force {
+		return nil
+	}
+
+	openBlockers, err := handler.openBlockers(ctx, taskID)
+	if err != nil {
+		return errors.New("unable to check blockers: " + err.Error())
+	}
+	for _, blocker := range openBlockers {
+		if !batch.completing[blocker] {
+			return errors.New("task is blocked by open tasks")
+		}
+	}
+	return nil
+}
+
+// errBulkRejected - aborts the transaction of writeBulk when some of the writes were rejected
+var errBulkRejected = errors.New("some writes were rejected")
+
+// writeBulk - applies the steps with unordered bulk writes and records them, in one transaction, returning the ones
+// which were written and the errors of the others by operation index. A write error aborts a transaction, so the
+// steps whose writes were rejected are dropped and the others written again; without transactions the others
+// are already written, and recorded right away.
+func (handler *TasksHandler) writeBulk(ctx context.Context, actor string, steps []bulkStep) ([]bulkStep, map[int]error) {
+	failures := make(map[int]error)
+	pending := steps
+	for len(pending) > 0 {
+		var written []bulkStep
+		rejected := make(map[int]error)
+		err := handler.outbox.Transact(ctx, func(ctx context.Context) error {
+			clear(rejected)
+			_, err := handler.tasksColl.BulkWrite(ctx, taskWrites(pending), options.BulkWrite().SetOrdered(false))
+			var bulkErr mongo.BulkWriteException
+			if errors.As(err, &bulkErr) && len(bulkErr.WriteErrors) > 0 && bulkErr.WriteConcernError == nil {
+				for _, writeErr := range bulkErr.WriteErrors {
+					rejected[pending[writeErr.Index].index] = errors.New(writeErr.Message)
+				}
+				if handler.outbox.Transactional() {
+					return errBulkRejected
+				}
+			} else if err != nil {
+				return err
+			}
+
+			written = withoutSteps(pending, rejected)
+			return handler.recordSteps(ctx, actor, written)
+		})
+
+		for index, err := range rejected {
+			failures[index] = err
+		}
+		if errors.Is(err, errBulkRejected) {
+			pending = withoutSteps(pending, rejected)
+			continue
+		}
+		if err != nil {
+			for _, step := range withoutSteps(pending, rejected) {
+				failures[step.index] = err
+			}
+			return nil, failures
+		}
+		return written, failures
+	}
+	return nil, failures
+}
+
+// withoutSteps - the steps whose operation index isn't in failures
+func withoutSteps(steps []bulkStep, failures map[int]error) []bulkStep {
+	kept := make([]bulkStep, 0, len(steps))
+	for _, step := range steps {
+		if failures[step.index] == nil {
+			kept = append(kept, step)
+		}
+	}
+	return kept
+}
+
+// errAtomicUnavailable - atomic bulk requests need transactions, which MongoDB only runs as a replica set
+var errAtomicUnavailable = errors.New("atomic mode is unavailable, the database doesn't support transactions")
+
+// writeBulkAtomically - applies and records all steps in the transaction of the outbox, fails with
+// errAtomicUnavailable rather than writing them one after the other when the outbox can't run transactions
+func (handler *TasksHandler) writeBulkAtomically(ctx context.Context, actor string, steps []bulkStep) error {
+	if !handler.outbox.Transactional() {
+		return errAtomicUnavailable
+	}
+	return handler.outbox.Transact(ctx, func(ctx context.Context) error {
+		return handler.writeSteps(ctx, actor, steps)
+	})
+}
+
+// writeSteps - writes the steps to the tasks and their owners and records the changes
+func (handler *TasksHandler) writeSteps(ctx context.Context, actor string, steps []bulkStep) error {
+	if _, err := handler.tasksColl.BulkWrite(ctx, taskWrites(steps)); err != nil {
+		var bulkErr mongo.BulkWriteException
+		if errors.As(err, &bulkErr) && len(bulkErr.WriteErrors) > 0 {
+			return errors.New(bulkErr.WriteErrors[0].Message)
+		}
+		return err
+	}
+	return handler.recordSteps(ctx, actor, steps)
+}
+
+// recordSteps - writes the steps written to the tasks to their owners and records the changes
+func (handler *TasksHandler) recordSteps(ctx context.Context, actor string, steps []bulkStep) error {
+	if len(steps) == 0 {
+		return nil
+	}
+	if _, err := handler.usersColl.BulkWrite(ctx, userWrites(steps), options.BulkWrite().SetOrdered(false)); err != nil {
+		return fmt.Errorf("unable to update the tasks of users: %w", err)
+	}
+
+	for _, step := range steps {
+		if err := handler.recordChange(ctx, actor, step.action, step.task.ID, step.before); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mirroredTaskUpdate - the update of a task and of its copy in the owner's document
+func mirroredTaskUpdate(task model.Task, set, unset bson.M) (mongo.WriteModel, mongo.WriteModel) {
+	update := bson.M{"$set": set}
+	userUpdate := bson.M{"$set": prefixFields(set)}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+		userUpdate["$unset"] = prefixFields(unset)
+	}
+
+	taskWrite := mongo.NewUpdateOneModel().SetFilter(activeTask(bson.M{"_id": task.ID})).SetUpdate(update)
+	userWrite := mongo.NewUpdateOneModel().SetFilter(bson.M{"_id": task.UserID, "task._id": task.ID}).SetUpdate(userUpdate)
+	return taskWrite, userWrite
+}
+
+// prefixFields - addresses the fields in the matched element of the users' task array
+func prefixFields(fields bson.M) bson.M {
+	prefixed := make(bson.M, len(fields))
+	for field, value := range fields {
+		prefixed["task.$."+field] = value
+	}
+	return prefixed
+}
+
+func taskWrites(steps []bulkStep) []mongo.WriteModel {
+	writes := make([]mongo.WriteModel, 0, len(steps))
+	for _, step := range steps {
+		writes = append(writes, step.taskWrite)
+	}
+	return writes
+}
+
+func userWrites(steps []bulkStep) []mongo.WriteModel {
+	writes := make([]mongo.WriteModel, 0, len(steps))
+	for _, step := range steps {
+		writes = append(writes, step.userWrite)
+	}
+	return writes
+}
+
+func columnKey(ownerID primitive.ObjectID, projectID *primitive.ObjectID, status string) string {
+	project := ""
+	if projectID != nil {
+		project = projectID.Hex()
+	}
+	return ownerID.Hex() + ":" + project + ":" + status
+}
+
+func sameProject(a, b *primitive.ObjectID) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
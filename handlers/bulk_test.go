@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/utpal74/track-my-tasks-backend/model"
+	"github.com/utpal74/track-my-tasks-backend/outbox"
+	"github.com/utpal74/track-my-tasks-backend/tenant"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// bulkTestHandler - a handler on the mock deployment, whose outbox runs without transactions like a standalone server
+func bulkTestHandler(mt *mtest.T) *TasksHandler {
+	mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "isWritablePrimary", Value: true}), mtest.CreateSuccessResponse())
+	box, err := outbox.New(context.Background(), mt.DB.Collection("outbox"))
+	if err != nil {
+		mt.Fatal(err)
+	}
+	return &TasksHandler{
+		tasksColl:  tenant.NewCollection(mt.DB.Collection("tasks")),
+		usersColl:  mt.DB.Collection("users"),
+		eventsColl: mt.DB.Collection("events"),
+		outbox:     box,
+	}
+}
+
+// bulkTestSteps - steps completing one task each, with operation indexes 0 to count-1
+func bulkTestSteps(count int) []bulkStep {
+	steps := make([]bulkStep, 0, count)
+	for i := 0; i < count; i++ {
+		task := model.Task{ID: primitive.NewObjectID(), UserID: primitive.NewObjectID()}
+		taskWrite, userWrite := mirroredTaskUpdate(task, bson.M{"done": true}, nil)
+		steps = append(steps, bulkStep{index: i, action: model.TaskActionUpdated, task: task, taskWrite: taskWrite, userWrite: userWrite})
+	}
+	return steps
+}
+
+func stepIndexes(steps []bulkStep) []int {
+	var indexes []int
+	for _, step := range steps {
+		indexes = append(indexes, step.index)
+	}
+	sort.Ints(indexes)
+	return indexes
+}
+
+func TestWriteBulk(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	updated := func(n int) bson.D {
+		return mtest.CreateSuccessResponse(bson.E{Key: "n", Value: n}, bson.E{Key: "nModified", Value: n})
+	}
+	rejected := mtest.CreateSuccessResponse(
+		bson.E{Key: "n", Value: 2},
+		bson.E{Key: "nModified", Value: 2},
+		bson.E{Key: "writeErrors", Value: bson.A{bson.D{{Key: "index", Value: 1}, {Key: "code", Value: 121}, {Key: "errmsg", Value: "Document failed validation"}}}},
+	)
+	failed := mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 11600, Message: "interrupted at shutdown"})
+	missing := mtest.CreateCursorResponse(0, "db.tasks", mtest.FirstBatch)
+
+	tests := []struct {
+		name        string
+		responses   []bson.D
+		wantWritten []int
+		wantFailed  []int
+		wantError   string
+	}{
+		{
+			name:        "writes every step",
+			responses:   []bson.D{updated(3), updated(3), missing, missing, missing},
+			wantWritten: []int{0, 1, 2},
+		},
+		{
+			name:        "keeps the steps which weren't rejected",
+			responses:   []bson.D{rejected, updated(2), missing, missing},
+			wantWritten: []int{0, 2},
+			wantFailed:  []int{1},
+			wantError:   "Document failed validation",
+		},
+		{
+			name:       "fails every step when the tasks can't be written",
+			responses:  []bson.D{failed},
+			wantFailed: []int{0, 1, 2},
+			wantError:  "interrupted at shutdown",
+		},
+		{
+			name:       "fails every step when the owners can't be written",
+			responses:  []bson.D{updated(3), failed},
+			wantFailed: []int{0, 1, 2},
+			wantError:  "unable to update the tasks of users: interrupted at shutdown",
+		},
+	}
+
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			handler := bulkTestHandler(mt)
+			mt.AddMockResponses(tt.responses...)
+			ctx := tenant.WithWorkspace(context.Background(), model.Workspace{ID: primitive.NewObjectID()})
+
+			written, failures := handler.writeBulk(ctx, "alice", bulkTestSteps(3))
+			if got := stepIndexes(written); !reflect.DeepEqual(got, tt.wantWritten) {
+				mt.Errorf("writeBulk() wrote %v, want %v", got, tt.wantWritten)
+			}
+
+			var failed []int
+			for index, err := range failures {
+				failed = append(failed, index)
+				if !strings.Contains(err.Error(), tt.wantError) {
+					mt.Errorf("operation %d error = %v, want %q", index, err, tt.wantError)
+				}
+			}
+			sort.Ints(failed)
+			if !reflect.DeepEqual(failed, tt.wantFailed) {
+				mt.Errorf("writeBulk() failed %v, want %v", failed, tt.wantFailed)
+			}
+		})
+	}
+}
+
+func TestWriteBulkAtomically(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	mt.Run("needs transactions", func(mt *mtest.T) {
+		handler := bulkTestHandler(mt)
+		mt.ClearEvents()
+
+		err := handler.writeBulkAtomically(context.Background(), "alice", bulkTestSteps(2))
+		if !errors.Is(err, errAtomicUnavailable) {
+			mt.Errorf("writeBulkAtomically() error = %v, want %v", err, errAtomicUnavailable)
+		}
+		if started := mt.GetAllStartedEvents(); len(started) != 0 {
+			mt.Errorf("writeBulkAtomically() sent %d commands", len(started))
+		}
+	})
+}
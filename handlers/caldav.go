@@ -0,0 +1,1108 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/utpal74/track-my-tasks-backend/ical"
+	"github.com/utpal74/track-my-tasks-backend/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// The CalDAV server exposes one VTODO calendar per project the user can see, plus an inbox for their tasks outside
+// of projects:
+//
+//	/dav/                            root
+//	/dav/principal/                  the signed in user
+//	/dav/calendars/                  calendar home
+//	/dav/calendars/<inbox|project>/  calendar collection
+//	/dav/calendars/<...>/<name>.ics  a task
+//
+// Sync tokens are the last update time of the collection's tasks; tasks in the trash are reported as removed until
+// they are purged, older tokens are refused. Tasks moved to another calendar are reported as removed from the old
+// one, found through their history.
+const (
+	davRoot         = "/dav/"
+	davPrincipal    = "/dav/principal/"
+	davHome         = "/dav/calendars/"
+	davInbox        = "inbox"
+	davProdID       = "-//track-my-tasks//CalDAV//EN"
+	syncTokenPrefix = "http://track-my-tasks/sync/"
+	icalUIDSuffix   = "@track-my-tasks"
+	// Largest calendar object accepted by PUT
+	maxCalendarObject = 1 << 20
+)
+
+// errDAVPrecondition - the task changed after its ETag was checked
+var errDAVPrecondition = errors.New("the task has changed")
+
+// davCollection - a calendar collection, the inbox or a project
+type davCollection struct {
+	key     string // Path segment
+	name    string
+	project *model.Project
+	role    string // model.RoleOwner, model.RoleEditor or model.RoleViewer
+}
+
+func (col davCollection) href() string {
+	return davHome + col.key + "/"
+}
+
+// filter - matches the tasks of the collection, including the ones in the trash
+func (col davCollection) filter(userID primitive.ObjectID) bson.M {
+	if col.project == nil {
+		return bson.M{"user_id": userID, "project_id": bson.M{"$exists": false}}
+	}
+	return bson.M{"project_id": col.project.ID}
+}
+
+// davTarget - what a path under /dav points at
+type davTarget struct {
+	kind       string // One of the davTarget* constants
+	collection string
+	name       string
+}
+
+const (
+	davTargetRoot       = "root"
+	davTargetPrincipal  = "principal"
+	davTargetHome       = "home"
+	davTargetCollection = "collection"
+	davTargetResource   = "resource"
+)
+
+func parseDAVPath(p string) (davTarget, bool) {
+	p = strings.Trim(p, "/")
+	if p == "" {
+		return davTarget{kind: davTargetRoot}, true
+	}
+
+	segments := strings.Split(p, "/")
+	switch {
+	case segments[0] == "principal" && len(segments) == 1:
+		return davTarget{kind: davTargetPrincipal}, true
+	case segments[0] != "calendars" || len(segments) > 3:
+		return davTarget{}, false
+	case len(segments) == 1:
+		return davTarget{kind: davTargetHome}, true
+	case len(segments) == 2:
+		return davTarget{kind: davTargetCollection, collection: segments[1]}, true
+	}
+	return davTarget{kind: davTargetResource, collection: segments[1], name: segments[2]}, true
+}
+
+// DAVWellKnownHandler - points clients discovering the service (RFC 6764) at the DAV root
+func (handler *TasksHandler) DAVWellKnownHandler(c *gin.Context) {
+	c.Redirect(http.StatusMovedPermanently, davRoot)
+}
+
+// DAVOptionsHandler - advertises the CalDAV capabilities
+func (handler *TasksHandler) DAVOptionsHandler(c *gin.Context) {
+	c.Header("DAV", "1, 3, calendar-access")
+	c.Header("Allow", "OPTIONS, GET, PUT, DELETE, PROPFIND, REPORT")
+	c.Status(http.StatusOK)
+}
+
+// DAVPropfindHandler - the properties of the principal, the calendars and the tasks, with Depth 0 or 1
+func (handler *TasksHandler) DAVPropfindHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	user, ok := handler.currentUser(ctx, c)
+	if !ok {
+		return
+	}
+
+	target, ok := parseDAVPath(c.Param("path"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+
+	var req davPropfind
+	if err := readDAVBody(c, &req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid PROPFIND body: " + err.Error()})
+		return
+	}
+	requested := req.Prop.requested()
+	if req.AllProp != nil {
+		requested = nil
+	}
+	withData := containsXMLName(requested, davName(nsCalDAV, "calendar-data"))
+	children := c.GetHeader("Depth") != "0"
+
+	m := newDAVMultistatus()
+	switch target.kind {
+	case davTargetRoot:
+		m.add(davRoot, davProps{
+			davName(nsDAV, "resourcetype"):           "<d:collection/>",
+			davName(nsDAV, "current-user-principal"): davHref(davPrincipal),
+		}, requested)
+		if children {
+			m.add(davPrincipal, principalProps(user), requested)
+			m.add(davHome, homeProps(), requested)
+		}
+
+	case davTargetPrincipal:
+		m.add(davPrincipal, principalProps(user), requested)
+
+	case davTargetHome:
+		m.add(davHome, homeProps(), requested)
+		if children {
+			collections, err := handler.davCollections(ctx, user)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			for _, col := range collections {
+				props, err := handler.collectionProps(ctx, col, user.ID)
+				if err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+					return
+				}
+				m.add(col.href(), props, requested)
+			}
+		}
+
+	case davTargetCollection:
+		col, ok := handler.davCollectionFromPath(ctx, c, user, target)
+		if !ok {
+			return
+		}
+		props, err := handler.collectionProps(ctx, col, user.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		m.add(col.href(), props, requested)
+
+		if children {
+			tasks, err := handler.davTasks(ctx, activeTask(col.filter(user.ID)))
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			parents, err := handler.parentUIDs(ctx, tasks)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			for _, task := range tasks {
+				m.add(taskHref(col, task), resourceProps(task, parents, withData), requested)
+			}
+		}
+
+	case davTargetResource:
+		col, ok := handler.davCollectionFromPath(ctx, c, user, target)
+		if !ok {
+			return
+		}
+		task, err := handler.davTask(ctx, col, user.ID, target.name)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "task not found"})
+			return
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		parents, err := handler.parentUIDs(ctx, []model.Task{task})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		m.add(taskHref(col, task), resourceProps(task, parents, withData), requested)
+	}
+
+	m.write(c)
+}
+
+// DAVReportHandler - the calendar-query, calendar-multiget and sync-collection reports of a calendar
+func (handler *TasksHandler) DAVReportHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	user, ok := handler.currentUser(ctx, c)
+	if !ok {
+		return
+	}
+
+	target, ok := parseDAVPath(c.Param("path"))
+	if !ok || target.kind != davTargetCollection {
+		davError(c, http.StatusForbidden, nsDAV, "supported-report")
+		return
+	}
+	col, ok := handler.davCollectionFromPath(ctx, c, user, target)
+	if !ok {
+		return
+	}
+
+	var req davReport
+	if err := readDAVBody(c, &req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid REPORT body: " + err.Error()})
+		return
+	}
+	requested := req.Prop.requested()
+	withData := requested == nil || containsXMLName(requested, davName(nsCalDAV, "calendar-data"))
+
+	m := newDAVMultistatus()
+	var tasks []model.Task
+	var gone []string
+	syncToken := ""
+
+	switch req.XMLName {
+	case davName(nsCalDAV, "calendar-query"):
+		// The calendars only hold to-dos, queries for anything else match nothing
+		for _, comp := range req.Filter.Comp.Comps {
+			if comp.Name != ical.KindTodo {
+				m.write(c)
+				return
+			}
+		}
+		var err error
+		if tasks, err = handler.davTasks(ctx, activeTask(col.filter(user.ID))); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+	case davName(nsCalDAV, "calendar-multiget"):
+		for _, href := range req.Hrefs {
+			task, err := handler.davTaskFromHref(ctx, col, user.ID, href)
+			if err == mongo.ErrNoDocuments {
+				m.gone(href)
+				continue
+			} else if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			tasks = append(tasks, task)
+		}
+
+	case davName(nsDAV, "sync-collection"):
+		// Taken before reading the changes, a change made meanwhile is sent again rather than missed
+		var err error
+		syncToken, err = handler.davSyncToken(ctx, col, user.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		filter := col.filter(user.ID)
+		if req.SyncToken == "" {
+			filter = activeTask(filter)
+		} else {
+			since, ok := parseSyncToken(req.SyncToken)
+			if !ok {
+				davError(c, http.StatusForbidden, nsDAV, "valid-sync-token")
+				return
+			}
+			filter["updated_at"] = bson.M{"$gt": since}
+		}
+
+		changed, err := handler.davTasks(ctx, filter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		for _, task := range changed {
+			if task.DeletedAt != nil {
+				gone = append(gone, taskHref(col, task))
+			} else {
+				tasks = append(tasks, task)
+			}
+		}
+
+		if req.SyncToken != "" {
+			since, _ := parseSyncToken(req.SyncToken)
+			moved, err := handler.davMovedOut(ctx, col, user.ID, since, changed)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			for _, task := range moved {
+				gone = append(gone, taskHref(col, task))
+			}
+		}
+
+	default:
+		davError(c, http.StatusForbidden, nsDAV, "supported-report")
+		return
+	}
+
+	parents, err := handler.parentUIDs(ctx, tasks)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	for _, task := range tasks {
+		m.add(taskHref(col, task), resourceProps(task, parents, withData), requested)
+	}
+	for _, href := range gone {
+		m.gone(href)
+	}
+	if syncToken != "" {
+		m.syncToken(syncToken)
+	}
+	m.write(c)
+}
+
+// DAVGetHandler - a task as an iCalendar object
+func (handler *TasksHandler) DAVGetHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	user, ok := handler.currentUser(ctx, c)
+	if !ok {
+		return
+	}
+
+	task, col, ok := handler.davTaskFromPath(ctx, c, user)
+	if !ok {
+		return
+	}
+
+	parents, err := handler.parentUIDs(ctx, []model.Task{task})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("ETag", taskETag(task))
+	c.Header("Content-Location", taskHref(col, task))
+	c.Data(http.StatusOK, "text/calendar; charset=utf-8", calendarData(task, parents[task.ID]))
+}
+
+// DAVPutHandler - creates or replaces a task from a VTODO. The task keeps the fields iCalendar has no room for,
+// such as its checklist, assignees and time entries.
+func (handler *TasksHandler) DAVPutHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	user, ok := handler.currentUser(ctx, c)
+	if !ok {
+		return
+	}
+
+	target, ok := parseDAVPath(c.Param("path"))
+	if !ok || target.kind != davTargetResource {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "only calendar objects can be written"})
+		return
+	}
+	col, ok := handler.davCollectionFromPath(ctx, c, user, target)
+	if !ok {
+		return
+	}
+	if col.role == model.RoleViewer {
+		c.JSON(http.StatusForbidden, gin.H{"error": "viewers can't change the calendar"})
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxCalendarObject+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(body) > maxCalendarObject {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "calendar object too large"})
+		return
+	}
+
+	calendar, err := ical.Parse(bytes.NewReader(body))
+	if err != nil {
+		davError(c, http.StatusForbidden, nsCalDAV, "valid-calendar-data")
+		return
+	}
+	object, ok := calendar.Find(ical.KindTodo)
+	if !ok {
+		davError(c, http.StatusForbidden, nsCalDAV, "supported-calendar-component")
+		return
+	}
+	todo, err := parseDAVTodo(object)
+	if err != nil {
+		davError(c, http.StatusForbidden, nsCalDAV, "valid-calendar-data")
+		return
+	}
+
+	existing, err := handler.davTask(ctx, col, user.ID, target.name)
+	found := err == nil
+	if err != nil && err != mongo.ErrNoDocuments {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Clients send If-None-Match: * to create and If-Match with the ETag they have to update,
+	// anything else changed the task since they read it
+	ifMatch := c.GetHeader("If-Match")
+	if (c.GetHeader("If-None-Match") == "*" && found) ||
+		(ifMatch != "" && (!found || (ifMatch != "*" && ifMatch != taskETag(existing)))) {
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": "the task has changed"})
+		return
+	}
+
+	if found && icalUID(existing) != todo.uid {
+		davError(c, http.StatusConflict, nsCalDAV, "no-uid-conflict")
+		return
+	}
+	if !found {
+		if _, err := handler.davTaskByUID(ctx, user.ID, todo.uid); err == nil {
+			davError(c, http.StatusConflict, nsCalDAV, "no-uid-conflict")
+			return
+		} else if err != mongo.ErrNoDocuments {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	// RELATED-TO pointing at a task the user can't see is ignored
+	var parentID *primitive.ObjectID
+	if todo.parentUID != "" {
+		if parent, err := handler.davTaskByUID(ctx, user.ID, todo.parentUID); err == nil && (!found || parent.ID != existing.ID) {
+			parentID = &parent.ID
+		} else if err != nil && err != mongo.ErrNoDocuments {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if !found {
+		task := model.Task{
+			Title:      todo.title,
+			Comment:    todo.comment,
+			Done:       todo.done,
+			ParentID:   parentID,
+			Priority:   todo.priority,
+			DueDate:    todo.due,
+			Recurrence: todo.recurrence,
+			Labels:     todo.labels,
+			CalDAV:     &model.CalDAVResource{UID: todo.uid, Name: target.name},
+		}
+		if col.project != nil {
+			task.ProjectID = &col.project.ID
+		}
+
+		task, ok := handler.createTask(ctx, c, user, task)
+		if !ok {
+			return
+		}
+		c.Header("ETag", taskETag(task))
+		c.Status(http.StatusCreated)
+		return
+	}
+
+	task, ok := handler.editableTask(ctx, c, user, existing.ID)
+	if !ok {
+		return
+	}
+
+	before, err := handler.taskSnapshot(ctx, task.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := time.Now()
+	set := bson.M{
+		"title":      todo.title,
+		"comment":    todo.comment,
+		"priority":   todo.priority,
+		"labels":     normalizeLabels(todo.labels),
+		"updated_at": now,
+	}
+	unset := bson.M{}
+	if todo.due != nil {
+		set["due_date"] = *todo.due
+	} else {
+		unset["due_date"] = ""
+	}
+	// Without a due date the task was sent without its RRULE, so the client couldn't have removed it
+	if todo.recurrence != nil {
+		set["recurrence"] = *todo.recurrence
+	} else if todo.due != nil {
+		unset["recurrence"] = ""
+	}
+	if parentID != nil {
+		set["parent_id"] = *parentID
+	}
+
+	if todo.done != task.Done {
+		category := model.StatusCategoryOpen
+		if todo.done {
+			category = model.StatusCategoryClosed
+			blockers, err := handler.openBlockers(ctx, task.ID)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "unable to check blockers: " + err.Error()})
+				return
+			}
+			if len(blockers) > 0 {
+				c.JSON(http.StatusConflict, gin.H{"error": "task is blocked by open tasks", "blocked_by": blockers})
+				return
+			}
+		}
+		columns, err := handler.workflowFor(ctx, task.UserID, task.ProjectID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "unable to resolve status: " + err.Error()})
+			return
+		}
+		column := model.FirstStatus(columns, category)
+		if column.Key != task.Status {
+			if err := handler.checkWIPLimit(ctx, task.UserID, task.ProjectID, column, 1); err != nil {
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		set["status"] = column.Key
+		set["done"] = todo.done
+	}
+
+	update, userUpdate := bson.M{"$set": set}, bson.M{"$set": prefixFields(set)}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+		userUpdate["$unset"] = prefixFields(unset)
+	}
+	// With an ETag, only over the version it names: a concurrent PUT may have replaced it since the check above
+	filter := activeTask(bson.M{"_id": task.ID})
+	if ifMatch != "" && ifMatch != "*" {
+		filter = unchangedTask(filter, existing.UpdatedAt)
+	}
+	err = handler.commitChange(ctx, c, model.TaskActionUpdated, task.ID, before, func(ctx context.Context) error {
+		res, err := handler.tasksColl.UpdateOne(ctx, filter, update)
+		if err != nil {
+			return err
+		}
+		if res.MatchedCount == 0 {
+			return errDAVPrecondition
+		}
+		if _, err := handler.usersColl.UpdateOne(ctx, bson.M{"_id": task.UserID, "task._id": task.ID}, userUpdate); err != nil {
+			return fmt.Errorf("Failed to update user with task: %w", err)
+		}
+		return nil
+	})
+	if errors.Is(err, errDAVPrecondition) {
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": "the task has changed"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	invalidateMemberCaches(ctx, handler.redisClient, handler.projectsColl, task)
+
+	task.UpdatedAt = now
+	c.Header("ETag", taskETag(task))
+	c.Status(http.StatusNoContent)
+}
+
+// DAVDeleteHandler - moves a task to the trash, only its owner may do so
+func (handler *TasksHandler) DAVDeleteHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	user, ok := handler.currentUser(ctx, c)
+	if !ok {
+		return
+	}
+
+	task, _, ok := handler.davTaskFromPath(ctx, c, user)
+	if !ok {
+		return
+	}
+
+	var version *time.Time
+	if ifMatch := c.GetHeader("If-Match"); ifMatch != "" && ifMatch != "*" {
+		if ifMatch != taskETag(task) {
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": "the task has changed"})
+			return
+		}
+		version = &task.UpdatedAt
+	}
+	if task.UserID != user.ID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only the owner can delete the task"})
+		return
+	}
+
+	before, err := handler.taskSnapshot(ctx, task.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if trashed, err := handler.trashTask(ctx, c, user.ID, task.ID, before, version); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	} else if !trashed && version != nil {
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": "the task has changed"})
+		return
+	} else if !trashed {
+		c.JSON(http.StatusNotFound, gin.H{"error": "task not found"})
+		return
+	}
+
+	handler.invalidateTaskCaches(ctx, task.ID)
+
+	c.Status(http.StatusNoContent)
+}
+
+// davTodo - the fields of a task read from a VTODO
+type davTodo struct {
+	uid        string
+	title      string
+	comment    string
+	done       bool
+	due        *time.Time
+	priority   string
+	labels     []string
+	recurrence *model.Recurrence
+	parentUID  string
+}
+
+func parseDAVTodo(object ical.Object) (davTodo, error) {
+	var todo davTodo
+
+	uid, ok := object.Get("UID")
+	if !ok || strings.TrimSpace(uid.Value) == "" {
+		return todo, errors.New("missing UID")
+	}
+	todo.uid = ical.Unescape(uid.Value)
+
+	todo.title = "Untitled"
+	if summary, ok := object.Get("SUMMARY"); ok && strings.TrimSpace(summary.Value) != "" {
+		todo.title = strings.TrimSpace(ical.Unescape(summary.Value))
+	}
+	if description, ok := object.Get("DESCRIPTION"); ok {
+		todo.comment = ical.Unescape(description.Value)
+	}
+
+	_, completed := object.Get("COMPLETED")
+	status, _ := object.Get("STATUS")
+	todo.done = completed || status.Value == "COMPLETED" || status.Value == "CANCELLED"
+
+	// Written by taskComponent either as DUE or, for recurring tasks, as DTSTART plus DURATION
+	if due, ok := object.Get("DUE"); ok {
+		t, _, err := ical.ParseTime(due)
+		if err != nil {
+			return todo, err
+		}
+		todo.due = &t
+	} else if start, ok := object.Get("DTSTART"); ok {
+		t, allDay, err := ical.ParseTime(start)
+		if err != nil {
+			return todo, err
+		}
+		if duration, ok := object.Get("DURATION"); ok && !allDay {
+			d, err := ical.ParseDuration(duration.Value)
+			if err != nil {
+				return todo, err
+			}
+			t = t.Add(d)
+		}
+		todo.due = &t
+	}
+
+	todo.priority = model.PriorityNone
+	if priority, ok := object.Get("PRIORITY"); ok {
+		n, err := strconv.Atoi(priority.Value)
+		if err != nil {
+			return todo, errors.New("invalid PRIORITY")
+		}
+		todo.priority = taskPriority(n)
+	}
+
+	for _, categories := range object.All("CATEGORIES") {
+		for _, category := range ical.SplitList(categories.Value) {
+			if category = strings.TrimSpace(category); category != "" {
+				todo.labels = append(todo.labels, category)
+			}
+		}
+	}
+
+	if rrule, ok := object.Get("RRULE"); ok {
+		if todo.due == nil {
+			return todo, errors.New("recurring to-do without a date")
+		}
+		recurrence, err := model.ParseRRule(rrule.Value)
+		if err != nil {
+			return todo, err
+		}
+		todo.recurrence = &recurrence
+	}
+
+	for _, related := range object.All("RELATED-TO") {
+		if reltype := related.Params["RELTYPE"]; reltype == "" || strings.EqualFold(reltype, "PARENT") {
+			todo.parentUID = ical.Unescape(related.Value)
+			break
+		}
+	}
+
+	return todo, nil
+}
+
+// taskPriority - maps the 1 (highest) to 9 scale of RFC 5545 back to a priority, the inverse of icalPriority
+func taskPriority(n int) string {
+	switch {
+	case n >= 1 && n <= 2:
+		return model.PriorityUrgent
+	case n >= 3 && n <= 4:
+		return model.PriorityHigh
+	case n == 5:
+		return model.PriorityMedium
+	case n >= 6 && n <= 9:
+		return model.PriorityLow
+	}
+	return model.PriorityNone
+}
+
+// icalUID - the UID of a task, the one its CalDAV client chose or one made of its ID
+func icalUID(task model.Task) string {
+	if task.CalDAV != nil && task.CalDAV.UID != "" {
+		return task.CalDAV.UID
+	}
+	return task.ID.Hex() + icalUIDSuffix
+}
+
+// davResourceName - the last segment of the task's URL
+func davResourceName(task model.Task) string {
+	if task.CalDAV != nil && task.CalDAV.Name != "" {
+		return task.CalDAV.Name
+	}
+	return task.ID.Hex() + ".ics"
+}
+
+// taskETag - changes whenever the task is updated
+func taskETag(task model.Task) string {
+	return `"` + strconv.FormatInt(task.UpdatedAt.UnixMilli(), 10) + `"`
+}
+
+func taskHref(col davCollection, task model.Task) string {
+	return col.href() + url.PathEscape(davResourceName(task))
+}
+
+// calendarData - the task as a calendar with a single VTODO
+func calendarData(task model.Task, parentUID string) []byte {
+	component := taskComponent(task, ical.KindTodo)
+	component.RelatedTo = parentUID
+
+	var buf bytes.Buffer
+	if err := ical.Write(&buf, ical.Calendar{ProdID: davProdID, Components: []ical.Component{component}}); err != nil {
+		log.Printf("Failed to write task %s as iCalendar: %v", task.ID.Hex(), err)
+	}
+	return buf.Bytes()
+}
+
+func principalProps(user model.User) davProps {
+	return davProps{
+		davName(nsDAV, "resourcetype"):           "<d:principal/>",
+		davName(nsDAV, "displayname"):            davEscape(user.Username),
+		davName(nsDAV, "principal-URL"):          davHref(davPrincipal),
+		davName(nsDAV, "current-user-principal"): davHref(davPrincipal),
+		davName(nsCalDAV, "calendar-home-set"):   davHref(davHome),
+	}
+}
+
+func homeProps() davProps {
+	return davProps{
+		davName(nsDAV, "resourcetype"):           "<d:collection/>",
+		davName(nsDAV, "current-user-principal"): davHref(davPrincipal),
+	}
+}
+
+func (handler *TasksHandler) collectionProps(ctx context.Context, col davCollection, userID primitive.ObjectID) (davProps, error) {
+	token, err := handler.davSyncToken(ctx, col, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	privileges := "<d:privilege><d:read/></d:privilege>"
+	if col.role != model.RoleViewer {
+		privileges += "<d:privilege><d:write/></d:privilege>"
+	}
+
+	return davProps{
+		davName(nsDAV, "resourcetype"):                        "<d:collection/><cal:calendar/>",
+		davName(nsDAV, "displayname"):                         davEscape(col.name),
+		davName(nsDAV, "current-user-principal"):              davHref(davPrincipal),
+		davName(nsDAV, "current-user-privilege-set"):          privileges,
+		davName(nsDAV, "sync-token"):                          davEscape(token),
+		davName(nsCS, "getctag"):                              davEscape(token),
+		davName(nsCalDAV, "supported-calendar-component-set"): `<cal:comp name="VTODO"/>`,
+		davName(nsDAV, "supported-report-set"): "<d:supported-report><d:report><cal:calendar-query/></d:report></d:supported-report>" +
+			"<d:supported-report><d:report><cal:calendar-multiget/></d:report></d:supported-report>" +
+			"<d:supported-report><d:report><d:sync-collection/></d:report></d:supported-report>",
+	}, nil
+}
+
+// davCollections - the inbox and the projects the user owns or collaborates on, by name
+func (handler *TasksHandler) davCollections(ctx context.Context, user model.User) ([]davCollection, error) {
+	cur, err := handler.projectsColl.Find(ctx,
+		bson.M{"$or": []bson.M{{"user_id": user.ID}, {"collaborators.user_id": user.ID}}},
+		options.Find().SetSort(bson.M{"name": 1}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var projects []model.Project
+	if err := cur.All(ctx, &projects); err != nil {
+		return nil, err
+	}
+
+	collections := []davCollection{{key: davInbox, name: "Inbox", role: model.RoleOwner}}
+	for i := range projects {
+		collections = append(collections, projectCollection(&projects[i], user.ID))
+	}
+	return collections, nil
+}
+
+func projectCollection(project *model.Project, userID primitive.ObjectID) davCollection {
+	col := davCollection{key: project.ID.Hex(), name: project.Name, project: project, role: model.RoleOwner}
+	if project.UserID != userID {
+		col.role = model.RoleViewer
+		for _, collaborator := range project.Collaborators {
+			if collaborator.UserID == userID && col.role != model.RoleEditor {
+				col.role = collaborator.Role
+			}
+		}
+	}
+	return col
+}
+
+// davCollectionFromPath - the calendar the target is in, responding with 404 when the user can't see it
+func (handler *TasksHandler) davCollectionFromPath(ctx context.Context, c *gin.Context, user model.User, target davTarget) (davCollection, bool) {
+	if target.collection == davInbox {
+		return davCollection{key: davInbox, name: "Inbox", role: model.RoleOwner}, true
+	}
+
+	projectID, err := primitive.ObjectIDFromHex(target.collection)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "calendar not found"})
+		return davCollection{}, false
+	}
+
+	var project model.Project
+	err = handler.projectsColl.FindOne(ctx, bson.M{
+		"_id": projectID,
+		"$or": []bson.M{{"user_id": user.ID}, {"collaborators.user_id": user.ID}},
+	}).Decode(&project)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "calendar not found"})
+		return davCollection{}, false
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return davCollection{}, false
+	}
+	return projectCollection(&project, user.ID), true
+}
+
+// davSyncToken - the sync token (and ctag) of the collection, made of the time of its last change
+func (handler *TasksHandler) davSyncToken(ctx context.Context, col davCollection, userID primitive.ObjectID) (string, error) {
+	var last model.Task
+	err := handler.tasksColl.FindOne(ctx, col.filter(userID), options.FindOne().SetSort(bson.M{"updated_at": -1})).Decode(&last)
+	if err == mongo.ErrNoDocuments {
+		return syncTokenPrefix + "0", nil
+	} else if err != nil {
+		return "", err
+	}
+	return syncTokenPrefix + strconv.FormatInt(last.UpdatedAt.UnixMilli(), 10), nil
+}
+
+// parseSyncToken - the time of a sync token. Tokens from before the trash retention period are refused, tasks
+// deleted since then may have been purged without a trace. The token of an empty calendar stays valid, its
+// clients knew no task which could have been purged.
+func parseSyncToken(token string) (time.Time, bool) {
+	millis, ok := strings.CutPrefix(token, syncTokenPrefix)
+	if !ok {
+		return time.Time{}, false
+	}
+	n, err := strconv.ParseInt(millis, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	since := time.UnixMilli(n)
+	if n != 0 && time.Since(since) > trashRetention() {
+		return time.Time{}, false
+	}
+	return since, true
+}
+
+// davMovedOut - the tasks which were moved out of the collection after since and aren't among its changed
+// tasks, the ones moved back are
+func (handler *TasksHandler) davMovedOut(ctx context.Context, col davCollection, userID primitive.ObjectID, since time.Time, changed []model.Task) ([]model.Task, error) {
+	filter := bson.M{
+		"task_updated_at": bson.M{"$gt": since},
+		"changes":         bson.M{"$elemMatch": bson.M{"field": "project_id", "old": nil}},
+	}
+	if col.project == nil {
+		filter["user_id"] = userID
+	} else {
+		filter["changes"] = bson.M{"$elemMatch": bson.M{"field": "project_id", "old": col.project.ID}}
+	}
+
+	taskIDs, err := handler.eventsColl.Distinct(ctx, "task_id", filter)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]primitive.ObjectID, 0, len(taskIDs))
+	for _, value := range taskIDs {
+		id, ok := value.(primitive.ObjectID)
+		if !ok || slices.ContainsFunc(changed, func(task model.Task) bool { return task.ID == id }) {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	return handler.davTasks(ctx, bson.M{"_id": bson.M{"$in": ids}})
+}
+
+func (handler *TasksHandler) davTasks(ctx context.Context, filter bson.M) ([]model.Task, error) {
+	cur, err := handler.tasksColl.Find(ctx, filter, options.Find().SetSort(bson.M{"rank": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	tasks := make([]model.Task, 0)
+	if err := cur.All(ctx, &tasks); err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+// davTask - the task of the collection with the resource name, mongo.ErrNoDocuments when there is none
+func (handler *TasksHandler) davTask(ctx context.Context, col davCollection, userID primitive.ObjectID, name string) (model.Task, error) {
+	names := []bson.M{{"caldav.name": name}}
+	if id, err := primitive.ObjectIDFromHex(strings.TrimSuffix(name, ".ics")); err == nil {
+		names = append(names, bson.M{"_id": id, "caldav": bson.M{"$exists": false}})
+	}
+
+	var task model.Task
+	filter := activeTask(col.filter(userID))
+	filter["$and"] = []bson.M{{"$or": names}}
+	err := handler.tasksColl.FindOne(ctx, filter).Decode(&task)
+	return task, err
+}
+
+// davTaskByUID - the task with the UID among the ones the user can see, mongo.ErrNoDocuments when there is none
+func (handler *TasksHandler) davTaskByUID(ctx context.Context, userID primitive.ObjectID, uid string) (model.Task, error) {
+	uids := []bson.M{{"caldav.uid": uid}}
+	if hex, ok := strings.CutSuffix(uid, icalUIDSuffix); ok {
+		if id, err := primitive.ObjectIDFromHex(hex); err == nil {
+			uids = append(uids, bson.M{"_id": id, "caldav": bson.M{"$exists": false}})
+		}
+	}
+
+	var task model.Task
+	filter, err := visibleTasksFilter(ctx, handler.projectsColl, userID)
+	if err != nil {
+		return task, err
+	}
+	filter["$and"] = []bson.M{{"$or": uids}}
+	err = handler.tasksColl.FindOne(ctx, filter).Decode(&task)
+	return task, err
+}
+
+// davTaskFromHref - the task of the collection an href of a multiget points at
+func (handler *TasksHandler) davTaskFromHref(ctx context.Context, col davCollection, userID primitive.ObjectID, href string) (model.Task, error) {
+	u, err := url.Parse(href)
+	if err != nil || path.Dir(u.Path)+"/" != col.href() {
+		return model.Task{}, mongo.ErrNoDocuments
+	}
+	return handler.davTask(ctx, col, userID, path.Base(u.Path))
+}
+
+// davTaskFromPath - the task the request path points at, responding with 405 for collections and 404 when
+// there is no such task
+func (handler *TasksHandler) davTaskFromPath(ctx context.Context, c *gin.Context, user model.User) (model.Task, davCollection, bool) {
+	target, ok := parseDAVPath(c.Param("path"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return model.Task{}, davCollection{}, false
+	}
+	if target.kind != davTargetResource {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "not a calendar object"})
+		return model.Task{}, davCollection{}, false
+	}
+
+	col, ok := handler.davCollectionFromPath(ctx, c, user, target)
+	if !ok {
+		return model.Task{}, col, false
+	}
+
+	task, err := handler.davTask(ctx, col, user.ID, target.name)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "task not found"})
+		return task, col, false
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return task, col, false
+	}
+	return task, col, true
+}
+
+// parentUIDs - the UIDs of the parents of the tasks, by task ID
+func (handler *TasksHandler) parentUIDs(ctx context.Context, tasks []model.Task) (map[primitive.ObjectID]string, error) {
+	uids := make(map[primitive.ObjectID]string)
+	var parentIDs []primitive.ObjectID
+	for _, task := range tasks {
+		if task.ParentID != nil {
+			parentIDs = append(parentIDs, *task.ParentID)
+		}
+	}
+	if len(parentIDs) == 0 {
+		return uids, nil
+	}
+
+	parents, err := handler.davTasks(ctx, bson.M{"_id": bson.M{"$in": parentIDs}})
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[primitive.ObjectID]string, len(parents))
+	for _, parent := range parents {
+		byID[parent.ID] = icalUID(parent)
+	}
+	for _, task := range tasks {
+		if task.ParentID != nil {
+			if uid, ok := byID[*task.ParentID]; ok {
+				uids[task.ID] = uid
+			}
+		}
+	}
+	return uids, nil
+}
+
+func resourceProps(task model.Task, parents map[primitive.ObjectID]string, withData bool) davProps {
+	props := davProps{
+		davName(nsDAV, "getetag"):        davEscape(taskETag(task)),
+		davName(nsDAV, "getcontenttype"): "text/calendar; charset=utf-8; component=VTODO",
+		davName(nsDAV, "resourcetype"):   "",
+	}
+	if withData {
+		props[davName(nsCalDAV, "calendar-data")] = davEscape(string(calendarData(task, parents[task.ID])))
+	}
+	return props
+}
+
+func containsXMLName(names []xml.Name, name xml.Name) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,296 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/utpal74/track-my-tasks-backend/ical"
+	"github.com/utpal74/track-my-tasks-backend/model"
+	"github.com/utpal74/track-my-tasks-backend/tenant"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// How long calendar apps may reuse a feed before fetching it again
+	calendarFeedMaxAge = 15 * time.Minute
+	// Length of events for tasks without an estimate
+	defaultEventDuration = 30 * time.Minute
+)
+
+type CalendarHandler struct {
+	ctx            context.Context
+	feedsColl      *mongo.Collection
+	workspacesColl *mongo.Collection
+	tasksColl      *tenant.Collection
+	projectsColl   *tenant.Collection
+	usersColl      *mongo.Collection
+}
+
+func NewCalendarHandler(ctx context.Context, feedsColl *mongo.Collection, workspacesColl *mongo.Collection, tasksColl *tenant.Collection, projectsColl *tenant.Collection, usersColl *mongo.Collection) *CalendarHandler {
+	return &CalendarHandler{
+		ctx:            ctx,
+		feedsColl:      feedsColl,
+		workspacesColl: workspacesColl,
+		tasksColl:      tasksColl,
+		projectsColl:   projectsColl,
+		usersColl:      usersColl,
+	}
+}
+
+// GetCalendarFeedHandler - the calendar feed of the user in the workspace, without its URL
+func (handler *CalendarHandler) GetCalendarFeedHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	user, ok := currentUser(ctx, c, handler.usersColl)
+	if !ok {
+		return
+	}
+
+	var feed model.CalendarFeed
+	err := handler.feedsColl.FindOne(ctx, bson.M{"user_id": user.ID, "workspace_id": workspaceID(ctx)}).Decode(&feed)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no calendar feed"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, feed)
+}
+
+// RotateCalendarFeedHandler - create the calendar feed of the user in the workspace, or give it a new token so
+// the old URL stops working. The URL is only returned here.
+func (handler *CalendarHandler) RotateCalendarFeedHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	user, ok := currentUser(ctx, c, handler.usersColl)
+	if !ok {
+		return
+	}
+
+	token, err := newSecretToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "unable to create token: " + err.Error()})
+		return
+	}
+
+	var feed model.CalendarFeed
+	err = handler.feedsColl.FindOneAndUpdate(ctx,
+		bson.M{"user_id": user.ID, "workspace_id": workspaceID(ctx)},
+		bson.M{
+			"$set":         bson.M{"token_hash": hashToken(token), "created_at": time.Now()},
+			"$setOnInsert": bson.M{"_id": primitive.NewObjectID()},
+		},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&feed)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"feed": feed, "url": "/ical/" + token + ".ics"})
+}
+
+// DeleteCalendarFeedHandler - turn the calendar feed of the user in the workspace off
+func (handler *CalendarHandler) DeleteCalendarFeedHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	user, ok := currentUser(ctx, c, handler.usersColl)
+	if !ok {
+		return
+	}
+
+	res, err := handler.feedsColl.DeleteOne(ctx, bson.M{"user_id": user.ID, "workspace_id": workspaceID(ctx)})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if res.DeletedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no calendar feed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Calendar feed deleted"})
+}
+
+// CalendarFeedHandler - the tasks with a due date visible to the owner of the feed, as an iCalendar document.
+// Public, the token in the path is the secret. Query parameters: project (ids) and label keep the matching tasks,
+// done=false leaves out completed ones and type=todo renders VTODOs instead of VEVENTs.
+func (handler *CalendarHandler) CalendarFeedHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	token := strings.TrimSuffix(c.Param("token"), ".ics")
+
+	var feed model.CalendarFeed
+	err := handler.feedsColl.FindOne(ctx, bson.M{"token_hash": hashToken(token)}).Decode(&feed)
+	if err == mongo.ErrNoDocuments {
+		c.String(http.StatusNotFound, "calendar not found")
+		return
+	} else if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// The feed stops working once its owner leaves the workspace
+	var workspace model.Workspace
+	err = handler.workspacesColl.FindOne(ctx, bson.M{"_id": feed.WorkspaceID}).Decode(&workspace)
+	if err == mongo.ErrNoDocuments {
+		c.String(http.StatusNotFound, "calendar not found")
+		return
+	} else if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	if _, member := workspace.Member(feed.UserID); !member {
+		c.String(http.StatusNotFound, "calendar not found")
+		return
+	}
+	ctx = tenant.WithWorkspace(ctx, workspace)
+
+	filter, err := visibleTasksFilter(ctx, handler.projectsColl, feed.UserID)
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	filter["due_date"] = bson.M{"$ne": nil}
+	if c.Query("done") == "false" {
+		filter["done"] = false
+	}
+	if projects := c.QueryArray("project"); len(projects) > 0 {
+		projectIDs := make([]primitive.ObjectID, 0, len(projects))
+		for _, project := range projects {
+			projectID, err := primitive.ObjectIDFromHex(project)
+			if err != nil {
+				c.String(http.StatusBadRequest, "invalid project id")
+				return
+			}
+			projectIDs = append(projectIDs, projectID)
+		}
+		filter["project_id"] = bson.M{"$in": projectIDs}
+	}
+
+	cursor, err := handler.tasksColl.Find(ctx, filter, options.Find().SetSort(bson.M{"due_date": 1}))
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	var tasks []model.Task
+	if err := cursor.All(ctx, &tasks); err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	kind := ical.KindEvent
+	if c.Query("type") == "todo" {
+		kind = ical.KindTodo
+	}
+	labels := c.QueryArray("label")
+
+	cal := ical.Calendar{ProdID: "-//track-my-tasks//tasks feed//EN", Name: "Tasks (" + workspace.Name + ")"}
+	lastModified := feed.CreatedAt
+	for _, task := range tasks {
+		if len(labels) > 0 && !hasAnyLabel(task, labels) {
+			continue
+		}
+		cal.Components = append(cal.Components, taskComponent(task, kind))
+		if task.UpdatedAt.After(lastModified) {
+			lastModified = task.UpdatedAt
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := ical.Write(&buf, cal); err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Tasks leaving the feed don't move Last-Modified, so only the ETag is used to answer 304
+	sum := sha256.Sum256(buf.Bytes())
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	c.Header("ETag", etag)
+	c.Header("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	c.Header("Cache-Control", "private, max-age="+strconv.Itoa(int(calendarFeedMaxAge.Seconds())))
+	if strings.Contains(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	c.Header("Content-Disposition", `inline; filename="tasks.ics"`)
+	c.Data(http.StatusOK, "text/calendar; charset=utf-8", buf.Bytes())
+}
+
+// taskComponent - a task as a to-do due at its due date, or as an event lasting its estimate.
+// Tasks due at midnight UTC have no time of day and become all-day entries, to-dos may have no due date.
+func taskComponent(task model.Task, kind string) ical.Component {
+	component := ical.Component{
+		Kind:         kind,
+		UID:          icalUID(task),
+		Summary:      task.Title,
+		Description:  task.Comment,
+		Duration:     defaultEventDuration,
+		Categories:   task.Labels,
+		Priority:     icalPriority(task.Priority),
+		Created:      task.CreatedAt,
+		LastModified: task.UpdatedAt,
+	}
+	if task.DueDate != nil {
+		due := task.DueDate.UTC()
+		component.Start = due
+		component.AllDay = due.Equal(due.Truncate(24 * time.Hour))
+	}
+	if task.Estimate > 0 {
+		component.Duration = time.Duration(task.Estimate) * time.Minute
+	}
+	if task.Recurrence != nil {
+		component.RRule = task.Recurrence.RRule()
+	}
+	if task.Done {
+		// Events have no completion, the title says it
+		if kind == ical.KindTodo {
+			completed := task.UpdatedAt
+			component.Completed = &completed
+		} else {
+			component.Summary = "✓ " + component.Summary
+		}
+	}
+	return component
+}
+
+// icalPriority - maps a priority to the 1 (highest) to 9 scale of RFC 5545, 0 is undefined
+func icalPriority(priority string) int {
+	switch priority {
+	case model.PriorityUrgent:
+		return 1
+	case model.PriorityHigh:
+		return 3
+	case model.PriorityMedium:
+		return 5
+	case model.PriorityLow:
+		return 7
+	}
+	return 0
+}
+
+func hasAnyLabel(task model.Task, labels []string) bool {
+	for _, label := range labels {
+		if hasLabel(task, label) {
+			return true
+		}
+	}
+	return false
+}
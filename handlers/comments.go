@@ -0,0 +1,325 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/utpal74/track-my-tasks-backend/markdown"
+	"github.com/utpal74/track-my-tasks-backend/model"
+	"github.com/utpal74/track-my-tasks-backend/tenant"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	defaultCommentsPageSize = 20
+	maxCommentsPageSize     = 100
+	maxCommentLength        = 10000
+)
+
+type CommentsHandler struct {
+	ctx          context.Context
+	commentsColl *mongo.Collection
+	tasksColl    *tenant.Collection
+	projectsColl *tenant.Collection
+	usersColl    *mongo.Collection
+	redisClient  *redis.Client
+}
+
+func NewCommentsHandler(ctx context.Context, commentsColl *mongo.Collection, tasksColl *tenant.Collection, projectsColl *tenant.Collection, usersColl *mongo.Collection, redisClient *redis.Client) *CommentsHandler {
+	return &CommentsHandler{
+		ctx:          ctx,
+		commentsColl: commentsColl,
+		tasksColl:    tasksColl,
+		projectsColl: projectsColl,
+		usersColl:    usersColl,
+		redisClient:  redisClient,
+	}
+}
+
+type commentRequest struct {
+	Body string `json:"body" binding:"required"`
+}
+
+// GetCommentsHandler - list the comments of a task, oldest first, paginated with page and limit
+func (handler *CommentsHandler) GetCommentsHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	user, ok := currentUser(ctx, c, handler.usersColl)
+	if !ok {
+		return
+	}
+
+	task, ok := taskFromPath(ctx, c, handler.tasksColl, handler.projectsColl, user)
+	if !ok {
+		return
+	}
+
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid page"})
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultCommentsPageSize)))
+	if err != nil || limit < 1 || limit > maxCommentsPageSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+		return
+	}
+
+	filter := bson.M{"task_id": task.ID}
+	total, err := handler.commentsColl.CountDocuments(ctx, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	cur, err := handler.commentsColl.Find(ctx, filter, options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}).
+		SetSkip(int64((page-1)*limit)).
+		SetLimit(int64(limit)))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer cur.Close(ctx)
+
+	comments := make([]model.Comment, 0)
+	if err := cur.All(ctx, &comments); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to decode comments"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"comments": comments, "page": page, "limit": limit, "total": total})
+}
+
+// NewCommentHandler - add a comment to a task
+func (handler *CommentsHandler) NewCommentHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	var req commentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !validCommentBody(c, req.Body) {
+		return
+	}
+
+	user, ok := currentUser(ctx, c, handler.usersColl)
+	if !ok {
+		return
+	}
+
+	task, ok := taskFromPath(ctx, c, handler.tasksColl, handler.projectsColl, user)
+	if !ok {
+		return
+	}
+
+	mentions, err := handler.resolveMentions(ctx, task, req.Body)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := time.Now()
+	comment := model.Comment{
+		ID:        primitive.NewObjectID(),
+		TaskID:    task.ID,
+		AuthorID:  user.ID,
+		Author:    user.Username,
+		Body:      req.Body,
+		HTML:      markdown.Render(req.Body),
+		Mentions:  mentions,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	if _, err := handler.commentsColl.InsertOne(ctx, comment); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := handler.incrementCommentCount(ctx, task, 1); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update comment count: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, comment)
+}
+
+// UpdateCommentHandler - edit a comment, only allowed for its author
+func (handler *CommentsHandler) UpdateCommentHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	var req commentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !validCommentBody(c, req.Body) {
+		return
+	}
+
+	user, ok := currentUser(ctx, c, handler.usersColl)
+	if !ok {
+		return
+	}
+
+	task, ok := taskFromPath(ctx, c, handler.tasksColl, handler.projectsColl, user)
+	if !ok {
+		return
+	}
+
+	comment, ok := handler.authoredComment(ctx, c, user, task)
+	if !ok {
+		return
+	}
+
+	mentions, err := handler.resolveMentions(ctx, task, req.Body)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	comment.Body = req.Body
+	comment.HTML = markdown.Render(req.Body)
+	comment.Mentions = mentions
+	comment.Edited = true
+	comment.UpdatedAt = time.Now()
+
+	_, err = handler.commentsColl.UpdateOne(ctx, bson.M{"_id": comment.ID}, bson.M{"$set": bson.M{
+		"body":       comment.Body,
+		"html":       comment.HTML,
+		"mentions":   comment.Mentions,
+		"edited":     comment.Edited,
+		"updated_at": comment.UpdatedAt,
+	}})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "unable to update: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, comment)
+}
+
+// DeleteCommentHandler - delete a comment, only allowed for its author
+func (handler *CommentsHandler) DeleteCommentHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	user, ok := currentUser(ctx, c, handler.usersColl)
+	if !ok {
+		return
+	}
+
+	task, ok := taskFromPath(ctx, c, handler.tasksColl, handler.projectsColl, user)
+	if !ok {
+		return
+	}
+
+	comment, ok := handler.authoredComment(ctx, c, user, task)
+	if !ok {
+		return
+	}
+
+	if _, err := handler.commentsColl.DeleteOne(ctx, bson.M{"_id": comment.ID}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := handler.incrementCommentCount(ctx, task, -1); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update comment count: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Comment deleted", "id": comment.ID})
+}
+
+// DeleteTaskComments - purge hook, removes every comment of a permanently deleted task
+func (handler *CommentsHandler) DeleteTaskComments(ctx context.Context, task model.Task) error {
+	_, err := handler.commentsColl.DeleteMany(ctx, bson.M{"task_id": task.ID})
+	return err
+}
+
+// authoredComment - loads the comment in the path, responding with 403 unless the user wrote it
+func (handler *CommentsHandler) authoredComment(ctx context.Context, c *gin.Context, user model.User, task model.Task) (model.Comment, bool) {
+	var comment model.Comment
+	commentID, err := primitive.ObjectIDFromHex(c.Param("commentId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid comment id format"})
+		return comment, false
+	}
+
+	if err := handler.commentsColl.FindOne(ctx, bson.M{"_id": commentID, "task_id": task.ID}).Decode(&comment); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "comment not found"})
+		return comment, false
+	}
+
+	if comment.AuthorID != user.ID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only the author can change a comment"})
+		return comment, false
+	}
+	return comment, true
+}
+
+// resolveMentions - keeps the @mentions of users who have access to the task
+func (handler *CommentsHandler) resolveMentions(ctx context.Context, task model.Task, body string) ([]string, error) {
+	members, err := taskMemberNames(ctx, handler.usersColl, handler.projectsColl, task)
+	if err != nil {
+		return nil, err
+	}
+
+	allowed := make(map[string]bool, len(members))
+	for _, member := range members {
+		allowed[member] = true
+	}
+
+	mentions := make([]string, 0)
+	for _, name := range markdown.Mentions(body) {
+		if allowed[name] {
+			mentions = append(mentions, name)
+		}
+	}
+	return mentions, nil
+}
+
+// incrementCommentCount - keeps the comment count on the task in sync, in both collections
+func (handler *CommentsHandler) incrementCommentCount(ctx context.Context, task model.Task, delta int) error {
+	if _, err := handler.tasksColl.UpdateOne(ctx, bson.M{"_id": task.ID}, bson.M{"$inc": bson.M{"comment_count": delta}}); err != nil {
+		return err
+	}
+
+	_, err := handler.usersColl.UpdateOne(ctx, bson.M{"_id": task.UserID, "task._id": task.ID},
+		bson.M{"$inc": bson.M{"task.$.comment_count": delta}})
+	if err != nil {
+		return err
+	}
+
+	invalidateMemberCaches(ctx, handler.redisClient, handler.projectsColl, task)
+	return nil
+}
+
+func validCommentBody(c *gin.Context, body string) bool {
+	if strings.TrimSpace(body) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "comment body is required"})
+		return false
+	}
+	if len(body) > maxCommentLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "comment body is too long"})
+		return false
+	}
+	return true
+}
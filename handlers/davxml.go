@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// XML namespaces of WebDAV, CalDAV and the CalendarServer extensions (getctag)
+const (
+	nsDAV    = "DAV:"
+	nsCalDAV = "urn:ietf:params:xml:ns:caldav"
+	nsCS     = "http://calendarserver.org/ns/"
+)
+
+var davPrefixes = map[string]string{nsDAV: "d", nsCalDAV: "cal", nsCS: "cs"}
+
+// davProps - property values of a resource as XML fragments
+type davProps map[xml.Name]string
+
+func davName(space, local string) xml.Name {
+	return xml.Name{Space: space, Local: local}
+}
+
+type davAnyElement struct {
+	XMLName xml.Name
+}
+
+type davPropList struct {
+	Names []davAnyElement `xml:",any"`
+}
+
+// davPropfind - the body of a PROPFIND, an empty body asks for all properties
+type davPropfind struct {
+	AllProp *struct{}    `xml:"DAV: allprop"`
+	Prop    *davPropList `xml:"DAV: prop"`
+}
+
+// davReport - the body of the REPORTs we support, told apart by XMLName
+type davReport struct {
+	XMLName   xml.Name
+	Prop      *davPropList `xml:"DAV: prop"`
+	Hrefs     []string     `xml:"DAV: href"`
+	SyncToken string       `xml:"DAV: sync-token"`
+	Filter    struct {
+		Comp struct {
+			Name  string `xml:"name,attr"`
+			Comps []struct {
+				Name string `xml:"name,attr"`
+			} `xml:"urn:ietf:params:xml:ns:caldav comp-filter"`
+		} `xml:"urn:ietf:params:xml:ns:caldav comp-filter"`
+	} `xml:"urn:ietf:params:xml:ns:caldav filter"`
+}
+
+// requested - the names of the properties asked for, nil for all of them
+func (list *davPropList) requested() []xml.Name {
+	if list == nil {
+		return nil
+	}
+	names := make([]xml.Name, 0, len(list.Names))
+	for _, element := range list.Names {
+		names = append(names, element.XMLName)
+	}
+	return names
+}
+
+// readDAVBody - decodes an XML request body into v, an empty body leaves v as it is
+func readDAVBody(c *gin.Context, v interface{}) error {
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(string(body)) == "" {
+		return nil
+	}
+	return xml.Unmarshal(body, v)
+}
+
+// davMultistatus - builds a 207 Multi-Status response
+type davMultistatus struct {
+	b strings.Builder
+}
+
+func newDAVMultistatus() *davMultistatus {
+	m := &davMultistatus{}
+	m.b.WriteString(`<?xml version="1.0" encoding="utf-8"?>` + "\n")
+	m.b.WriteString(`<d:multistatus xmlns:d="DAV:" xmlns:cal="urn:ietf:params:xml:ns:caldav" xmlns:cs="http://calendarserver.org/ns/">`)
+	return m
+}
+
+// add - a response for href with the requested properties (all available ones when requested is nil).
+// Requested properties the resource doesn't have are listed as not found.
+func (m *davMultistatus) add(href string, props davProps, requested []xml.Name) {
+	found := make([]xml.Name, 0, len(props))
+	var missing []xml.Name
+	if requested == nil {
+		for name := range props {
+			found = append(found, name)
+		}
+	} else {
+		for _, name := range requested {
+			if _, ok := props[name]; ok {
+				found = append(found, name)
+			} else {
+				missing = append(missing, name)
+			}
+		}
+	}
+
+	m.b.WriteString("<d:response><d:href>" + davEscape(href) + "</d:href>")
+	if len(found) > 0 {
+		m.b.WriteString("<d:propstat><d:prop>")
+		for _, name := range found {
+			m.b.WriteString(davElement(name, props[name]))
+		}
+		m.b.WriteString("</d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat>")
+	}
+	if len(missing) > 0 {
+		m.b.WriteString("<d:propstat><d:prop>")
+		for _, name := range missing {
+			m.b.WriteString(davElement(name, ""))
+		}
+		m.b.WriteString("</d:prop><d:status>HTTP/1.1 404 Not Found</d:status></d:propstat>")
+	}
+	m.b.WriteString("</d:response>")
+}
+
+// gone - a response for a member which was removed, for sync-collection reports
+func (m *davMultistatus) gone(href string) {
+	m.b.WriteString("<d:response><d:href>" + davEscape(href) + "</d:href><d:status>HTTP/1.1 404 Not Found</d:status></d:response>")
+}
+
+func (m *davMultistatus) syncToken(token string) {
+	m.b.WriteString("<d:sync-token>" + davEscape(token) + "</d:sync-token>")
+}
+
+func (m *davMultistatus) write(c *gin.Context) {
+	m.b.WriteString("</d:multistatus>")
+	c.Data(http.StatusMultiStatus, "application/xml; charset=utf-8", []byte(m.b.String()))
+}
+
+// davElement - the property element, with its own namespace declaration when the namespace has no prefix
+func davElement(name xml.Name, inner string) string {
+	tag, declaration := name.Local, ""
+	if prefix, ok := davPrefixes[name.Space]; ok {
+		tag = prefix + ":" + name.Local
+	} else if name.Space != "" {
+		tag = "x:" + name.Local
+		declaration = ` xmlns:x="` + davEscape(name.Space) + `"`
+	}
+	if inner == "" {
+		return "<" + tag + declaration + "/>"
+	}
+	return "<" + tag + declaration + ">" + inner + "</" + tag + ">"
+}
+
+// davHref - an href property value
+func davHref(href string) string {
+	return "<d:href>" + davEscape(href) + "</d:href>"
+}
+
+func davEscape(value string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(value))
+	return b.String()
+}
+
+// davError - a failed precondition (RFC 4918 section 16), such as valid-sync-token
+func davError(c *gin.Context, status int, space, precondition string) {
+	body := `<?xml version="1.0" encoding="utf-8"?>` + "\n" +
+		`<d:error xmlns:d="DAV:" xmlns:cal="urn:ietf:params:xml:ns:caldav">` + davElement(davName(space, precondition), "") + `</d:error>`
+	c.Data(status, "application/xml; charset=utf-8", []byte(body))
+}
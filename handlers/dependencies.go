@@ -0,0 +1,438 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/utpal74/track-my-tasks-backend/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type dependencyRequest struct {
+	BlockedBy string `json:"blocked_by" binding:"required"`
+}
+
+// AddDependencyHandler - mark the task in the path as blocked by another task the user can see
+func (handler *TasksHandler) AddDependencyHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	user, ok := handler.currentUser(ctx, c)
+	if !ok {
+		return
+	}
+
+	taskID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id format"})
+		return
+	}
+
+	var req dependencyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	blockerID, err := primitive.ObjectIDFromHex(req.BlockedBy)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid blocked_by id format"})
+		return
+	}
+
+	if blockerID == taskID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "a task cannot block itself"})
+		return
+	}
+
+	var task model.Task
+	if err := handler.tasksColl.FindOne(ctx, activeTask(bson.M{"_id": taskID, "user_id": user.ID})).Decode(&task); err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "task not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The blocker may be any task the user can see, shared ones included
+	if _, err := loadAccessibleTask(ctx, handler.tasksColl, handler.projectsColl, user.ID, blockerID); err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "task not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Held until the edge is written, so that two additions can't both pass the cycle check
+	unlock, err := handler.lockDependencies(ctx)
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "dependencies are being changed, try again"})
+		return
+	}
+	defer unlock()
+
+	// The new edge closes a cycle when the blocker already (transitively) waits on the task
+	cycle, err := handler.blockerReaches(ctx, blockerID, taskID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if cycle {
+		c.JSON(http.StatusConflict, gin.H{"error": "dependency would create a cycle"})
+		return
+	}
+
+	before, err := handler.taskSnapshot(ctx, taskID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := time.Now()
+	err = handler.commitChange(ctx, c, model.TaskActionDependency, taskID, before, func(ctx context.Context) error {
+		_, err := handler.tasksColl.UpdateOne(ctx, bson.M{"_id": taskID, "user_id": user.ID}, bson.M{
+			"$addToSet": bson.M{"blocked_by": blockerID},
+			"$set":      bson.M{"updated_at": now},
+		})
+		if err != nil {
+			return fmt.Errorf("unable to add dependency: %w", err)
+		}
+
+		_, err = handler.usersColl.UpdateOne(ctx, bson.M{"_id": user.ID, "task._id": taskID}, bson.M{
+			"$addToSet": bson.M{"task.$.blocked_by": blockerID},
+			"$set":      bson.M{"task.$.updated_at": now},
+		})
+		if err != nil {
+			return fmt.Errorf("Failed to update task in user collection: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	handler.invalidateTaskCaches(ctx, taskID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "dependency added", "task_id": taskID, "blocked_by": blockerID})
+}
+
+// RemoveDependencyHandler - remove a blocker from the task in the path
+func (handler *TasksHandler) RemoveDependencyHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	user, ok := handler.currentUser(ctx, c)
+	if !ok {
+		return
+	}
+
+	taskID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id format"})
+		return
+	}
+
+	blockerID, err := primitive.ObjectIDFromHex(c.Param("blockerId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid blocker id format"})
+		return
+	}
+
+	before, err := handler.taskSnapshot(ctx, taskID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := time.Now()
+	found := false
+	err = handler.commitChange(ctx, c, model.TaskActionDependency, taskID, before, func(ctx context.Context) error {
+		result, err := handler.tasksColl.UpdateOne(ctx, bson.M{"_id": taskID, "user_id": user.ID, "blocked_by": blockerID}, bson.M{
+			"$pull": bson.M{"blocked_by": blockerID},
+			"$set":  bson.M{"updated_at": now},
+		})
+		if err != nil {
+			return fmt.Errorf("unable to remove dependency: %w", err)
+		}
+		if found = result.MatchedCount > 0; !found {
+			return nil
+		}
+
+		_, err = handler.usersColl.UpdateOne(ctx, bson.M{"_id": user.ID, "task._id": taskID}, bson.M{
+			"$pull": bson.M{"task.$.blocked_by": blockerID},
+			"$set":  bson.M{"task.$.updated_at": now},
+		})
+		if err != nil {
+			return fmt.Errorf("Failed to update task in user collection: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "dependency not found"})
+		return
+	}
+
+	handler.invalidateTaskCaches(ctx, taskID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "dependency removed", "task_id": taskID, "blocked_by": blockerID})
+}
+
+// PlanHandler - returns the user's open tasks sorted so that every blocker comes before the tasks it blocks
+func (handler *TasksHandler) PlanHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	user, ok := handler.currentUser(ctx, c)
+	if !ok {
+		return
+	}
+
+	tasks, err := handler.loadUserTasks(ctx, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	markBlocked(tasks)
+	fillLegacyStatus(tasks)
+
+	plan, ok := newDependencyGraph(tasks).plan()
+	if !ok {
+		c.JSON(http.StatusConflict, gin.H{"error": "task dependencies contain a cycle"})
+		return
+	}
+
+	c.JSON(http.StatusOK, plan)
+}
+
+// openBlockers - returns the ids of the blockers of the given task which are not done yet
+func (handler *TasksHandler) openBlockers(ctx context.Context, taskID primitive.ObjectID) ([]primitive.ObjectID, error) {
+	var task model.Task
+	if err := handler.tasksColl.FindOne(ctx, activeTask(bson.M{"_id": taskID})).Decode(&task); err != nil {
+		return nil, err
+	}
+
+	openIDs := make([]primitive.ObjectID, 0)
+	if len(task.BlockedBy) == 0 {
+		return openIDs, nil
+	}
+
+	cur, err := handler.tasksColl.Find(ctx, activeTask(bson.M{"_id": bson.M{"$in": task.BlockedBy}, "done": false}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var blockers []model.Task
+	if err := cur.All(ctx, &blockers); err != nil {
+		return nil, err
+	}
+
+	for _, blocker := range blockers {
+		openIDs = append(openIDs, blocker.ID)
+	}
+	return openIDs, nil
+}
+
+// removeDependencyEdges - pulls a deleted task out of the blockers of every other task of the user
+func (handler *TasksHandler) removeDependencyEdges(ctx context.Context, userID, taskID primitive.ObjectID) error {
+	_, err := handler.tasksColl.UpdateMany(ctx,
+		bson.M{"user_id": userID, "blocked_by": taskID},
+		bson.M{"$pull": bson.M{"blocked_by": taskID}},
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = handler.usersColl.UpdateOne(ctx,
+		bson.M{"_id": userID},
+		bson.M{"$pull": bson.M{"task.$[].blocked_by": taskID}},
+	)
+	return err
+}
+
+// dependencyLockTTL - bounds how long a crashed request can hold the dependency lock of a workspace
+const dependencyLockTTL = 5 * time.Second
+
+// unlockScript - deletes the lock only while it still holds the token of the holder. KEYS[1] the lock, ARGV token.
+var unlockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// lockDependencies - takes the lock on the dependencies of the workspace, waiting for it as long as ctx allows.
+// Returns the function releasing it.
+func (handler *TasksHandler) lockDependencies(ctx context.Context) (func(), error) {
+	key := "dependencies-lock:" + workspaceID(ctx).Hex()
+	token := primitive.NewObjectID().Hex()
+	for {
+		locked, err := handler.redisClient.SetNX(ctx, key, token, dependencyLockTTL).Result()
+		if err != nil {
+			return nil, err
+		}
+		if locked {
+			return func() {
+				if err := unlockScript.Run(context.WithoutCancel(ctx), handler.redisClient, []string{key}, token).Err(); err != nil {
+					log.Printf("Failed to release %s: %v", key, err)
+				}
+			}, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
+
+// blockerReaches - reports whether "to" can be reached from "from" over the blocked_by edges of every task of the
+// workspace, whoever owns it and trashed ones included, loading the graph a level at a time
+func (handler *TasksHandler) blockerReaches(ctx context.Context, from, to primitive.ObjectID) (bool, error) {
+	graph := newDependencyGraph(nil)
+	queued := map[primitive.ObjectID]bool{from: true}
+	frontier := []primitive.ObjectID{from}
+	for len(frontier) > 0 {
+		cur, err := handler.tasksColl.Find(ctx, bson.M{"_id": bson.M{"$in": frontier}}, options.Find().SetProjection(bson.M{"blocked_by": 1}))
+		if err != nil {
+			return false, err
+		}
+		var tasks []model.Task
+		if err := cur.All(ctx, &tasks); err != nil {
+			return false, err
+		}
+
+		frontier = nil
+		for _, task := range tasks {
+			graph.tasks[task.ID] = task
+			for _, blockerID := range task.BlockedBy {
+				if !queued[blockerID] {
+					queued[blockerID] = true
+					frontier = append(frontier, blockerID)
+				}
+			}
+		}
+		if queued[to] {
+			break
+		}
+	}
+	return graph.reaches(from, to), nil
+}
+
+// markBlocked - sets the computed Blocked flag on every task which waits on an open task
+func markBlocked(tasks []model.Task) {
+	done := make(map[primitive.ObjectID]bool, len(tasks))
+	for _, task := range tasks {
+		done[task.ID] = task.Done
+	}
+
+	for i := range tasks {
+		tasks[i].Blocked = false
+		for _, blockerID := range tasks[i].BlockedBy {
+			if isDone, found := done[blockerID]; found && !isDone {
+				tasks[i].Blocked = true
+				break
+			}
+		}
+	}
+}
+
+// dependencyGraph - the "blocked by" relation between the tasks of a single user
+type dependencyGraph struct {
+	tasks map[primitive.ObjectID]model.Task
+}
+
+func newDependencyGraph(tasks []model.Task) *dependencyGraph {
+	graph := &dependencyGraph{tasks: make(map[primitive.ObjectID]model.Task, len(tasks))}
+	for _, task := range tasks {
+		graph.tasks[task.ID] = task
+	}
+	return graph
+}
+
+func (graph *dependencyGraph) has(id primitive.ObjectID) bool {
+	_, ok := graph.tasks[id]
+	return ok
+}
+
+// reaches - reports whether "to" can be reached from "from" by following blocked_by edges
+func (graph *dependencyGraph) reaches(from, to primitive.ObjectID) bool {
+	visited := make(map[primitive.ObjectID]bool)
+	stack := []primitive.ObjectID{from}
+	for len(stack) > 0 {
+		current := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if current == to {
+			return true
+		}
+		if visited[current] {
+			continue
+		}
+		visited[current] = true
+		stack = append(stack, graph.tasks[current].BlockedBy...)
+	}
+	return false
+}
+
+// plan - topologically sorts the open tasks (Kahn's algorithm), oldest first among tasks that are ready.
+// Returns false if the open tasks contain a cycle.
+func (graph *dependencyGraph) plan() ([]model.Task, bool) {
+	pending := make(map[primitive.ObjectID]int)
+	dependents := make(map[primitive.ObjectID][]primitive.ObjectID)
+	ready := make([]model.Task, 0)
+
+	for id, task := range graph.tasks {
+		if task.Done {
+			continue
+		}
+		for _, blockerID := range task.BlockedBy {
+			if blocker, ok := graph.tasks[blockerID]; ok && !blocker.Done {
+				pending[id]++
+				dependents[blockerID] = append(dependents[blockerID], id)
+			}
+		}
+		if pending[id] == 0 {
+			ready = append(ready, task)
+		}
+	}
+
+	plan := make([]model.Task, 0, len(graph.tasks))
+	for len(ready) > 0 {
+		sort.Slice(ready, func(i, j int) bool {
+			return ready[i].CreatedAt.Before(ready[j].CreatedAt)
+		})
+		next := ready[0]
+		ready = ready[1:]
+		plan = append(plan, next)
+
+		for _, dependentID := range dependents[next.ID] {
+			pending[dependentID]--
+			if pending[dependentID] == 0 {
+				ready = append(ready, graph.tasks[dependentID])
+			}
+		}
+	}
+
+	for id, task := range graph.tasks {
+		if !task.Done && pending[id] > 0 {
+			return plan, false
+		}
+	}
+	return plan, true
+}
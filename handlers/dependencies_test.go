@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/utpal74/track-my-tasks-backend/model"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// dependencyTasks - tasks named by their titles, created in the given order; edges maps a title to the titles
+// blocking it and done lists the finished ones
+func dependencyTasks(titles []string, edges map[string][]string, done ...string) []model.Task {
+	ids := make(map[string]primitive.ObjectID, len(titles))
+	for _, title := range titles {
+		ids[title] = primitive.NewObjectID()
+	}
+
+	created := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	tasks := make([]model.Task, 0, len(titles))
+	for i, title := range titles {
+		task := model.Task{ID: ids[title], Title: title, CreatedAt: created.Add(time.Duration(i) * time.Minute)}
+		for _, blocker := range edges[title] {
+			id, found := ids[blocker]
+			if !found {
+				id = primitive.NewObjectID()
+			}
+			task.BlockedBy = append(task.BlockedBy, id)
+		}
+		for _, finished := range done {
+			task.Done = task.Done || finished == title
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks
+}
+
+func taskTitles(tasks []model.Task) []string {
+	result := make([]string, 0, len(tasks))
+	for _, task := range tasks {
+		result = append(result, task.Title)
+	}
+	return result
+}
+
+func TestDependencyPlan(t *testing.T) {
+	tests := []struct {
+		name   string
+		titles []string
+		edges  map[string][]string
+		done   []string
+		want   []string
+		wantOK bool
+	}{
+		{
+			name:   "oldest first without dependencies",
+			titles: []string{"a", "b", "c"},
+			want:   []string{"a", "b", "c"},
+			wantOK: true,
+		},
+		{
+			name:   "blockers come first",
+			titles: []string{"a", "b", "c"},
+			edges:  map[string][]string{"a": {"c"}, "b": {"a"}},
+			want:   []string{"c", "a", "b"},
+			wantOK: true,
+		},
+		{
+			name:   "ready tasks stay in creation order",
+			titles: []string{"a", "b", "c", "d"},
+			edges:  map[string][]string{"b": {"d"}},
+			want:   []string{"a", "c", "d", "b"},
+			wantOK: true,
+		},
+		{
+			name:   "done tasks are left out and don't block",
+			titles: []string{"a", "b", "c"},
+			edges:  map[string][]string{"a": {"b"}},
+			done:   []string{"b"},
+			want:   []string{"a", "c"},
+			wantOK: true,
+		},
+		{
+			name:   "blockers outside of the graph are ignored",
+			titles: []string{"a", "b"},
+			edges:  map[string][]string{"a": {"elsewhere"}},
+			want:   []string{"a", "b"},
+			wantOK: true,
+		},
+		{
+			name:   "cycle",
+			titles: []string{"a", "b", "c"},
+			edges:  map[string][]string{"a": {"b"}, "b": {"a"}},
+			want:   []string{"c"},
+		},
+		{
+			name:   "cycle through a done task is broken",
+			titles: []string{"a", "b"},
+			edges:  map[string][]string{"a": {"b"}, "b": {"a"}},
+			done:   []string{"b"},
+			want:   []string{"a"},
+			wantOK: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan, ok := newDependencyGraph(dependencyTasks(tt.titles, tt.edges, tt.done...)).plan()
+			if got := taskTitles(plan); !reflect.DeepEqual(got, tt.want) || ok != tt.wantOK {
+				t.Errorf("plan() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestDependencyReaches(t *testing.T) {
+	tasks := dependencyTasks([]string{"a", "b", "c", "d"}, map[string][]string{"a": {"b"}, "b": {"c"}, "c": {"a"}})
+	ids := make(map[string]primitive.ObjectID, len(tasks))
+	for _, task := range tasks {
+		ids[task.Title] = task.ID
+	}
+	graph := newDependencyGraph(tasks)
+
+	tests := []struct {
+		from, to string
+		want     bool
+	}{
+		{from: "a", to: "b", want: true},
+		{from: "a", to: "c", want: true},
+		{from: "c", to: "b", want: true},
+		{from: "a", to: "a", want: true},
+		{from: "a", to: "d"},
+		{from: "d", to: "a"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.from+" to "+tt.to, func(t *testing.T) {
+			if got := graph.reaches(ids[tt.from], ids[tt.to]); got != tt.want {
+				t.Errorf("reaches(%s, %s) = %v, want %v", tt.from, tt.to, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMarkBlocked(t *testing.T) {
+	tests := []struct {
+		name  string
+		edges map[string][]string
+		done  []string
+		want  []string
+	}{
+		{name: "no dependencies"},
+		{name: "open blocker", edges: map[string][]string{"a": {"b"}}, want: []string{"a"}},
+		{name: "done blocker", edges: map[string][]string{"a": {"b"}}, done: []string{"b"}},
+		{name: "one of several blockers open", edges: map[string][]string{"a": {"b", "c"}}, done: []string{"b"}, want: []string{"a"}},
+		{name: "blocker outside of the list", edges: map[string][]string{"a": {"elsewhere"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tasks := dependencyTasks([]string{"a", "b", "c"}, tt.edges, tt.done...)
+			tasks[0].Blocked = tt.want == nil
+
+			markBlocked(tasks)
+			blocked := make([]string, 0)
+			for _, task := range tasks {
+				if task.Blocked {
+					blocked = append(blocked, task.Title)
+				}
+			}
+			if len(blocked) != len(tt.want) || (len(blocked) > 0 && !reflect.DeepEqual(blocked, tt.want)) {
+				t.Errorf("markBlocked() blocked %v, want %v", blocked, tt.want)
+			}
+		})
+	}
+}
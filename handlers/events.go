@@ -0,0 +1,304 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/utpal74/track-my-tasks-backend/domain"
+	"github.com/utpal74/track-my-tasks-backend/model"
+	"github.com/utpal74/track-my-tasks-backend/realtime"
+	"github.com/utpal74/track-my-tasks-backend/tenant"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/net/websocket"
+)
+
+const (
+	// How often idle streams send something, so proxies don't close them
+	heartbeatInterval = 25 * time.Second
+	// How long EventSource clients wait before reconnecting
+	reconnectDelay = 3 * time.Second
+	// How long a WebSocket client may take to accept a message
+	websocketWriteTimeout = 10 * time.Second
+
+	EventTaskCreated = "task.created"
+	EventTaskUpdated = "task.updated"
+	EventTaskDeleted = "task.deleted"
+	// Sent when missed events can't be replayed, the client has to reload its tasks
+	EventReset     = "reset"
+	EventHeartbeat = "heartbeat"
+)
+
+type EventsHandler struct {
+	ctx          context.Context
+	broker       *realtime.Broker
+	usersColl    *mongo.Collection
+	projectsColl *tenant.Collection
+}
+
+// TaskEvent - the data of the task events, Task is left out when the recipient lost access to it
+type TaskEvent struct {
+	Action      string             `json:"action"`
+	TaskID      primitive.ObjectID `json:"task_id"`
+	WorkspaceID primitive.ObjectID `json:"workspace_id"`
+	Actor       string             `json:"actor,omitempty"`
+	Task        *model.Task        `json:"task,omitempty"`
+}
+
+func NewEventsHandler(ctx context.Context, broker *realtime.Broker, usersColl *mongo.Collection, projectsColl *tenant.Collection) *EventsHandler {
+	return &EventsHandler{
+		ctx:          ctx,
+		broker:       broker,
+		usersColl:    usersColl,
+		projectsColl: projectsColl,
+	}
+}
+
+// PublishDomainEvent - a domain event subscriber sending task changes to everyone who can see the task, and a
+// deletion to everyone who could see it before but not any more
+func (handler *EventsHandler) PublishDomainEvent(ctx context.Context, event domain.Event) error {
+	audience, ok, err := taskChangeAudience(tenant.Unscoped(ctx), handler.projectsColl, event)
+	if err != nil || !ok {
+		return err
+	}
+
+	change, _ := domain.TaskOf(event)
+	taskEvent := newTaskEvent(change)
+	if err := handler.broker.Publish(ctx, recipientKeys(audience.current), audience.eventType, taskEvent); err != nil {
+		return err
+	}
+	if len(audience.removed) == 0 {
+		return nil
+	}
+	taskEvent.Task = nil
+	return handler.broker.Publish(ctx, recipientKeys(audience.removed), EventTaskDeleted, taskEvent)
+}
+
+// changeAudience - who hears about a change of a task
+type changeAudience struct {
+	eventType string               // One of the EventTask* types, sent to current
+	current   []primitive.ObjectID // The owner and the collaborators of the task
+	removed   []primitive.ObjectID // Who could see the task before the change but not any more, they get a deletion
+}
+
+// taskChangeAudience - false for the domain events which only tell more about a change another event reports,
+// like TaskCompleted following TaskUpdated
+func taskChangeAudience(ctx context.Context, projectsColl *tenant.Collection, event domain.Event) (changeAudience, bool, error) {
+	var audience changeAudience
+	switch event.(type) {
+	case domain.TaskCreated, domain.TaskRestored:
+		audience.eventType = EventTaskCreated
+	case domain.TaskUpdated:
+		audience.eventType = EventTaskUpdated
+	case domain.TaskDeleted:
+		audience.eventType = EventTaskDeleted
+	default:
+		return audience, false, nil
+	}
+	change, _ := domain.TaskOf(event)
+
+	var err error
+	if audience.current, err = taskAudience(ctx, projectsColl, change.Task); err != nil {
+		return audience, false, err
+	}
+	if change.Previous == nil {
+		return audience, true, nil
+	}
+	before, err := taskAudience(ctx, projectsColl, *change.Previous)
+	if err != nil {
+		return audience, false, err
+	}
+	for _, userID := range before {
+		if !containsID(audience.current, userID) {
+			audience.removed = append(audience.removed, userID)
+		}
+	}
+	return audience, true, nil
+}
+
+// taskAudience - the owner and the collaborators of the task
+func taskAudience(ctx context.Context, projectsColl *tenant.Collection, task model.Task) ([]primitive.ObjectID, error) {
+	collaborators, err := taskCollaborators(ctx, projectsColl, task)
+	if err != nil {
+		return nil, err
+	}
+	audience := []primitive.ObjectID{task.UserID}
+	for _, collaborator := range collaborators {
+		if !containsID(audience, collaborator.UserID) {
+			audience = append(audience, collaborator.UserID)
+		}
+	}
+	return audience, nil
+}
+
+func newTaskEvent(change domain.TaskEvent) TaskEvent {
+	return TaskEvent{
+		Action:      change.Action,
+		TaskID:      change.TaskID,
+		WorkspaceID: change.WorkspaceID,
+		Actor:       change.Actor,
+		Task:        &change.Task,
+	}
+}
+
+func recipientKeys(userIDs []primitive.ObjectID) []string {
+	keys := make([]string, 0, len(userIDs))
+	for _, userID := range userIDs {
+		keys = append(keys, userID.Hex())
+	}
+	return keys
+}
+
+// StreamHandler - the task events of the user as server-sent events, or over a WebSocket when the request asks
+// for an upgrade. Browsers authenticate with a ticket, see StreamTicketHandler. Clients resume with the Last-Event-ID header or the last_event_id query parameter.
+func (handler *EventsHandler) StreamHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	user, ok := currentUser(ctx, c, handler.usersColl)
+	cancel()
+	if !ok {
+		return
+	}
+
+	lastID := c.GetHeader("Last-Event-ID")
+	if lastID == "" {
+		lastID = c.Query("last_event_id")
+	}
+
+	if strings.EqualFold(c.GetHeader("Upgrade"), "websocket") {
+		handler.serveWebSocket(c, user.ID.Hex(), lastID)
+		return
+	}
+	handler.serveEventSource(c, user.ID.Hex(), lastID)
+}
+
+func (handler *EventsHandler) serveEventSource(c *gin.Context, recipient, lastID string) {
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	w := c.Writer
+	fmt.Fprintf(w, "retry: %d\n\n", reconnectDelay.Milliseconds())
+	w.Flush()
+
+	send := func(event realtime.Event) error {
+		payload, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		if event.ID != "" {
+			fmt.Fprintf(w, "id: %s\n", event.ID)
+		}
+		if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, payload); err != nil {
+			return err
+		}
+		w.Flush()
+		return nil
+	}
+	heartbeat := func() error {
+		if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+			return err
+		}
+		w.Flush()
+		return nil
+	}
+
+	if err := handler.stream(c.Request.Context(), recipient, lastID, send, heartbeat); err != nil {
+		log.Printf("Event stream of %s ended: %v", recipient, err)
+	}
+}
+
+func (handler *EventsHandler) serveWebSocket(c *gin.Context, recipient, lastID string) {
+	server := websocket.Server{Handler: func(conn *websocket.Conn) {
+		defer conn.Close()
+
+		// Clients don't send anything, reading only notices when they go away
+		ctx, cancel := context.WithCancel(c.Request.Context())
+		defer cancel()
+		go func() {
+			var message string
+			for websocket.Message.Receive(conn, &message) == nil {
+			}
+			cancel()
+		}()
+
+		send := func(event realtime.Event) error {
+			conn.SetWriteDeadline(time.Now().Add(websocketWriteTimeout))
+			return websocket.JSON.Send(conn, event)
+		}
+		heartbeat := func() error {
+			return send(realtime.Event{Type: EventHeartbeat})
+		}
+
+		if err := handler.stream(ctx, recipient, lastID, send, heartbeat); err != nil {
+			log.Printf("Event socket of %s ended: %v", recipient, err)
+		}
+	}}
+	server.ServeHTTP(c.Writer, c.Request)
+}
+
+// stream - sends the events after lastID, then the live ones, until the client goes away or falls behind
+func (handler *EventsHandler) stream(ctx context.Context, recipient, lastID string, send func(realtime.Event) error, heartbeat func() error) error {
+	// Subscribing first, events published while replaying arrive twice rather than never
+	subscription := handler.broker.Subscribe(recipient)
+	defer subscription.Close()
+
+	if lastID != "" {
+		events, complete, err := handler.broker.Replay(ctx, recipient, lastID)
+		if err != nil {
+			return err
+		}
+		if !complete {
+			lastID = ""
+			if err := send(realtime.Event{Type: EventReset}); err != nil {
+				return err
+			}
+		}
+		for _, event := range events {
+			if err := send(event); err != nil {
+				return err
+			}
+			lastID = event.ID
+		}
+	}
+
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-subscription.Events:
+			if !ok {
+				return fmt.Errorf("fell behind")
+			}
+			if lastID != "" && !realtime.After(event.ID, lastID) {
+				continue
+			}
+			if err := send(event); err != nil {
+				return err
+			}
+			lastID = event.ID
+		case <-ticker.C:
+			if err := heartbeat(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func containsID(ids []primitive.ObjectID, id primitive.ObjectID) bool {
+	for _, candidate := range ids {
+		if candidate == id {
+			return true
+		}
+	}
+	return false
+}
@@ -3,6 +3,7 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -10,27 +11,43 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"github.com/redis/go-redis/v9"
 	"github.com/utpal74/track-my-tasks-backend/model"
+	"github.com/utpal74/track-my-tasks-backend/outbox"
+	"github.com/utpal74/track-my-tasks-backend/tenant"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type TasksHandler struct {
-	ctx         context.Context
-	mutex       sync.Mutex
-	tasksColl   *mongo.Collection
-	usersColl   *mongo.Collection
-	redisClient *redis.Client
+	ctx               context.Context
+	mutex             sync.Mutex
+	tasksColl         *tenant.Collection
+	usersColl         *mongo.Collection
+	projectsColl      *tenant.Collection
+	eventsColl        *mongo.Collection
+	notificationsColl *mongo.Collection
+	templatesColl     *tenant.Collection
+	tombstonesColl    *tenant.Collection
+	redisClient       *redis.Client
+	outbox            *outbox.Outbox
+	purgeHooks        []PurgeHook
 }
 
-func NewTasksHandler(ctx context.Context, tasksColl *mongo.Collection, usersColl *mongo.Collection, redisClient *redis.Client) *TasksHandler {
+func NewTasksHandler(ctx context.Context, tasksColl *tenant.Collection, usersColl *mongo.Collection, projectsColl *tenant.Collection, eventsColl *mongo.Collection, notificationsColl *mongo.Collection, templatesColl *tenant.Collection, tombstonesColl *tenant.Collection, outbox *outbox.Outbox, redisClient *redis.Client) *TasksHandler {
 	return &TasksHandler{
-		ctx:         ctx,
-		tasksColl:   tasksColl,
-		usersColl:   usersColl,
-		redisClient: redisClient,
+		ctx:               ctx,
+		tasksColl:         tasksColl,
+		usersColl:         usersColl,
+		projectsColl:      projectsColl,
+		eventsColl:        eventsColl,
+		notificationsColl: notificationsColl,
+		templatesColl:     templatesColl,
+		tombstonesColl:    tombstonesColl,
+		outbox:            outbox,
+		redisClient:       redisClient,
 	}
 }
 
@@ -41,7 +58,7 @@ func (handler *TasksHandler) StatusHandler(c *gin.Context) {
 }
 
 func (handler *TasksHandler) GetAllTasksHandler(c *gin.Context) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
 	defer cancel()
 
 	username, _ := c.Get("username")
@@ -52,17 +69,24 @@ func (handler *TasksHandler) GetAllTasksHandler(c *gin.Context) {
 		return
 	}
 
-	redisKey := "tasks:" + user.ID.Hex()
-	cacheVal, err := handler.redisClient.Get(ctx, redisKey).Result()
+	redisKey, field := "tasks:"+user.ID.Hex(), cacheField(ctx)
+	cacheVal, err := handler.redisClient.HGet(ctx, redisKey, field).Result()
 	if err == redis.Nil {
 		log.Printf("request to mongo DB")
 
 		handler.mutex.Lock()
 		defer handler.mutex.Unlock()
 
-		cacheVal, err = handler.redisClient.Get(ctx, redisKey).Result()
+		cacheVal, err = handler.redisClient.HGet(ctx, redisKey, field).Result()
 		if err == redis.Nil {
-			cur, err := handler.tasksColl.Find(ctx, bson.M{"user_id": user.ID})
+			// Includes the tasks shared with the user, directly or through a project
+			filter, err := visibleTasksFilter(ctx, handler.projectsColl, user.ID)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+
+			cur, err := handler.tasksColl.Find(ctx, filter)
 			if err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 				return
@@ -78,6 +102,8 @@ func (handler *TasksHandler) GetAllTasksHandler(c *gin.Context) {
 				}
 				tasks = append(tasks, task)
 			}
+			markBlocked(tasks)
+			fillLegacyStatus(tasks)
 
 			taskData, err := json.Marshal(tasks)
 			if err != nil {
@@ -85,31 +111,33 @@ func (handler *TasksHandler) GetAllTasksHandler(c *gin.Context) {
 				return
 			}
 
-			if err := handler.redisClient.Set(ctx, redisKey, string(taskData), 10*time.Minute).Err(); err != nil {
+			if err := handler.setCache(ctx, redisKey, field, taskData, 10*time.Minute); err != nil {
 				log.Printf("Failed to set cache for key %s: %v", redisKey, err)
 			}
 
-			c.JSON(http.StatusOK, tasks)
+			respondWithTasks(c, tasks)
+			return
 		} else if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
+		// Another request filled the cache while we were waiting for the lock
 	} else if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
-	} else {
-		log.Println("request from redis")
-		var tasks []model.Task
-		if err := json.Unmarshal([]byte(cacheVal), &tasks); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to unmarshal tasks data"})
-			return
-		}
-		c.JSON(http.StatusOK, tasks)
 	}
+
+	log.Println("request from redis")
+	var tasks []model.Task
+	if err := json.Unmarshal([]byte(cacheVal), &tasks); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to unmarshal tasks data"})
+		return
+	}
+	respondWithTasks(c, tasks)
 }
 
 func (handler *TasksHandler) NewTaskHandler(c *gin.Context) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
 	defer cancel()
 
 	var task model.Task
@@ -126,34 +154,125 @@ func (handler *TasksHandler) NewTaskHandler(c *gin.Context) {
 		return
 	}
 
-	task.ID = primitive.NewObjectID()
-	task.UserID = user.ID
-	task.CreatedAt = time.Now()
-	task.UpdatedAt = time.Now()
+	task, ok := handler.createTask(ctx, c, user, task)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, task)
+}
 
-	// Insert the new task
-	if _, err := handler.tasksColl.InsertOne(ctx, task); err != nil {
+// createTask - validates and stores a new task of the user as NewTaskHandler does, responding with the error otherwise
+func (handler *TasksHandler) createTask(ctx context.Context, c *gin.Context, user model.User, task model.Task) (model.Task, bool) {
+	if task.ParentID != nil {
+		if _, err := loadAccessibleTask(ctx, handler.tasksColl, handler.projectsColl, user.ID, *task.ParentID); err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "parent task not found"})
+			return task, false
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return task, false
+		}
+	}
+
+	if task.Recurrence != nil && !model.ValidRecurrence(*task.Recurrence) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid recurrence"})
+		return task, false
+	}
+
+	columns, err := handler.workflowFor(ctx, user.ID, task.ProjectID)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "project not found"})
+		return task, false
+	} else if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+		return task, false
+	}
+
+	// Clients that only know about the Done flag get the first column of the matching category
+	column, found := model.FindStatus(columns, task.Status)
+	if task.Status == "" {
+		category := model.StatusCategoryOpen
+		if task.Done {
+			category = model.StatusCategoryClosed
+		}
+		column, found = model.FirstStatus(columns, category), true
+	}
+	if !found {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown status: " + task.Status})
+		return task, false
+	}
+
+	if err := handler.checkWIPLimit(ctx, user.ID, task.ProjectID, column, 1); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return task, false
+	}
+
+	if task.Priority == "" {
+		task.Priority = model.PriorityNone
+	}
+	if !model.ValidPriority(task.Priority) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown priority: " + task.Priority})
+		return task, false
 	}
 
-	// Update the User document to include the new task ID
-	update := bson.M{"$push": bson.M{"task": task}}
-	_, err = handler.usersColl.UpdateOne(ctx, bson.M{"_id": user.ID}, update)
+	// New tasks go to the bottom of the manual order
+	task.Rank, err = handler.nextRank(ctx, user.ID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to update user with new task: %v\n", err.Error())})
-		return
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "unable to compute rank: " + err.Error()})
+		return task, false
+	}
+
+	initNewTask(ctx, &task, user, column)
+
+	err = handler.commitChange(ctx, c, model.TaskActionCreated, task.ID, nil, func(ctx context.Context) error {
+		// Insert the new task
+		if _, err := handler.tasksColl.InsertOne(ctx, task); err != nil {
+			return err
+		}
+
+		// Update the User document to include the new task ID
+		update := bson.M{"$push": bson.M{"task": task}}
+		if _, err := handler.usersColl.UpdateOne(ctx, bson.M{"_id": user.ID}, update); err != nil {
+			return fmt.Errorf("Failed to update user with new task: %w", err)
+		}
+		return nil
+	})
+	if errors.Is(err, tenant.ErrQuotaExceeded) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "the workspace has reached its task quota"})
+		return task, false
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return task, false
 	}
 
 	log.Println("remove data from redis")
-	redisKey := "tasks:" + user.ID.Hex()
-	handler.redisClient.Del(ctx, redisKey)
+	handler.redisClient.Del(ctx, userCacheKeys(user.ID)...)
 
-	c.JSON(http.StatusOK, task)
+	return task, true
+}
+
+// initNewTask - sets the fields of a new task which clients can't choose, the task starts in column
+func initNewTask(ctx context.Context, task *model.Task, user model.User, column model.StatusColumn) {
+	task.ID = primitive.NewObjectID()
+	task.UserID = user.ID
+	task.WorkspaceID = workspaceID(ctx)
+	task.BlockedBy = nil
+	task.DeletedAt = nil
+	task.CommentCount = 0
+	task.Collaborators = nil
+	task.Assignees = nil
+	task.TrackedTime = 0
+	task.Pomodoros = 0
+	task.Labels = normalizeLabels(task.Labels)
+	task.Checklist = prepareChecklist(task.Checklist)
+	task.Status = column.Key
+	task.Done = column.Category == model.StatusCategoryClosed
+	task.CreatedAt = time.Now()
+	task.UpdatedAt = time.Now()
 }
 
 func (handler *TasksHandler) UpdateTaskHandler(c *gin.Context) {
-	ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 8*time.Second)
 	defer cancel()
 
 	username, _ := c.Get("username")
@@ -166,7 +285,14 @@ func (handler *TasksHandler) UpdateTaskHandler(c *gin.Context) {
 
 	id := c.Param("id")
 	var taskToBeUpdated model.Task
-	if err := c.ShouldBindJSON(&taskToBeUpdated); err != nil {
+	if err := c.ShouldBindBodyWith(&taskToBeUpdated, binding.JSON); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Fields whose zero value is meaningful need to be told apart from "not sent"
+	var patch taskPatch
+	if err := c.ShouldBindBodyWith(&patch, binding.JSON); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
@@ -177,28 +303,84 @@ func (handler *TasksHandler) UpdateTaskHandler(c *gin.Context) {
 		return
 	}
 
-	filter := bson.M{"_id": objectId}
-	updateFields := bson.M{}
+	task, ok := handler.editableTask(ctx, c, user, objectId)
+	if !ok {
+		return
+	}
 
-	if taskToBeUpdated.Title != "" {
-		updateFields["title"] = taskToBeUpdated.Title
+	before, err := handler.taskSnapshot(ctx, objectId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
 
-	if taskToBeUpdated.Comment != "" {
-		updateFields["comment"] = taskToBeUpdated.Comment
+	filter := activeTask(bson.M{"_id": objectId})
+	updateFields, err := taskUpdateFields(taskToBeUpdated, patch)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
 	if taskToBeUpdated.Done {
+		// Refuse to complete a task while any of its blockers is still open, unless forced
+		openBlockers, err := handler.openBlockers(ctx, objectId)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "unable to check blockers: " + err.Error()})
+			return
+		}
+		if len(openBlockers) > 0 && c.Query("force") != "true" {
+			c.JSON(http.StatusConflict, gin.H{"error": "task is blocked by open tasks", "blocked_by": openBlockers})
+			return
+		}
+
+		// done: true moves the task into the first closed column of its workflow
+		column, err := handler.closedColumnFor(ctx, task)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "unable to resolve status: " + err.Error()})
+			return
+		}
+		if column.Key != task.Status {
+			if err := handler.checkWIPLimit(ctx, task.UserID, task.ProjectID, column, 1); err != nil {
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+				return
+			}
+		}
 		updateFields["done"] = taskToBeUpdated.Done
+		updateFields["status"] = column.Key
 	}
 
 	updateFields["updated_at"] = time.Now()
 
 	if len(updateFields) > 0 {
 		update := bson.M{"$set": updateFields}
-		result, err := handler.tasksColl.UpdateOne(ctx, filter, update)
+		var result *mongo.UpdateResult
+		err := handler.commitChange(ctx, c, model.TaskActionUpdated, objectId, before, func(ctx context.Context) error {
+			var err error
+			result, err = handler.tasksColl.UpdateOne(ctx, filter, update)
+			if err != nil {
+				return fmt.Errorf("unable to update: %w", err)
+			}
+			if result.MatchedCount == 0 {
+				return nil
+			}
+
+			// Update the task in the owner's Task array, editors may not be the owner
+			userUpdateFields := bson.M{}
+			for field, value := range updateFields {
+				userUpdateFields["task.$."+field] = value
+			}
+
+			if len(userUpdateFields) > 0 {
+				_, err = handler.usersColl.UpdateOne(ctx, bson.M{"_id": task.UserID, "task._id": objectId},
+					bson.M{"$set": userUpdateFields})
+				if err != nil {
+					return fmt.Errorf("Failed to update task in user collection: %w", err)
+				}
+			}
+			return nil
+		})
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "unable to update: " + err.Error()})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 
@@ -209,45 +391,68 @@ func (handler *TasksHandler) UpdateTaskHandler(c *gin.Context) {
 			return
 		}
 
-		// Update the task in the user's Task array
-		username, _ := c.Get("username")
-		userUpdateFields := bson.M{}
+		invalidateMemberCaches(ctx, handler.redisClient, handler.projectsColl, task)
 
-		if taskToBeUpdated.Title != "" {
-			userUpdateFields["task.$.title"] = taskToBeUpdated.Title
-		}
+		c.JSON(http.StatusOK, gin.H{"message": "1 record updated", "matchedCount": result.MatchedCount, "modifiedCount": result.ModifiedCount})
+	} else {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No fields to update"})
+	}
+}
+
+// taskUpdateFields - the fields set by an update of the task's attributes, done and status are handled separately
+func taskUpdateFields(update model.Task, patch taskPatch) (bson.M, error) {
+	updateFields := bson.M{}
+
+	if update.Title != "" {
+		updateFields["title"] = update.Title
+	}
 
-		if taskToBeUpdated.Comment != "" {
-			userUpdateFields["task.$.comment"] = taskToBeUpdated.Comment
+	if update.Comment != "" {
+		updateFields["comment"] = update.Comment
+	}
+
+	if update.Priority != "" {
+		if !model.ValidPriority(update.Priority) {
+			return nil, errors.New("unknown priority: " + update.Priority)
 		}
+		updateFields["priority"] = update.Priority
+	}
 
-		if taskToBeUpdated.Done {
-			userUpdateFields["task.$.done"] = taskToBeUpdated.Done
+	if patch.Important != nil {
+		updateFields["important"] = *patch.Important
+	}
+
+	if patch.Estimate != nil {
+		if *patch.Estimate < 0 {
+			return nil, errors.New("estimate can't be negative")
 		}
+		updateFields["estimate_minutes"] = *patch.Estimate
+	}
 
-		userUpdateFields["task.$.updated_at"] = time.Now()
+	if update.DueDate != nil {
+		updateFields["due_date"] = *update.DueDate
+	}
 
-		if len(userUpdateFields) > 0 {
-			_, err = handler.usersColl.UpdateOne(ctx, bson.M{"username": username, "task._id": objectId},
-				bson.M{"$set": userUpdateFields})
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update task in user collection: " + err.Error()})
-				return
-			}
+	if update.Recurrence != nil {
+		if !model.ValidRecurrence(*update.Recurrence) {
+			return nil, errors.New("invalid recurrence")
 		}
+		updateFields["recurrence"] = *update.Recurrence
+	}
 
-		log.Println("remove data from redis")
-		redisKey := "tasks:" + user.ID.Hex()
-		handler.redisClient.Del(ctx, redisKey)
+	if patch.Labels != nil {
+		updateFields["labels"] = normalizeLabels(*patch.Labels)
+	}
 
-		c.JSON(http.StatusOK, gin.H{"message": "1 record updated", "matchedCount": result.MatchedCount, "modifiedCount": result.ModifiedCount})
-	} else {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "No fields to update"})
+	if patch.Checklist != nil {
+		updateFields["checklist"] = prepareChecklist(*patch.Checklist)
 	}
+
+	return updateFields, nil
 }
 
 func (handler *TasksHandler) DeleteTaskHandler(c *gin.Context) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
 	defer cancel()
 
 	username, _ := c.Get("username")
@@ -265,104 +470,166 @@ func (handler *TasksHandler) DeleteTaskHandler(c *gin.Context) {
 		return
 	}
 
-	// Find the task to retrieve its UserID
-	var task model.Task
-	err = handler.tasksColl.FindOne(ctx, bson.M{"_id": objectID}).Decode(&task)
+	before, err := handler.taskSnapshot(ctx, objectID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Delete the task
-	_, err = handler.tasksColl.DeleteOne(ctx, bson.M{"_id": objectID})
+	trashed, err := handler.trashTask(ctx, c, user.ID, objectID, before, nil)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Remove the task from the user's task list
-	_, err = handler.usersColl.UpdateOne(
-		ctx,
-		bson.M{"_id": task.UserID},
-		bson.M{"$pull": bson.M{"task": bson.M{"_id": objectID}}},
-	)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user with removed task"})
+	if !trashed {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
 		return
 	}
 
-	log.Println("remove data from redis")
-	redisKey := "tasks:" + user.ID.Hex()
-	handler.redisClient.Del(ctx, redisKey)
+	handler.invalidateTaskCaches(ctx, objectID)
 
-	c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("Task with id %v deleted", id)})
+	c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("Task with id %v moved to trash", id)})
 }
 
+// trashTask - moves a task of the owner to the trash and records the deletion, the task is purged for good after
+// the retention period. With a version, only while the task is still the version last updated then. Returns false
+// when the owner has no such task outside the trash.
+func (handler *TasksHandler) trashTask(ctx context.Context, c *gin.Context, ownerID, taskID primitive.ObjectID, before bson.M, version *time.Time) (bool, error) {
+	now := time.Now()
+	trashed := false
+	filter := activeTask(bson.M{"_id": taskID, "user_id": ownerID})
+	if version != nil {
+		filter = unchangedTask(filter, *version)
+	}
+	err := handler.commitChange(ctx, c, model.TaskActionDeleted, taskID, before, func(ctx context.Context) error {
+		result, err := handler.tasksColl.UpdateOne(ctx, filter,
+			bson.M{"$set": bson.M{"deleted_at": now, "updated_at": now}},
+		)
+		if err != nil {
+			return err
+		}
+		if trashed = result.MatchedCount > 0; !trashed {
+			return nil
+		}
+
+		_, err = handler.usersColl.UpdateOne(ctx,
+			bson.M{"_id": ownerID, "task._id": taskID},
+			bson.M{"$set": bson.M{"task.$.deleted_at": now, "task.$.updated_at": now}},
+		)
+		if err != nil {
+			return fmt.Errorf("failed to update user with removed task: %w", err)
+		}
+		return nil
+	})
+	return trashed && err == nil, err
+}
+
+// SearchTaskHandler - returns a task the user can see. Not cached: the access check reads the task anyway,
+// and a cached copy would outlive a revoked share.
 func (handler *TasksHandler) SearchTaskHandler(c *gin.Context) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
 	defer cancel()
 
-	username, _ := c.Get("username")
-	var user model.User
-	err := handler.usersColl.FindOne(ctx, bson.M{"username": username}).Decode(&user)
-	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+	user, ok := handler.currentUser(ctx, c)
+	if !ok {
 		return
 	}
 
-	redisKey := "tasks:" + user.ID.Hex()
-	cacheVal, err := handler.redisClient.Get(ctx, redisKey).Result()
+	task, ok := taskFromPath(ctx, c, handler.tasksColl, handler.projectsColl, user)
+	if !ok {
+		return
+	}
 
-	if err == redis.Nil {
-		log.Println("request from DB")
+	c.JSON(http.StatusOK, task)
+}
 
-		handler.mutex.Lock()
-		defer handler.mutex.Unlock()
+// currentUser - loads the user set by AuthMiddleware, responds with 401 when it can't be found
+func (handler *TasksHandler) currentUser(ctx context.Context, c *gin.Context) (model.User, bool) {
+	return currentUser(ctx, c, handler.usersColl)
+}
 
-		// Check the cache again to avoid re-fetching from DB if another request already did
-		cacheVal, err = handler.redisClient.Get(ctx, redisKey).Result()
-		if err == redis.Nil {
-			objId, err := primitive.ObjectIDFromHex(c.Param("id"))
-			if err != nil {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id format: " + err.Error()})
-				return
-			}
+func currentUser(ctx context.Context, c *gin.Context, usersColl *mongo.Collection) (model.User, bool) {
+	username, _ := c.Get("username")
+	var user model.User
+	if err := usersColl.FindOne(ctx, bson.M{"username": username}).Decode(&user); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return user, false
+	}
+	return user, true
+}
 
-			var task model.Task
-			if err := handler.tasksColl.FindOne(ctx, bson.M{"_id": objId}).Decode(&task); err != nil {
-				if err == mongo.ErrNoDocuments {
-					c.JSON(http.StatusNotFound, gin.H{"error": "task not found"})
-					return
-				}
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "couldn't find task: " + err.Error()})
-				return
-			}
+// loadUserTasks - returns every task owned by the given user, except the ones in the trash
+func (handler *TasksHandler) loadUserTasks(ctx context.Context, userID primitive.ObjectID) ([]model.Task, error) {
+	cur, err := handler.tasksColl.Find(ctx, activeTask(bson.M{"user_id": userID}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
 
-			data, err := json.Marshal(&task)
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to marshal task data"})
-				return
-			}
+	tasks := make([]model.Task, 0)
+	if err := cur.All(ctx, &tasks); err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
 
-			if err := handler.redisClient.Set(ctx, redisKey, string(data), 10*time.Minute).Err(); err != nil {
-				log.Printf("Failed to set cache for key %s: %v", redisKey, err)
-			}
+// invalidateTasksCache - removes the cached task list (and views derived from it) of the given user
+func (handler *TasksHandler) invalidateTasksCache(ctx context.Context, userID primitive.ObjectID) {
+	log.Println("remove data from redis")
+	handler.redisClient.Del(ctx, userCacheKeys(userID)...)
+}
 
-			c.JSON(http.StatusOK, task)
-		} else if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
+// invalidateTaskCaches - removes the cached task lists of everyone the task is visible to
+func (handler *TasksHandler) invalidateTaskCaches(ctx context.Context, taskID primitive.ObjectID) {
+	var task model.Task
+	if err := handler.tasksColl.FindOne(ctx, bson.M{"_id": taskID}).Decode(&task); err != nil {
+		log.Printf("Failed to load task %s for cache invalidation: %v", taskID.Hex(), err)
+		return
+	}
+	invalidateMemberCaches(ctx, handler.redisClient, handler.projectsColl, task)
+}
+
+// editableTask - loads a task the user can see, responding with 404 when they can't and 403 when they may only view it
+func (handler *TasksHandler) editableTask(ctx context.Context, c *gin.Context, user model.User, taskID primitive.ObjectID) (model.Task, bool) {
+	task, err := loadAccessibleTask(ctx, handler.tasksColl, handler.projectsColl, user.ID, taskID)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "task not found"})
+		return task, false
 	} else if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	} else {
-		log.Println("request from redis")
-		var task model.Task
-		if err := json.Unmarshal([]byte(cacheVal), &task); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to unmarshal task data"})
-			return
-		}
-		c.JSON(http.StatusOK, task)
+		return task, false
 	}
+
+	role, err := taskRole(ctx, handler.projectsColl, task, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return task, false
+	}
+	if role == model.RoleViewer {
+		c.JSON(http.StatusForbidden, gin.H{"error": "viewers can't change the task"})
+		return task, false
+	}
+	return task, true
+}
+
+// setCache - stores value in a field of the user's cache hash, the whole hash expires after ttl
+func (handler *TasksHandler) setCache(ctx context.Context, key, field string, value []byte, ttl time.Duration) error {
+	_, err := handler.redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, key, field, value)
+		pipe.Expire(ctx, key, ttl)
+		return nil
+	})
+	return err
+}
+
+// cacheField - the field of the user's cache hashes holding the data of the current workspace
+func cacheField(ctx context.Context) string {
+	return workspaceID(ctx).Hex()
+}
+
+// userCacheKeys - every Redis key caching data derived from the user's tasks.
+// These are hashes with a field per workspace, so that a change clears the user's cache in all of them.
+func userCacheKeys(userID primitive.ObjectID) []string {
+	return []string{"tasks:" + userID.Hex(), "matrix:" + userID.Hex()}
 }
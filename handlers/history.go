@@ -0,0 +1,326 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/utpal74/track-my-tasks-backend/domain"
+	"github.com/utpal74/track-my-tasks-backend/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// fields left out of history diffs, they change on every write or never change at all
+var untrackedFields = map[string]bool{"_id": true, "user_id": true, "created_at": true, "updated_at": true}
+
+// TaskHistoryHandler - list the history of a task, newest first
+func (handler *TasksHandler) TaskHistoryHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	user, ok := handler.currentUser(ctx, c)
+	if !ok {
+		return
+	}
+
+	taskID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id format"})
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+		return
+	}
+
+	cur, err := handler.eventsColl.Find(ctx,
+		bson.M{"task_id": taskID, "user_id": user.ID},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}).SetLimit(int64(limit)),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer cur.Close(ctx)
+
+	events := make([]model.TaskEvent, 0)
+	if err := cur.All(ctx, &events); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to decode task history"})
+		return
+	}
+
+	c.JSON(http.StatusOK, events)
+}
+
+// UndoTaskHandler - revert the last change of a task, as long as nothing modified the task since
+func (handler *TasksHandler) UndoTaskHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	user, ok := handler.currentUser(ctx, c)
+	if !ok {
+		return
+	}
+
+	taskID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id format"})
+		return
+	}
+
+	var task model.Task
+	if err := handler.tasksColl.FindOne(ctx, bson.M{"_id": taskID, "user_id": user.ID}).Decode(&task); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "task not found"})
+		return
+	}
+
+	var last model.TaskEvent
+	err = handler.eventsColl.FindOne(ctx,
+		bson.M{"task_id": taskID, "user_id": user.ID},
+		options.FindOne().SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}),
+	).Decode(&last)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "nothing to undo"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if last.Action == model.TaskActionCreated {
+		c.JSON(http.StatusConflict, gin.H{"error": "cannot undo the creation of a task, delete it instead"})
+		return
+	}
+
+	if !task.UpdatedAt.Equal(last.TaskUpdatedAt) {
+		c.JSON(http.StatusConflict, gin.H{"error": "task was modified since the last recorded change"})
+		return
+	}
+
+	before, err := handler.taskSnapshot(ctx, taskID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	set := bson.M{"updated_at": time.Now()}
+	unset := bson.M{}
+	for _, change := range last.Changes {
+		if change.Old == nil {
+			unset[change.Field] = ""
+		} else {
+			set[change.Field] = change.Old
+		}
+	}
+
+	update := bson.M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	var undone model.Task
+	if err := decodeSnapshot(applyUndo(before, set, unset), &undone); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !handler.checkUndoneStatus(ctx, c, task, undone) {
+		return
+	}
+
+	err = handler.commitChange(ctx, c, model.TaskActionUndo, taskID, before, func(ctx context.Context) error {
+		if _, err := handler.tasksColl.UpdateOne(ctx, bson.M{"_id": taskID}, update); err != nil {
+			return fmt.Errorf("unable to undo: %w", err)
+		}
+
+		if err := handler.tasksColl.FindOne(ctx, bson.M{"_id": taskID}).Decode(&task); err != nil {
+			return err
+		}
+
+		_, err := handler.usersColl.UpdateOne(ctx, bson.M{"_id": user.ID, "task._id": taskID}, bson.M{"$set": bson.M{"task.$": task}})
+		if err != nil {
+			return fmt.Errorf("Failed to update task in user collection: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	handler.invalidateTaskCaches(ctx, taskID)
+
+	c.JSON(http.StatusOK, task)
+}
+
+// applyUndo - the task document as the undo leaves it
+func applyUndo(doc, set, unset bson.M) bson.M {
+	undone := make(bson.M, len(doc)+len(set))
+	for field, value := range doc {
+		if _, removed := unset[field]; !removed {
+			undone[field] = value
+		}
+	}
+	for field, value := range set {
+		undone[field] = value
+	}
+	return undone
+}
+
+// checkUndoneStatus - an undo which moves the task into another column, or back out of the trash, is held to the
+// WIP limit of that column, and one which completes the task to its open blockers, like UpdateTaskHandler
+func (handler *TasksHandler) checkUndoneStatus(ctx context.Context, c *gin.Context, task, undone model.Task) bool {
+	if undone.DeletedAt != nil {
+		return true
+	}
+	tasks := []model.Task{task, undone}
+	fillLegacyStatus(tasks)
+	task, undone = tasks[0], tasks[1]
+
+	if undone.Done && !task.Done {
+		openBlockers, err := handler.openBlockers(ctx, task.ID)
+		if err != nil && err != mongo.ErrNoDocuments {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "unable to check blockers: " + err.Error()})
+			return false
+		}
+		if len(openBlockers) > 0 && c.Query("force") != "true" {
+			c.JSON(http.StatusConflict, gin.H{"error": "task is blocked by open tasks", "blocked_by": openBlockers})
+			return false
+		}
+	}
+
+	if undone.Status == task.Status && task.DeletedAt == nil && sameProject(task.ProjectID, undone.ProjectID) {
+		return true
+	}
+	column, known, err := handler.statusColumnFor(ctx, undone)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "unable to resolve status: " + err.Error()})
+		return false
+	}
+	if known {
+		if err := handler.checkWIPLimit(ctx, undone.UserID, undone.ProjectID, column, 1); err != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return false
+		}
+	}
+	return true
+}
+
+// taskSnapshot - returns the stored document of a task, nil if it doesn't exist
+func (handler *TasksHandler) taskSnapshot(ctx context.Context, taskID primitive.ObjectID) (bson.M, error) {
+	var doc bson.M
+	err := handler.tasksColl.FindOne(ctx, bson.M{"_id": taskID}).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	return doc, err
+}
+
+// commitChange - runs write, the writes changing the task, and recordChange in one transaction, so a change is
+// never stored without its history and domain events or the other way round. write runs again when the
+// transaction is retried; its error is returned as is.
+func (handler *TasksHandler) commitChange(ctx context.Context, c *gin.Context, action string, taskID primitive.ObjectID, before bson.M, write func(ctx context.Context) error) error {
+	actor := c.GetString("username")
+	return handler.outbox.Transact(ctx, func(ctx context.Context) error {
+		if err := write(ctx); err != nil {
+			return err
+		}
+		return handler.recordChange(ctx, actor, action, taskID, before)
+	})
+}
+
+// recordChange - appends a history entry with the difference between the before snapshot and the task as stored
+// now, and adds the domain events of the change to the outbox. Nothing is recorded when the task didn't change.
+func (handler *TasksHandler) recordChange(ctx context.Context, actor, action string, taskID primitive.ObjectID, before bson.M) error {
+	after, err := handler.taskSnapshot(ctx, taskID)
+	if err != nil {
+		return fmt.Errorf("unable to load task %s for its history: %w", taskID.Hex(), err)
+	}
+	if after == nil {
+		return nil
+	}
+
+	changes := diffTask(before, after)
+	if len(changes) == 0 {
+		return nil
+	}
+
+	ownerID, _ := after["user_id"].(primitive.ObjectID)
+	updatedAt, _ := after["updated_at"].(primitive.DateTime)
+	now := time.Now()
+
+	event := model.TaskEvent{
+		ID:            primitive.NewObjectID(),
+		TaskID:        taskID,
+		UserID:        ownerID,
+		Actor:         actor,
+		Action:        action,
+		Changes:       changes,
+		TaskUpdatedAt: updatedAt.Time(),
+		CreatedAt:     now,
+	}
+	if _, err := handler.eventsColl.InsertOne(ctx, event); err != nil {
+		return fmt.Errorf("unable to record the history of task %s: %w", taskID.Hex(), err)
+	}
+
+	base := domain.TaskEvent{ChangeID: event.ID, TaskID: taskID, Action: action, Actor: actor, OccurredAt: now}
+	if err := decodeSnapshot(after, &base.Task); err != nil {
+		return err
+	}
+	if before != nil {
+		base.Previous = &model.Task{}
+		if err := decodeSnapshot(before, base.Previous); err != nil {
+			return err
+		}
+	}
+	base.WorkspaceID = base.Task.WorkspaceID
+	if base.WorkspaceID.IsZero() {
+		base.WorkspaceID = workspaceID(ctx)
+	}
+	return handler.outbox.Add(ctx, domain.FromChange(base, changes)...)
+}
+
+func decodeSnapshot(doc bson.M, task *model.Task) error {
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return bson.Unmarshal(raw, task)
+}
+
+// diffTask - lists the fields which differ between two task documents, sorted by field name
+func diffTask(before, after bson.M) []model.FieldChange {
+	fields := make(map[string]bool)
+	for field := range before {
+		fields[field] = true
+	}
+	for field := range after {
+		fields[field] = true
+	}
+
+	changes := make([]model.FieldChange, 0)
+	for field := range fields {
+		if untrackedFields[field] {
+			continue
+		}
+		oldValue, newValue := before[field], after[field]
+		if reflect.DeepEqual(oldValue, newValue) {
+			continue
+		}
+		changes = append(changes, model.FieldChange{Field: field, Old: oldValue, New: newValue})
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Field < changes[j].Field
+	})
+	return changes
+}
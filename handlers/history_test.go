@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestApplyUndo(t *testing.T) {
+	doc := bson.M{"title": "Buy milk", "status": "done", "done": true, "deleted_at": "2024-03-01"}
+
+	tests := []struct {
+		name  string
+		set   bson.M
+		unset bson.M
+		want  bson.M
+	}{
+		{
+			name: "status change is reverted",
+			set:  bson.M{"status": "in_progress", "done": false},
+			want: bson.M{"title": "Buy milk", "status": "in_progress", "done": false, "deleted_at": "2024-03-01"},
+		},
+		{
+			name:  "deletion is reverted",
+			unset: bson.M{"deleted_at": ""},
+			want:  bson.M{"title": "Buy milk", "status": "done", "done": true},
+		},
+		{
+			name: "nothing to revert",
+			want: doc,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := len(doc)
+			if got := applyUndo(doc, tt.set, tt.unset); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("applyUndo() = %v, want %v", got, tt.want)
+			}
+			if len(doc) != before {
+				t.Errorf("applyUndo() modified the document")
+			}
+		})
+	}
+}
@@ -0,0 +1,341 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/utpal74/track-my-tasks-backend/inbound"
+	"github.com/utpal74/track-my-tasks-backend/model"
+	"github.com/utpal74/track-my-tasks-backend/quickadd"
+	"github.com/utpal74/track-my-tasks-backend/tenant"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	maxInboundEmailSize = 30 << 20
+	// inboundSecretHeader - carries INBOUND_EMAIL_SECRET, providers which can't set headers pass ?secret=
+	inboundSecretHeader = "X-Inbound-Secret"
+)
+
+// lower case base32, mail servers don't always keep the case of local parts
+var inboundTokenEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+type InboundEmailHandler struct {
+	ctx            context.Context
+	addressesColl  *mongo.Collection
+	workspacesColl *mongo.Collection
+	usersColl      *mongo.Collection
+	tasks          *TasksHandler
+	attachments    *AttachmentsHandler
+	domain         string // Of the addresses, INBOUND_EMAIL_DOMAIN
+	secret         string // Shared with the mail provider, INBOUND_EMAIL_SECRET
+}
+
+// NewInboundEmailHandler - tasks are created through the tasks handler and attachments stored through the
+// attachments handler, as if the user had made them
+func NewInboundEmailHandler(ctx context.Context, addressesColl *mongo.Collection, workspacesColl *mongo.Collection, usersColl *mongo.Collection, tasks *TasksHandler, attachments *AttachmentsHandler) *InboundEmailHandler {
+	return &InboundEmailHandler{
+		ctx:            ctx,
+		addressesColl:  addressesColl,
+		workspacesColl: workspacesColl,
+		usersColl:      usersColl,
+		tasks:          tasks,
+		attachments:    attachments,
+		domain:         strings.ToLower(os.Getenv("INBOUND_EMAIL_DOMAIN")),
+		secret:         os.Getenv("INBOUND_EMAIL_SECRET"),
+	}
+}
+
+// GetInboundAddressHandler - the inbound email address of the user in the workspace, without the address itself
+func (handler *InboundEmailHandler) GetInboundAddressHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	user, ok := currentUser(ctx, c, handler.usersColl)
+	if !ok {
+		return
+	}
+
+	var address model.InboundAddress
+	err := handler.addressesColl.FindOne(ctx, bson.M{"user_id": user.ID, "workspace_id": workspaceID(ctx)}).Decode(&address)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no inbound email address"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, address)
+}
+
+// RotateInboundAddressHandler - create the inbound email address of the user in the workspace, or replace it so
+// the old one stops working. The address is only returned here.
+func (handler *InboundEmailHandler) RotateInboundAddressHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	if handler.domain == "" {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "inbound email is not configured"})
+		return
+	}
+
+	user, ok := currentUser(ctx, c, handler.usersColl)
+	if !ok {
+		return
+	}
+
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "unable to create token: " + err.Error()})
+		return
+	}
+	token := inboundTokenEncoding.EncodeToString(secret)
+
+	var address model.InboundAddress
+	err := handler.addressesColl.FindOneAndUpdate(ctx,
+		bson.M{"user_id": user.ID, "workspace_id": workspaceID(ctx)},
+		bson.M{
+			"$set":         bson.M{"token_hash": hashToken(token), "created_at": time.Now()},
+			"$unset":       bson.M{"last_received_at": ""},
+			"$setOnInsert": bson.M{"_id": primitive.NewObjectID()},
+		},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&address)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"inbound_address": address, "address": token + "@" + handler.domain})
+}
+
+// DeleteInboundAddressHandler - stop turning emails into tasks of the user in the workspace
+func (handler *InboundEmailHandler) DeleteInboundAddressHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	user, ok := currentUser(ctx, c, handler.usersColl)
+	if !ok {
+		return
+	}
+
+	res, err := handler.addressesColl.DeleteOne(ctx, bson.M{"user_id": user.ID, "workspace_id": workspaceID(ctx)})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if res.DeletedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no inbound email address"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Inbound email address deleted"})
+}
+
+// skippedAttachment - an attachment of an email which wasn't stored
+type skippedAttachment struct {
+	FileName string `json:"file_name"`
+	Reason   string `json:"reason"`
+}
+
+// ReceiveEmailHandler - the webhook of the mail provider, turns an email into a task of the owner of the address
+// it was sent to. Takes the raw message as the body, or in the email or body-mime field of a form, along with
+// the envelope recipients as recipient or a SendGrid style envelope when the provider passes them; otherwise
+// the recipients are read from the headers. The subject is the title, read with the quick-add syntax for due
+// dates, labels and priority, the text of the body the comment, and the attachments of allowed types are stored.
+// Public, authenticated with the secret shared with the provider.
+func (handler *InboundEmailHandler) ReceiveEmailHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 60*time.Second)
+	defer cancel()
+
+	if handler.secret == "" || handler.domain == "" {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "inbound email is not configured"})
+		return
+	}
+	secret := c.GetHeader(inboundSecretHeader)
+	if secret == "" {
+		secret = c.Query("secret")
+	}
+	if subtle.ConstantTimeCompare([]byte(secret), []byte(handler.secret)) != 1 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid secret"})
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxInboundEmailSize)
+	var raw io.Reader = c.Request.Body
+	recipients := c.QueryArray("recipient")
+
+	mediaType, _, _ := mime.ParseMediaType(c.GetHeader("Content-Type"))
+	if mediaType == "multipart/form-data" || mediaType == "application/x-www-form-urlencoded" {
+		message := c.PostForm("email")
+		if message == "" {
+			message = c.PostForm("body-mime")
+		}
+		if message == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "the raw message is expected in the email or body-mime field"})
+			return
+		}
+		raw = strings.NewReader(message)
+
+		recipients = append(recipients, c.PostFormArray("recipient")...)
+		if envelope := c.PostForm("envelope"); envelope != "" {
+			var parsed struct {
+				To []string `json:"to"`
+			}
+			if err := json.Unmarshal([]byte(envelope), &parsed); err == nil {
+				recipients = append(recipients, parsed.To...)
+			}
+		}
+	}
+
+	email, err := inbound.Parse(raw, maxAttachmentSize())
+	var maxBytesErr *http.MaxBytesError
+	if errors.Is(err, inbound.ErrTooLarge) || errors.As(err, &maxBytesErr) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	address, err := handler.addressFor(ctx, append(recipients, email.Recipients...))
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown recipient"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The address stops working once its owner leaves the workspace
+	var workspace model.Workspace
+	err = handler.workspacesColl.FindOne(ctx, bson.M{"_id": address.WorkspaceID}).Decode(&workspace)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown recipient"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if _, member := workspace.Member(address.UserID); !member {
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown recipient"})
+		return
+	}
+	ctx = tenant.WithWorkspace(ctx, workspace)
+
+	var user model.User
+	if err := handler.usersColl.FindOne(ctx, bson.M{"_id": address.UserID}).Decode(&user); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown recipient"})
+		return
+	}
+	// The history names the owner of the address as the author of the task
+	c.Set("username", user.Username)
+
+	// Providers retry deliveries they aren't sure about, the Message-ID recognises them
+	task := newTaskFromEmail(email)
+	if task.ExternalID != "" {
+		var existing model.Task
+		err := handler.tasks.tasksColl.FindOne(ctx, bson.M{"user_id": user.ID, "external_id": task.ExternalID}).Decode(&existing)
+		if err == nil {
+			c.JSON(http.StatusOK, gin.H{"task": existing, "duplicate": true})
+			return
+		} else if err != mongo.ErrNoDocuments {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	task, ok := handler.tasks.createTask(ctx, c, user, task)
+	if !ok {
+		return
+	}
+
+	attachments := make([]model.Attachment, 0, len(email.Attachments))
+	skipped := make([]skippedAttachment, 0)
+	for _, file := range email.Attachments {
+		attachment, err := handler.attachments.saveAttachment(ctx, task, user, file.FileName, bytes.NewReader(file.Content), int64(len(file.Content)))
+		if err != nil {
+			skipped = append(skipped, skippedAttachment{FileName: file.FileName, Reason: err.Error()})
+			continue
+		}
+		attachments = append(attachments, attachment)
+	}
+
+	_, err = handler.addressesColl.UpdateOne(ctx, bson.M{"_id": address.ID}, bson.M{"$set": bson.M{"last_received_at": time.Now()}})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"task": task, "attachments": attachments, "skipped": skipped})
+}
+
+// addressFor - the first of the recipients which is an inbound address, "token+anything@domain" included.
+// Returns mongo.ErrNoDocuments when there is none.
+func (handler *InboundEmailHandler) addressFor(ctx context.Context, recipients []string) (model.InboundAddress, error) {
+	var address model.InboundAddress
+	for _, recipient := range recipients {
+		at := strings.LastIndex(recipient, "@")
+		if at < 0 || !strings.EqualFold(strings.Trim(recipient[at+1:], "> "), handler.domain) {
+			continue
+		}
+		token := strings.ToLower(strings.Trim(recipient[:at], "< "))
+		token, _, _ = strings.Cut(token, "+")
+
+		err := handler.addressesColl.FindOne(ctx, bson.M{"token_hash": hashToken(token)}).Decode(&address)
+		if err != mongo.ErrNoDocuments {
+			return address, err
+		}
+	}
+	return address, mongo.ErrNoDocuments
+}
+
+// newTaskFromEmail - the subject read as quick-add text, in the time zone the email was sent from
+func newTaskFromEmail(email *inbound.Email) model.Task {
+	task := model.Task{Title: email.Subject, Comment: truncateText(email.Text, maxCommentLength)}
+	if email.MessageID != "" {
+		task.ExternalID = "email:" + email.MessageID
+	}
+
+	now := time.Now()
+	if !email.Date.IsZero() {
+		now = now.In(email.Date.Location())
+	}
+	if parsed, err := quickadd.Parse(email.Subject, now); err == nil {
+		task.Title = parsed.Title
+		task.DueDate = parsed.Due
+		task.Recurrence = recurrenceFromQuickAdd(parsed.Recurrence)
+		task.Labels = parsed.Labels
+		task.Priority = parsed.Priority
+	}
+	if task.Title == "" && email.From != "" {
+		task.Title = "Email from " + email.From
+	} else if task.Title == "" {
+		task.Title = "(no subject)"
+	}
+	return task
+}
+
+// truncateText - cuts the text to at most limit bytes, at a character boundary
+func truncateText(text string, limit int) string {
+	if len(text) <= limit {
+		return text
+	}
+	return strings.ToValidUTF8(text[:limit], "")
+}
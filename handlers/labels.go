@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"strings"
+
+	"github.com/utpal74/track-my-tasks-backend/model"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// normalizeLabels - trims labels and drops empty and duplicate ones, case-insensitively
+func normalizeLabels(labels []string) []string {
+	if len(labels) == 0 {
+		return nil
+	}
+
+	seen := make(map[string]bool, len(labels))
+	normalized := make([]string, 0, len(labels))
+	for _, label := range labels {
+		label = strings.TrimSpace(label)
+		key := strings.ToLower(label)
+		if label == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		normalized = append(normalized, label)
+	}
+	return normalized
+}
+
+// prepareChecklist - gives new checklist items an id and drops the ones without text
+func prepareChecklist(items []model.ChecklistItem) []model.ChecklistItem {
+	if len(items) == 0 {
+		return nil
+	}
+
+	prepared := make([]model.ChecklistItem, 0, len(items))
+	for _, item := range items {
+		item.Text = strings.TrimSpace(item.Text)
+		if item.Text == "" {
+			continue
+		}
+		if item.ID.IsZero() {
+			item.ID = primitive.NewObjectID()
+		}
+		prepared = append(prepared, item)
+	}
+	return prepared
+}
+
+func hasLabel(task model.Task, label string) bool {
+	for _, taskLabel := range task.Labels {
+		if strings.EqualFold(taskLabel, label) {
+			return true
+		}
+	}
+	return false
+}
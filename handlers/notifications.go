@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/utpal74/track-my-tasks-backend/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const maxNotifications = 100
+
+type NotificationsHandler struct {
+	ctx               context.Context
+	notificationsColl *mongo.Collection
+	usersColl         *mongo.Collection
+}
+
+func NewNotificationsHandler(ctx context.Context, notificationsColl *mongo.Collection, usersColl *mongo.Collection) *NotificationsHandler {
+	return &NotificationsHandler{
+		ctx:               ctx,
+		notificationsColl: notificationsColl,
+		usersColl:         usersColl,
+	}
+}
+
+// GetNotificationsHandler - the latest notifications of the signed in user, from every workspace, newest first.
+// ?unread=true leaves out the ones already read.
+func (handler *NotificationsHandler) GetNotificationsHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	user, ok := currentUser(ctx, c, handler.usersColl)
+	if !ok {
+		return
+	}
+
+	filter := bson.M{"user_id": user.ID}
+	if value := c.Query("unread"); value != "" {
+		unread, err := strconv.ParseBool(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid unread filter: " + value})
+			return
+		}
+		if unread {
+			filter["read"] = false
+		}
+	}
+
+	cur, err := handler.notificationsColl.Find(ctx, filter, options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetLimit(maxNotifications))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer cur.Close(ctx)
+
+	notifications := make([]model.Notification, 0)
+	if err := cur.All(ctx, &notifications); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to decode notifications"})
+		return
+	}
+
+	c.JSON(http.StatusOK, notifications)
+}
+
+// MarkNotificationReadHandler - mark one of the user's notifications as read
+func (handler *NotificationsHandler) MarkNotificationReadHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	user, ok := currentUser(ctx, c, handler.usersColl)
+	if !ok {
+		return
+	}
+
+	notificationID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id format"})
+		return
+	}
+
+	result, err := handler.notificationsColl.UpdateOne(ctx, bson.M{"_id": notificationID, "user_id": user.ID},
+		bson.M{"$set": bson.M{"read": true}})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "notification not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "notification read", "id": notificationID})
+}
@@ -0,0 +1,346 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/utpal74/track-my-tasks-backend/logger"
+	"github.com/utpal74/track-my-tasks-backend/model"
+	"github.com/utpal74/track-my-tasks-backend/rank"
+	"github.com/utpal74/track-my-tasks-backend/tenant"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+const (
+	// ranks longer than this get spread out again by RebalanceRanks
+	maxRankLength = 8
+	// rankReserveAttempts - how often reserveRanks retries when other tasks of the user are created meanwhile
+	rankReserveAttempts = 5
+)
+
+type moveRequest struct {
+	Before string `json:"before"` // Place the task right before this task
+	After  string `json:"after"`  // or right after this one
+}
+
+// MoveTaskHandler - change the manual position of a task relative to another task
+func (handler *TasksHandler) MoveTaskHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 8*time.Second)
+	defer cancel()
+
+	user, ok := handler.currentUser(ctx, c)
+	if !ok {
+		return
+	}
+
+	taskID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id format"})
+		return
+	}
+
+	var req moveRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if (req.Before == "") == (req.After == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "exactly one of before or after is required"})
+		return
+	}
+
+	anchorHex := req.Before
+	if anchorHex == "" {
+		anchorHex = req.After
+	}
+	anchorID, err := primitive.ObjectIDFromHex(anchorHex)
+	if err != nil || anchorID == taskID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid anchor task id"})
+		return
+	}
+
+	tasks, err := handler.loadUserTasks(ctx, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Tasks created before manual ordering existed have no rank yet, give every task one first
+	for _, task := range tasks {
+		if task.Rank == "" {
+			if tasks, err = handler.rebalanceUserRanks(ctx, user.ID); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "unable to assign ranks: " + err.Error()})
+				return
+			}
+			break
+		}
+	}
+
+	lower, upper, found := moveNeighbours(tasks, taskID, anchorID, req.Before != "")
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "task not found"})
+		return
+	}
+
+	// Neighbours which share a rank have nothing between them, spread the ranks out first
+	if lower != "" && lower == upper {
+		if tasks, err = handler.rebalanceUserRanks(ctx, user.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "unable to assign ranks: " + err.Error()})
+			return
+		}
+		lower, upper, _ = moveNeighbours(tasks, taskID, anchorID, req.Before != "")
+	}
+
+	newRank, err := rank.Between(lower, upper)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "unable to compute rank: " + err.Error()})
+		return
+	}
+
+	before, err := handler.taskSnapshot(ctx, taskID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := time.Now()
+	err = handler.commitChange(ctx, c, model.TaskActionMoved, taskID, before, func(ctx context.Context) error {
+		_, err := handler.tasksColl.UpdateOne(ctx, bson.M{"_id": taskID}, bson.M{"$set": bson.M{"rank": newRank, "updated_at": now}})
+		if err != nil {
+			return fmt.Errorf("unable to update: %w", err)
+		}
+
+		_, err = handler.usersColl.UpdateOne(ctx, bson.M{"_id": user.ID, "task._id": taskID},
+			bson.M{"$set": bson.M{"task.$.rank": newRank, "task.$.updated_at": now}})
+		if err != nil {
+			return fmt.Errorf("Failed to update task in user collection: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	handler.invalidateTaskCaches(ctx, taskID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "task moved", "id": taskID, "rank": newRank})
+}
+
+// moveNeighbours - the ranks a task moved right before (or after) the anchor goes between, an empty rank
+// standing for the start (or the end) of the list. Reports whether both tasks were found.
+func moveNeighbours(tasks []model.Task, taskID, anchorID primitive.ObjectID, before bool) (string, string, bool) {
+	sortTasks(tasks, "manual")
+
+	// Ignore the task being moved
+	ordered := make([]model.Task, 0, len(tasks))
+	found := false
+	for _, task := range tasks {
+		if task.ID == taskID {
+			found = true
+			continue
+		}
+		ordered = append(ordered, task)
+	}
+
+	anchorIndex := -1
+	for i, task := range ordered {
+		if task.ID == anchorID {
+			anchorIndex = i
+			break
+		}
+	}
+	if !found || anchorIndex < 0 {
+		return "", "", false
+	}
+
+	var lower, upper string
+	if before {
+		upper = ordered[anchorIndex].Rank
+		if anchorIndex > 0 {
+			lower = ordered[anchorIndex-1].Rank
+		}
+	} else {
+		lower = ordered[anchorIndex].Rank
+		if anchorIndex+1 < len(ordered) {
+			upper = ordered[anchorIndex+1].Rank
+		}
+	}
+	return lower, upper, true
+}
+
+// RebalanceRanks - background job, spreads out the ranks of every user whose ranks have grown too long
+func (handler *TasksHandler) RebalanceRanks(ctx context.Context) error {
+	log := logger.FromCtx(ctx)
+	ctx = tenant.Unscoped(ctx) // ranks are per user, across their workspaces
+
+	pattern := fmt.Sprintf("^.{%d,}", maxRankLength+1)
+	userIDs, err := handler.tasksColl.Distinct(ctx, "user_id", bson.M{"rank": bson.M{"$regex": pattern}})
+	if err != nil {
+		return err
+	}
+
+	for _, value := range userIDs {
+		userID, ok := value.(primitive.ObjectID)
+		if !ok {
+			continue
+		}
+		if _, err := handler.rebalanceUserRanks(ctx, userID); err != nil {
+			return err
+		}
+		log.Info("rebalanced task ranks", zap.String("user_id", userID.Hex()))
+	}
+	return nil
+}
+
+// rebalanceUserRanks - rewrites the ranks of all tasks of the user, keeping their current manual order, which
+// also separates tasks sharing a rank. Returns the tasks with their new ranks.
+func (handler *TasksHandler) rebalanceUserRanks(ctx context.Context, userID primitive.ObjectID) ([]model.Task, error) {
+	tasks, err := handler.loadUserTasks(ctx, userID)
+	if err != nil || len(tasks) == 0 {
+		return tasks, err
+	}
+
+	sortTasks(tasks, "manual")
+	ranks := rank.Spread(len(tasks))
+
+	models := make([]mongo.WriteModel, 0, len(tasks))
+	userSet := bson.M{}
+	arrayFilters := make([]interface{}, 0, len(tasks))
+	for i := range tasks {
+		tasks[i].Rank = ranks[i]
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": tasks[i].ID}).
+			SetUpdate(bson.M{"$set": bson.M{"rank": ranks[i]}}))
+
+		identifier := fmt.Sprintf("t%d", i)
+		userSet["task.$["+identifier+"].rank"] = ranks[i]
+		arrayFilters = append(arrayFilters, bson.M{identifier + "._id": tasks[i].ID})
+	}
+
+	if _, err := handler.tasksColl.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false)); err != nil {
+		return nil, err
+	}
+
+	// Reservations start over from the new ranks, see reserveRanks
+	_, err = handler.usersColl.UpdateOne(ctx, bson.M{"_id": userID}, bson.M{"$set": userSet, "$unset": bson.M{"rank_tails": ""}},
+		options.Update().SetArrayFilters(options.ArrayFilters{Filters: arrayFilters}))
+	if err != nil {
+		return nil, err
+	}
+
+	handler.invalidateTasksCache(ctx, userID)
+	return tasks, nil
+}
+
+// nextRank - returns a rank placing a new task after all existing tasks of the user
+func (handler *TasksHandler) nextRank(ctx context.Context, userID primitive.ObjectID) (string, error) {
+	ranks, err := reserveRanks(ctx, handler.tasksColl, handler.usersColl, userID, 1)
+	if err != nil {
+		return "", err
+	}
+	return ranks[0], nil
+}
+
+// reserveRanks - returns n ranks, in order, placing new tasks after all existing tasks of the user. The last rank
+// handed out is kept on the user per workspace and advanced with a compare-and-set, so tasks created at the same
+// time never get the same rank. Unused ranks only leave a gap.
+func reserveRanks(ctx context.Context, tasksColl *tenant.Collection, usersColl *mongo.Collection, userID primitive.ObjectID, n int) ([]string, error) {
+	field := rankTailField(ctx)
+	for attempt := 0; attempt < rankReserveAttempts; attempt++ {
+		var user struct {
+			RankTails map[string]string `bson:"rank_tails"`
+		}
+		err := usersColl.FindOne(ctx, bson.M{"_id": userID}, options.FindOne().SetProjection(bson.M{field: 1})).Decode(&user)
+		if err != nil {
+			return nil, err
+		}
+		tail, reserved := user.RankTails[workspaceID(ctx).Hex()]
+
+		var last model.Task
+		err = tasksColl.FindOne(ctx,
+			bson.M{"user_id": userID, "rank": bson.M{"$exists": true}},
+			options.FindOne().SetSort(bson.M{"rank": -1}),
+		).Decode(&last)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return nil, err
+		}
+
+		previous := max(tail, last.Rank)
+		ranks := make([]string, n)
+		for i := range ranks {
+			if previous, err = rank.After(previous); err != nil {
+				return nil, err
+			}
+			ranks[i] = previous
+		}
+
+		filter := bson.M{"_id": userID, field: tail}
+		if !reserved {
+			filter[field] = bson.M{"$exists": false}
+		}
+		result, err := usersColl.UpdateOne(ctx, filter, bson.M{"$set": bson.M{field: previous}})
+		if err != nil {
+			return nil, err
+		}
+		if result.MatchedCount > 0 {
+			return ranks, nil
+		}
+	}
+	return nil, errors.New("too many tasks created at the same time, try again")
+}
+
+// rankTailField - the field of the user holding the last rank reserved in the workspace of the context
+func rankTailField(ctx context.Context) string {
+	return "rank_tails." + workspaceID(ctx).Hex()
+}
+
+// sortTasks - orders tasks in place for the "sort" query parameter of the list endpoint.
+// Unknown or empty modes keep the storage order.
+func sortTasks(tasks []model.Task, mode string) {
+	switch mode {
+	case "manual":
+		// Unranked (legacy) tasks go last, oldest first
+		sort.SliceStable(tasks, func(i, j int) bool {
+			a, b := tasks[i], tasks[j]
+			if (a.Rank == "") != (b.Rank == "") {
+				return a.Rank != ""
+			}
+			if a.Rank != b.Rank {
+				return a.Rank < b.Rank
+			}
+			return a.CreatedAt.Before(b.CreatedAt)
+		})
+	case "priority":
+		// Most pressing first, then earliest due date
+		sort.SliceStable(tasks, func(i, j int) bool {
+			a, b := model.PriorityWeight(tasks[i].Priority), model.PriorityWeight(tasks[j].Priority)
+			if a != b {
+				return a > b
+			}
+			return dueBefore(tasks[i], tasks[j])
+		})
+	case "due":
+		sort.SliceStable(tasks, func(i, j int) bool {
+			return dueBefore(tasks[i], tasks[j])
+		})
+	}
+}
+
+// dueBefore - orders by due date, tasks without one last
+func dueBefore(a, b model.Task) bool {
+	if a.DueDate == nil || b.DueDate == nil {
+		return a.DueDate != nil && b.DueDate == nil
+	}
+	return a.DueDate.Before(*b.DueDate)
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/utpal74/track-my-tasks-backend/model"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestMoveNeighbours(t *testing.T) {
+	ids := make([]primitive.ObjectID, 5)
+	for i := range ids {
+		ids[i] = primitive.NewObjectID()
+	}
+	created := time.Date(2026, time.March, 11, 10, 0, 0, 0, time.UTC)
+	list := func(ranks ...string) []model.Task {
+		tasks := make([]model.Task, len(ranks))
+		for i, rank := range ranks {
+			tasks[i] = model.Task{ID: ids[i], Rank: rank, CreatedAt: created.Add(time.Duration(i) * time.Minute)}
+		}
+		// Stored in reverse, moveNeighbours sorts them
+		for i, j := 0, len(tasks)-1; i < j; i, j = i+1, j-1 {
+			tasks[i], tasks[j] = tasks[j], tasks[i]
+		}
+		return tasks
+	}
+
+	tests := []struct {
+		name                 string
+		tasks                []model.Task
+		task, anchor         primitive.ObjectID
+		before               bool
+		wantLower, wantUpper string
+		wantFound            bool
+	}{
+		{name: "before the first", tasks: list("F", "V", "l"), task: ids[2], anchor: ids[0], before: true, wantUpper: "F", wantFound: true},
+		{name: "after the last", tasks: list("F", "V", "l"), task: ids[0], anchor: ids[2], wantLower: "l", wantFound: true},
+		{name: "before a middle task", tasks: list("F", "V", "l"), task: ids[2], anchor: ids[1], before: true, wantLower: "F", wantUpper: "V", wantFound: true},
+		{name: "after a middle task skips the moved one", tasks: list("F", "V", "l"), task: ids[2], anchor: ids[1], wantLower: "V", wantFound: true},
+		{name: "neighbours sharing a rank", tasks: list("F", "V", "V", "l"), task: ids[3], anchor: ids[1], wantLower: "V", wantUpper: "V", wantFound: true},
+		{name: "unranked tasks go last", tasks: list("F", "", "V"), task: ids[0], anchor: ids[2], wantLower: "V", wantFound: true},
+		{name: "unknown task", tasks: list("F", "V"), task: ids[4], anchor: ids[0], before: true},
+		{name: "unknown anchor", tasks: list("F", "V"), task: ids[0], anchor: ids[4], before: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lower, upper, found := moveNeighbours(tt.tasks, tt.task, tt.anchor, tt.before)
+			if found != tt.wantFound {
+				t.Fatalf("found = %v, want %v", found, tt.wantFound)
+			}
+			if lower != tt.wantLower || upper != tt.wantUpper {
+				t.Errorf("neighbours = %q, %q, want %q, %q", lower, upper, tt.wantLower, tt.wantUpper)
+			}
+		})
+	}
+}
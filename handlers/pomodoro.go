@@ -0,0 +1,477 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/utpal74/track-my-tasks-backend/model"
+	"github.com/utpal74/track-my-tasks-backend/tenant"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// Sessions are kept this long after their last phase ended
+	pomodoroSessionTTL = 24 * time.Hour
+	maxPomodoroHistory = 200
+	maxPomodoroDays    = 90
+)
+
+var defaultPomodoroSettings = model.PomodoroSettings{Work: 25, ShortBreak: 5, LongBreak: 15, LongBreakEvery: 4}
+
+type PomodoroHandler struct {
+	ctx           context.Context
+	pomodorosColl *tenant.Collection
+	tasksColl     *tenant.Collection
+	projectsColl  *tenant.Collection
+	usersColl     *mongo.Collection
+	redisClient   *redis.Client
+}
+
+func NewPomodoroHandler(ctx context.Context, pomodorosColl *tenant.Collection, tasksColl *tenant.Collection, projectsColl *tenant.Collection, usersColl *mongo.Collection, redisClient *redis.Client) *PomodoroHandler {
+	return &PomodoroHandler{
+		ctx:           ctx,
+		pomodorosColl: pomodorosColl,
+		tasksColl:     tasksColl,
+		projectsColl:  projectsColl,
+		usersColl:     usersColl,
+		redisClient:   redisClient,
+	}
+}
+
+// pomodoroState - a session as returned to clients
+type pomodoroState struct {
+	model.PomodoroSession
+	RemainingSeconds int64 `json:"remaining_seconds"` // Left in the current phase, 0 while idle
+}
+
+// pomodoroDay - the pomodoros of one day
+type pomodoroDay struct {
+	Date         string `json:"date"`
+	Completed    int    `json:"completed"`
+	Interrupted  int    `json:"interrupted"`
+	FocusMinutes int    `json:"focus_minutes"`
+}
+
+// StartPomodoroHandler - start a work phase on a task. Settings not in the body are taken from the current session or the
+// defaults (25/5/15 minutes, a long break every 4 pomodoros). A running work phase is only interrupted with ?switch=true.
+func (handler *PomodoroHandler) StartPomodoroHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	var settings model.PomodoroSettings
+	if err := c.ShouldBindJSON(&settings); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := currentUser(ctx, c, handler.usersColl)
+	if !ok {
+		return
+	}
+
+	task, ok := taskFromPath(ctx, c, handler.tasksColl, handler.projectsColl, user)
+	if !ok {
+		return
+	}
+
+	session, err := handler.loadSession(ctx, user)
+	if err != nil && err != redis.Nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	running := err == nil
+
+	if running && session.Phase == model.PomodoroWork {
+		if c.Query("switch") != "true" {
+			c.JSON(http.StatusConflict, gin.H{"error": "a pomodoro is running", "pomodoro": newPomodoroState(session)})
+			return
+		}
+		if err := handler.interrupt(ctx, user, session); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "unable to stop the running pomodoro: " + err.Error()})
+			return
+		}
+	}
+
+	fallback := defaultPomodoroSettings
+	completed := 0
+	if running {
+		fallback = session.Settings
+		completed = session.Completed
+	}
+	settings = mergePomodoroSettings(settings, fallback)
+	if err := validatePomodoroSettings(settings); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := time.Now()
+	ends := now.Add(time.Duration(settings.Work) * time.Minute)
+	session = model.PomodoroSession{
+		TaskID:         task.ID,
+		WorkspaceID:    task.WorkspaceID,
+		Settings:       settings,
+		Phase:          model.PomodoroWork,
+		Completed:      completed,
+		PhaseStartedAt: now,
+		PhaseEndsAt:    &ends,
+	}
+	if err := handler.saveSession(ctx, user.ID, session); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, newPomodoroState(session))
+}
+
+// GetPomodoroHandler - the pomodoro session of the signed in user, advanced to the current phase
+func (handler *PomodoroHandler) GetPomodoroHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	user, ok := currentUser(ctx, c, handler.usersColl)
+	if !ok {
+		return
+	}
+
+	session, err := handler.loadSession(ctx, user)
+	if err == redis.Nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no pomodoro session"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, newPomodoroState(session))
+}
+
+// StopPomodoroHandler - end the session, a running work phase is kept as an interrupted pomodoro
+func (handler *PomodoroHandler) StopPomodoroHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	user, ok := currentUser(ctx, c, handler.usersColl)
+	if !ok {
+		return
+	}
+
+	session, err := handler.loadSession(ctx, user)
+	if err == redis.Nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no pomodoro session"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if session.Phase == model.PomodoroWork {
+		if err := handler.interrupt(ctx, user, session); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if err := handler.redisClient.Del(ctx, pomodoroKey(user.ID)).Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Pomodoro session stopped", "completed": session.Completed})
+}
+
+// GetTaskPomodorosHandler - the pomodoros of everyone on a task, latest first
+func (handler *PomodoroHandler) GetTaskPomodorosHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	user, ok := currentUser(ctx, c, handler.usersColl)
+	if !ok {
+		return
+	}
+
+	task, ok := taskFromPath(ctx, c, handler.tasksColl, handler.projectsColl, user)
+	if !ok {
+		return
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "start", Value: -1}}).SetLimit(maxPomodoroHistory)
+	cur, err := handler.pomodorosColl.Find(ctx, bson.M{"task_id": task.ID}, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer cur.Close(ctx)
+
+	pomodoros := make([]model.Pomodoro, 0)
+	if err := cur.All(ctx, &pomodoros); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to decode pomodoros"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"pomodoros": pomodoros, "completed": task.Pomodoros})
+}
+
+// PomodoroStatsHandler - daily pomodoro counts of the signed in user in the workspace.
+// Query: days (default 7, today included) and tz (IANA name, default UTC).
+func (handler *PomodoroHandler) PomodoroStatsHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	days, err := strconv.Atoi(c.DefaultQuery("days", "7"))
+	if err != nil || days < 1 || days > maxPomodoroDays {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "days must be between 1 and 90"})
+		return
+	}
+
+	location, err := time.LoadLocation(c.DefaultQuery("tz", "UTC"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown time zone"})
+		return
+	}
+
+	user, ok := currentUser(ctx, c, handler.usersColl)
+	if !ok {
+		return
+	}
+
+	now := time.Now().In(location)
+	from := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, location).AddDate(0, 0, -(days - 1))
+
+	cur, err := handler.pomodorosColl.Find(ctx, bson.M{"user_id": user.ID, "start": bson.M{"$gte": from}})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer cur.Close(ctx)
+
+	pomodoros := make([]model.Pomodoro, 0)
+	if err := cur.All(ctx, &pomodoros); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to decode pomodoros"})
+		return
+	}
+
+	stats := make([]pomodoroDay, days)
+	index := make(map[string]int, days)
+	for i := range stats {
+		stats[i].Date = from.AddDate(0, 0, i).Format("2006-01-02")
+		index[stats[i].Date] = i
+	}
+
+	total := pomodoroDay{}
+	for _, pomodoro := range pomodoros {
+		i, found := index[pomodoro.Start.In(location).Format("2006-01-02")]
+		if !found {
+			continue
+		}
+		minutes := int(pomodoro.End.Sub(pomodoro.Start).Minutes())
+		if pomodoro.Completed {
+			stats[i].Completed++
+			total.Completed++
+		} else {
+			stats[i].Interrupted++
+			total.Interrupted++
+		}
+		stats[i].FocusMinutes += minutes
+		total.FocusMinutes += minutes
+	}
+
+	c.JSON(http.StatusOK, gin.H{"days": stats, "completed": total.Completed, "interrupted": total.Interrupted, "focus_minutes": total.FocusMinutes})
+}
+
+// DeleteTaskPomodoros - purge hook, removes the pomodoro history of a permanently deleted task
+func (handler *PomodoroHandler) DeleteTaskPomodoros(ctx context.Context, task model.Task) error {
+	_, err := handler.pomodorosColl.DeleteMany(ctx, bson.M{"task_id": task.ID})
+	return err
+}
+
+// loadSession - reads the session of the user and catches it up with the clock, recording the work phases which
+// ended since it was last read. Returns redis.Nil without a session.
+func (handler *PomodoroHandler) loadSession(ctx context.Context, user model.User) (model.PomodoroSession, error) {
+	var session model.PomodoroSession
+	data, err := handler.redisClient.Get(ctx, pomodoroKey(user.ID)).Bytes()
+	if err != nil {
+		return session, err
+	}
+	if err := json.Unmarshal(data, &session); err != nil {
+		return session, err
+	}
+
+	phase := session.Phase
+	finished := advancePomodoro(&session, time.Now())
+	for _, pomodoro := range finished {
+		pomodoro.UserID = user.ID
+		if err := handler.record(ctx, pomodoro); err != nil {
+			return session, err
+		}
+	}
+
+	if phase != session.Phase {
+		if err := handler.saveSession(ctx, user.ID, session); err != nil {
+			return session, err
+		}
+	}
+	return session, nil
+}
+
+func (handler *PomodoroHandler) saveSession(ctx context.Context, userID primitive.ObjectID, session model.PomodoroSession) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+
+	ttl := pomodoroSessionTTL
+	if session.PhaseEndsAt != nil {
+		ttl += time.Until(*session.PhaseEndsAt)
+	}
+	return handler.redisClient.Set(ctx, pomodoroKey(userID), data, ttl).Err()
+}
+
+// interrupt - records the running work phase of the session as interrupted
+func (handler *PomodoroHandler) interrupt(ctx context.Context, user model.User, session model.PomodoroSession) error {
+	return handler.record(ctx, model.Pomodoro{
+		TaskID:      session.TaskID,
+		UserID:      user.ID,
+		WorkspaceID: session.WorkspaceID,
+		Start:       session.PhaseStartedAt,
+		End:         time.Now(),
+		Minutes:     session.Settings.Work,
+	})
+}
+
+// record - stores a pomodoro in the workspace of its session, which may not be the current one. Recording the same
+// work phase twice, as concurrent reads of a session may, is a no-op; the unique index on user, workspace and start
+// settles concurrent upserts.
+func (handler *PomodoroHandler) record(ctx context.Context, pomodoro model.Pomodoro) error {
+	ctx = tenant.Unscoped(ctx)
+	result, err := handler.pomodorosColl.UpdateOne(ctx,
+		bson.M{"user_id": pomodoro.UserID, "workspace_id": pomodoro.WorkspaceID, "start": pomodoro.Start},
+		bson.M{"$setOnInsert": bson.M{
+			"_id":        primitive.NewObjectID(),
+			"task_id":    pomodoro.TaskID,
+			"end":        pomodoro.End,
+			"minutes":    pomodoro.Minutes,
+			"completed":  pomodoro.Completed,
+			"created_at": time.Now(),
+		}},
+		options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if result.UpsertedCount == 0 || !pomodoro.Completed {
+		return nil
+	}
+
+	var task model.Task
+	err = handler.tasksColl.FindOneAndUpdate(ctx, bson.M{"_id": pomodoro.TaskID, "workspace_id": pomodoro.WorkspaceID},
+		bson.M{"$inc": bson.M{"pomodoros": 1}}).Decode(&task)
+	if err == mongo.ErrNoDocuments {
+		log.Printf("Task %s of a pomodoro no longer exists", pomodoro.TaskID.Hex())
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	_, err = handler.usersColl.UpdateOne(ctx, bson.M{"_id": task.UserID, "task._id": task.ID},
+		bson.M{"$inc": bson.M{"task.$.pomodoros": 1}})
+	if err != nil {
+		return err
+	}
+
+	invalidateMemberCaches(ctx, handler.redisClient, handler.projectsColl, task)
+	return nil
+}
+
+// advancePomodoro - moves the session through the phases which ended before now, returning the completed work phases.
+// Work is followed by a break, a break by idling until the next work phase is started.
+func advancePomodoro(session *model.PomodoroSession, now time.Time) []model.Pomodoro {
+	var finished []model.Pomodoro
+	for session.PhaseEndsAt != nil && !now.Before(*session.PhaseEndsAt) {
+		ended := *session.PhaseEndsAt
+		if session.Phase != model.PomodoroWork {
+			session.Phase = model.PomodoroIdle
+			session.PhaseStartedAt = ended
+			session.PhaseEndsAt = nil
+			break
+		}
+
+		finished = append(finished, model.Pomodoro{
+			TaskID:      session.TaskID,
+			WorkspaceID: session.WorkspaceID,
+			Start:       session.PhaseStartedAt,
+			End:         ended,
+			Minutes:     session.Settings.Work,
+			Completed:   true,
+		})
+		session.Completed++
+
+		length := session.Settings.ShortBreak
+		session.Phase = model.PomodoroShortBreak
+		if session.Completed%session.Settings.LongBreakEvery == 0 {
+			length = session.Settings.LongBreak
+			session.Phase = model.PomodoroLongBreak
+		}
+		breakEnds := ended.Add(time.Duration(length) * time.Minute)
+		session.PhaseStartedAt = ended
+		session.PhaseEndsAt = &breakEnds
+	}
+	return finished
+}
+
+// mergePomodoroSettings - fills the unset lengths of settings from fallback
+func mergePomodoroSettings(settings, fallback model.PomodoroSettings) model.PomodoroSettings {
+	if settings.Work == 0 {
+		settings.Work = fallback.Work
+	}
+	if settings.ShortBreak == 0 {
+		settings.ShortBreak = fallback.ShortBreak
+	}
+	if settings.LongBreak == 0 {
+		settings.LongBreak = fallback.LongBreak
+	}
+	if settings.LongBreakEvery == 0 {
+		settings.LongBreakEvery = fallback.LongBreakEvery
+	}
+	return settings
+}
+
+func validatePomodoroSettings(settings model.PomodoroSettings) error {
+	switch {
+	case settings.Work < 1 || settings.Work > 120:
+		return errors.New("work_minutes must be between 1 and 120")
+	case settings.ShortBreak < 1 || settings.ShortBreak > 60:
+		return errors.New("break_minutes must be between 1 and 60")
+	case settings.LongBreak < 1 || settings.LongBreak > 60:
+		return errors.New("long_break_minutes must be between 1 and 60")
+	case settings.LongBreakEvery < 1 || settings.LongBreakEvery > 12:
+		return errors.New("long_break_every must be between 1 and 12")
+	}
+	return nil
+}
+
+func newPomodoroState(session model.PomodoroSession) pomodoroState {
+	state := pomodoroState{PomodoroSession: session}
+	if session.PhaseEndsAt != nil {
+		if remaining := time.Until(*session.PhaseEndsAt); remaining > 0 {
+			state.RemainingSeconds = int64(remaining.Seconds())
+		}
+	}
+	return state
+}
+
+// pomodoroKey - Redis key holding the pomodoro session of a user
+func pomodoroKey(userID primitive.ObjectID) string {
+	return "pomodoro:" + userID.Hex()
+}
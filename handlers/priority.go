@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/utpal74/track-my-tasks-backend/model"
+)
+
+// tasks due within this window count as urgent in the priority matrix
+const urgentWindow = 48 * time.Hour
+
+// taskPatch - update fields whose zero value is a valid new value
+type taskPatch struct {
+	Important *bool                  `json:"important"`
+	Estimate  *int                   `json:"estimate_minutes"` // 0 clears the estimate
+	Labels    *[]string              `json:"labels"`           // Replaces all labels, [] clears them
+	Checklist *[]model.ChecklistItem `json:"checklist"`        // Replaces the checklist, items without id are added
+}
+
+// priorityMatrix - open tasks bucketed into the Eisenhower quadrants
+type priorityMatrix struct {
+	Do        []model.Task `json:"do"`        // urgent and important
+	Schedule  []model.Task `json:"schedule"`  // important, not urgent
+	Delegate  []model.Task `json:"delegate"`  // urgent, not important
+	Eliminate []model.Task `json:"eliminate"` // neither
+}
+
+// MatrixHandler - returns the user's open tasks bucketed into urgent/important quadrants
+func (handler *TasksHandler) MatrixHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	user, ok := handler.currentUser(ctx, c)
+	if !ok {
+		return
+	}
+
+	redisKey, field := "matrix:"+user.ID.Hex(), cacheField(ctx)
+	cacheVal, err := handler.redisClient.HGet(ctx, redisKey, field).Result()
+	if err == nil {
+		log.Println("request from redis")
+		c.Data(http.StatusOK, "application/json; charset=utf-8", []byte(cacheVal))
+		return
+	} else if err != redis.Nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	log.Println("request to mongo DB")
+	tasks, err := handler.loadUserTasks(ctx, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	markBlocked(tasks)
+	fillLegacyStatus(tasks)
+	sortTasks(tasks, "priority")
+
+	matrix := buildPriorityMatrix(tasks, time.Now())
+	data, err := json.Marshal(matrix)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to marshal matrix data"})
+		return
+	}
+
+	// Urgency depends on the clock too, so keep this shorter lived than the task list
+	if err := handler.setCache(ctx, redisKey, field, data, 5*time.Minute); err != nil {
+		log.Printf("Failed to set cache for key %s: %v", redisKey, err)
+	}
+
+	c.JSON(http.StatusOK, matrix)
+}
+
+func buildPriorityMatrix(tasks []model.Task, now time.Time) priorityMatrix {
+	matrix := priorityMatrix{
+		Do:        make([]model.Task, 0),
+		Schedule:  make([]model.Task, 0),
+		Delegate:  make([]model.Task, 0),
+		Eliminate: make([]model.Task, 0),
+	}
+
+	for _, task := range tasks {
+		if task.Done {
+			continue
+		}
+
+		urgent := task.Priority == model.PriorityUrgent ||
+			(task.DueDate != nil && task.DueDate.Before(now.Add(urgentWindow)))
+		important := task.Important || model.PriorityWeight(task.Priority) >= model.PriorityWeight(model.PriorityHigh)
+
+		switch {
+		case urgent && important:
+			matrix.Do = append(matrix.Do, task)
+		case important:
+			matrix.Schedule = append(matrix.Schedule, task)
+		case urgent:
+			matrix.Delegate = append(matrix.Delegate, task)
+		default:
+			matrix.Eliminate = append(matrix.Eliminate, task)
+		}
+	}
+	return matrix
+}
+
+// respondWithTasks - applies the filter and sort query parameters of the list endpoint and writes the tasks
+func respondWithTasks(c *gin.Context, tasks []model.Task) {
+	tasks, err := filterTasks(tasks, c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	sortTasks(tasks, c.Query("sort"))
+	c.JSON(http.StatusOK, tasks)
+}
+
+// filterTasks - keeps the tasks matching the "priority" (comma separated), "important" and "assignee" query parameters.
+// The assignee is a username, "me" or "none" for unassigned tasks.
+func filterTasks(tasks []model.Task, c *gin.Context) ([]model.Task, error) {
+	wanted := make(map[string]bool)
+	if value := c.Query("priority"); value != "" {
+		for _, priority := range strings.Split(value, ",") {
+			if !model.ValidPriority(priority) {
+				return nil, fmt.Errorf("unknown priority: %s", priority)
+			}
+			wanted[priority] = true
+		}
+	}
+
+	var important *bool
+	if value := c.Query("important"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid important filter: %s", value)
+		}
+		important = &parsed
+	}
+
+	assignee := c.Query("assignee")
+	if assignee == "me" {
+		username, _ := c.Get("username")
+		assignee, _ = username.(string)
+	}
+
+	label := strings.TrimSpace(c.Query("label"))
+
+	filtered := make([]model.Task, 0, len(tasks))
+	for _, task := range tasks {
+		priority := task.Priority
+		if priority == "" {
+			priority = model.PriorityNone
+		}
+		if len(wanted) > 0 && !wanted[priority] {
+			continue
+		}
+		if important != nil && task.Important != *important {
+			continue
+		}
+		if assignee == "none" && len(task.Assignees) > 0 {
+			continue
+		}
+		if assignee != "" && assignee != "none" && !assignedTo(task, assignee) {
+			continue
+		}
+		if label != "" && !hasLabel(task, label) {
+			continue
+		}
+		filtered = append(filtered, task)
+	}
+	return filtered, nil
+}
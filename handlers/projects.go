@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/utpal74/track-my-tasks-backend/model"
+	"github.com/utpal74/track-my-tasks-backend/tenant"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type ProjectsHandler struct {
+	ctx          context.Context
+	projectsColl *tenant.Collection
+	tasksColl    *tenant.Collection
+	usersColl    *mongo.Collection
+	redisClient  *redis.Client
+}
+
+func NewProjectsHandler(ctx context.Context, projectsColl *tenant.Collection, tasksColl *tenant.Collection, usersColl *mongo.Collection, redisClient *redis.Client) *ProjectsHandler {
+	return &ProjectsHandler{
+		ctx:          ctx,
+		projectsColl: projectsColl,
+		tasksColl:    tasksColl,
+		usersColl:    usersColl,
+		redisClient:  redisClient,
+	}
+}
+
+// NewProjectHandler - create a project, with the default workflow unless statuses are given
+func (handler *ProjectsHandler) NewProjectHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	var project model.Project
+	if err := c.ShouldBindJSON(&project); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if project.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "project name is required"})
+		return
+	}
+
+	user, ok := currentUser(ctx, c, handler.usersColl)
+	if !ok {
+		return
+	}
+
+	if len(project.Statuses) == 0 {
+		project.Statuses = model.DefaultStatuses()
+	}
+	if err := model.ValidateStatuses(project.Statuses); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	project.ID = primitive.NewObjectID()
+	project.UserID = user.ID
+	project.WorkspaceID = workspaceID(ctx)
+	project.CreatedAt = time.Now()
+	project.UpdatedAt = time.Now()
+
+	if _, err := handler.projectsColl.InsertOne(ctx, project); errors.Is(err, tenant.ErrQuotaExceeded) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "the workspace has reached its project quota"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, project)
+}
+
+// GetAllProjectsHandler - list the projects of the signed in user
+func (handler *ProjectsHandler) GetAllProjectsHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	user, ok := currentUser(ctx, c, handler.usersColl)
+	if !ok {
+		return
+	}
+
+	cur, err := handler.projectsColl.Find(ctx, bson.M{"user_id": user.ID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer cur.Close(ctx)
+
+	projects := make([]model.Project, 0)
+	if err := cur.All(ctx, &projects); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to decode projects"})
+		return
+	}
+
+	c.JSON(http.StatusOK, projects)
+}
+
+// UpdateStatusesHandler - replace the workflow columns of a project.
+// A column can only be removed once no task of the project uses it.
+func (handler *ProjectsHandler) UpdateStatusesHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	user, ok := currentUser(ctx, c, handler.usersColl)
+	if !ok {
+		return
+	}
+
+	projectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id format"})
+		return
+	}
+
+	var statuses []model.StatusColumn
+	if err := c.ShouldBindJSON(&statuses); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := model.ValidateStatuses(statuses); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var project model.Project
+	if err := handler.projectsColl.FindOne(ctx, bson.M{"_id": projectID, "user_id": user.ID}).Decode(&project); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "project not found"})
+		return
+	}
+
+	keys := make([]string, 0, len(statuses))
+	for _, column := range statuses {
+		keys = append(keys, column.Key)
+	}
+
+	inUse, err := handler.tasksColl.CountDocuments(ctx, bson.M{"project_id": projectID, "status": bson.M{"$nin": keys}})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if inUse > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "move tasks out of the removed statuses first", "tasks": inUse})
+		return
+	}
+
+	project.Statuses = statuses
+	project.UpdatedAt = time.Now()
+	_, err = handler.projectsColl.UpdateOne(ctx, bson.M{"_id": projectID}, bson.M{"$set": bson.M{
+		"statuses":   project.Statuses,
+		"updated_at": project.UpdatedAt,
+	}})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "unable to update: " + err.Error()})
+		return
+	}
+
+	// A column may have switched category, keep the Done flag of its tasks in sync
+	for _, column := range statuses {
+		done := column.Category == model.StatusCategoryClosed
+		_, err = handler.tasksColl.UpdateMany(ctx,
+			bson.M{"project_id": projectID, "status": column.Key, "done": !done},
+			bson.M{"$set": bson.M{"done": done, "updated_at": project.UpdatedAt}},
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "unable to update tasks: " + err.Error()})
+			return
+		}
+
+		_, err = handler.usersColl.UpdateOne(ctx,
+			bson.M{"_id": user.ID},
+			bson.M{"$set": bson.M{"task.$[t].done": done, "task.$[t].updated_at": project.UpdatedAt}},
+			options.Update().SetArrayFilters(options.ArrayFilters{Filters: []interface{}{
+				bson.M{"t.project_id": projectID, "t.status": column.Key},
+			}}),
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update tasks in user collection: " + err.Error()})
+			return
+		}
+	}
+
+	// Tasks of the project are visible to its collaborators too
+	cacheKeys := userCacheKeys(user.ID)
+	for _, collaborator := range project.Collaborators {
+		cacheKeys = append(cacheKeys, userCacheKeys(collaborator.UserID)...)
+	}
+
+	log.Println("remove data from redis")
+	handler.redisClient.Del(ctx, cacheKeys...)
+
+	c.JSON(http.StatusOK, project)
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/utpal74/track-my-tasks-backend/model"
+	"github.com/utpal74/track-my-tasks-backend/quickadd"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// quickAddRequest - time_zone is the IANA name dates are read in (default UTC), dry_run only returns the parsed task
+type quickAddRequest struct {
+	Text      string              `json:"text" binding:"required"`
+	TimeZone  string              `json:"time_zone"`
+	ProjectID *primitive.ObjectID `json:"project_id"`
+	DryRun    bool                `json:"dry_run"`
+}
+
+// QuickAddHandler - create a task from one line of text, see package quickadd for the syntax.
+// With dry_run (in the body or the query) nothing is stored.
+func (handler *TasksHandler) QuickAddHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	var req quickAddRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.TimeZone == "" {
+		req.TimeZone = "UTC"
+	}
+	location, err := time.LoadLocation(req.TimeZone)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown time zone"})
+		return
+	}
+
+	parsed, err := quickadd.Parse(req.Text, time.Now().In(location))
+	if errors.Is(err, quickadd.ErrEmptyTitle) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "the text has no title"})
+		return
+	} else if errors.Is(err, quickadd.ErrDateOutOfRange) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "the due date is past the year 9999"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	task := model.Task{
+		Title:      parsed.Title,
+		ProjectID:  req.ProjectID,
+		DueDate:    parsed.Due,
+		Recurrence: recurrenceFromQuickAdd(parsed.Recurrence),
+		Labels:     parsed.Labels,
+		Priority:   parsed.Priority,
+	}
+
+	if req.DryRun || c.Query("dry_run") == "true" {
+		c.JSON(http.StatusOK, gin.H{"dry_run": true, "all_day": parsed.AllDay, "task": task})
+		return
+	}
+
+	user, ok := currentUser(ctx, c, handler.usersColl)
+	if !ok {
+		return
+	}
+
+	task, ok = handler.createTask(ctx, c, user, task)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"all_day": parsed.AllDay, "task": task})
+}
+
+func recurrenceFromQuickAdd(parsed *quickadd.Recurrence) *model.Recurrence {
+	if parsed == nil {
+		return nil
+	}
+
+	recurrence := &model.Recurrence{Frequency: parsed.Frequency, Interval: parsed.Interval, MonthDay: parsed.MonthDay}
+	for _, day := range parsed.Weekdays {
+		recurrence.Weekdays = append(recurrence.Weekdays, model.WeekdayCode(day))
+	}
+	return recurrence
+}
@@ -0,0 +1,413 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/utpal74/track-my-tasks-backend/model"
+	"github.com/utpal74/track-my-tasks-backend/tenant"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type SharingHandler struct {
+	ctx             context.Context
+	invitationsColl *mongo.Collection
+	tasksColl       *tenant.Collection
+	projectsColl    *tenant.Collection
+	usersColl       *mongo.Collection
+	redisClient     *redis.Client
+}
+
+func NewSharingHandler(ctx context.Context, invitationsColl *mongo.Collection, tasksColl *tenant.Collection, projectsColl *tenant.Collection, usersColl *mongo.Collection, redisClient *redis.Client) *SharingHandler {
+	return &SharingHandler{
+		ctx:             ctx,
+		invitationsColl: invitationsColl,
+		tasksColl:       tasksColl,
+		projectsColl:    projectsColl,
+		usersColl:       usersColl,
+		redisClient:     redisClient,
+	}
+}
+
+// shareRequest - the invitee is looked up by username, or by email when no username is given
+type shareRequest struct {
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	Role     string `json:"role" binding:"required"`
+}
+
+// sharedResource - the fields tasks and projects have in common for sharing
+type sharedResource struct {
+	ID            primitive.ObjectID   `bson:"_id"`
+	UserID        primitive.ObjectID   `bson:"user_id"`
+	ProjectID     *primitive.ObjectID  `bson:"project_id,omitempty"`
+	Title         string               `bson:"title,omitempty"` // tasks
+	Name          string               `bson:"name,omitempty"`  // projects
+	Collaborators []model.Collaborator `bson:"collaborators"`
+}
+
+func (r sharedResource) displayName() string {
+	if r.Title != "" {
+		return r.Title
+	}
+	return r.Name
+}
+
+// ShareTaskHandler - invite another user to a task of the signed in user
+func (handler *SharingHandler) ShareTaskHandler(c *gin.Context) {
+	handler.share(c, model.ShareTask)
+}
+
+// ShareProjectHandler - invite another user to a project of the signed in user, and so to all its tasks
+func (handler *SharingHandler) ShareProjectHandler(c *gin.Context) {
+	handler.share(c, model.ShareProject)
+}
+
+func (handler *SharingHandler) share(c *gin.Context, kind string) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	var req shareRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !model.ValidRole(req.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown role: " + req.Role})
+		return
+	}
+
+	var inviteeFilter bson.M
+	switch {
+	case req.Username != "":
+		inviteeFilter = bson.M{"username": req.Username}
+	case req.Email != "":
+		inviteeFilter = bson.M{"email": req.Email}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "username or email is required"})
+		return
+	}
+
+	user, ok := currentUser(ctx, c, handler.usersColl)
+	if !ok {
+		return
+	}
+
+	resourceID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id format"})
+		return
+	}
+
+	// Only the owner can share
+	resource, err := handler.loadResource(ctx, kind, bson.M{"_id": resourceID, "user_id": user.ID})
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": kind + " not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var invitee model.User
+	if err := handler.usersColl.FindOne(ctx, inviteeFilter).Decode(&invitee); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+
+	if invitee.ID == user.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "you can't share with yourself"})
+		return
+	}
+
+	// Sharing never crosses workspaces
+	workspace, _ := tenant.Workspace(ctx)
+	if _, member := workspace.Member(invitee.ID); !member {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user is not a member of this workspace"})
+		return
+	}
+
+	// Inviting again while an invitation is pending only changes its role
+	var invitation model.Invitation
+	pending := bson.M{"kind": kind, "resource_id": resource.ID, "invitee_id": invitee.ID, "status": model.InvitationPending}
+	err = handler.invitationsColl.FindOneAndUpdate(ctx, pending, bson.M{"$set": bson.M{"role": req.Role}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&invitation)
+	if err == nil {
+		c.JSON(http.StatusOK, invitation)
+		return
+	} else if err != mongo.ErrNoDocuments {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	invitation = model.Invitation{
+		ID:           primitive.NewObjectID(),
+		Kind:         kind,
+		ResourceID:   resource.ID,
+		ResourceName: resource.displayName(),
+		WorkspaceID:  workspace.ID,
+		InviterID:    user.ID,
+		Inviter:      user.Username,
+		InviteeID:    invitee.ID,
+		Invitee:      invitee.Username,
+		Role:         req.Role,
+		Status:       model.InvitationPending,
+		CreatedAt:    time.Now(),
+	}
+
+	if _, err := handler.invitationsColl.InsertOne(ctx, invitation); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, invitation)
+}
+
+// GetInvitationsHandler - list the pending invitations of the signed in user, newest first
+func (handler *SharingHandler) GetInvitationsHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	user, ok := currentUser(ctx, c, handler.usersColl)
+	if !ok {
+		return
+	}
+
+	cur, err := handler.invitationsColl.Find(ctx,
+		bson.M{"invitee_id": user.ID, "status": model.InvitationPending},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer cur.Close(ctx)
+
+	invitations := make([]model.Invitation, 0)
+	if err := cur.All(ctx, &invitations); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to decode invitations"})
+		return
+	}
+
+	c.JSON(http.StatusOK, invitations)
+}
+
+// AcceptInvitationHandler - accept a pending invitation, adding the user as a collaborator
+func (handler *SharingHandler) AcceptInvitationHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	user, invitation, ok := handler.pendingInvitation(ctx, c)
+	if !ok {
+		return
+	}
+
+	// Invitations can be accepted from any workspace, the invitee was a member of the resource's one when invited
+	ctx = tenant.Unscoped(ctx)
+	resource, err := handler.loadResource(ctx, invitation.Kind, bson.M{"_id": invitation.ResourceID, "workspace_id": invitation.WorkspaceID})
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusGone, gin.H{"error": "the shared " + invitation.Kind + " no longer exists"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	collaborator := model.Collaborator{UserID: user.ID, Username: user.Username, Role: invitation.Role}
+	if err := handler.setCollaborator(ctx, invitation.Kind, resource, collaborator); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "unable to add collaborator: " + err.Error()})
+		return
+	}
+
+	if err := handler.markResponded(ctx, invitation.ID, model.InvitationAccepted); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	resource.Collaborators = append(resource.Collaborators, collaborator)
+	handler.invalidateCaches(ctx, invitation.Kind, resource)
+
+	c.JSON(http.StatusOK, gin.H{"message": "invitation accepted", "kind": invitation.Kind, "resource_id": invitation.ResourceID})
+}
+
+// DeclineInvitationHandler - decline a pending invitation
+func (handler *SharingHandler) DeclineInvitationHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	_, invitation, ok := handler.pendingInvitation(ctx, c)
+	if !ok {
+		return
+	}
+
+	if err := handler.markResponded(ctx, invitation.ID, model.InvitationDeclined); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "invitation declined"})
+}
+
+// RemoveTaskCollaboratorHandler - stop sharing a task with a user, allowed for the owner and the collaborator themselves
+func (handler *SharingHandler) RemoveTaskCollaboratorHandler(c *gin.Context) {
+	handler.removeCollaborator(c, model.ShareTask)
+}
+
+// RemoveProjectCollaboratorHandler - stop sharing a project with a user, allowed for the owner and the collaborator themselves
+func (handler *SharingHandler) RemoveProjectCollaboratorHandler(c *gin.Context) {
+	handler.removeCollaborator(c, model.ShareProject)
+}
+
+func (handler *SharingHandler) removeCollaborator(c *gin.Context, kind string) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	user, ok := currentUser(ctx, c, handler.usersColl)
+	if !ok {
+		return
+	}
+
+	resourceID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id format"})
+		return
+	}
+
+	collaboratorID, err := primitive.ObjectIDFromHex(c.Param("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id format"})
+		return
+	}
+
+	resource, err := handler.loadResource(ctx, kind, bson.M{"_id": resourceID, "collaborators.user_id": collaboratorID})
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "collaborator not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if user.ID != resource.UserID && user.ID != collaboratorID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only the owner can remove other collaborators"})
+		return
+	}
+
+	if err := handler.setCollaborator(ctx, kind, resource, model.Collaborator{UserID: collaboratorID}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "unable to remove collaborator: " + err.Error()})
+		return
+	}
+
+	// The removed user still belongs to resource.Collaborators, so their cache is cleared too
+	handler.invalidateCaches(ctx, kind, resource)
+
+	c.JSON(http.StatusOK, gin.H{"message": "collaborator removed", "user_id": collaboratorID})
+}
+
+// pendingInvitation - loads the invitation in the path, responding with 404 unless it is pending and addressed to the user
+func (handler *SharingHandler) pendingInvitation(ctx context.Context, c *gin.Context) (model.User, model.Invitation, bool) {
+	var invitation model.Invitation
+	user, ok := currentUser(ctx, c, handler.usersColl)
+	if !ok {
+		return user, invitation, false
+	}
+
+	invitationID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id format"})
+		return user, invitation, false
+	}
+
+	filter := bson.M{"_id": invitationID, "invitee_id": user.ID, "status": model.InvitationPending}
+	if err := handler.invitationsColl.FindOne(ctx, filter).Decode(&invitation); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "invitation not found"})
+		return user, invitation, false
+	}
+	return user, invitation, true
+}
+
+func (handler *SharingHandler) markResponded(ctx context.Context, invitationID primitive.ObjectID, status string) error {
+	_, err := handler.invitationsColl.UpdateOne(ctx, bson.M{"_id": invitationID},
+		bson.M{"$set": bson.M{"status": status, "responded_at": time.Now()}})
+	return err
+}
+
+func (handler *SharingHandler) collectionFor(kind string) *tenant.Collection {
+	if kind == model.ShareProject {
+		return handler.projectsColl
+	}
+	return handler.tasksColl
+}
+
+func (handler *SharingHandler) loadResource(ctx context.Context, kind string, filter bson.M) (sharedResource, error) {
+	var resource sharedResource
+	if kind == model.ShareTask {
+		filter = activeTask(filter)
+	}
+	err := handler.collectionFor(kind).FindOne(ctx, filter).Decode(&resource)
+	return resource, err
+}
+
+// setCollaborator - replaces the entry of the collaborator's user, an empty Role only removes it.
+// The owner's embedded copy of a task is kept in sync.
+func (handler *SharingHandler) setCollaborator(ctx context.Context, kind string, resource sharedResource, collaborator model.Collaborator) error {
+	coll := handler.collectionFor(kind)
+	now := time.Now()
+
+	_, err := coll.UpdateOne(ctx, bson.M{"_id": resource.ID}, bson.M{
+		"$pull": bson.M{"collaborators": bson.M{"user_id": collaborator.UserID}},
+		"$set":  bson.M{"updated_at": now},
+	})
+	if err != nil {
+		return err
+	}
+
+	if collaborator.Role != "" {
+		_, err = coll.UpdateOne(ctx, bson.M{"_id": resource.ID}, bson.M{"$push": bson.M{"collaborators": collaborator}})
+		if err != nil {
+			return err
+		}
+	}
+
+	if kind != model.ShareTask {
+		return nil
+	}
+
+	var task model.Task
+	if err := coll.FindOne(ctx, bson.M{"_id": resource.ID}).Decode(&task); err != nil {
+		return err
+	}
+	_, err = handler.usersColl.UpdateOne(ctx, bson.M{"_id": task.UserID, "task._id": task.ID}, bson.M{"$set": bson.M{
+		"task.$.collaborators": task.Collaborators,
+		"task.$.updated_at":    now,
+	}})
+	return err
+}
+
+// invalidateCaches - removes the cached task lists of the owner and every collaborator of the resource
+func (handler *SharingHandler) invalidateCaches(ctx context.Context, kind string, resource sharedResource) {
+	if kind == model.ShareTask {
+		invalidateMemberCaches(ctx, handler.redisClient, handler.projectsColl, model.Task{
+			ID:            resource.ID,
+			UserID:        resource.UserID,
+			ProjectID:     resource.ProjectID,
+			Collaborators: resource.Collaborators,
+		})
+		return
+	}
+
+	keys := userCacheKeys(resource.UserID)
+	for _, collaborator := range resource.Collaborators {
+		keys = append(keys, userCacheKeys(collaborator.UserID)...)
+	}
+
+	log.Println("remove data from redis")
+	handler.redisClient.Del(ctx, keys...)
+}
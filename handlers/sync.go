@@ -0,0 +1,622 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/utpal74/track-my-tasks-backend/model"
+	"github.com/utpal74/track-my-tasks-backend/tenant"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// Changes this recent are sent again by the next sync: writes still in flight while the changes were read
+	// may carry an earlier updated_at than writes which were already visible
+	syncSkew         = 5 * time.Second
+	maxSyncChanges   = 500
+	maxSyncMutations = 100
+	// How often a mutation is applied again when the task changes between reading and writing it
+	syncAttempts     = 3
+	syncTokenVersion = "s1"
+)
+
+// sync mutation operations
+const (
+	syncCreate = "create"
+	syncUpdate = "update"
+	syncDelete = "delete"
+)
+
+// sync conflict resolution strategies
+const (
+	syncLastWriterWins = "lww"   // The later of the two versions wins as a whole
+	syncMerge          = "merge" // Fields changed on one side are kept, fields changed on both go to the later change
+)
+
+// sync mutation results
+const (
+	syncApplied  = "applied"
+	syncMerged   = "merged" // Applied without the rejected fields
+	syncRejected = "rejected"
+)
+
+// Fields a sync update may change, under their JSON names which are also the names in the task history
+var syncFields = map[string]bool{
+	"title":            true,
+	"comment":          true,
+	"priority":         true,
+	"important":        true,
+	"estimate_minutes": true,
+	"due_date":         true,
+	"recurrence":       true,
+	"labels":           true,
+	"checklist":        true,
+	"done":             true,
+}
+
+// syncPosition - where a sync stopped: after the tasks updated before updatedAt, and those updated at
+// updatedAt with an ID up to id
+type syncPosition struct {
+	updatedAt time.Time
+	id        primitive.ObjectID
+}
+
+// syncDeletion - a task in the trash or deleted for good
+type syncDeletion struct {
+	ID        primitive.ObjectID `json:"id"`
+	DeletedAt time.Time          `json:"deleted_at"`
+}
+
+type syncMutation struct {
+	Op        string          `json:"op"`              // One of the sync mutation operations
+	ID        string          `json:"id"`              // Chosen by the client when it creates the task
+	Task      json.RawMessage `json:"task"`            // create: the body of /tasks/create, update: the changed fields
+	Base      *time.Time      `json:"base_updated_at"` // update and delete: updated_at of the version the client changed
+	ChangedAt *time.Time      `json:"changed_at"`      // When the client made the change, now by default
+}
+
+type syncRequest struct {
+	Strategy  string         `json:"strategy"` // One of the sync conflict resolution strategies, merge by default
+	Mutations []syncMutation `json:"mutations" binding:"required"`
+}
+
+type syncResult struct {
+	Index          int         `json:"index"`
+	Op             string      `json:"op"`
+	ID             string      `json:"id"`
+	Status         string      `json:"status"`          // One of the sync mutation results
+	Error          string      `json:"error,omitempty"` // Why the mutation, or some of its fields, were rejected
+	RejectedFields []string    `json:"rejected_fields,omitempty"`
+	Task           *model.Task `json:"task,omitempty"` // The task as stored now, unless it is gone
+	stale          bool        // The task changed while the mutation was applied, it is applied again
+}
+
+// errSyncStale - the task changed on the server after the mutation was checked against it
+var errSyncStale = errors.New("conflict: the task changed while the mutation was applied")
+
+// SyncHandler - the changes to the tasks visible to the user since the sync token in since, for clients working
+// offline; without since every task is sent. Tasks in the trash or deleted for good are listed under deleted.
+// Clients keep the returned sync token for the next call, and call again right away while more is true.
+// Tasks the user merely lost access to aren't reported.
+func (handler *TasksHandler) SyncHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	user, ok := handler.currentUser(ctx, c)
+	if !ok {
+		return
+	}
+
+	var since syncPosition
+	full := c.Query("since") == ""
+	if !full {
+		since, ok = parseSyncPosition(c.Query("since"))
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid sync token"})
+			return
+		}
+		// The trash has been purged since, without leaving tombstones
+		if time.Since(since.updatedAt) > trashRetention() {
+			c.JSON(http.StatusGone, gin.H{"error": "sync token expired, sync again without since"})
+			return
+		}
+	}
+	now := time.Now()
+
+	visible, err := visibleTasksFilter(ctx, handler.projectsColl, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !full {
+		delete(visible, "deleted_at")
+	}
+	filter := bson.M{"$and": []bson.M{visible, {"$or": []bson.M{
+		{"updated_at": bson.M{"$gt": since.updatedAt}},
+		{"updated_at": since.updatedAt, "_id": bson.M{"$gt": since.id}},
+	}}}}
+
+	opts := options.Find().SetSort(bson.D{{Key: "updated_at", Value: 1}, {Key: "_id", Value: 1}}).SetLimit(maxSyncChanges + 1)
+	cur, err := handler.tasksColl.Find(ctx, filter, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	tasks := make([]model.Task, 0)
+	if err := cur.All(ctx, &tasks); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	more := len(tasks) > maxSyncChanges
+	if more {
+		tasks = tasks[:maxSyncChanges]
+	}
+
+	changed := make([]model.Task, 0, len(tasks))
+	deleted := make([]syncDeletion, 0)
+	for _, task := range tasks {
+		if task.DeletedAt != nil {
+			deleted = append(deleted, syncDeletion{ID: task.ID, DeletedAt: *task.DeletedAt})
+		} else {
+			changed = append(changed, task)
+		}
+	}
+
+	// Every page repeats the tombstones since the token the client started with, they are few
+	if !full {
+		tombstones, err := handler.tombstonesSince(ctx, user.ID, since.updatedAt)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		for _, tombstone := range tombstones {
+			deleted = append(deleted, syncDeletion{ID: tombstone.ID, DeletedAt: tombstone.DeletedAt})
+		}
+	}
+
+	next := since
+	if more {
+		last := tasks[len(tasks)-1]
+		next = syncPosition{updatedAt: last.UpdatedAt, id: last.ID}
+	} else if cutoff := now.Add(-syncSkew); cutoff.After(since.updatedAt) {
+		next = syncPosition{updatedAt: cutoff}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tasks": changed, "deleted": deleted, "sync_token": next.token(), "more": more})
+}
+
+// SyncMutationsHandler - applies the changes an offline client made, in order, each with its own result.
+// Updates and deletions name the version they were made to; when the task changed since, the strategy decides.
+func (handler *TasksHandler) SyncMutationsHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+	defer cancel()
+
+	var req syncRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(req.Mutations) == 0 || len(req.Mutations) > maxSyncMutations {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "between 1 and " + strconv.Itoa(maxSyncMutations) + " mutations are required"})
+		return
+	}
+	if req.Strategy == "" {
+		req.Strategy = syncMerge
+	}
+	if req.Strategy != syncMerge && req.Strategy != syncLastWriterWins {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown strategy: " + req.Strategy})
+		return
+	}
+
+	user, ok := handler.currentUser(ctx, c)
+	if !ok {
+		return
+	}
+
+	results := make([]syncResult, len(req.Mutations))
+	rejected := 0
+	for i, mutation := range req.Mutations {
+		result := handler.applySyncMutation(ctx, c, user, req.Strategy, mutation)
+		result.Index, result.Op, result.ID = i, mutation.Op, mutation.ID
+		if result.Status == syncRejected {
+			rejected++
+		}
+
+		// The client learns how the task ended up, whatever happened to its change
+		if id, err := primitive.ObjectIDFromHex(mutation.ID); err == nil {
+			if task, _, err := handler.syncTarget(ctx, user, id); err == nil && task.DeletedAt == nil {
+				result.Task = &task
+			}
+		}
+		results[i] = result
+	}
+
+	c.JSON(http.StatusOK, gin.H{"results": results, "applied": len(results) - rejected, "rejected": rejected})
+}
+
+func (handler *TasksHandler) applySyncMutation(ctx context.Context, c *gin.Context, user model.User, strategy string, mutation syncMutation) syncResult {
+	id, err := primitive.ObjectIDFromHex(mutation.ID)
+	if err != nil {
+		return rejectSync(errors.New("invalid id format"))
+	}
+
+	// Clocks running ahead of the server don't win conflicts
+	changedAt := time.Now()
+	if mutation.ChangedAt != nil && mutation.ChangedAt.Before(changedAt) {
+		changedAt = *mutation.ChangedAt
+	}
+
+	switch mutation.Op {
+	case syncCreate:
+		return handler.syncCreate(ctx, c, user, id, mutation)
+	case syncUpdate:
+		if mutation.Base == nil {
+			return rejectSync(errors.New("base_updated_at is required"))
+		}
+		return retryStaleSync(func() syncResult {
+			return handler.syncUpdate(ctx, c, user, id, strategy, mutation, changedAt)
+		})
+	case syncDelete:
+		if mutation.Base == nil {
+			return rejectSync(errors.New("base_updated_at is required"))
+		}
+		return retryStaleSync(func() syncResult {
+			return handler.syncDelete(ctx, c, user, id, mutation, changedAt)
+		})
+	}
+	return rejectSync(errors.New("unknown operation: " + mutation.Op))
+}
+
+// retryStaleSync - applies a mutation until it isn't based on a stale read of the task, at most syncAttempts times
+func retryStaleSync(apply func() syncResult) syncResult {
+	var result syncResult
+	for attempt := 0; attempt < syncAttempts; attempt++ {
+		if result = apply(); !result.stale {
+			break
+		}
+	}
+	return result
+}
+
+// syncCreate - creates the task under the client's ID. Creating it again is a no-op, the client may not have got
+// the answer the first time.
+func (handler *TasksHandler) syncCreate(ctx context.Context, c *gin.Context, user model.User, id primitive.ObjectID, mutation syncMutation) syncResult {
+	if _, _, err := handler.syncTarget(ctx, user, id); err == nil {
+		return syncResult{Status: syncApplied}
+	} else if err != mongo.ErrNoDocuments {
+		return rejectSync(err)
+	}
+
+	// The ID may belong to a task the user can't see, in any workspace, or to one deleted for good
+	unscoped := tenant.Unscoped(ctx)
+	if n, err := handler.tasksColl.CountDocuments(unscoped, bson.M{"_id": id}); err != nil {
+		return rejectSync(err)
+	} else if n > 0 {
+		return rejectSync(errors.New("id already in use"))
+	}
+	if n, err := handler.tombstonesColl.CountDocuments(unscoped, bson.M{"_id": id}); err != nil {
+		return rejectSync(err)
+	} else if n > 0 {
+		return rejectSync(errors.New("id already in use"))
+	}
+
+	batch, err := handler.newBulkBatch(ctx, user, nil)
+	if err != nil {
+		return rejectSync(err)
+	}
+	step, err := handler.planBulkCreate(ctx, batch, bulkOperation{Op: bulkCreate, Task: mutation.Task, taskID: id})
+	if err != nil {
+		return rejectSync(err)
+	}
+	if err := handler.writeSyncStep(ctx, c, step); err != nil {
+		return rejectSync(err)
+	}
+	return syncResult{Status: syncApplied}
+}
+
+// syncUpdate - applies the changed fields. Under merge, fields which also changed on the server since the
+// client's version keep the later value; under lww the later version wins as a whole.
+func (handler *TasksHandler) syncUpdate(ctx context.Context, c *gin.Context, user model.User, id primitive.ObjectID, strategy string, mutation syncMutation, changedAt time.Time) syncResult {
+	task, snapshot, err := handler.syncTarget(ctx, user, id)
+	if err == mongo.ErrNoDocuments {
+		return rejectSync(errors.New("task not found"))
+	} else if err != nil {
+		return rejectSync(err)
+	}
+	if task.DeletedAt != nil {
+		return rejectSync(errors.New("task was deleted"))
+	}
+
+	role, err := taskRole(ctx, handler.projectsColl, task, user.ID)
+	if err != nil {
+		return rejectSync(err)
+	}
+	if role == model.RoleViewer {
+		return rejectSync(errors.New("viewers can't change the task"))
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(mutation.Task, &fields); err != nil {
+		return rejectSync(errors.New("invalid task: " + err.Error()))
+	}
+	for field := range fields {
+		if !syncFields[field] {
+			delete(fields, field)
+		}
+	}
+
+	result := syncResult{Status: syncApplied}
+	if task.UpdatedAt.After(*mutation.Base) {
+		var changes map[string]time.Time
+		if strategy == syncMerge {
+			if changes, err = handler.fieldsChangedSince(ctx, task.ID, *mutation.Base); err != nil {
+				return rejectSync(err)
+			}
+		}
+		if result = resolveSyncConflict(strategy, fields, task.UpdatedAt, changedAt, changes); result.Status == syncRejected {
+			return result
+		}
+	}
+
+	set, err := handler.syncUpdateFields(ctx, task, fields)
+	if err != nil {
+		return rejectSync(err)
+	}
+	if len(set) == 0 {
+		return result
+	}
+	set["updated_at"] = time.Now()
+
+	// Only over the version the conflicts were resolved against
+	err = handler.commitChange(ctx, c, model.TaskActionUpdated, task.ID, snapshot, func(ctx context.Context) error {
+		res, err := handler.tasksColl.UpdateOne(ctx, unchangedTask(activeTask(bson.M{"_id": task.ID}), task.UpdatedAt), bson.M{"$set": set})
+		if err != nil {
+			return err
+		}
+		if res.MatchedCount == 0 {
+			return errSyncStale
+		}
+
+		_, err = handler.usersColl.UpdateOne(ctx, bson.M{"_id": task.UserID, "task._id": task.ID}, bson.M{"$set": prefixFields(set)})
+		if err != nil {
+			return fmt.Errorf("failed to update user with updated task: %w", err)
+		}
+		return nil
+	})
+	if errors.Is(err, errSyncStale) {
+		return staleSync()
+	} else if err != nil {
+		return rejectSync(err)
+	}
+
+	invalidateMemberCaches(ctx, handler.redisClient, handler.projectsColl, task)
+	return result
+}
+
+// resolveSyncConflict - resolves an update of a task which changed on the server at updatedAt since the client's
+// version, changes holds when each field last changed there. Fields which lose are taken out of fields and
+// reported as rejected, sorted; the update is rejected when nothing is left of it.
+func resolveSyncConflict(strategy string, fields map[string]json.RawMessage, updatedAt, changedAt time.Time, changes map[string]time.Time) syncResult {
+	result := syncResult{Status: syncApplied}
+	switch strategy {
+	case syncLastWriterWins:
+		if !changedAt.After(updatedAt) {
+			return rejectSync(errors.New("conflict: the task changed later on the server"))
+		}
+	case syncMerge:
+		for field := range fields {
+			if changed, found := changes[field]; found && !changedAt.After(changed) {
+				result.RejectedFields = append(result.RejectedFields, field)
+				delete(fields, field)
+			}
+		}
+	}
+
+	if len(result.RejectedFields) > 0 {
+		sort.Strings(result.RejectedFields)
+		result.Status, result.Error = syncMerged, "conflict: the rejected fields changed later on the server"
+		if len(fields) == 0 {
+			result.Status = syncRejected
+		}
+	}
+	return result
+}
+
+// syncUpdateFields - the fields set by a sync update, done moves the task to the first column of its category
+func (handler *TasksHandler) syncUpdateFields(ctx context.Context, task model.Task, fields map[string]json.RawMessage) (bson.M, error) {
+	raw, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+	var update model.Task
+	var patch taskPatch
+	if err := json.Unmarshal(raw, &update); err != nil {
+		return nil, errors.New("invalid task: " + err.Error())
+	}
+	if err := json.Unmarshal(raw, &patch); err != nil {
+		return nil, errors.New("invalid task: " + err.Error())
+	}
+
+	set, err := taskUpdateFields(update, patch)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, sent := fields["done"]; sent && update.Done != task.Done {
+		category := model.StatusCategoryOpen
+		if update.Done {
+			category = model.StatusCategoryClosed
+			blockers, err := handler.openBlockers(ctx, task.ID)
+			if err != nil {
+				return nil, errors.New("unable to check blockers: " + err.Error())
+			}
+			if len(blockers) > 0 {
+				return nil, errors.New("task is blocked by open tasks")
+			}
+		}
+		columns, err := handler.workflowFor(ctx, task.UserID, task.ProjectID)
+		if err != nil {
+			return nil, errors.New("unable to resolve status: " + err.Error())
+		}
+		column := model.FirstStatus(columns, category)
+		if column.Key != task.Status {
+			if err := handler.checkWIPLimit(ctx, task.UserID, task.ProjectID, column, 1); err != nil {
+				return nil, err
+			}
+		}
+		set["status"] = column.Key
+		set["done"] = update.Done
+	}
+	return set, nil
+}
+
+// syncDelete - moves the task to the trash unless it changed later on the server. Deleting a deleted task is a no-op.
+func (handler *TasksHandler) syncDelete(ctx context.Context, c *gin.Context, user model.User, id primitive.ObjectID, mutation syncMutation, changedAt time.Time) syncResult {
+	task, snapshot, err := handler.syncTarget(ctx, user, id)
+	if err == mongo.ErrNoDocuments {
+		if n, err := handler.tombstonesColl.CountDocuments(ctx, bson.M{"_id": id}); err != nil {
+			return rejectSync(err)
+		} else if n > 0 {
+			return syncResult{Status: syncApplied}
+		}
+		return rejectSync(errors.New("task not found"))
+	} else if err != nil {
+		return rejectSync(err)
+	}
+	if task.DeletedAt != nil {
+		return syncResult{Status: syncApplied}
+	}
+	if task.UserID != user.ID {
+		return rejectSync(errors.New("only the owner can delete the task"))
+	}
+
+	// A deletion has no fields to merge
+	if task.UpdatedAt.After(*mutation.Base) && !changedAt.After(task.UpdatedAt) {
+		return rejectSync(errors.New("conflict: the task changed later on the server"))
+	}
+
+	trashed, err := handler.trashTask(ctx, c, user.ID, id, snapshot, &task.UpdatedAt)
+	if err != nil {
+		return rejectSync(err)
+	}
+	if !trashed {
+		return staleSync()
+	}
+	handler.invalidateTaskCaches(ctx, id)
+	return syncResult{Status: syncApplied}
+}
+
+// writeSyncStep - writes a single planned step and records it
+func (handler *TasksHandler) writeSyncStep(ctx context.Context, c *gin.Context, step bulkStep) error {
+	_, failures := handler.writeBulk(ctx, c.GetString("username"), []bulkStep{step})
+	if err := failures[step.index]; err != nil {
+		return err
+	}
+
+	invalidateMemberCaches(ctx, handler.redisClient, handler.projectsColl, step.task)
+	return nil
+}
+
+// syncTarget - a task the user can see, including the trash, along with its snapshot for the history.
+// Returns mongo.ErrNoDocuments otherwise.
+func (handler *TasksHandler) syncTarget(ctx context.Context, user model.User, id primitive.ObjectID) (model.Task, bson.M, error) {
+	var task model.Task
+	filter, err := visibleTasksFilter(ctx, handler.projectsColl, user.ID)
+	if err != nil {
+		return task, nil, err
+	}
+	delete(filter, "deleted_at")
+	filter["_id"] = id
+
+	var snapshot bson.M
+	if err := handler.tasksColl.FindOne(ctx, filter).Decode(&snapshot); err != nil {
+		return task, nil, err
+	}
+	if err := decodeSnapshot(snapshot, &task); err != nil {
+		return task, nil, err
+	}
+	return task, snapshot, nil
+}
+
+// fieldsChangedSince - the fields of the task which its history shows changed after since, with the time of
+// their last change
+func (handler *TasksHandler) fieldsChangedSince(ctx context.Context, taskID primitive.ObjectID, since time.Time) (map[string]time.Time, error) {
+	cur, err := handler.eventsColl.Find(ctx, bson.M{"task_id": taskID, "task_updated_at": bson.M{"$gt": since}})
+	if err != nil {
+		return nil, err
+	}
+	var events []model.TaskEvent
+	if err := cur.All(ctx, &events); err != nil {
+		return nil, err
+	}
+
+	changed := make(map[string]time.Time)
+	for _, event := range events {
+		for _, change := range event.Changes {
+			if event.TaskUpdatedAt.After(changed[change.Field]) {
+				changed[change.Field] = event.TaskUpdatedAt
+			}
+		}
+	}
+	return changed, nil
+}
+
+// tombstonesSince - the tasks the user could see which were deleted for good after since
+func (handler *TasksHandler) tombstonesSince(ctx context.Context, userID primitive.ObjectID, since time.Time) ([]model.Tombstone, error) {
+	filter, err := visibleTasksFilter(ctx, handler.projectsColl, userID)
+	if err != nil {
+		return nil, err
+	}
+	filter["deleted_at"] = bson.M{"$gt": since}
+
+	cur, err := handler.tombstonesColl.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	tombstones := make([]model.Tombstone, 0)
+	if err := cur.All(ctx, &tombstones); err != nil {
+		return nil, err
+	}
+	return tombstones, nil
+}
+
+func rejectSync(err error) syncResult {
+	return syncResult{Status: syncRejected, Error: err.Error()}
+}
+
+func staleSync() syncResult {
+	return syncResult{Status: syncRejected, Error: errSyncStale.Error(), stale: true}
+}
+
+func (position syncPosition) token() string {
+	return syncTokenVersion + "." + strconv.FormatInt(position.updatedAt.UnixMilli(), 10) + "." + position.id.Hex()
+}
+
+// parseSyncPosition - the position of a token made by syncPosition.token
+func parseSyncPosition(token string) (syncPosition, bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != syncTokenVersion {
+		return syncPosition{}, false
+	}
+	millis, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return syncPosition{}, false
+	}
+	id, err := primitive.ObjectIDFromHex(parts[2])
+	if err != nil {
+		return syncPosition{}, false
+	}
+	return syncPosition{updatedAt: time.UnixMilli(millis), id: id}, true
+}
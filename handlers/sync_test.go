@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestResolveSyncConflict(t *testing.T) {
+	updatedAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	before, after := updatedAt.Add(-time.Hour), updatedAt.Add(time.Hour)
+	changes := map[string]time.Time{"title": updatedAt, "done": before}
+
+	tests := []struct {
+		name         string
+		strategy     string
+		fields       []string
+		changedAt    time.Time
+		wantStatus   string
+		wantRejected []string
+		wantFields   []string
+	}{
+		{
+			name:       "lww: later client change wins as a whole",
+			strategy:   syncLastWriterWins,
+			fields:     []string{"title", "comment"},
+			changedAt:  after,
+			wantStatus: syncApplied,
+			wantFields: []string{"comment", "title"},
+		},
+		{
+			name:       "lww: earlier client change loses as a whole",
+			strategy:   syncLastWriterWins,
+			fields:     []string{"title", "comment"},
+			changedAt:  before,
+			wantStatus: syncRejected,
+			wantFields: []string{"comment", "title"},
+		},
+		{
+			name:       "lww: a tie goes to the server",
+			strategy:   syncLastWriterWins,
+			fields:     []string{"comment"},
+			changedAt:  updatedAt,
+			wantStatus: syncRejected,
+			wantFields: []string{"comment"},
+		},
+		{
+			name:       "merge: fields only the client changed are kept",
+			strategy:   syncMerge,
+			fields:     []string{"comment", "labels"},
+			changedAt:  before,
+			wantStatus: syncApplied,
+			wantFields: []string{"comment", "labels"},
+		},
+		{
+			name:         "merge: fields changed later on the server are rejected",
+			strategy:     syncMerge,
+			fields:       []string{"title", "comment", "done"},
+			changedAt:    before.Add(time.Minute),
+			wantStatus:   syncMerged,
+			wantRejected: []string{"title"},
+			wantFields:   []string{"comment", "done"},
+		},
+		{
+			name:         "merge: rejected when every field loses",
+			strategy:     syncMerge,
+			fields:       []string{"title", "done"},
+			changedAt:    before,
+			wantStatus:   syncRejected,
+			wantRejected: []string{"done", "title"},
+		},
+		{
+			name:       "merge: later client change wins every field",
+			strategy:   syncMerge,
+			fields:     []string{"title", "done"},
+			changedAt:  after,
+			wantStatus: syncApplied,
+			wantFields: []string{"done", "title"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fields := make(map[string]json.RawMessage, len(tt.fields))
+			for _, field := range tt.fields {
+				fields[field] = json.RawMessage(`"x"`)
+			}
+
+			result := resolveSyncConflict(tt.strategy, fields, updatedAt, tt.changedAt, changes)
+			if result.Status != tt.wantStatus || !reflect.DeepEqual(result.RejectedFields, tt.wantRejected) {
+				t.Errorf("resolveSyncConflict() = %s %v, want %s %v", result.Status, result.RejectedFields, tt.wantStatus, tt.wantRejected)
+			}
+			if (result.Status == syncApplied) != (result.Error == "") {
+				t.Errorf("resolveSyncConflict() error = %q with status %s", result.Error, result.Status)
+			}
+
+			var kept []string
+			for field := range fields {
+				kept = append(kept, field)
+			}
+			sort.Strings(kept)
+			if !reflect.DeepEqual(kept, tt.wantFields) {
+				t.Errorf("resolveSyncConflict() kept %v, want %v", kept, tt.wantFields)
+			}
+		})
+	}
+}
+
+func TestSyncPosition(t *testing.T) {
+	position := syncPosition{updatedAt: time.UnixMilli(1709294400123), id: primitive.NewObjectID()}
+	if got, ok := parseSyncPosition(position.token()); !ok || !got.updatedAt.Equal(position.updatedAt) || got.id != position.id {
+		t.Errorf("parseSyncPosition(token()) = %v, %v, want %v", got, ok, position)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{name: "empty", token: ""},
+		{name: "other version", token: "s0.1709294400123." + position.id.Hex()},
+		{name: "missing part", token: "s1.1709294400123"},
+		{name: "invalid time", token: "s1.noon." + position.id.Hex()},
+		{name: "invalid id", token: "s1.1709294400123.abc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := parseSyncPosition(tt.token); ok {
+				t.Errorf("parseSyncPosition(%q) accepted the token", tt.token)
+			}
+		})
+	}
+}
+
+func TestRetryStaleSync(t *testing.T) {
+	tests := []struct {
+		name         string
+		stale        int // attempts which find the task changed
+		wantAttempts int
+		wantStatus   string
+	}{
+		{name: "applied at once", wantAttempts: 1, wantStatus: syncApplied},
+		{name: "applied after a stale read", stale: 1, wantAttempts: 2, wantStatus: syncApplied},
+		{name: "gives up", stale: syncAttempts, wantAttempts: syncAttempts, wantStatus: syncRejected},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			result := retryStaleSync(func() syncResult {
+				attempts++
+				if attempts <= tt.stale {
+					return staleSync()
+				}
+				return syncResult{Status: syncApplied}
+			})
+			if attempts != tt.wantAttempts || result.Status != tt.wantStatus {
+				t.Errorf("retryStaleSync() = %s after %d attempts, want %s after %d", result.Status, attempts, tt.wantStatus, tt.wantAttempts)
+			}
+		})
+	}
+}
@@ -0,0 +1,435 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/utpal74/track-my-tasks-backend/model"
+	"github.com/utpal74/track-my-tasks-backend/tenant"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	maxTemplateTasks = 200
+	maxTemplateDepth = 5
+)
+
+// placeholder - {{name}}, spaces inside the braces are allowed
+var placeholder = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+// instantiateRequest - variables fill the placeholders, due offsets count from start_date (YYYY-MM-DD, default today)
+type instantiateRequest struct {
+	Variables map[string]string   `json:"variables"`
+	ProjectID *primitive.ObjectID `json:"project_id"`
+	StartDate string              `json:"start_date"`
+}
+
+// GetTemplatesHandler - the templates of the workspace
+func (handler *TasksHandler) GetTemplatesHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	cur, err := handler.templatesColl.Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"name": 1}))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer cur.Close(ctx)
+
+	templates := make([]model.Template, 0)
+	if err := cur.All(ctx, &templates); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to decode templates"})
+		return
+	}
+	for i := range templates {
+		templates[i].Variables = templateVariables(templates[i].Tasks)
+	}
+
+	c.JSON(http.StatusOK, templates)
+}
+
+func (handler *TasksHandler) GetTemplateHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	template, ok := handler.templateFromPath(ctx, c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, template)
+}
+
+func (handler *TasksHandler) NewTemplateHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	var template model.Template
+	if err := c.ShouldBindJSON(&template); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := validateTemplate(template); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := currentUser(ctx, c, handler.usersColl)
+	if !ok {
+		return
+	}
+
+	template.ID = primitive.NewObjectID()
+	template.UserID = user.ID
+	template.WorkspaceID = workspaceID(ctx)
+	template.CreatedAt = time.Now()
+	template.UpdatedAt = time.Now()
+
+	if _, err := handler.templatesColl.InsertOne(ctx, template); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	template.Variables = templateVariables(template.Tasks)
+	c.JSON(http.StatusCreated, template)
+}
+
+// UpdateTemplateHandler - replace the name, description and tasks of a template, only allowed for its creator
+func (handler *TasksHandler) UpdateTemplateHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id format"})
+		return
+	}
+
+	var template model.Template
+	if err := c.ShouldBindJSON(&template); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := validateTemplate(template); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := currentUser(ctx, c, handler.usersColl)
+	if !ok {
+		return
+	}
+
+	var updated model.Template
+	err = handler.templatesColl.FindOneAndUpdate(ctx,
+		bson.M{"_id": id, "user_id": user.ID},
+		bson.M{"$set": bson.M{
+			"name":        template.Name,
+			"description": template.Description,
+			"tasks":       template.Tasks,
+			"updated_at":  time.Now(),
+		}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&updated)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "template not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	updated.Variables = templateVariables(updated.Tasks)
+	c.JSON(http.StatusOK, updated)
+}
+
+// DeleteTemplateHandler - only allowed for the creator of the template
+func (handler *TasksHandler) DeleteTemplateHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id format"})
+		return
+	}
+
+	user, ok := currentUser(ctx, c, handler.usersColl)
+	if !ok {
+		return
+	}
+
+	result, err := handler.templatesColl.DeleteOne(ctx, bson.M{"_id": id, "user_id": user.ID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if result.DeletedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "template not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Template deleted", "id": id})
+}
+
+// InstantiateTemplateHandler - create the tasks of a template for the signed in user in one go, subtasks are linked
+// to their parents. Every placeholder used by the template needs a variable.
+func (handler *TasksHandler) InstantiateTemplateHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 15*time.Second)
+	defer cancel()
+
+	var req instantiateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	start := time.Now().UTC().Truncate(24 * time.Hour)
+	if req.StartDate != "" {
+		parsed, err := time.Parse("2006-01-02", req.StartDate)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid start_date"})
+			return
+		}
+		start = parsed
+	}
+
+	template, ok := handler.templateFromPath(ctx, c)
+	if !ok {
+		return
+	}
+
+	var missing []string
+	for _, variable := range template.Variables {
+		if _, found := req.Variables[variable]; !found {
+			missing = append(missing, variable)
+		}
+	}
+	if len(missing) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "missing variables", "missing": missing})
+		return
+	}
+
+	user, ok := currentUser(ctx, c, handler.usersColl)
+	if !ok {
+		return
+	}
+
+	columns, err := handler.workflowFor(ctx, user.ID, req.ProjectID)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "project not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	column := model.FirstStatus(columns, model.StatusCategoryOpen)
+	if err := handler.checkWIPLimit(ctx, user.ID, req.ProjectID, column, countTemplateTasks(template.Tasks)); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	ranks, err := reserveRanks(ctx, handler.tasksColl, handler.usersColl, user.ID, countTemplateTasks(template.Tasks))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "unable to compute rank: " + err.Error()})
+		return
+	}
+
+	now := time.Now()
+	tasks := make([]model.Task, 0, countTemplateTasks(template.Tasks))
+	var build func(items []model.TemplateTask, parentID *primitive.ObjectID) error
+	build = func(items []model.TemplateTask, parentID *primitive.ObjectID) error {
+		for _, item := range items {
+			task := model.Task{
+				ID:          primitive.NewObjectID(),
+				UserID:      user.ID,
+				WorkspaceID: workspaceID(ctx),
+				Title:       strings.TrimSpace(fillPlaceholders(item.Title, req.Variables)),
+				Comment:     fillPlaceholders(item.Comment, req.Variables),
+				ProjectID:   req.ProjectID,
+				ParentID:    parentID,
+				Status:      column.Key,
+				Rank:        ranks[len(tasks)],
+				Priority:    item.Priority,
+				Important:   item.Important,
+				Estimate:    item.Estimate,
+				CreatedAt:   now,
+				UpdatedAt:   now,
+			}
+			if task.Title == "" {
+				return fmt.Errorf("task title %q is empty once filled in", item.Title)
+			}
+			if task.Priority == "" {
+				task.Priority = model.PriorityNone
+			}
+			if item.DueOffset != nil {
+				due := start.AddDate(0, 0, *item.DueOffset)
+				task.DueDate = &due
+			}
+			for _, label := range item.Labels {
+				task.Labels = append(task.Labels, fillPlaceholders(label, req.Variables))
+			}
+			task.Labels = normalizeLabels(task.Labels)
+			for _, text := range item.Checklist {
+				task.Checklist = append(task.Checklist, model.ChecklistItem{Text: fillPlaceholders(text, req.Variables)})
+			}
+			task.Checklist = prepareChecklist(task.Checklist)
+
+			tasks = append(tasks, task)
+			if err := build(item.Subtasks, &task.ID); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := build(template.Tasks, nil); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	documents := make([]interface{}, 0, len(tasks))
+	for _, task := range tasks {
+		documents = append(documents, task)
+	}
+
+	actor := c.GetString("username")
+	err = handler.outbox.Transact(ctx, func(ctx context.Context) error {
+		if _, err := handler.tasksColl.InsertMany(ctx, documents); err != nil {
+			return err
+		}
+
+		_, err := handler.usersColl.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$push": bson.M{"task": bson.M{"$each": tasks}}})
+		if err != nil {
+			return fmt.Errorf("Failed to update user with new tasks: %w", err)
+		}
+
+		for _, task := range tasks {
+			if err := handler.recordChange(ctx, actor, model.TaskActionCreated, task.ID, nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, tenant.ErrQuotaExceeded) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "the workspace has reached its task quota"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	log.Println("remove data from redis")
+	handler.redisClient.Del(ctx, userCacheKeys(user.ID)...)
+
+	c.JSON(http.StatusCreated, gin.H{"template_id": template.ID, "created": len(tasks), "tasks": tasks})
+}
+
+// templateFromPath - loads the template named by the "id" path parameter, responding with 400/404 when it can't be used
+func (handler *TasksHandler) templateFromPath(ctx context.Context, c *gin.Context) (model.Template, bool) {
+	var template model.Template
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id format"})
+		return template, false
+	}
+
+	err = handler.templatesColl.FindOne(ctx, bson.M{"_id": id}).Decode(&template)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "template not found"})
+		return template, false
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return template, false
+	}
+
+	template.Variables = templateVariables(template.Tasks)
+	return template, true
+}
+
+func validateTemplate(template model.Template) error {
+	if strings.TrimSpace(template.Name) == "" {
+		return errors.New("name is required")
+	}
+	if len(template.Tasks) == 0 {
+		return errors.New("a template needs at least one task")
+	}
+	if count := countTemplateTasks(template.Tasks); count > maxTemplateTasks {
+		return fmt.Errorf("a template can't have more than %d tasks", maxTemplateTasks)
+	}
+	return validateTemplateTasks(template.Tasks, 1)
+}
+
+func validateTemplateTasks(items []model.TemplateTask, depth int) error {
+	if depth > maxTemplateDepth {
+		return fmt.Errorf("subtasks can't be nested more than %d levels deep", maxTemplateDepth)
+	}
+	for _, item := range items {
+		if strings.TrimSpace(item.Title) == "" {
+			return errors.New("every task needs a title")
+		}
+		if item.Priority != "" && !model.ValidPriority(item.Priority) {
+			return errors.New("unknown priority: " + item.Priority)
+		}
+		if item.Estimate < 0 {
+			return errors.New("estimate can't be negative")
+		}
+		if err := validateTemplateTasks(item.Subtasks, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func countTemplateTasks(items []model.TemplateTask) int {
+	count := len(items)
+	for _, item := range items {
+		count += countTemplateTasks(item.Subtasks)
+	}
+	return count
+}
+
+// templateVariables - the sorted names of the placeholders used anywhere in the tasks
+func templateVariables(items []model.TemplateTask) []string {
+	seen := make(map[string]bool)
+	var collect func(items []model.TemplateTask)
+	collect = func(items []model.TemplateTask) {
+		for _, item := range items {
+			texts := append([]string{item.Title, item.Comment}, item.Labels...)
+			texts = append(texts, item.Checklist...)
+			for _, text := range texts {
+				for _, match := range placeholder.FindAllStringSubmatch(text, -1) {
+					seen[match[1]] = true
+				}
+			}
+			collect(item.Subtasks)
+		}
+	}
+	collect(items)
+
+	variables := make([]string, 0, len(seen))
+	for variable := range seen {
+		variables = append(variables, variable)
+	}
+	sort.Strings(variables)
+	return variables
+}
+
+func fillPlaceholders(text string, variables map[string]string) string {
+	return placeholder.ReplaceAllStringFunc(text, func(match string) string {
+		return variables[placeholder.FindStringSubmatch(match)[1]]
+	})
+}
@@ -0,0 +1,567 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/utpal74/track-my-tasks-backend/model"
+	"github.com/utpal74/track-my-tasks-backend/tenant"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// Longest time entry, also caps timers which were left running
+	maxTimeEntry      = 24 * time.Hour
+	defaultReportDays = 7
+	maxReportDays     = 366
+)
+
+type TimeHandler struct {
+	ctx          context.Context
+	entriesColl  *tenant.Collection
+	tasksColl    *tenant.Collection
+	projectsColl *tenant.Collection
+	usersColl    *mongo.Collection
+	redisClient  *redis.Client
+}
+
+func NewTimeHandler(ctx context.Context, entriesColl *tenant.Collection, tasksColl *tenant.Collection, projectsColl *tenant.Collection, usersColl *mongo.Collection, redisClient *redis.Client) *TimeHandler {
+	return &TimeHandler{
+		ctx:          ctx,
+		entriesColl:  entriesColl,
+		tasksColl:    tasksColl,
+		projectsColl: projectsColl,
+		usersColl:    usersColl,
+		redisClient:  redisClient,
+	}
+}
+
+// timeEntryRequest - either start and end, or minutes ending at end (default now)
+type timeEntryRequest struct {
+	Start   *time.Time `json:"start"`
+	End     *time.Time `json:"end"`
+	Minutes int        `json:"minutes"`
+	Note    string     `json:"note"`
+}
+
+// timeReportRow - the time logged for one day or project
+type timeReportRow struct {
+	Key     string  `json:"key"` // Date (YYYY-MM-DD) or project id, empty for tasks outside of projects
+	Label   string  `json:"label"`
+	Seconds int64   `json:"seconds"`
+	Hours   float64 `json:"hours"`
+}
+
+// StartTimerHandler - start tracking time on a task. Only one timer runs per user, ?switch=true stops the running one first.
+func (handler *TimeHandler) StartTimerHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	user, ok := currentUser(ctx, c, handler.usersColl)
+	if !ok {
+		return
+	}
+
+	task, ok := handler.trackableTask(ctx, c, user)
+	if !ok {
+		return
+	}
+
+	timer := model.Timer{TaskID: task.ID, WorkspaceID: task.WorkspaceID, StartedAt: time.Now()}
+	data, err := json.Marshal(timer)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to marshal timer"})
+		return
+	}
+
+	started, err := handler.redisClient.SetNX(ctx, timerKey(user.ID), data, 0).Result()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !started && c.Query("switch") == "true" {
+		if _, err := handler.stopTimer(ctx, user); err != nil && err != redis.Nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "unable to stop the running timer: " + err.Error()})
+			return
+		}
+		started, err = handler.redisClient.SetNX(ctx, timerKey(user.ID), data, 0).Result()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if !started {
+		running, _ := handler.runningTimer(ctx, user.ID)
+		c.JSON(http.StatusConflict, gin.H{"error": "another timer is running", "timer": running})
+		return
+	}
+
+	c.JSON(http.StatusCreated, timer)
+}
+
+// StopTimerHandler - stop the running timer of the signed in user and log the time on its task
+func (handler *TimeHandler) StopTimerHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	user, ok := currentUser(ctx, c, handler.usersColl)
+	if !ok {
+		return
+	}
+
+	entry, err := handler.stopTimer(ctx, user)
+	if err == redis.Nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no timer running"})
+		return
+	} else if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "the task of the timer no longer exists, the time was discarded"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, entry)
+}
+
+// GetTimerHandler - the running timer of the signed in user
+func (handler *TimeHandler) GetTimerHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	user, ok := currentUser(ctx, c, handler.usersColl)
+	if !ok {
+		return
+	}
+
+	timer, err := handler.runningTimer(ctx, user.ID)
+	if err == redis.Nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no timer running"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"timer": timer, "elapsed_seconds": int64(time.Since(timer.StartedAt).Seconds())})
+}
+
+// NewTimeEntryHandler - log time on a task by hand
+func (handler *TimeHandler) NewTimeEntryHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	var req timeEntryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	end := time.Now()
+	if req.End != nil {
+		end = *req.End
+	}
+
+	// Lengths are checked before they become a time.Duration, which overflows after about 290 years
+	var start time.Time
+	switch {
+	case req.Minutes > int(maxTimeEntry/time.Minute):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "a time entry can't be longer than 24 hours"})
+		return
+	case req.Minutes > 0:
+		start = end.Add(-time.Duration(req.Minutes) * time.Minute)
+	case req.Start != nil && req.End != nil:
+		start = *req.Start
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "start and end, or minutes, are required"})
+		return
+	}
+
+	if !end.After(start) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "end must be after start"})
+		return
+	}
+	if start.Add(maxTimeEntry).Before(end) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "a time entry can't be longer than 24 hours"})
+		return
+	}
+
+	user, ok := currentUser(ctx, c, handler.usersColl)
+	if !ok {
+		return
+	}
+
+	task, ok := handler.trackableTask(ctx, c, user)
+	if !ok {
+		return
+	}
+
+	entry := newTimeEntry(task, user, start, end)
+	entry.Note = req.Note
+	entry.Manual = true
+
+	if err := handler.logTime(ctx, task, entry); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "unable to log time: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, entry)
+}
+
+// GetTimeEntriesHandler - the time logged on a task by everyone, latest first
+func (handler *TimeHandler) GetTimeEntriesHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	user, ok := currentUser(ctx, c, handler.usersColl)
+	if !ok {
+		return
+	}
+
+	task, ok := taskFromPath(ctx, c, handler.tasksColl, handler.projectsColl, user)
+	if !ok {
+		return
+	}
+
+	cur, err := handler.entriesColl.Find(ctx, bson.M{"task_id": task.ID}, options.Find().SetSort(bson.D{{Key: "start", Value: -1}}))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer cur.Close(ctx)
+
+	entries := make([]model.TimeEntry, 0)
+	if err := cur.All(ctx, &entries); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to decode time entries"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"entries": entries, "tracked_seconds": task.TrackedTime, "estimate_minutes": task.Estimate})
+}
+
+// DeleteTimeEntryHandler - delete a time entry, only allowed for the user who logged it
+func (handler *TimeHandler) DeleteTimeEntryHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	user, ok := currentUser(ctx, c, handler.usersColl)
+	if !ok {
+		return
+	}
+
+	task, ok := taskFromPath(ctx, c, handler.tasksColl, handler.projectsColl, user)
+	if !ok {
+		return
+	}
+
+	entryID, err := primitive.ObjectIDFromHex(c.Param("entryId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid entry id format"})
+		return
+	}
+
+	var entry model.TimeEntry
+	err = handler.entriesColl.FindOneAndDelete(ctx, bson.M{"_id": entryID, "task_id": task.ID, "user_id": user.ID}).Decode(&entry)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "time entry not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := handler.incrementTrackedTime(ctx, task, -entry.Duration); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update tracked time: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Time entry deleted", "id": entry.ID})
+}
+
+// TimeReportHandler - the time the signed in user logged in the workspace, per day or per project.
+// Query: from and to (YYYY-MM-DD, inclusive, default the last 7 days), group=day|project, tz (IANA name, default UTC)
+// and format=csv for a download.
+func (handler *TimeHandler) TimeReportHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	location, err := time.LoadLocation(c.DefaultQuery("tz", "UTC"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown time zone"})
+		return
+	}
+
+	now := time.Now().In(location)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, location)
+	from, to := today.AddDate(0, 0, -(defaultReportDays-1)), today
+	if value := c.Query("from"); value != "" {
+		if from, err = time.ParseInLocation("2006-01-02", value, location); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid from date"})
+			return
+		}
+	}
+	if value := c.Query("to"); value != "" {
+		if to, err = time.ParseInLocation("2006-01-02", value, location); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid to date"})
+			return
+		}
+	}
+	if to.Before(from) || to.Sub(from) > maxReportDays*24*time.Hour {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid date range"})
+		return
+	}
+
+	group := c.DefaultQuery("group", "day")
+	if group != "day" && group != "project" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "group must be day or project"})
+		return
+	}
+
+	user, ok := currentUser(ctx, c, handler.usersColl)
+	if !ok {
+		return
+	}
+
+	cur, err := handler.entriesColl.Find(ctx, bson.M{
+		"user_id": user.ID,
+		"start":   bson.M{"$gte": from, "$lt": to.AddDate(0, 0, 1)},
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer cur.Close(ctx)
+
+	entries := make([]model.TimeEntry, 0)
+	if err := cur.All(ctx, &entries); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to decode time entries"})
+		return
+	}
+
+	var rows []timeReportRow
+	if group == "day" {
+		rows = reportByDay(entries, location)
+	} else if rows, err = handler.reportByProject(ctx, entries); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if c.Query("format") != "csv" {
+		c.JSON(http.StatusOK, gin.H{"from": from.Format("2006-01-02"), "to": to.Format("2006-01-02"), "group": group, "rows": rows})
+		return
+	}
+
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", `attachment; filename="time-report-`+group+`.csv"`)
+	c.Status(http.StatusOK)
+
+	writer := csv.NewWriter(c.Writer)
+	writer.Write([]string{group, "label", "seconds", "hours"})
+	for _, row := range rows {
+		writer.Write([]string{row.Key, row.Label, strconv.FormatInt(row.Seconds, 10), strconv.FormatFloat(row.Hours, 'f', 2, 64)})
+	}
+	writer.Flush()
+}
+
+// DeleteTaskTimeEntries - purge hook, removes the time logged on a permanently deleted task
+func (handler *TimeHandler) DeleteTaskTimeEntries(ctx context.Context, task model.Task) error {
+	_, err := handler.entriesColl.DeleteMany(ctx, bson.M{"task_id": task.ID})
+	return err
+}
+
+// trackableTask - loads the task in the path, responding with 403 for viewers who can't log time on it
+func (handler *TimeHandler) trackableTask(ctx context.Context, c *gin.Context, user model.User) (model.Task, bool) {
+	task, ok := taskFromPath(ctx, c, handler.tasksColl, handler.projectsColl, user)
+	if !ok {
+		return task, false
+	}
+
+	role, err := taskRole(ctx, handler.projectsColl, task, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return task, false
+	}
+	if role == model.RoleViewer {
+		c.JSON(http.StatusForbidden, gin.H{"error": "viewers can't log time"})
+		return task, false
+	}
+	return task, true
+}
+
+func (handler *TimeHandler) runningTimer(ctx context.Context, userID primitive.ObjectID) (model.Timer, error) {
+	var timer model.Timer
+	data, err := handler.redisClient.Get(ctx, timerKey(userID)).Bytes()
+	if err != nil {
+		return timer, err
+	}
+	err = json.Unmarshal(data, &timer)
+	return timer, err
+}
+
+// stopTimer - removes the running timer and logs its time in the timer's workspace, which may not be the current one.
+// The timer is put back when its time can't be stored, unless another one was started meanwhile.
+// Returns redis.Nil without a running timer and mongo.ErrNoDocuments when its task is gone.
+func (handler *TimeHandler) stopTimer(ctx context.Context, user model.User) (entry model.TimeEntry, err error) {
+	key := timerKey(user.ID)
+	data, err := handler.redisClient.GetDel(ctx, key).Bytes()
+	if err != nil {
+		return entry, err
+	}
+
+	var timer model.Timer
+	if err := json.Unmarshal(data, &timer); err != nil {
+		return entry, err
+	}
+
+	logged := false
+	defer func() {
+		if logged || err == mongo.ErrNoDocuments {
+			return
+		}
+		if restoreErr := handler.redisClient.SetNX(context.WithoutCancel(ctx), key, data, 0).Err(); restoreErr != nil {
+			log.Printf("Failed to restore the timer of user %s: %v", user.ID.Hex(), restoreErr)
+		}
+	}()
+
+	ctx = tenant.Unscoped(ctx)
+	var task model.Task
+	if err := handler.tasksColl.FindOne(ctx, bson.M{"_id": timer.TaskID, "workspace_id": timer.WorkspaceID}).Decode(&task); err != nil {
+		return entry, err
+	}
+
+	end := time.Now()
+	if end.Sub(timer.StartedAt) > maxTimeEntry {
+		end = timer.StartedAt.Add(maxTimeEntry)
+	}
+
+	entry = newTimeEntry(task, user, timer.StartedAt, end)
+	if _, err := handler.entriesColl.InsertOne(ctx, entry); err != nil {
+		return entry, err
+	}
+	logged = true
+	return entry, handler.incrementTrackedTime(ctx, task, entry.Duration)
+}
+
+// logTime - stores the entry and adds it to the tracked time of the task
+func (handler *TimeHandler) logTime(ctx context.Context, task model.Task, entry model.TimeEntry) error {
+	if _, err := handler.entriesColl.InsertOne(ctx, entry); err != nil {
+		return err
+	}
+	return handler.incrementTrackedTime(ctx, task, entry.Duration)
+}
+
+// incrementTrackedTime - keeps the tracked time on the task in sync, in both collections
+func (handler *TimeHandler) incrementTrackedTime(ctx context.Context, task model.Task, seconds int64) error {
+	if _, err := handler.tasksColl.UpdateOne(ctx, bson.M{"_id": task.ID}, bson.M{"$inc": bson.M{"tracked_seconds": seconds}}); err != nil {
+		return err
+	}
+
+	_, err := handler.usersColl.UpdateOne(ctx, bson.M{"_id": task.UserID, "task._id": task.ID},
+		bson.M{"$inc": bson.M{"task.$.tracked_seconds": seconds}})
+	if err != nil {
+		return err
+	}
+
+	invalidateMemberCaches(ctx, handler.redisClient, handler.projectsColl, task)
+	return nil
+}
+
+// reportByProject - sums the entries per project, labelled with the project names
+func (handler *TimeHandler) reportByProject(ctx context.Context, entries []model.TimeEntry) ([]timeReportRow, error) {
+	totals := make(map[primitive.ObjectID]int64)
+	var withoutProject int64
+	projectIDs := make([]primitive.ObjectID, 0)
+	for _, entry := range entries {
+		if entry.ProjectID == nil {
+			withoutProject += entry.Duration
+			continue
+		}
+		if _, seen := totals[*entry.ProjectID]; !seen {
+			projectIDs = append(projectIDs, *entry.ProjectID)
+		}
+		totals[*entry.ProjectID] += entry.Duration
+	}
+
+	names := make(map[primitive.ObjectID]string, len(projectIDs))
+	if len(projectIDs) > 0 {
+		cur, err := handler.projectsColl.Find(ctx, bson.M{"_id": bson.M{"$in": projectIDs}})
+		if err != nil {
+			return nil, err
+		}
+		projects := make([]model.Project, 0)
+		if err := cur.All(ctx, &projects); err != nil {
+			return nil, err
+		}
+		for _, project := range projects {
+			names[project.ID] = project.Name
+		}
+	}
+
+	rows := make([]timeReportRow, 0, len(projectIDs)+1)
+	for _, projectID := range projectIDs {
+		name, found := names[projectID]
+		if !found {
+			name = "Deleted project"
+		}
+		rows = append(rows, newReportRow(projectID.Hex(), name, totals[projectID]))
+	}
+	if withoutProject > 0 {
+		rows = append(rows, newReportRow("", "No project", withoutProject))
+	}
+
+	sort.Slice(rows, func(i, j int) bool { return rows[i].Seconds > rows[j].Seconds })
+	return rows, nil
+}
+
+// reportByDay - sums the entries per day they started on, in the given location
+func reportByDay(entries []model.TimeEntry, location *time.Location) []timeReportRow {
+	totals := make(map[string]int64)
+	for _, entry := range entries {
+		totals[entry.Start.In(location).Format("2006-01-02")] += entry.Duration
+	}
+
+	rows := make([]timeReportRow, 0, len(totals))
+	for day, seconds := range totals {
+		rows = append(rows, newReportRow(day, day, seconds))
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].Key < rows[j].Key })
+	return rows
+}
+
+func newReportRow(key, label string, seconds int64) timeReportRow {
+	return timeReportRow{Key: key, Label: label, Seconds: seconds, Hours: math.Round(float64(seconds)/36) / 100}
+}
+
+func newTimeEntry(task model.Task, user model.User, start, end time.Time) model.TimeEntry {
+	return model.TimeEntry{
+		ID:          primitive.NewObjectID(),
+		TaskID:      task.ID,
+		UserID:      user.ID,
+		Username:    user.Username,
+		WorkspaceID: task.WorkspaceID,
+		ProjectID:   task.ProjectID,
+		Start:       start,
+		End:         end,
+		Duration:    int64(end.Sub(start).Seconds()),
+		CreatedAt:   time.Now(),
+	}
+}
+
+// timerKey - Redis key holding the running timer of a user
+func timerKey(userID primitive.ObjectID) string {
+	return "timer:" + userID.Hex()
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/utpal74/track-my-tasks-backend/model"
+	"github.com/utpal74/track-my-tasks-backend/tenant"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestStopTimer(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	user := model.User{ID: primitive.NewObjectID(), Username: "alice"}
+	task := model.Task{ID: primitive.NewObjectID(), UserID: user.ID, WorkspaceID: primitive.NewObjectID()}
+	taskDoc := bson.D{{Key: "_id", Value: task.ID}, {Key: "user_id", Value: task.UserID}, {Key: "workspace_id", Value: task.WorkspaceID}}
+	found := mtest.CreateCursorResponse(0, "db.tasks", mtest.FirstBatch, taskDoc)
+	gone := mtest.CreateCursorResponse(0, "db.tasks", mtest.FirstBatch)
+	failed := mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 11600, Message: "interrupted at shutdown"})
+
+	tests := []struct {
+		name        string
+		responses   []bson.D
+		wantErr     error
+		wantRunning bool
+	}{
+		{
+			name:      "logs the time",
+			responses: []bson.D{found, mtest.CreateSuccessResponse(), mtest.CreateSuccessResponse(), mtest.CreateSuccessResponse()},
+		},
+		{
+			name:      "discards the time of a deleted task",
+			responses: []bson.D{gone},
+			wantErr:   mongo.ErrNoDocuments,
+		},
+		{
+			name:        "keeps the timer when the task can't be loaded",
+			responses:   []bson.D{failed},
+			wantRunning: true,
+		},
+		{
+			name:        "keeps the timer when the entry can't be stored",
+			responses:   []bson.D{found, failed},
+			wantRunning: true,
+		},
+	}
+
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			server := miniredis.RunT(mt)
+			handler := &TimeHandler{
+				entriesColl: tenant.NewCollection(mt.DB.Collection("time_entries")),
+				tasksColl:   tenant.NewCollection(mt.DB.Collection("tasks")),
+				usersColl:   mt.DB.Collection("users"),
+				redisClient: redis.NewClient(&redis.Options{Addr: server.Addr()}),
+			}
+
+			timer := model.Timer{TaskID: task.ID, WorkspaceID: task.WorkspaceID, StartedAt: time.Now().Add(-time.Hour)}
+			data, _ := json.Marshal(timer)
+			server.Set(timerKey(user.ID), string(data))
+			mt.AddMockResponses(tt.responses...)
+
+			_, err := handler.stopTimer(context.Background(), user)
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				mt.Errorf("stopTimer() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && tt.wantRunning == (err == nil) {
+				mt.Errorf("stopTimer() error = %v", err)
+			}
+			if running := server.Exists(timerKey(user.ID)); running != tt.wantRunning {
+				mt.Errorf("timer running = %v, want %v", running, tt.wantRunning)
+			}
+		})
+	}
+}
+
+func TestNewTimeEntryLength(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	end := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		body gin.H
+	}{
+		{name: "more than a day of minutes", body: gin.H{"minutes": 24*60 + 1}},
+		{name: "minutes overflowing a duration", body: gin.H{"minutes": math.MaxInt64 / 60}},
+		{name: "range longer than a day", body: gin.H{"start": end.Add(-25 * time.Hour), "end": end}},
+		{name: "range overflowing a duration", body: gin.H{"start": time.Date(1, 1, 1, 0, 0, 0, 0, time.UTC), "end": end}},
+		{name: "end before start", body: gin.H{"start": end, "end": end.Add(-time.Minute)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, _ := json.Marshal(tt.body)
+			recorder := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(recorder)
+			c.Request = httptest.NewRequest(http.MethodPost, "/tasks/1/time", bytes.NewReader(body))
+
+			(&TimeHandler{}).NewTimeEntryHandler(c)
+			if recorder.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want %d: %s", recorder.Code, http.StatusBadRequest, recorder.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/utpal74/track-my-tasks-backend/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// accessTokenPrefix - marks personal access tokens, so leaked ones are easy to recognise
+const accessTokenPrefix = "tmt_"
+
+type accessTokenRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+// GetAccessTokensHandler - list the personal access tokens of the signed in user
+func (handler *AuthHandler) GetAccessTokensHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	user, ok := currentUser(ctx, c, handler.collections)
+	if !ok {
+		return
+	}
+
+	cur, err := handler.tokensColl.Find(ctx, bson.M{"user_id": user.ID}, options.Find().SetSort(bson.M{"created_at": -1}))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer cur.Close(ctx)
+
+	tokens := make([]model.AccessToken, 0)
+	if err := cur.All(ctx, &tokens); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to decode access tokens"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// NewAccessTokenHandler - create a personal access token working in the current workspace.
+// The token itself is only returned here.
+func (handler *AuthHandler) NewAccessTokenHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	var req accessTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := currentUser(ctx, c, handler.collections)
+	if !ok {
+		return
+	}
+
+	secret, err := newSecretToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "unable to create token: " + err.Error()})
+		return
+	}
+	secret = accessTokenPrefix + secret
+
+	token := model.AccessToken{
+		ID:          primitive.NewObjectID(),
+		UserID:      user.ID,
+		WorkspaceID: workspaceID(ctx),
+		Name:        strings.TrimSpace(req.Name),
+		Prefix:      secret[:len(accessTokenPrefix)+6],
+		TokenHash:   hashToken(secret),
+		CreatedAt:   time.Now(),
+	}
+	if _, err := handler.tokensColl.InsertOne(ctx, token); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"access_token": token, "token": secret})
+}
+
+// DeleteAccessTokenHandler - revoke a personal access token of the signed in user
+func (handler *AuthHandler) DeleteAccessTokenHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid token id"})
+		return
+	}
+
+	user, ok := currentUser(ctx, c, handler.collections)
+	if !ok {
+		return
+	}
+
+	res, err := handler.tokensColl.DeleteOne(ctx, bson.M{"_id": id, "user_id": user.ID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if res.DeletedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "access token not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Access token revoked", "id": id})
+}
+
+// TokenAuthMiddleware - authenticates clients which can't keep a session, such as CalDAV apps: HTTP basic auth
+// with the username and a personal access token or the password, or a bearer access token.
+// Requests made with a token work in the token's workspace.
+func (handler *AuthHandler) TokenAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+		defer cancel()
+
+		username, secret, basic := c.Request.BasicAuth()
+		if !basic {
+			secret, _ = strings.CutPrefix(c.Request.Header.Get("Authorization"), "Bearer ")
+		}
+		if secret == "" {
+			requireAuthentication(c)
+			return
+		}
+
+		var token model.AccessToken
+		err := handler.tokensColl.FindOne(ctx, bson.M{"token_hash": hashToken(secret)}).Decode(&token)
+		if err == nil {
+			var user model.User
+			err = handler.collections.FindOne(ctx, bson.M{"_id": token.UserID}).Decode(&user)
+			if err != nil || (basic && username != user.Username) {
+				requireAuthentication(c)
+				return
+			}
+
+			handler.tokensColl.UpdateOne(ctx, bson.M{"_id": token.ID}, bson.M{"$set": bson.M{"last_used_at": time.Now()}})
+			c.Set("username", user.Username)
+			c.Set("token_workspace_id", token.WorkspaceID)
+			c.Next()
+			return
+		} else if err != mongo.ErrNoDocuments {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error checking access token: %v", err.Error())})
+			return
+		}
+
+		if !basic {
+			requireAuthentication(c)
+			return
+		}
+
+		// Hashed the same way as on sign in
+		h := sha256.New()
+		h.Write([]byte(secret))
+		err = handler.collections.FindOne(ctx, bson.M{"username": username, "password": hex.EncodeToString(h.Sum(nil))}).Err()
+		if err == mongo.ErrNoDocuments {
+			requireAuthentication(c)
+			return
+		} else if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.Set("username", username)
+		c.Next()
+	}
+}
+
+func requireAuthentication(c *gin.Context) {
+	c.Header("WWW-Authenticate", `Basic realm="track-my-tasks", charset="UTF-8"`)
+	c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+}
+
+// newSecretToken - a random URL safe token
+func newSecretToken() (string, error) {
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(token), nil
+}
+
+// hashToken - what is stored of a secret token
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,821 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/utpal74/track-my-tasks-backend/jobs"
+	"github.com/utpal74/track-my-tasks-backend/logger"
+	"github.com/utpal74/track-my-tasks-backend/markdown"
+	"github.com/utpal74/track-my-tasks-backend/model"
+	"github.com/utpal74/track-my-tasks-backend/tenant"
+	"github.com/utpal74/track-my-tasks-backend/transfer"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	maxImportSize = 10 << 20
+	maxImportRows = 10000
+	// Imports with more rows run as a background job
+	maxInlineImport = 200
+	importChunkSize = 100
+	// Failed rows listed on an import, the others are only counted
+	maxImportErrors = 1000
+	importTimeout   = 10 * time.Minute
+	// Tasks shown by a dry run
+	maxImportPreview = 50
+)
+
+type TransferHandler struct {
+	ctx          context.Context
+	tasksColl    *tenant.Collection
+	projectsColl *tenant.Collection
+	usersColl    *mongo.Collection
+	commentsColl *mongo.Collection
+	importsColl  *mongo.Collection
+	redisClient  *redis.Client
+	tasks        *TasksHandler
+}
+
+// NewTransferHandler - imported tasks are recorded through the tasks handler, like the ones created by hand
+func NewTransferHandler(ctx context.Context, tasksColl *tenant.Collection, projectsColl *tenant.Collection, usersColl *mongo.Collection, commentsColl *mongo.Collection, importsColl *mongo.Collection, redisClient *redis.Client, tasks *TasksHandler) *TransferHandler {
+	return &TransferHandler{
+		ctx:          ctx,
+		tasksColl:    tasksColl,
+		projectsColl: projectsColl,
+		usersColl:    usersColl,
+		commentsColl: commentsColl,
+		importsColl:  importsColl,
+		redisClient:  redisClient,
+		tasks:        tasks,
+	}
+}
+
+// ExportHandler - download the tasks of the user in the workspace with their projects, labels and comments,
+// as json (default), csv or markdown. Tasks in the trash are left out.
+func (handler *TransferHandler) ExportHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+	defer cancel()
+
+	format := c.DefaultQuery("format", transfer.FormatJSON)
+	if !validTransferFormat(format) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json, csv or markdown"})
+		return
+	}
+
+	user, ok := currentUser(ctx, c, handler.usersColl)
+	if !ok {
+		return
+	}
+
+	doc, err := handler.exportDocument(ctx, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := transfer.Write(format, &buf, doc); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	filename := fmt.Sprintf("tasks-%s.%s", doc.ExportedAt.Format("2006-01-02"), transfer.Extension(format))
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Data(http.StatusOK, transfer.ContentType(format), buf.Bytes())
+}
+
+func (handler *TransferHandler) exportDocument(ctx context.Context, userID primitive.ObjectID) (transfer.Document, error) {
+	doc := transfer.Document{
+		Version:    transfer.Version,
+		ExportedAt: time.Now().UTC(),
+		Projects:   []transfer.Project{},
+		Tasks:      []transfer.Task{},
+	}
+
+	cursor, err := handler.projectsColl.Find(ctx, bson.M{"user_id": userID}, options.Find().SetSort(bson.M{"created_at": 1}))
+	if err != nil {
+		return doc, err
+	}
+	var projects []model.Project
+	if err := cursor.All(ctx, &projects); err != nil {
+		return doc, err
+	}
+
+	projectNames := make(map[primitive.ObjectID]string, len(projects))
+	for _, project := range projects {
+		projectNames[project.ID] = project.Name
+		doc.Projects = append(doc.Projects, transfer.Project{ID: project.ID.Hex(), Name: project.Name})
+	}
+
+	cursor, err = handler.tasksColl.Find(ctx, activeTask(bson.M{"user_id": userID}),
+		options.Find().SetSort(bson.D{{Key: "rank", Value: 1}, {Key: "created_at", Value: 1}}))
+	if err != nil {
+		return doc, err
+	}
+	var tasks []model.Task
+	if err := cursor.All(ctx, &tasks); err != nil {
+		return doc, err
+	}
+	fillLegacyStatus(tasks)
+
+	exported := make(map[primitive.ObjectID]bool, len(tasks))
+	taskIDs := make([]primitive.ObjectID, 0, len(tasks))
+	for _, task := range tasks {
+		exported[task.ID] = true
+		taskIDs = append(taskIDs, task.ID)
+	}
+
+	comments := make(map[primitive.ObjectID][]transfer.Comment)
+	if len(taskIDs) > 0 {
+		cursor, err = handler.commentsColl.Find(ctx, bson.M{"task_id": bson.M{"$in": taskIDs}}, options.Find().SetSort(bson.M{"created_at": 1}))
+		if err != nil {
+			return doc, err
+		}
+		var stored []model.Comment
+		if err := cursor.All(ctx, &stored); err != nil {
+			return doc, err
+		}
+		for _, comment := range stored {
+			comments[comment.TaskID] = append(comments[comment.TaskID], transfer.Comment{
+				Author:    comment.Author,
+				Body:      comment.Body,
+				CreatedAt: comment.CreatedAt,
+			})
+		}
+	}
+
+	for _, task := range tasks {
+		created := task.CreatedAt
+		exportedTask := transfer.Task{
+			ID:        task.ID.Hex(),
+			Title:     task.Title,
+			Comment:   task.Comment,
+			Done:      task.Done,
+			Status:    task.Status,
+			Priority:  task.Priority,
+			Important: task.Important,
+			DueDate:   task.DueDate,
+			Labels:    task.Labels,
+			Estimate:  task.Estimate,
+			Comments:  comments[task.ID],
+			CreatedAt: &created,
+		}
+		// Subtasks of trashed tasks become top level tasks
+		if task.ParentID != nil && exported[*task.ParentID] {
+			exportedTask.ParentID = task.ParentID.Hex()
+		}
+		if task.ProjectID != nil {
+			exportedTask.Project = projectNames[*task.ProjectID]
+		}
+		for _, item := range task.Checklist {
+			exportedTask.Checklist = append(exportedTask.Checklist, transfer.ChecklistItem{Text: item.Text, Done: item.Done})
+		}
+		doc.Tasks = append(doc.Tasks, exportedTask)
+	}
+
+	return doc, nil
+}
+
+// ImportHandler - import tasks from a json, csv or markdown file, or from the export of Todoist (todoist), Trello
+// (trello) or Microsoft To Do (mstodo), sent as the body or as the "file" field of a multipart form. Rows with
+// an ID seen in an earlier import (or the ID of an existing task, when restoring an export) are skipped, invalid
+// rows are reported and the others imported; tasks without a project go to the project named by ?project= when
+// given. Files of up to 200 rows are imported right away, larger ones (or with async=true) become a job to poll
+// at /imports/:id. With dry_run=true nothing is stored, the answer previews the tasks and projects the import
+// would create along with how the items of the source are mapped.
+func (handler *TransferHandler) ImportHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+	defer cancel()
+
+	body, filename, err := importFile(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer body.Close()
+
+	format := c.Query("format")
+	if format == "" {
+		format = formatFromFilename(filename)
+	}
+	if !transfer.Importable(format) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json, csv, markdown, todoist, trello or mstodo"})
+		return
+	}
+
+	imported, err := transfer.ParseImport(format, body)
+	rows := imported.Rows
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "the file is larger than 10 MB"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unable to read the file: " + err.Error()})
+		return
+	}
+	if len(rows) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "the file has no tasks"})
+		return
+	}
+	if len(rows) > maxImportRows {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("at most %d tasks can be imported at once", maxImportRows)})
+		return
+	}
+
+	if project := strings.TrimSpace(c.Query("project")); project != "" {
+		for i := range rows {
+			if rows[i].Task.Project == "" {
+				rows[i].Task.Project = project
+			}
+		}
+	}
+
+	user, ok := currentUser(ctx, c, handler.usersColl)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	job := model.ImportJob{
+		ID:          primitive.NewObjectID(),
+		UserID:      user.ID,
+		WorkspaceID: workspaceID(ctx),
+		Format:      format,
+		DryRun:      c.Query("dry_run") == "true",
+		Status:      model.ImportQueued,
+		Total:       len(rows),
+		Errors:      []model.ImportError{},
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	for _, mapping := range imported.Mappings {
+		job.Mapping = append(job.Mapping, model.ImportMapping{Source: mapping.Source, Target: mapping.Target, Count: mapping.Count})
+	}
+
+	if job.DryRun {
+		preview, err := handler.previewImport(ctx, user, rows, &job)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, importPreview{ImportJob: job, Tasks: preview})
+		return
+	}
+
+	if len(rows) <= maxInlineImport && c.Query("async") != "true" {
+		if err := handler.runImport(ctx, user, rows, &job, false); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "import": job})
+			return
+		}
+		c.JSON(http.StatusOK, job)
+		return
+	}
+
+	if _, err := handler.importsColl.InsertOne(ctx, job); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	background := job
+	jobCtx := logger.WithLogger(ctx, logger.FromCtx(handler.ctx))
+	jobs.Go(jobCtx, "import "+job.ID.Hex(), importTimeout, func(ctx context.Context) error {
+		return handler.runImport(ctx, user, rows, &background, true)
+	})
+
+	c.JSON(http.StatusAccepted, job)
+}
+
+// GetImportHandler - the progress of an import job of the user
+func (handler *TransferHandler) GetImportHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid import id"})
+		return
+	}
+
+	user, ok := currentUser(ctx, c, handler.usersColl)
+	if !ok {
+		return
+	}
+
+	var job model.ImportJob
+	err = handler.importsColl.FindOne(ctx, bson.M{"_id": id, "user_id": user.ID}).Decode(&job)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "import not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// importFile - the uploaded file of a multipart form, the request body otherwise
+func importFile(c *gin.Context) (io.ReadCloser, string, error) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize)
+
+	if !strings.HasPrefix(c.ContentType(), "multipart/form-data") {
+		return c.Request.Body, "", nil
+	}
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		return nil, "", errors.New("the form has no file")
+	}
+	if header.Size > maxImportSize {
+		return nil, "", errors.New("the file is larger than 10 MB")
+	}
+	file, err := header.Open()
+	if err != nil {
+		return nil, "", err
+	}
+	return file, header.Filename, nil
+}
+
+func formatFromFilename(filename string) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv":
+		return transfer.FormatCSV
+	case ".md", ".markdown":
+		return transfer.FormatMarkdown
+	}
+	return transfer.FormatJSON
+}
+
+// validTransferFormat - reports whether the format can be exported, and so round-tripped
+func validTransferFormat(format string) bool {
+	return format == transfer.FormatJSON || format == transfer.FormatCSV || format == transfer.FormatMarkdown
+}
+
+// importPreview - the answer to a dry run, the job as the import would end and the first tasks it would create
+type importPreview struct {
+	model.ImportJob
+	Tasks []transfer.Task `json:"tasks"`
+}
+
+// previewImport - plans the import of the rows without storing anything
+func (handler *TransferHandler) previewImport(ctx context.Context, user model.User, rows []transfer.Row, job *model.ImportJob) ([]transfer.Task, error) {
+	run := &importRun{handler: handler, user: user, job: job, preview: []transfer.Task{}}
+	err := run.importRows(ctx, rows, func() {})
+
+	finished := time.Now()
+	job.FinishedAt = &finished
+	job.UpdatedAt = finished
+	job.Status = model.ImportDone
+	return run.preview, err
+}
+
+// runImport - imports the rows, counting them on the job. A persisted job is saved as it makes progress.
+func (handler *TransferHandler) runImport(ctx context.Context, user model.User, rows []transfer.Row, job *model.ImportJob, persisted bool) error {
+	job.Status = model.ImportRunning
+	handler.saveImport(ctx, job, persisted)
+
+	run := &importRun{handler: handler, user: user, job: job}
+	err := run.importRows(ctx, rows, func() { handler.saveImport(ctx, job, persisted) })
+
+	finished := time.Now()
+	job.FinishedAt = &finished
+	job.Status = model.ImportDone
+	if err != nil {
+		job.Status = model.ImportFailed
+		job.Error = err.Error()
+	}
+
+	// The job may have run out of time, its outcome is saved regardless
+	saveCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+	handler.saveImport(saveCtx, job, persisted)
+
+	if job.Created > 0 {
+		log.Println("remove data from redis")
+		handler.redisClient.Del(saveCtx, userCacheKeys(user.ID)...)
+	}
+	return err
+}
+
+func (handler *TransferHandler) saveImport(ctx context.Context, job *model.ImportJob, persisted bool) {
+	job.UpdatedAt = time.Now()
+	if !persisted {
+		return
+	}
+	if _, err := handler.importsColl.ReplaceOne(ctx, bson.M{"_id": job.ID}, job); err != nil {
+		log.Printf("Failed to save import %s: %v", job.ID.Hex(), err)
+	}
+}
+
+// importRun - the state of one import
+type importRun struct {
+	handler     *TransferHandler
+	user        model.User
+	job         *model.ImportJob
+	existing    map[string]primitive.ObjectID // Tasks already stored, by external ID and by ID
+	projects    map[string]*model.Project     // By lower case name
+	projectErrs map[string]error              // Projects which couldn't be created
+	ranks       []string                      // Reserved for the tasks still to be planned, nil in dry runs
+	preview     []transfer.Task               // Tasks a dry run would create
+}
+
+// importedTask - a row ready to be written
+type importedTask struct {
+	row      transfer.Row
+	task     model.Task
+	comments []model.Comment
+	parent   *importedTask // Set when the parent is in the same file
+	failed   bool
+}
+
+func (run *importRun) importRows(ctx context.Context, rows []transfer.Row, progress func()) error {
+	if err := run.load(ctx, rows); err != nil {
+		return err
+	}
+
+	// Plan every row first, so IDs are known when parents are resolved
+	planned := make([]*importedTask, 0, len(rows))
+	byExternalID := make(map[string]*importedTask)
+	seen := make(map[string]bool)
+	rejected := make(map[string]bool)
+	for _, row := range rows {
+		if id := row.Task.ID; id != "" {
+			if _, found := run.existing[id]; found || seen[id] {
+				run.job.Skipped++
+				run.job.Processed++
+				continue
+			}
+			seen[id] = true
+		}
+
+		item, err := run.plan(ctx, row)
+		if err != nil {
+			run.reject(row, err.Error())
+			rejected[row.Task.ID] = true
+			continue
+		}
+		planned = append(planned, item)
+		if row.Task.ID != "" {
+			byExternalID[row.Task.ID] = item
+		}
+	}
+
+	for _, item := range planned {
+		parentID := item.row.Task.ParentID
+		if parentID == "" {
+			continue
+		}
+		if parent, found := byExternalID[parentID]; found {
+			item.parent = parent
+			item.task.ParentID = &parent.task.ID
+		} else if id, found := run.existing[parentID]; found {
+			item.task.ParentID = &id
+		} else if rejected[parentID] {
+			run.fail(item, "the parent task wasn't imported")
+		} else {
+			run.fail(item, fmt.Sprintf("parent task %q not found", parentID))
+		}
+	}
+
+	// A task fails with its parent, and tasks which are each other's parents fail together
+	for changed := true; changed; {
+		changed = false
+		for _, item := range planned {
+			if item.failed || item.parent == nil {
+				continue
+			}
+			if item.parent.failed {
+				run.fail(item, "the parent task wasn't imported")
+				changed = true
+			} else if inParentCycle(item, len(planned)) {
+				run.fail(item, "the parent tasks form a cycle")
+				changed = true
+			}
+		}
+	}
+
+	pending := make([]*importedTask, 0, len(planned))
+	for _, item := range planned {
+		if !item.failed {
+			pending = append(pending, item)
+		}
+	}
+	progress()
+
+	if run.job.DryRun {
+		for _, item := range pending[:min(len(pending), maxImportPreview)] {
+			run.preview = append(run.preview, previewTask(item))
+		}
+		run.job.Created += len(pending)
+		run.job.Processed += len(pending)
+		return nil
+	}
+
+	for start := 0; start < len(pending); start += importChunkSize {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		chunk := pending[start:min(start+importChunkSize, len(pending))]
+		if err := run.write(ctx, chunk); errors.Is(err, tenant.ErrQuotaExceeded) {
+			for _, item := range chunk {
+				run.fail(item, "the workspace has reached its task quota")
+			}
+		} else if err != nil {
+			return err
+		} else {
+			run.job.Created += len(chunk)
+			run.job.Processed += len(chunk)
+		}
+		progress()
+	}
+
+	return nil
+}
+
+// load - finds the tasks of the file which are already stored and the projects of the user
+func (run *importRun) load(ctx context.Context, rows []transfer.Row) error {
+	var externalIDs []string
+	var taskIDs []primitive.ObjectID
+	for _, row := range rows {
+		for _, id := range []string{row.Task.ID, row.Task.ParentID} {
+			if id == "" {
+				continue
+			}
+			externalIDs = append(externalIDs, id)
+			if taskID, err := primitive.ObjectIDFromHex(id); err == nil {
+				taskIDs = append(taskIDs, taskID)
+			}
+		}
+	}
+
+	run.existing = make(map[string]primitive.ObjectID)
+	if len(externalIDs) > 0 {
+		// Tasks in the trash count as imported too
+		filter := bson.M{"user_id": run.user.ID, "$or": bson.A{
+			bson.M{"external_id": bson.M{"$in": externalIDs}},
+			bson.M{"_id": bson.M{"$in": taskIDs}},
+		}}
+		cursor, err := run.handler.tasksColl.Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1, "external_id": 1}))
+		if err != nil {
+			return err
+		}
+		var tasks []model.Task
+		if err := cursor.All(ctx, &tasks); err != nil {
+			return err
+		}
+		for _, task := range tasks {
+			run.existing[task.ID.Hex()] = task.ID
+			if task.ExternalID != "" {
+				run.existing[task.ExternalID] = task.ID
+			}
+		}
+	}
+
+	cursor, err := run.handler.projectsColl.Find(ctx, bson.M{"user_id": run.user.ID})
+	if err != nil {
+		return err
+	}
+	var projects []model.Project
+	if err := cursor.All(ctx, &projects); err != nil {
+		return err
+	}
+	run.projects = make(map[string]*model.Project, len(projects))
+	run.projectErrs = make(map[string]error)
+	for i := range projects {
+		run.projects[strings.ToLower(projects[i].Name)] = &projects[i]
+	}
+
+	if !run.job.DryRun && len(rows) > 0 {
+		run.ranks, err = reserveRanks(ctx, run.handler.tasksColl, run.handler.usersColl, run.user.ID, len(rows))
+	}
+	return err
+}
+
+// plan - validates a row and turns it into a task. WIP limits don't apply, an import restores existing work.
+func (run *importRun) plan(ctx context.Context, row transfer.Row) (*importedTask, error) {
+	if row.Err != nil {
+		return nil, row.Err
+	}
+
+	source := row.Task
+	title := strings.TrimSpace(source.Title)
+	if title == "" {
+		return nil, errors.New("title is required")
+	}
+
+	priority := strings.ToLower(strings.TrimSpace(source.Priority))
+	if priority == "" {
+		priority = model.PriorityNone
+	}
+	if !model.ValidPriority(priority) {
+		return nil, fmt.Errorf("unknown priority: %s", source.Priority)
+	}
+	if source.Estimate < 0 {
+		return nil, errors.New("estimate_minutes can't be negative")
+	}
+
+	columns := model.DefaultStatuses()
+	var projectID *primitive.ObjectID
+	if name := strings.TrimSpace(source.Project); name != "" {
+		project, err := run.project(ctx, name)
+		if errors.Is(err, tenant.ErrQuotaExceeded) {
+			return nil, errors.New("the workspace has reached its project quota")
+		} else if err != nil {
+			return nil, err
+		}
+		projectID = &project.ID
+		columns = project.Workflow()
+	}
+
+	// Statuses missing from the workflow fall back to the first column of the matching category
+	column, found := model.FindStatus(columns, source.Status)
+	if !found {
+		category := model.StatusCategoryOpen
+		if source.Done {
+			category = model.StatusCategoryClosed
+		}
+		column = model.FirstStatus(columns, category)
+	}
+
+	task := model.Task{
+		ExternalID: source.ID,
+		Title:      title,
+		Comment:    source.Comment,
+		ProjectID:  projectID,
+		Priority:   priority,
+		Important:  source.Important,
+		DueDate:    source.DueDate,
+		Labels:     source.Labels,
+		Estimate:   source.Estimate,
+	}
+	for _, item := range source.Checklist {
+		task.Checklist = append(task.Checklist, model.ChecklistItem{Text: item.Text, Done: item.Done})
+	}
+	initNewTask(ctx, &task, run.user, column)
+	if source.CreatedAt != nil && !source.CreatedAt.IsZero() {
+		task.CreatedAt = *source.CreatedAt
+	}
+
+	if len(run.ranks) > 0 {
+		task.Rank, run.ranks = run.ranks[0], run.ranks[1:]
+	}
+
+	item := &importedTask{row: row, task: task}
+	for _, comment := range source.Comments {
+		body := strings.TrimSpace(comment.Body)
+		if body == "" {
+			continue
+		}
+		// Comments are stored as the importing user's, naming whoever wrote them in the source
+		if comment.Author != "" && comment.Author != run.user.Username {
+			body = fmt.Sprintf("*%s wrote:*\n\n%s", comment.Author, body)
+		}
+		created := comment.CreatedAt
+		if created.IsZero() {
+			created = task.CreatedAt
+		}
+		item.comments = append(item.comments, model.Comment{
+			ID:        primitive.NewObjectID(),
+			TaskID:    task.ID,
+			AuthorID:  run.user.ID,
+			Author:    run.user.Username,
+			Body:      body,
+			HTML:      markdown.Render(body),
+			CreatedAt: created,
+			UpdatedAt: created,
+		})
+	}
+	item.task.CommentCount = len(item.comments)
+
+	return item, nil
+}
+
+// project - the user's project with the name, created with the default workflow when there is none
+func (run *importRun) project(ctx context.Context, name string) (*model.Project, error) {
+	key := strings.ToLower(name)
+	if project, found := run.projects[key]; found {
+		return project, nil
+	}
+	if err, found := run.projectErrs[key]; found {
+		return nil, err
+	}
+
+	project := &model.Project{
+		ID:          primitive.NewObjectID(),
+		UserID:      run.user.ID,
+		WorkspaceID: workspaceID(ctx),
+		Name:        name,
+		Statuses:    model.DefaultStatuses(),
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+	}
+	if !run.job.DryRun {
+		if _, err := run.handler.projectsColl.InsertOne(ctx, project); err != nil {
+			run.projectErrs[key] = err
+			return nil, err
+		}
+	}
+	run.projects[key] = project
+	run.job.NewProjects = append(run.job.NewProjects, name)
+	return project, nil
+}
+
+// write - stores a chunk of tasks with their copies on the user and their comments, and records their creation,
+// in one transaction
+func (run *importRun) write(ctx context.Context, chunk []*importedTask) error {
+	documents := make([]interface{}, 0, len(chunk))
+	tasks := make([]model.Task, 0, len(chunk))
+	var comments []interface{}
+	for _, item := range chunk {
+		documents = append(documents, item.task)
+		tasks = append(tasks, item.task)
+		for _, comment := range item.comments {
+			comments = append(comments, comment)
+		}
+	}
+
+	return run.handler.tasks.outbox.Transact(ctx, func(ctx context.Context) error {
+		if _, err := run.handler.tasksColl.InsertMany(ctx, documents); err != nil {
+			return err
+		}
+
+		_, err := run.handler.usersColl.UpdateOne(ctx, bson.M{"_id": run.user.ID}, bson.M{"$push": bson.M{"task": bson.M{"$each": tasks}}})
+		if err != nil {
+			return fmt.Errorf("failed to update user with new tasks: %w", err)
+		}
+
+		if len(comments) > 0 {
+			if _, err := run.handler.commentsColl.InsertMany(ctx, comments); err != nil {
+				return err
+			}
+		}
+
+		for _, task := range tasks {
+			if err := run.handler.tasks.recordChange(ctx, run.user.Username, model.TaskActionCreated, task.ID, nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (run *importRun) fail(item *importedTask, message string) {
+	item.failed = true
+	run.reject(item.row, message)
+}
+
+func (run *importRun) reject(row transfer.Row, message string) {
+	run.job.Failed++
+	run.job.Processed++
+	if len(run.job.Errors) < maxImportErrors {
+		run.job.Errors = append(run.job.Errors, model.ImportError{Row: row.Line, ExternalID: row.Task.ID, Error: message})
+	}
+}
+
+// previewTask - a planned task as a dry run shows it, with the status, priority and labels it would get
+func previewTask(item *importedTask) transfer.Task {
+	source := item.row.Task
+	preview := transfer.Task{
+		ID:        source.ID,
+		ParentID:  source.ParentID,
+		Title:     item.task.Title,
+		Comment:   item.task.Comment,
+		Done:      item.task.Done,
+		Status:    item.task.Status,
+		Priority:  item.task.Priority,
+		Important: item.task.Important,
+		DueDate:   item.task.DueDate,
+		Project:   strings.TrimSpace(source.Project),
+		Labels:    item.task.Labels,
+		Estimate:  item.task.Estimate,
+		Checklist: source.Checklist,
+		Comments:  source.Comments,
+		CreatedAt: &item.task.CreatedAt,
+	}
+	return preview
+}
+
+// inParentCycle - reports whether following the parents of item within the file leads back to it
+func inParentCycle(item *importedTask, limit int) bool {
+	for parent, steps := item.parent, 0; parent != nil && steps <= limit; parent, steps = parent.parent, steps+1 {
+		if parent == item {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,300 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/utpal74/track-my-tasks-backend/domain"
+	"github.com/utpal74/track-my-tasks-backend/logger"
+	"github.com/utpal74/track-my-tasks-backend/model"
+	"github.com/utpal74/track-my-tasks-backend/tenant"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+// how long a task stays in the trash when TRASH_RETENTION_DAYS is not set
+const defaultTrashRetention = 30 * 24 * time.Hour
+
+// PurgeHook - removes data owned by other subsystems when a task is deleted for good
+type PurgeHook func(ctx context.Context, task model.Task) error
+
+// OnPurge - registers a hook run whenever a task is permanently deleted
+func (handler *TasksHandler) OnPurge(hook PurgeHook) {
+	handler.purgeHooks = append(handler.purgeHooks, hook)
+}
+
+// activeTask - restricts a task filter to tasks which are not in the trash
+func activeTask(filter bson.M) bson.M {
+	filter["deleted_at"] = bson.M{"$exists": false}
+	return filter
+}
+
+// unchangedTask - restricts a task filter to the version of the task last updated at updatedAt, so a write based
+// on that version doesn't overwrite a later one
+func unchangedTask(filter bson.M, updatedAt time.Time) bson.M {
+	if updatedAt.IsZero() {
+		filter["updated_at"] = bson.M{"$in": bson.A{nil, updatedAt}}
+	} else {
+		filter["updated_at"] = updatedAt
+	}
+	return filter
+}
+
+// GetTrashHandler - list the tasks in the user's trash, most recently deleted first
+func (handler *TasksHandler) GetTrashHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	user, ok := handler.currentUser(ctx, c)
+	if !ok {
+		return
+	}
+
+	cur, err := handler.tasksColl.Find(ctx,
+		bson.M{"user_id": user.ID, "deleted_at": bson.M{"$exists": true}},
+		options.Find().SetSort(bson.M{"deleted_at": -1}),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer cur.Close(ctx)
+
+	tasks := make([]model.Task, 0)
+	if err := cur.All(ctx, &tasks); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to decode task"})
+		return
+	}
+	fillLegacyStatus(tasks)
+
+	c.JSON(http.StatusOK, tasks)
+}
+
+// RestoreTaskHandler - move a task out of the trash
+func (handler *TasksHandler) RestoreTaskHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	user, ok := handler.currentUser(ctx, c)
+	if !ok {
+		return
+	}
+
+	taskID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id format"})
+		return
+	}
+
+	var task model.Task
+	err = handler.tasksColl.FindOne(ctx, bson.M{"_id": taskID, "user_id": user.ID, "deleted_at": bson.M{"$exists": true}}).Decode(&task)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Task not found in trash"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The task comes back into its status column, which must have room for it
+	column, known, err := handler.statusColumnFor(ctx, task)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "unable to resolve status: " + err.Error()})
+		return
+	}
+	if known {
+		if err := handler.checkWIPLimit(ctx, task.UserID, task.ProjectID, column, 1); err != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	before, err := handler.taskSnapshot(ctx, taskID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := time.Now()
+	found := false
+	err = handler.commitChange(ctx, c, model.TaskActionRestored, taskID, before, func(ctx context.Context) error {
+		result, err := handler.tasksColl.UpdateOne(ctx,
+			bson.M{"_id": taskID, "user_id": user.ID, "deleted_at": bson.M{"$exists": true}},
+			bson.M{"$unset": bson.M{"deleted_at": ""}, "$set": bson.M{"updated_at": now}},
+		)
+		if err != nil {
+			return fmt.Errorf("unable to restore: %w", err)
+		}
+		if found = result.MatchedCount > 0; !found {
+			return nil
+		}
+
+		_, err = handler.usersColl.UpdateOne(ctx,
+			bson.M{"_id": user.ID, "task._id": taskID},
+			bson.M{"$unset": bson.M{"task.$.deleted_at": ""}, "$set": bson.M{"task.$.updated_at": now}},
+		)
+		if err != nil {
+			return fmt.Errorf("Failed to update task in user collection: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Task not found in trash"})
+		return
+	}
+
+	handler.invalidateTaskCaches(ctx, taskID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Task restored", "id": taskID})
+}
+
+// PermanentDeleteHandler - remove a task from the trash for good
+func (handler *TasksHandler) PermanentDeleteHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	user, ok := handler.currentUser(ctx, c)
+	if !ok {
+		return
+	}
+
+	taskID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id format"})
+		return
+	}
+
+	var task model.Task
+	err = handler.tasksColl.FindOne(ctx, bson.M{"_id": taskID, "user_id": user.ID, "deleted_at": bson.M{"$exists": true}}).Decode(&task)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Task not found in trash"})
+		return
+	}
+
+	if err := handler.purgeTask(ctx, task); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "unable to delete: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Task deleted permanently", "id": taskID})
+}
+
+// PurgeTrash - background job, permanently deletes tasks which have been in the trash longer than the retention period
+func (handler *TasksHandler) PurgeTrash(ctx context.Context) error {
+	log := logger.FromCtx(ctx)
+	ctx = tenant.Unscoped(ctx) // the trash of every workspace
+	cutoff := time.Now().Add(-trashRetention())
+
+	cur, err := handler.tasksColl.Find(ctx, bson.M{"deleted_at": bson.M{"$lt": cutoff}})
+	if err != nil {
+		return err
+	}
+	defer cur.Close(ctx)
+
+	purged := 0
+	for cur.Next(ctx) {
+		var task model.Task
+		if err := cur.Decode(&task); err != nil {
+			return err
+		}
+		if err := handler.purgeTask(ctx, task); err != nil {
+			return err
+		}
+		purged++
+	}
+
+	if err := cur.Err(); err != nil {
+		return err
+	}
+	if purged > 0 {
+		log.Info("purged trashed tasks", zap.Int("count", purged))
+	}
+
+	// Sync tokens this old are refused, nobody needs the tombstones any more
+	_, err = handler.tombstonesColl.DeleteMany(ctx, bson.M{"deleted_at": bson.M{"$lt": cutoff}})
+	return err
+}
+
+// purgeTask - removes a task from both collections along with every reference to it
+func (handler *TasksHandler) purgeTask(ctx context.Context, task model.Task) error {
+	err := handler.outbox.Transact(ctx, func(ctx context.Context) error {
+		if _, err := handler.tasksColl.DeleteOne(ctx, bson.M{"_id": task.ID}); err != nil {
+			return err
+		}
+
+		// Tasks purged from the trash by hand may be newer than sync tokens still in use
+		now := time.Now()
+		tombstone := model.Tombstone{
+			ID:            task.ID,
+			UserID:        task.UserID,
+			WorkspaceID:   task.WorkspaceID,
+			ProjectID:     task.ProjectID,
+			Collaborators: task.Collaborators,
+			Assignees:     task.Assignees,
+			DeletedAt:     now,
+		}
+		if _, err := handler.tombstonesColl.InsertOne(ctx, tombstone); err != nil {
+			return err
+		}
+
+		_, err := handler.usersColl.UpdateOne(ctx,
+			bson.M{"_id": task.UserID},
+			bson.M{"$pull": bson.M{"task": bson.M{"_id": task.ID}}},
+		)
+		if err != nil {
+			return err
+		}
+
+		return handler.outbox.Add(ctx, domain.TaskPurged{TaskEvent: domain.TaskEvent{
+			TaskID:      task.ID,
+			WorkspaceID: task.WorkspaceID,
+			Action:      model.TaskActionPurged,
+			Task:        task,
+			OccurredAt:  now,
+		}})
+	})
+	if err != nil {
+		return err
+	}
+
+	// Drop the deleted task from the blockers of any other task
+	if err := handler.removeDependencyEdges(ctx, task.UserID, task.ID); err != nil {
+		return err
+	}
+
+	// The history goes along with the task
+	if _, err := handler.eventsColl.DeleteMany(ctx, bson.M{"task_id": task.ID}); err != nil {
+		return err
+	}
+
+	for _, hook := range handler.purgeHooks {
+		if err := hook(ctx, task); err != nil {
+			return err
+		}
+	}
+
+	invalidateMemberCaches(ctx, handler.redisClient, handler.projectsColl, task)
+	return nil
+}
+
+// trashRetention - reads TRASH_RETENTION_DAYS, falling back to the default
+func trashRetention() time.Duration {
+	days, err := strconv.Atoi(os.Getenv("TRASH_RETENTION_DAYS"))
+	if err != nil || days <= 0 {
+		return defaultTrashRetention
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
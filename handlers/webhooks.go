@@ -0,0 +1,662 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/utpal74/track-my-tasks-backend/domain"
+	"github.com/utpal74/track-my-tasks-backend/logger"
+	"github.com/utpal74/track-my-tasks-backend/model"
+	"github.com/utpal74/track-my-tasks-backend/tenant"
+	"github.com/utpal74/track-my-tasks-backend/webhook"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+const (
+	maxWebhooksPerUser = 20
+	minWebhookSecret   = 16
+	// Failed attempts in a row after which a webhook is disabled
+	maxWebhookFailures = 20
+	// How long finished deliveries stay in the log
+	webhookDeliveryRetention = 30 * 24 * time.Hour
+
+	webhookQueueKey      = "webhooks:deliveries"
+	deliveryLease        = time.Minute
+	deliveryPollInterval = 2 * time.Second
+	deliveryBatch        = 16
+
+	// Sent by the test action only
+	EventPing = "ping"
+)
+
+// Event types webhooks can subscribe to
+var webhookEvents = []string{EventTaskCreated, EventTaskUpdated, EventTaskDeleted}
+
+type WebhooksHandler struct {
+	ctx            context.Context
+	webhooksColl   *mongo.Collection
+	deliveriesColl *mongo.Collection
+	usersColl      *mongo.Collection
+	projectsColl   *tenant.Collection
+	queue          *webhook.Queue
+	client         *http.Client
+}
+
+// webhookRequest - the fields of a webhook to create or change, fields left out are kept
+type webhookRequest struct {
+	URL    *string   `json:"url"`
+	Secret *string   `json:"secret"` // Generated when creating without one
+	Events *[]string `json:"events"`
+	Active *bool     `json:"active"` // Turning a disabled webhook back on clears its failures
+}
+
+// webhookPayload - the body POSTed to webhooks, ID is the delivery's
+type webhookPayload struct {
+	ID        primitive.ObjectID `json:"id"`
+	Event     string             `json:"event"`
+	CreatedAt time.Time          `json:"created_at"`
+	Data      interface{}        `json:"data"`
+}
+
+func NewWebhooksHandler(ctx context.Context, webhooksColl *mongo.Collection, deliveriesColl *mongo.Collection, usersColl *mongo.Collection, projectsColl *tenant.Collection, redisClient *redis.Client) *WebhooksHandler {
+	return &WebhooksHandler{
+		ctx:            ctx,
+		webhooksColl:   webhooksColl,
+		deliveriesColl: deliveriesColl,
+		usersColl:      usersColl,
+		projectsColl:   projectsColl,
+		queue:          webhook.NewQueue(redisClient, webhookQueueKey),
+		client:         webhook.NewClient(),
+	}
+}
+
+// ListWebhooksHandler - the webhooks of the user in the workspace
+func (handler *WebhooksHandler) ListWebhooksHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	user, ok := currentUser(ctx, c, handler.usersColl)
+	if !ok {
+		return
+	}
+
+	cur, err := handler.webhooksColl.Find(ctx, bson.M{"user_id": user.ID, "workspace_id": workspaceID(ctx)}, options.Find().SetSort(bson.M{"created_at": 1}))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	webhooks := make([]model.Webhook, 0)
+	if err := cur.All(ctx, &webhooks); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, webhooks)
+}
+
+// CreateWebhookHandler - subscribes a URL to task events. The secret signing the requests is only returned here.
+func (handler *WebhooksHandler) CreateWebhookHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	var req webhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.URL == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "url is required"})
+		return
+	}
+
+	user, ok := currentUser(ctx, c, handler.usersColl)
+	if !ok {
+		return
+	}
+
+	count, err := handler.webhooksColl.CountDocuments(ctx, bson.M{"user_id": user.ID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if count >= maxWebhooksPerUser {
+		c.JSON(http.StatusForbidden, gin.H{"error": "at most " + strconv.Itoa(maxWebhooksPerUser) + " webhooks per user"})
+		return
+	}
+
+	now := time.Now()
+	hook := model.Webhook{
+		ID:          primitive.NewObjectID(),
+		UserID:      user.ID,
+		WorkspaceID: workspaceID(ctx),
+		Events:      []string{},
+		Active:      true,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if req.Secret == nil {
+		secret, err := newSecretToken()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "unable to create secret: " + err.Error()})
+			return
+		}
+		req.Secret = &secret
+	}
+	if err := applyWebhookRequest(&hook, req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, err := handler.webhooksColl.InsertOne(ctx, hook); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"webhook": hook, "secret": hook.Secret})
+}
+
+// UpdateWebhookHandler - changes the URL, secret, events or state of a webhook
+func (handler *WebhooksHandler) UpdateWebhookHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	var req webhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	hook, ok := handler.userWebhook(ctx, c)
+	if !ok {
+		return
+	}
+
+	if err := applyWebhookRequest(&hook, req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	hook.UpdatedAt = time.Now()
+
+	if _, err := handler.webhooksColl.ReplaceOne(ctx, bson.M{"_id": hook.ID}, hook); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, hook)
+}
+
+// DeleteWebhookHandler - removes a webhook, its pending deliveries are dropped
+func (handler *WebhooksHandler) DeleteWebhookHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	hook, ok := handler.userWebhook(ctx, c)
+	if !ok {
+		return
+	}
+
+	if _, err := handler.webhooksColl.DeleteOne(ctx, bson.M{"_id": hook.ID}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook deleted"})
+}
+
+// WebhookDeliveriesHandler - the delivery log of a webhook, most recent first. Query parameters: status keeps
+// the deliveries in that state, limit (at most 200) defaults to 50.
+func (handler *WebhooksHandler) WebhookDeliveriesHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	hook, ok := handler.userWebhook(ctx, c)
+	if !ok {
+		return
+	}
+
+	limit := 50
+	if value := c.Query("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > 200 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 200"})
+			return
+		}
+		limit = n
+	}
+
+	filter := bson.M{"webhook_id": hook.ID}
+	if status := c.Query("status"); status != "" {
+		filter["status"] = status
+	}
+
+	opts := options.Find().SetSort(bson.M{"created_at": -1}).SetLimit(int64(limit))
+	cur, err := handler.deliveriesColl.Find(ctx, filter, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	deliveries := make([]model.WebhookDelivery, 0)
+	if err := cur.All(ctx, &deliveries); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, deliveries)
+}
+
+// TestWebhookHandler - sends a ping event to the webhook right away, disabled or not, and returns the delivery.
+// Tests aren't retried and don't count towards disabling the webhook.
+func (handler *WebhooksHandler) TestWebhookHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 20*time.Second)
+	defer cancel()
+
+	hook, ok := handler.userWebhook(ctx, c)
+	if !ok {
+		return
+	}
+
+	delivery, err := newDelivery(hook, EventPing, gin.H{"webhook_id": hook.ID, "message": "Test event"})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	attempt := handler.send(ctx, hook, delivery)
+	delivery.Attempts = []model.DeliveryAttempt{attempt}
+	delivery.Status = model.DeliverySucceeded
+	if attempt.Error != "" {
+		delivery.Status = model.DeliveryFailed
+	}
+
+	if _, err := handler.deliveriesColl.InsertOne(ctx, delivery); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, delivery)
+}
+
+// DeliverDomainEvent - a domain event subscriber queueing task changes for the subscribed webhooks of everyone
+// who can see the task, and a deletion for those who could see it before but not any more
+func (handler *WebhooksHandler) DeliverDomainEvent(ctx context.Context, event domain.Event) error {
+	audience, ok, err := taskChangeAudience(tenant.Unscoped(ctx), handler.projectsColl, event)
+	if err != nil || !ok {
+		return err
+	}
+
+	change, _ := domain.TaskOf(event)
+	taskEvent := newTaskEvent(change)
+	if err := handler.enqueue(ctx, audience.current, change, audience.eventType, taskEvent); err != nil {
+		return err
+	}
+	if len(audience.removed) == 0 {
+		return nil
+	}
+	taskEvent.Task = nil
+	return handler.enqueue(ctx, audience.removed, change, EventTaskDeleted, taskEvent)
+}
+
+// enqueue - stores a delivery of the event for each active webhook of the users subscribed to it, and queues them.
+// A webhook gets one delivery per change, also when the domain event is handled again.
+func (handler *WebhooksHandler) enqueue(ctx context.Context, userIDs []primitive.ObjectID, change domain.TaskEvent, eventType string, data interface{}) error {
+	cur, err := handler.webhooksColl.Find(ctx, bson.M{"user_id": bson.M{"$in": userIDs}, "workspace_id": change.WorkspaceID, "active": true})
+	if err != nil {
+		return err
+	}
+	var webhooks []model.Webhook
+	if err := cur.All(ctx, &webhooks); err != nil {
+		return err
+	}
+
+	for _, hook := range webhooks {
+		if !hook.Subscribed(eventType) {
+			continue
+		}
+
+		delivery, err := newDelivery(hook, eventType, data)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		delivery.NextAttemptAt = &now
+		delivery.ChangeID = &change.ChangeID
+		result, err := handler.deliveriesColl.UpdateOne(ctx,
+			bson.M{"webhook_id": hook.ID, "change_id": change.ChangeID},
+			bson.M{"$setOnInsert": delivery},
+			options.Update().SetUpsert(true),
+		)
+		if mongo.IsDuplicateKeyError(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if result.UpsertedCount == 0 {
+			continue
+		}
+		// Deliveries missing from the queue are queued again by MaintainDeliveries
+		if err := handler.queue.Schedule(ctx, delivery.ID.Hex(), now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RunDeliveries - makes the attempts of the queued deliveries until ctx is done
+func (handler *WebhooksHandler) RunDeliveries(ctx context.Context) {
+	log := logger.FromCtx(ctx)
+	ticker := time.NewTicker(deliveryPollInterval)
+	defer ticker.Stop()
+
+	for {
+		ids, err := handler.queue.Claim(ctx, deliveryLease, deliveryBatch)
+		if err != nil {
+			log.Error("unable to claim webhook deliveries", zap.Error(err))
+		}
+
+		var wg sync.WaitGroup
+		for _, id := range ids {
+			wg.Add(1)
+			go func(id string) {
+				defer wg.Done()
+				if err := handler.attempt(ctx, id); err != nil {
+					log.Error("webhook delivery failed", zap.String("delivery_id", id), zap.Error(err))
+				}
+			}(id)
+		}
+		wg.Wait()
+
+		// A full batch means more may be due already
+		if len(ids) == deliveryBatch {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// attempt - sends a claimed delivery and records the outcome; it is retried with a growing delay until it
+// succeeds or runs out of attempts
+func (handler *WebhooksHandler) attempt(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, deliveryLease/2)
+	defer cancel()
+
+	deliveryID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return handler.queue.Done(ctx, id)
+	}
+
+	var delivery model.WebhookDelivery
+	err = handler.deliveriesColl.FindOne(ctx, bson.M{"_id": deliveryID}).Decode(&delivery)
+	if err == mongo.ErrNoDocuments {
+		return handler.queue.Done(ctx, id)
+	} else if err != nil {
+		return err
+	}
+	if delivery.Status != model.DeliveryPending {
+		return handler.queue.Done(ctx, id)
+	}
+
+	var hook model.Webhook
+	err = handler.webhooksColl.FindOne(ctx, bson.M{"_id": delivery.WebhookID}).Decode(&hook)
+	if err == mongo.ErrNoDocuments || (err == nil && !hook.Active) {
+		reason := "not sent: the webhook was deleted"
+		if err == nil {
+			reason = "not sent: the webhook is disabled"
+		}
+		return handler.finishDelivery(ctx, delivery, model.DeliveryFailed, model.DeliveryAttempt{At: time.Now(), Error: reason})
+	} else if err != nil {
+		return err
+	}
+
+	attempt := handler.send(ctx, hook, delivery)
+	if attempt.Error == "" {
+		if hook.Failures > 0 {
+			if _, err := handler.webhooksColl.UpdateOne(ctx, bson.M{"_id": hook.ID}, bson.M{"$set": bson.M{"failures": 0}}); err != nil {
+				return err
+			}
+		}
+		return handler.finishDelivery(ctx, delivery, model.DeliverySucceeded, attempt)
+	}
+
+	if err := handler.countFailure(ctx, hook); err != nil {
+		return err
+	}
+
+	attempts := len(delivery.Attempts) + 1
+	if attempts >= webhook.MaxAttempts {
+		return handler.finishDelivery(ctx, delivery, model.DeliveryFailed, attempt)
+	}
+
+	next := time.Now().Add(webhook.Backoff(attempts))
+	_, err = handler.deliveriesColl.UpdateOne(ctx, bson.M{"_id": delivery.ID}, bson.M{
+		"$push": bson.M{"attempts": attempt},
+		"$set":  bson.M{"next_attempt_at": next},
+	})
+	if err != nil {
+		return err
+	}
+	return handler.queue.Schedule(ctx, id, next)
+}
+
+// finishDelivery - records the last attempt of a delivery and takes it off the queue
+func (handler *WebhooksHandler) finishDelivery(ctx context.Context, delivery model.WebhookDelivery, status string, attempt model.DeliveryAttempt) error {
+	_, err := handler.deliveriesColl.UpdateOne(ctx, bson.M{"_id": delivery.ID}, bson.M{
+		"$push":  bson.M{"attempts": attempt},
+		"$set":   bson.M{"status": status},
+		"$unset": bson.M{"next_attempt_at": ""},
+	})
+	if err != nil {
+		return err
+	}
+	return handler.queue.Done(ctx, delivery.ID.Hex())
+}
+
+// countFailure - counts a failed attempt against the webhook, disabling it after too many in a row
+func (handler *WebhooksHandler) countFailure(ctx context.Context, hook model.Webhook) error {
+	var updated model.Webhook
+	err := handler.webhooksColl.FindOneAndUpdate(ctx,
+		bson.M{"_id": hook.ID},
+		bson.M{"$inc": bson.M{"failures": 1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&updated)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if reason := disabledAfter(updated.Failures); updated.Active && reason != "" {
+		_, err = handler.webhooksColl.UpdateOne(ctx, bson.M{"_id": hook.ID, "active": true}, bson.M{"$set": bson.M{
+			"active":          false,
+			"disabled_reason": reason,
+			"updated_at":      time.Now(),
+		}})
+	}
+	return err
+}
+
+// disabledAfter - why a webhook which failed that many attempts in a row is disabled, empty while it isn't
+func disabledAfter(failures int) string {
+	if failures < maxWebhookFailures {
+		return ""
+	}
+	return "disabled after " + strconv.Itoa(failures) + " failed deliveries in a row"
+}
+
+// send - makes one attempt of the delivery, any response but a 2xx fails it
+func (handler *WebhooksHandler) send(ctx context.Context, hook model.Webhook, delivery model.WebhookDelivery) model.DeliveryAttempt {
+	start := time.Now()
+	attempt := model.DeliveryAttempt{At: start}
+
+	req, err := webhook.NewRequest(ctx, hook.URL, hook.Secret, delivery.Event, delivery.ID.Hex(), []byte(delivery.Payload))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	resp, err := handler.client.Do(req)
+	attempt.DurationMS = time.Since(start).Milliseconds()
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	resp.Body.Close()
+
+	attempt.StatusCode = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		attempt.Error = "unexpected response: " + resp.Status
+	}
+	return attempt
+}
+
+// MaintainDeliveries - background job, drops finished deliveries from the log after the retention period and
+// queues pending ones again which should have been attempted long ago, e.g. after Redis lost the queue
+func (handler *WebhooksHandler) MaintainDeliveries(ctx context.Context) error {
+	log := logger.FromCtx(ctx)
+
+	res, err := handler.deliveriesColl.DeleteMany(ctx, bson.M{
+		"status":     bson.M{"$ne": model.DeliveryPending},
+		"created_at": bson.M{"$lt": time.Now().Add(-webhookDeliveryRetention)},
+	})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount > 0 {
+		log.Info("pruned webhook deliveries", zap.Int64("count", res.DeletedCount))
+	}
+
+	cur, err := handler.deliveriesColl.Find(ctx, bson.M{
+		"status":          model.DeliveryPending,
+		"next_attempt_at": bson.M{"$lt": time.Now().Add(-10 * deliveryLease)},
+	}, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return err
+	}
+	defer cur.Close(ctx)
+
+	requeued := 0
+	for cur.Next(ctx) {
+		var delivery model.WebhookDelivery
+		if err := cur.Decode(&delivery); err != nil {
+			return err
+		}
+		if err := handler.queue.Schedule(ctx, delivery.ID.Hex(), time.Now()); err != nil {
+			return err
+		}
+		requeued++
+	}
+	if requeued > 0 {
+		log.Info("requeued webhook deliveries", zap.Int("count", requeued))
+	}
+	return cur.Err()
+}
+
+// userWebhook - the webhook in the path if it belongs to the user and the workspace, responding with the error
+// otherwise
+func (handler *WebhooksHandler) userWebhook(ctx context.Context, c *gin.Context) (model.Webhook, bool) {
+	var hook model.Webhook
+	user, ok := currentUser(ctx, c, handler.usersColl)
+	if !ok {
+		return hook, false
+	}
+
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id format"})
+		return hook, false
+	}
+
+	err = handler.webhooksColl.FindOne(ctx, bson.M{"_id": id, "user_id": user.ID, "workspace_id": workspaceID(ctx)}).Decode(&hook)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "webhook not found"})
+		return hook, false
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return hook, false
+	}
+	return hook, true
+}
+
+// applyWebhookRequest - validates the fields sent and sets them on the webhook
+func applyWebhookRequest(hook *model.Webhook, req webhookRequest) error {
+	if req.URL != nil {
+		target, err := url.Parse(*req.URL)
+		if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+			return errors.New("url must be an absolute http or https URL")
+		}
+		hook.URL = target.String()
+	}
+
+	if req.Secret != nil {
+		if len(*req.Secret) < minWebhookSecret {
+			return errors.New("secret must have at least " + strconv.Itoa(minWebhookSecret) + " characters")
+		}
+		hook.Secret = *req.Secret
+	}
+
+	if req.Events != nil {
+		events := make([]string, 0, len(*req.Events))
+		for _, event := range *req.Events {
+			if !containsEvent(webhookEvents, event) {
+				return errors.New("unknown event: " + event)
+			}
+			if !containsEvent(events, event) {
+				events = append(events, event)
+			}
+		}
+		hook.Events = events
+	}
+
+	if req.Active != nil {
+		if *req.Active && !hook.Active {
+			hook.Failures = 0
+			hook.DisabledReason = ""
+		}
+		hook.Active = *req.Active
+	}
+	return nil
+}
+
+func newDelivery(hook model.Webhook, eventType string, data interface{}) (model.WebhookDelivery, error) {
+	delivery := model.WebhookDelivery{
+		ID:        primitive.NewObjectID(),
+		WebhookID: hook.ID,
+		UserID:    hook.UserID,
+		Event:     eventType,
+		Status:    model.DeliveryPending,
+		Attempts:  []model.DeliveryAttempt{},
+		CreatedAt: time.Now(),
+	}
+
+	payload, err := json.Marshal(webhookPayload{ID: delivery.ID, Event: eventType, CreatedAt: delivery.CreatedAt, Data: data})
+	if err != nil {
+		return delivery, err
+	}
+	delivery.Payload = string(payload)
+	return delivery, nil
+}
+
+func containsEvent(events []string, event string) bool {
+	for _, e := range events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/utpal74/track-my-tasks-backend/model"
+	"github.com/utpal74/track-my-tasks-backend/webhook"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestWebhookSend(t *testing.T) {
+	t.Setenv("WEBHOOK_ALLOW_PRIVATE_NETWORKS", "true")
+	handler := &WebhooksHandler{client: webhook.NewClient()}
+
+	hook := model.Webhook{ID: primitive.NewObjectID(), Secret: "0123456789abcdef", Active: true}
+	delivery, err := newDelivery(hook, EventTaskCreated, map[string]string{"title": "Buy milk"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		status  int
+		wantErr bool
+	}{
+		{name: "2xx succeeds", status: http.StatusNoContent},
+		{name: "server error fails", status: http.StatusInternalServerError, wantErr: true},
+		{name: "redirect fails", status: http.StatusFound, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var signatureValid bool
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				unix, _ := strconv.ParseInt(r.Header.Get(webhook.TimestampHeader), 10, 64)
+				signatureValid = r.Header.Get(webhook.SignatureHeader) == "sha256="+webhook.Sign(hook.Secret, time.Unix(unix, 0), body) &&
+					r.Header.Get(webhook.DeliveryHeader) == delivery.ID.Hex() &&
+					r.Header.Get(webhook.EventHeader) == EventTaskCreated
+
+				var payload webhookPayload
+				if err := json.Unmarshal(body, &payload); err != nil || payload.ID != delivery.ID {
+					t.Errorf("payload %s doesn't carry the delivery ID", body)
+				}
+				if tt.status == http.StatusFound {
+					w.Header().Set("Location", "/elsewhere")
+				}
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+			hook.URL = server.URL
+
+			attempt := handler.send(context.Background(), hook, delivery)
+			if !signatureValid {
+				t.Error("the request isn't signed with the secret of the webhook")
+			}
+			if attempt.StatusCode != tt.status {
+				t.Errorf("status code = %d, want %d", attempt.StatusCode, tt.status)
+			}
+			if (attempt.Error != "") != tt.wantErr {
+				t.Errorf("error = %q, want an error: %v", attempt.Error, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWebhookSendRefusesPrivateNetworks(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("the request reached a loopback address")
+	}))
+	defer server.Close()
+
+	handler := &WebhooksHandler{client: webhook.NewClient()}
+	hook := model.Webhook{ID: primitive.NewObjectID(), URL: server.URL, Secret: "0123456789abcdef"}
+	delivery, err := newDelivery(hook, EventPing, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attempt := handler.send(context.Background(), hook, delivery)
+	if attempt.Error == "" || attempt.StatusCode != 0 {
+		t.Errorf("got status %d error %q, want the address refused", attempt.StatusCode, attempt.Error)
+	}
+}
+
+func TestWebhookDisabledAfterFailures(t *testing.T) {
+	for failures := 0; failures < maxWebhookFailures; failures++ {
+		if reason := disabledAfter(failures); reason != "" {
+			t.Fatalf("disabled after %d failures: %q", failures, reason)
+		}
+	}
+	if disabledAfter(20) != "disabled after 20 failed deliveries in a row" {
+		t.Errorf("not disabled after 20 failures: %q", disabledAfter(20))
+	}
+}
+
+func TestApplyWebhookRequest(t *testing.T) {
+	str := func(s string) *string { return &s }
+	events := func(e ...string) *[]string { return &e }
+	active := true
+
+	tests := []struct {
+		name    string
+		req     webhookRequest
+		wantErr bool
+	}{
+		{name: "https url", req: webhookRequest{URL: str("https://example.com/hook")}},
+		{name: "relative url", req: webhookRequest{URL: str("/hook")}, wantErr: true},
+		{name: "other scheme", req: webhookRequest{URL: str("ftp://example.com/hook")}, wantErr: true},
+		{name: "short secret", req: webhookRequest{Secret: str("short")}, wantErr: true},
+		{name: "known events", req: webhookRequest{Events: events(EventTaskCreated, EventTaskCreated)}},
+		{name: "unknown event", req: webhookRequest{Events: events("task.exploded")}, wantErr: true},
+		{name: "turned back on", req: webhookRequest{Active: &active}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hook := model.Webhook{Failures: maxWebhookFailures, DisabledReason: disabledAfter(maxWebhookFailures)}
+			err := applyWebhookRequest(&hook, tt.req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want an error: %v", err, tt.wantErr)
+			}
+			if tt.req.Events != nil && err == nil && len(hook.Events) != 1 {
+				t.Errorf("events = %v, want duplicates dropped", hook.Events)
+			}
+			if tt.req.Active != nil && (hook.Failures != 0 || hook.DisabledReason != "" || !hook.Active) {
+				t.Errorf("turning the webhook back on kept failures %d and reason %q", hook.Failures, hook.DisabledReason)
+			}
+		})
+	}
+}
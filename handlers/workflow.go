@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/utpal74/track-my-tasks-backend/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type statusTransitionRequest struct {
+	Status string `json:"status" binding:"required"`
+}
+
+// TransitionStatusHandler - move a task to another column of its project's workflow
+func (handler *TasksHandler) TransitionStatusHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	user, ok := handler.currentUser(ctx, c)
+	if !ok {
+		return
+	}
+
+	taskID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id format"})
+		return
+	}
+
+	var req statusTransitionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	task, ok := handler.editableTask(ctx, c, user, taskID)
+	if !ok {
+		return
+	}
+
+	// The workflow and WIP limits are the owner's, also when an editor moves the task
+	columns, err := handler.workflowFor(ctx, task.UserID, task.ProjectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "unable to load workflow: " + err.Error()})
+		return
+	}
+
+	column, found := model.FindStatus(columns, req.Status)
+	if !found {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown status: " + req.Status, "statuses": columns})
+		return
+	}
+
+	if task.Status != column.Key {
+		if err := handler.checkWIPLimit(ctx, task.UserID, task.ProjectID, column, 1); err != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	done := column.Category == model.StatusCategoryClosed
+	if done {
+		openBlockers, err := handler.openBlockers(ctx, taskID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "unable to check blockers: " + err.Error()})
+			return
+		}
+		if len(openBlockers) > 0 && c.Query("force") != "true" {
+			c.JSON(http.StatusConflict, gin.H{"error": "task is blocked by open tasks", "blocked_by": openBlockers})
+			return
+		}
+	}
+
+	before, err := handler.taskSnapshot(ctx, taskID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := time.Now()
+	err = handler.commitChange(ctx, c, model.TaskActionStatus, taskID, before, func(ctx context.Context) error {
+		_, err := handler.tasksColl.UpdateOne(ctx, bson.M{"_id": taskID}, bson.M{"$set": bson.M{
+			"status":     column.Key,
+			"done":       done,
+			"updated_at": now,
+		}})
+		if err != nil {
+			return fmt.Errorf("unable to update: %w", err)
+		}
+
+		_, err = handler.usersColl.UpdateOne(ctx, bson.M{"_id": task.UserID, "task._id": taskID}, bson.M{"$set": bson.M{
+			"task.$.status":     column.Key,
+			"task.$.done":       done,
+			"task.$.updated_at": now,
+		}})
+		if err != nil {
+			return fmt.Errorf("Failed to update task in user collection: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	invalidateMemberCaches(ctx, handler.redisClient, handler.projectsColl, task)
+
+	task.Status = column.Key
+	task.Done = done
+	task.UpdatedAt = now
+	c.JSON(http.StatusOK, task)
+}
+
+// workflowFor - returns the status columns for tasks of the given project, or the defaults when projectID is nil.
+// Returns mongo.ErrNoDocuments if the project doesn't belong to the user.
+func (handler *TasksHandler) workflowFor(ctx context.Context, userID primitive.ObjectID, projectID *primitive.ObjectID) ([]model.StatusColumn, error) {
+	if projectID == nil {
+		return model.DefaultStatuses(), nil
+	}
+
+	var project model.Project
+	if err := handler.projectsColl.FindOne(ctx, bson.M{"_id": *projectID, "user_id": userID}).Decode(&project); err != nil {
+		return nil, err
+	}
+	return project.Workflow(), nil
+}
+
+// closedColumnFor - the first closed column in the workflow of the task, done: true moves it there
+func (handler *TasksHandler) closedColumnFor(ctx context.Context, task model.Task) (model.StatusColumn, error) {
+	columns, err := handler.workflowFor(ctx, task.UserID, task.ProjectID)
+	if err != nil {
+		return model.StatusColumn{}, err
+	}
+	return model.FirstStatus(columns, model.StatusCategoryClosed), nil
+}
+
+// statusColumnFor - the column of the task's status in its workflow; false when the status or the project is gone
+func (handler *TasksHandler) statusColumnFor(ctx context.Context, task model.Task) (model.StatusColumn, bool, error) {
+	columns, err := handler.workflowFor(ctx, task.UserID, task.ProjectID)
+	if err == mongo.ErrNoDocuments {
+		return model.StatusColumn{}, false, nil
+	} else if err != nil {
+		return model.StatusColumn{}, false, err
+	}
+
+	status := task.Status
+	if status == "" {
+		status = model.LegacyStatus(task.Done)
+	}
+	column, found := model.FindStatus(columns, status)
+	return column, found, nil
+}
+
+// checkWIPLimit - returns an error when adding tasks to the column would exceed its WIP limit
+func (handler *TasksHandler) checkWIPLimit(ctx context.Context, userID primitive.ObjectID, projectID *primitive.ObjectID, column model.StatusColumn, adding int) error {
+	if column.WIPLimit == 0 {
+		return nil
+	}
+
+	filter := activeTask(bson.M{"user_id": userID, "status": column.Key})
+	if projectID == nil {
+		filter["project_id"] = bson.M{"$exists": false}
+	} else {
+		filter["project_id"] = *projectID
+	}
+
+	count, err := handler.tasksColl.CountDocuments(ctx, filter)
+	if err != nil {
+		return err
+	}
+	if count+int64(adding) > int64(column.WIPLimit) {
+		return fmt.Errorf("wip limit of %d reached for status %q", column.WIPLimit, column.Key)
+	}
+	return nil
+}
+
+// fillLegacyStatus - derives the status of tasks stored before statuses existed from their Done flag
+func fillLegacyStatus(tasks []model.Task) {
+	for i := range tasks {
+		if tasks[i].Status == "" {
+			tasks[i].Status = model.LegacyStatus(tasks[i].Done)
+		}
+	}
+}
@@ -0,0 +1,455 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/utpal74/track-my-tasks-backend/model"
+	"github.com/utpal74/track-my-tasks-backend/tenant"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type WorkspacesHandler struct {
+	ctx            context.Context
+	workspacesColl *mongo.Collection
+	tasksColl      *tenant.Collection
+	projectsColl   *tenant.Collection
+	usersColl      *mongo.Collection
+	redisClient    *redis.Client
+}
+
+func NewWorkspacesHandler(ctx context.Context, workspacesColl *mongo.Collection, tasksColl *tenant.Collection, projectsColl *tenant.Collection, usersColl *mongo.Collection, redisClient *redis.Client) *WorkspacesHandler {
+	return &WorkspacesHandler{
+		ctx:            ctx,
+		workspacesColl: workspacesColl,
+		tasksColl:      tasksColl,
+		projectsColl:   projectsColl,
+		usersColl:      usersColl,
+		redisClient:    redisClient,
+	}
+}
+
+type workspaceRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+// memberRequest - the new member is looked up by username, or by email when no username is given
+type memberRequest struct {
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	Role     string `json:"role"` // defaults to model.WorkspaceRoleMember
+}
+
+// WorkspaceMiddleware - scopes the request to the workspace selected for the session, the user's
+// personal workspace unless another one was switched to. Must run after AuthMiddleware.
+func (handler *WorkspacesHandler) WorkspaceMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+		defer cancel()
+
+		user, ok := currentUser(ctx, c, handler.usersColl)
+		if !ok {
+			c.Abort()
+			return
+		}
+
+		var workspace model.Workspace
+		var err error
+		if id, ok := c.Get("token_workspace_id"); ok {
+			// Access tokens are bound to the workspace they were created in
+			err = handler.workspacesColl.FindOne(ctx, bson.M{"_id": id, "members.user_id": user.ID}).Decode(&workspace)
+			if err == mongo.ErrNoDocuments {
+				c.JSON(http.StatusForbidden, gin.H{"error": "the workspace of the access token is no longer available"})
+				c.Abort()
+				return
+			}
+		} else {
+			workspace, err = handler.sessionWorkspace(ctx, c.Request.Header.Get("Authorization"), user)
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "unable to load workspace: " + err.Error()})
+			c.Abort()
+			return
+		}
+
+		c.Set("workspace_id", workspace.ID)
+		c.Request = c.Request.WithContext(tenant.WithWorkspace(c.Request.Context(), workspace))
+		c.Next()
+	}
+}
+
+// GetWorkspacesHandler - list the workspaces the signed in user is a member of
+func (handler *WorkspacesHandler) GetWorkspacesHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	user, ok := currentUser(ctx, c, handler.usersColl)
+	if !ok {
+		return
+	}
+
+	cur, err := handler.workspacesColl.Find(ctx, bson.M{"members.user_id": user.ID},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer cur.Close(ctx)
+
+	workspaces := make([]model.Workspace, 0)
+	if err := cur.All(ctx, &workspaces); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to decode workspaces"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"workspaces": workspaces, "current": workspaceID(ctx)})
+}
+
+// NewWorkspaceHandler - create a workspace owned by the signed in user
+func (handler *WorkspacesHandler) NewWorkspaceHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	var req workspaceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := currentUser(ctx, c, handler.usersColl)
+	if !ok {
+		return
+	}
+
+	workspace := newWorkspace(req.Name, user, false)
+	if _, err := handler.workspacesColl.InsertOne(ctx, workspace); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, workspace)
+}
+
+// CurrentWorkspaceHandler - returns the workspace of the session with its usage against the quota
+func (handler *WorkspacesHandler) CurrentWorkspaceHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	workspace, _ := tenant.Workspace(ctx)
+
+	tasks, err := handler.tasksColl.CountDocuments(ctx, bson.M{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	projects, err := handler.projectsColl.CountDocuments(ctx, bson.M{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"workspace": workspace,
+		"usage": gin.H{
+			"tasks":    tasks,
+			"projects": projects,
+			"members":  len(workspace.Members),
+		},
+	})
+}
+
+// SwitchWorkspaceHandler - select the workspace used by the rest of the session
+func (handler *WorkspacesHandler) SwitchWorkspaceHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	user, ok := currentUser(ctx, c, handler.usersColl)
+	if !ok {
+		return
+	}
+
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id format"})
+		return
+	}
+
+	var workspace model.Workspace
+	if err := handler.workspacesColl.FindOne(ctx, bson.M{"_id": id, "members.user_id": user.ID}).Decode(&workspace); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "workspace not found"})
+		return
+	}
+
+	// The selection lives as long as the session token
+	sessionToken := c.Request.Header.Get("Authorization")
+	ttl, err := handler.redisClient.TTL(ctx, sessionToken).Result()
+	if err != nil || ttl <= 0 {
+		ttl = 10 * time.Minute
+	}
+
+	if err := handler.redisClient.Set(ctx, sessionWorkspaceKey(sessionToken), workspace.ID.Hex(), ttl).Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not save workspace in session: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, workspace)
+}
+
+// AddMemberHandler - add a user to the current workspace, only allowed for its owner and admins
+func (handler *WorkspacesHandler) AddMemberHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	var req memberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Role == "" {
+		req.Role = model.WorkspaceRoleMember
+	}
+	if !model.ValidWorkspaceRole(req.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown role: " + req.Role})
+		return
+	}
+
+	var userFilter bson.M
+	switch {
+	case req.Username != "":
+		userFilter = bson.M{"username": req.Username}
+	case req.Email != "":
+		userFilter = bson.M{"email": req.Email}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "username or email is required"})
+		return
+	}
+
+	workspace, ok := handler.managedWorkspace(ctx, c)
+	if !ok {
+		return
+	}
+
+	if workspace.Personal {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "personal workspaces can't have other members"})
+		return
+	}
+
+	if limit := workspace.Quota.MaxMembers; limit > 0 && len(workspace.Members) >= limit {
+		c.JSON(http.StatusForbidden, gin.H{"error": "the workspace has reached its member quota"})
+		return
+	}
+
+	var newUser model.User
+	if err := handler.usersColl.FindOne(ctx, userFilter).Decode(&newUser); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+
+	member := model.WorkspaceMember{UserID: newUser.ID, Username: newUser.Username, Role: req.Role, JoinedAt: time.Now()}
+	result, err := handler.workspacesColl.UpdateOne(ctx,
+		bson.M{"_id": workspace.ID, "members.user_id": bson.M{"$ne": newUser.ID}},
+		bson.M{"$push": bson.M{"members": member}, "$set": bson.M{"updated_at": time.Now()}})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "user is already a member"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, member)
+}
+
+// RemoveMemberHandler - remove a user from the current workspace, allowed for its owner and admins and for the member themselves
+func (handler *WorkspacesHandler) RemoveMemberHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	user, ok := currentUser(ctx, c, handler.usersColl)
+	if !ok {
+		return
+	}
+
+	memberID, err := primitive.ObjectIDFromHex(c.Param("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id format"})
+		return
+	}
+
+	workspace, _ := tenant.Workspace(ctx)
+	member, found := workspace.Member(memberID)
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "member not found"})
+		return
+	}
+
+	if member.Role == model.WorkspaceRoleOwner {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "the owner can't be removed"})
+		return
+	}
+
+	if memberID != user.ID && !canManageWorkspace(workspace, user.ID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only the owner and admins can remove other members"})
+		return
+	}
+
+	_, err = handler.workspacesColl.UpdateOne(ctx, bson.M{"_id": workspace.ID}, bson.M{
+		"$pull": bson.M{"members": bson.M{"user_id": memberID}},
+		"$set":  bson.M{"updated_at": time.Now()},
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Tasks can't stay assigned to someone who can't see them anymore
+	if err := unassignMember(ctx, handler.tasksColl, handler.usersColl, handler.projectsColl, handler.redisClient, memberID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "unable to unassign tasks: " + err.Error()})
+		return
+	}
+
+	handler.redisClient.Del(ctx, userCacheKeys(memberID)...)
+
+	c.JSON(http.StatusOK, gin.H{"message": "member removed", "user_id": memberID})
+}
+
+// managedWorkspace - returns the current workspace, responding with 403 unless the user may manage it
+func (handler *WorkspacesHandler) managedWorkspace(ctx context.Context, c *gin.Context) (model.Workspace, bool) {
+	workspace, _ := tenant.Workspace(ctx)
+	user, ok := currentUser(ctx, c, handler.usersColl)
+	if !ok {
+		return workspace, false
+	}
+
+	if !canManageWorkspace(workspace, user.ID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only the owner and admins can manage members"})
+		return workspace, false
+	}
+	return workspace, true
+}
+
+// sessionWorkspace - the workspace switched to in the session, if the user is still a member, else their personal one
+func (handler *WorkspacesHandler) sessionWorkspace(ctx context.Context, sessionToken string, user model.User) (model.Workspace, error) {
+	var workspace model.Workspace
+
+	selected, err := handler.redisClient.Get(ctx, sessionWorkspaceKey(sessionToken)).Result()
+	if err != nil && err != redis.Nil {
+		return workspace, err
+	}
+
+	if id, err := primitive.ObjectIDFromHex(selected); err == nil {
+		err := handler.workspacesColl.FindOne(ctx, bson.M{"_id": id, "members.user_id": user.ID}).Decode(&workspace)
+		if err == nil {
+			return workspace, nil
+		} else if err != mongo.ErrNoDocuments {
+			return workspace, err
+		}
+	}
+	return handler.personalWorkspace(ctx, user)
+}
+
+// personalWorkspace - returns the personal workspace of the user, creating it on first use.
+// Tasks and projects created before workspaces existed are moved into it.
+func (handler *WorkspacesHandler) personalWorkspace(ctx context.Context, user model.User) (model.Workspace, error) {
+	var workspace model.Workspace
+	filter := bson.M{"owner_id": user.ID, "personal": true}
+
+	result, err := handler.workspacesColl.UpdateOne(ctx, filter,
+		bson.M{"$setOnInsert": newWorkspace(user.Username, user, true)},
+		options.Update().SetUpsert(true))
+	if err != nil {
+		return workspace, err
+	}
+
+	if result.UpsertedCount > 0 {
+		if err := handler.adoptLegacyData(ctx, user.ID, result.UpsertedID.(primitive.ObjectID)); err != nil {
+			return workspace, err
+		}
+	}
+
+	err = handler.workspacesColl.FindOne(ctx, filter).Decode(&workspace)
+	return workspace, err
+}
+
+// adoptLegacyData - moves the user's tasks and projects without a workspace into the given one
+func (handler *WorkspacesHandler) adoptLegacyData(ctx context.Context, userID, workspaceID primitive.ObjectID) error {
+	unscoped := tenant.Unscoped(ctx)
+	legacy := bson.M{"user_id": userID, "workspace_id": bson.M{"$exists": false}}
+	set := bson.M{"$set": bson.M{"workspace_id": workspaceID}}
+
+	if _, err := handler.tasksColl.UpdateMany(unscoped, legacy, set); err != nil {
+		return err
+	}
+	if _, err := handler.projectsColl.UpdateMany(unscoped, legacy, set); err != nil {
+		return err
+	}
+
+	_, err := handler.usersColl.UpdateOne(ctx, bson.M{"_id": userID},
+		bson.M{"$set": bson.M{"task.$[t].workspace_id": workspaceID}},
+		options.Update().SetArrayFilters(options.ArrayFilters{Filters: []interface{}{
+			bson.M{"t.workspace_id": bson.M{"$exists": false}},
+		}}),
+	)
+	return err
+}
+
+func newWorkspace(name string, owner model.User, personal bool) model.Workspace {
+	now := time.Now()
+	return model.Workspace{
+		ID:       primitive.NewObjectID(),
+		Name:     name,
+		OwnerID:  owner.ID,
+		Personal: personal,
+		Members: []model.WorkspaceMember{
+			{UserID: owner.ID, Username: owner.Username, Role: model.WorkspaceRoleOwner, JoinedAt: now},
+		},
+		Quota:     defaultWorkspaceQuota(),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+func canManageWorkspace(workspace model.Workspace, userID primitive.ObjectID) bool {
+	member, found := workspace.Member(userID)
+	return found && (member.Role == model.WorkspaceRoleOwner || member.Role == model.WorkspaceRoleAdmin)
+}
+
+// defaultWorkspaceQuota - the quota given to new workspaces, unlimited unless configured
+func defaultWorkspaceQuota() model.WorkspaceQuota {
+	return model.WorkspaceQuota{
+		MaxTasks:    quotaFromEnv("WORKSPACE_MAX_TASKS"),
+		MaxProjects: quotaFromEnv("WORKSPACE_MAX_PROJECTS"),
+		MaxMembers:  quotaFromEnv("WORKSPACE_MAX_MEMBERS"),
+	}
+}
+
+func quotaFromEnv(name string) int {
+	limit, err := strconv.Atoi(os.Getenv(name))
+	if err != nil || limit < 0 {
+		return 0
+	}
+	return limit
+}
+
+// workspaceID - the workspace the request is scoped to, zero outside of WorkspaceMiddleware
+func workspaceID(ctx context.Context) primitive.ObjectID {
+	workspace, _ := tenant.Workspace(ctx)
+	return workspace.ID
+}
+
+// sessionWorkspaceKey - Redis key holding the workspace switched to in a session
+func sessionWorkspaceKey(sessionToken string) string {
+	return "workspace:" + sessionToken
+}
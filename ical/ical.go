@@ -0,0 +1,184 @@
+// Package ical reads and writes iCalendar (RFC 5545) documents. Write produces a calendar of VTODO and VEVENT
+// components with the properties tasks need, escaping text and folding lines at 75 octets as the RFC requires.
+// Parse reads any calendar into a generic tree of components and properties.
+package ical
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// component kinds
+const (
+	KindTodo  = "VTODO"
+	KindEvent = "VEVENT"
+)
+
+// Calendar - a VCALENDAR, Name is shown by clients as the calendar's title
+type Calendar struct {
+	ProdID     string
+	Name       string
+	Components []Component
+}
+
+// Component - a to-do or an event. A to-do is due at Start (recurring ones are worked on for Duration before),
+// an event starts at Start and lasts Duration. All-day components use the date of Start only. A to-do with a zero
+// Start has no due date, and then no RRULE either since the rule would have nothing to repeat.
+type Component struct {
+	Kind         string // KindTodo or KindEvent
+	UID          string
+	Summary      string
+	Description  string
+	Start        time.Time
+	AllDay       bool
+	Duration     time.Duration
+	RRule        string // Value of the RRULE property, empty for one-off components
+	Categories   []string
+	Priority     int        // 1 (highest) to 9 (lowest), 0 for none
+	RelatedTo    string     // UID of the parent component
+	Completed    *time.Time // To-dos only
+	Created      time.Time
+	LastModified time.Time
+}
+
+// maxLineOctets - content lines longer than this are folded
+const maxLineOctets = 75
+
+// Write - writes the calendar to w
+func Write(w io.Writer, cal Calendar) error {
+	var buf bytes.Buffer
+	line := func(name, value string) {
+		fold(&buf, name+":"+value)
+	}
+
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", cal.ProdID)
+	line("CALSCALE", "GREGORIAN")
+	if cal.Name != "" {
+		line("X-WR-CALNAME", Text(cal.Name))
+	}
+
+	now := time.Now()
+	for _, component := range cal.Components {
+		line("BEGIN", component.Kind)
+		line("UID", Text(component.UID))
+		stamp := component.LastModified
+		if stamp.IsZero() {
+			stamp = now
+		}
+		line("DTSTAMP", DateTime(stamp))
+		if !component.Created.IsZero() {
+			line("CREATED", DateTime(component.Created))
+		}
+		if !component.LastModified.IsZero() {
+			line("LAST-MODIFIED", DateTime(component.LastModified))
+		}
+		line("SUMMARY", Text(component.Summary))
+		if component.Description != "" {
+			line("DESCRIPTION", Text(component.Description))
+		}
+
+		switch component.Kind {
+		case KindTodo:
+			// A recurring to-do needs DTSTART for the rule to apply to, and DUE would have to be later than it,
+			// so the due time is given as DTSTART plus DURATION
+			switch {
+			case component.Start.IsZero():
+				// Not due at any time
+			case component.RRule == "":
+				dateProperty(&buf, "DUE", component.Start, component.AllDay)
+			case component.AllDay:
+				dateProperty(&buf, "DTSTART", component.Start, true)
+				line("DURATION", "P1D")
+			default:
+				dateProperty(&buf, "DTSTART", component.Start.Add(-component.Duration), false)
+				line("DURATION", "PT"+strconv.Itoa(int(component.Duration.Minutes()))+"M")
+			}
+			if component.Completed != nil {
+				line("STATUS", "COMPLETED")
+				line("COMPLETED", DateTime(*component.Completed))
+				line("PERCENT-COMPLETE", "100")
+			} else {
+				line("STATUS", "NEEDS-ACTION")
+			}
+		case KindEvent:
+			dateProperty(&buf, "DTSTART", component.Start, component.AllDay)
+			if component.AllDay {
+				dateProperty(&buf, "DTEND", component.Start.AddDate(0, 0, 1), true)
+			} else {
+				dateProperty(&buf, "DTEND", component.Start.Add(component.Duration), false)
+			}
+			line("TRANSP", "TRANSPARENT")
+		}
+
+		if component.RRule != "" && !component.Start.IsZero() {
+			line("RRULE", component.RRule)
+		}
+		if len(component.Categories) > 0 {
+			categories := make([]string, len(component.Categories))
+			for i, category := range component.Categories {
+				categories[i] = Text(category)
+			}
+			line("CATEGORIES", strings.Join(categories, ","))
+		}
+		if component.Priority > 0 {
+			line("PRIORITY", strconv.Itoa(component.Priority))
+		}
+		if component.RelatedTo != "" {
+			line("RELATED-TO", Text(component.RelatedTo))
+		}
+		line("END", component.Kind)
+	}
+
+	line("END", "VCALENDAR")
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// Text - escapes a TEXT value
+func Text(value string) string {
+	value = strings.ReplaceAll(value, "\r\n", "\n")
+	replacer := strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`, "\r", `\n`)
+	return replacer.Replace(value)
+}
+
+// DateTime - a DATE-TIME value in UTC
+func DateTime(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+// Date - a DATE value
+func Date(t time.Time) string {
+	return t.Format("20060102")
+}
+
+func dateProperty(buf *bytes.Buffer, name string, t time.Time, allDay bool) {
+	if allDay {
+		fold(buf, name+";VALUE=DATE:"+Date(t))
+		return
+	}
+	fold(buf, name+":"+DateTime(t))
+}
+
+// fold - writes a content line, continuing it on lines starting with a space after 75 octets
+// without splitting UTF-8 sequences
+func fold(buf *bytes.Buffer, line string) {
+	limit := maxLineOctets
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		buf.WriteString(line[:cut])
+		buf.WriteString("\r\n ")
+		line = line[cut:]
+		limit = maxLineOctets - 1 // The leading space counts
+	}
+	buf.WriteString(line)
+	buf.WriteString("\r\n")
+}
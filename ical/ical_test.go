@@ -0,0 +1,163 @@
+package ical
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestText(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{value: "Buy milk", want: "Buy milk"},
+		{value: `a\b`, want: `a\\b`},
+		{value: "milk, eggs; bread", want: `milk\, eggs\; bread`},
+		{value: "one\r\ntwo\nthree\rfour", want: `one\ntwo\nthree\nfour`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			if got := Text(tt.value); got != tt.want {
+				t.Errorf("Text(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+			if got := Unescape(Text(tt.value)); got != strings.ReplaceAll(strings.ReplaceAll(tt.value, "\r\n", "\n"), "\r", "\n") {
+				t.Errorf("Unescape(Text(%q)) = %q", tt.value, got)
+			}
+		})
+	}
+}
+
+func TestFold(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+	}{
+		{name: "short", line: "SUMMARY:Buy milk"},
+		{name: "exactly 75 octets", line: "SUMMARY:" + strings.Repeat("a", 67)},
+		{name: "long", line: "DESCRIPTION:" + strings.Repeat("abcdefghij", 20)},
+		{name: "multibyte runes are not split", line: "SUMMARY:" + strings.Repeat("é", 100)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			fold(&buf, tt.line)
+			folded := buf.String()
+			if !strings.HasSuffix(folded, "\r\n") {
+				t.Fatalf("fold() = %q doesn't end the line", folded)
+			}
+
+			lines := strings.Split(strings.TrimSuffix(folded, "\r\n"), "\r\n")
+			for i, line := range lines {
+				if len(line) > maxLineOctets {
+					t.Errorf("line %d has %d octets", i, len(line))
+				}
+				if !utf8.ValidString(line) {
+					t.Errorf("line %d splits a rune: %q", i, line)
+				}
+				if i > 0 && !strings.HasPrefix(line, " ") {
+					t.Errorf("continuation line %d doesn't start with a space", i)
+				}
+			}
+
+			unfolded, err := unfold(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(unfolded) != 1 || unfolded[0] != tt.line {
+				t.Errorf("unfold(fold()) = %q, want %q", unfolded, tt.line)
+			}
+		})
+	}
+}
+
+func TestWrite(t *testing.T) {
+	due := time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)
+	completed := time.Date(2024, 3, 2, 8, 0, 0, 0, time.UTC)
+	modified := time.Date(2024, 2, 1, 8, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		component Component
+		want      []string
+		wantNot   []string
+	}{
+		{
+			name:      "to-do due at a time",
+			component: Component{Kind: KindTodo, UID: "1", Summary: "Buy milk, eggs", Start: due, Priority: 1, LastModified: modified},
+			want: []string{
+				"BEGIN:VTODO", `SUMMARY:Buy milk\, eggs`, "DUE:20240301T093000Z", "STATUS:NEEDS-ACTION", "PRIORITY:1",
+				"DTSTAMP:20240201T080000Z", "LAST-MODIFIED:20240201T080000Z",
+			},
+			wantNot: []string{"DTSTART", "RRULE"},
+		},
+		{
+			name:      "all-day to-do",
+			component: Component{Kind: KindTodo, UID: "1", Summary: "Buy milk", Start: due, AllDay: true},
+			want:      []string{"DUE;VALUE=DATE:20240301"},
+		},
+		{
+			name:      "to-do without a due date has no rule",
+			component: Component{Kind: KindTodo, UID: "1", Summary: "Buy milk", RRule: "FREQ=DAILY"},
+			wantNot:   []string{"DUE", "DTSTART", "RRULE"},
+		},
+		{
+			name:      "recurring to-do starts before it is due",
+			component: Component{Kind: KindTodo, UID: "1", Summary: "Water plants", Start: due, Duration: 30 * time.Minute, RRule: "FREQ=WEEKLY"},
+			want:      []string{"DTSTART:20240301T090000Z", "DURATION:PT30M", "RRULE:FREQ=WEEKLY"},
+			wantNot:   []string{"DUE"},
+		},
+		{
+			name:      "recurring all-day to-do",
+			component: Component{Kind: KindTodo, UID: "1", Summary: "Water plants", Start: due, AllDay: true, RRule: "FREQ=DAILY"},
+			want:      []string{"DTSTART;VALUE=DATE:20240301", "DURATION:P1D", "RRULE:FREQ=DAILY"},
+		},
+		{
+			name:      "completed to-do",
+			component: Component{Kind: KindTodo, UID: "1", Summary: "Buy milk", Completed: &completed},
+			want:      []string{"STATUS:COMPLETED", "COMPLETED:20240302T080000Z", "PERCENT-COMPLETE:100"},
+		},
+		{
+			name:      "event",
+			component: Component{Kind: KindEvent, UID: "1", Summary: "Focus", Start: due, Duration: time.Hour, Categories: []string{"work", "a,b"}},
+			want:      []string{"BEGIN:VEVENT", "DTSTART:20240301T093000Z", "DTEND:20240301T103000Z", "TRANSP:TRANSPARENT", `CATEGORIES:work,a\,b`},
+		},
+		{
+			name:      "all-day event ends the next day",
+			component: Component{Kind: KindEvent, UID: "1", Summary: "Focus", Start: due, AllDay: true, RelatedTo: "parent"},
+			want:      []string{"DTSTART;VALUE=DATE:20240301", "DTEND;VALUE=DATE:20240302", "RELATED-TO:parent"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := Write(&buf, Calendar{ProdID: "-//Test//EN", Name: "Tasks", Components: []Component{tt.component}}); err != nil {
+				t.Fatal(err)
+			}
+			lines := strings.Split(buf.String(), "\r\n")
+			has := func(prefix string) bool {
+				for _, line := range lines {
+					if strings.HasPrefix(line, prefix) {
+						return true
+					}
+				}
+				return false
+			}
+			for _, want := range tt.want {
+				if !has(want) {
+					t.Errorf("Write() has no %q:\n%s", want, buf.String())
+				}
+			}
+			for _, unwanted := range tt.wantNot {
+				if has(unwanted) {
+					t.Errorf("Write() has %q:\n%s", unwanted, buf.String())
+				}
+			}
+		})
+	}
+}
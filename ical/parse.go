@@ -0,0 +1,271 @@
+package ical
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalid = errors.New("ical: invalid calendar data")
+
+// Property - a content line, Value is as written (see Unescape for TEXT values)
+type Property struct {
+	Name   string
+	Params map[string]string // Names upper case, quotes removed
+	Value  string
+}
+
+// Object - a parsed component with its properties and nested components
+type Object struct {
+	Name     string
+	Props    []Property
+	Children []Object
+}
+
+// Get - the first property with the name
+func (o Object) Get(name string) (Property, bool) {
+	for _, prop := range o.Props {
+		if prop.Name == name {
+			return prop, true
+		}
+	}
+	return Property{}, false
+}
+
+// All - every property with the name
+func (o Object) All(name string) []Property {
+	var props []Property
+	for _, prop := range o.Props {
+		if prop.Name == name {
+			props = append(props, prop)
+		}
+	}
+	return props
+}
+
+// Find - the first nested component with the name
+func (o Object) Find(name string) (Object, bool) {
+	for _, child := range o.Children {
+		if child.Name == name {
+			return child, true
+		}
+	}
+	return Object{}, false
+}
+
+// Parse - reads an iCalendar stream, returning its VCALENDAR
+func Parse(r io.Reader) (Object, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return Object{}, err
+	}
+
+	var stack []Object
+	for _, line := range lines {
+		prop, err := parseLine(line)
+		if err != nil {
+			return Object{}, err
+		}
+
+		switch prop.Name {
+		case "BEGIN":
+			stack = append(stack, Object{Name: strings.ToUpper(prop.Value)})
+		case "END":
+			if len(stack) == 0 || stack[len(stack)-1].Name != strings.ToUpper(prop.Value) {
+				return Object{}, fmt.Errorf("%w: unexpected END:%s", ErrInvalid, prop.Value)
+			}
+			done := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if len(stack) == 0 {
+				if done.Name != "VCALENDAR" {
+					return Object{}, fmt.Errorf("%w: not a VCALENDAR", ErrInvalid)
+				}
+				return done, nil
+			}
+			parent := &stack[len(stack)-1]
+			parent.Children = append(parent.Children, done)
+		default:
+			if len(stack) == 0 {
+				return Object{}, fmt.Errorf("%w: property outside of a component", ErrInvalid)
+			}
+			current := &stack[len(stack)-1]
+			current.Props = append(current.Props, prop)
+		}
+	}
+	return Object{}, fmt.Errorf("%w: missing END:VCALENDAR", ErrInvalid)
+}
+
+// unfold - the content lines, joining the continuation lines which start with a space or a tab
+func unfold(r io.Reader) ([]string, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var lines []string
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
+
+// parseLine - splits NAME;PARAM=value;PARAM="quoted":VALUE
+func parseLine(line string) (Property, error) {
+	prop := Property{Params: map[string]string{}}
+
+	inQuotes := false
+	colon := -1
+	for i, r := range line {
+		if r == '"' {
+			inQuotes = !inQuotes
+		} else if r == ':' && !inQuotes {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return prop, fmt.Errorf("%w: no value in %q", ErrInvalid, line)
+	}
+
+	prop.Value = line[colon+1:]
+	head := line[:colon]
+
+	var parts []string
+	start := 0
+	inQuotes = false
+	for i, r := range head {
+		if r == '"' {
+			inQuotes = !inQuotes
+		} else if r == ';' && !inQuotes {
+			parts = append(parts, head[start:i])
+			start = i + 1
+		}
+	}
+	parts = append(parts, head[start:])
+
+	prop.Name = strings.ToUpper(parts[0])
+	for _, param := range parts[1:] {
+		name, value, _ := strings.Cut(param, "=")
+		prop.Params[strings.ToUpper(name)] = strings.Trim(value, `"`)
+	}
+	return prop, nil
+}
+
+// Unescape - the text of a TEXT value
+func Unescape(value string) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && i+1 < len(value) {
+			i++
+			switch value[i] {
+			case 'n', 'N':
+				b.WriteByte('\n')
+			default:
+				b.WriteByte(value[i])
+			}
+			continue
+		}
+		b.WriteByte(value[i])
+	}
+	return b.String()
+}
+
+// SplitList - the unescaped items of a comma separated TEXT list such as CATEGORIES
+func SplitList(value string) []string {
+	var items []string
+	start := 0
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' {
+			i++
+		} else if value[i] == ',' {
+			items = append(items, Unescape(value[start:i]))
+			start = i + 1
+		}
+	}
+	return append(items, Unescape(value[start:]))
+}
+
+// ParseTime - the time of a DATE or DATE-TIME property. Dates are midnight UTC and report allDay, times in
+// a TZID are converted to UTC and floating times are read as UTC.
+func ParseTime(prop Property) (t time.Time, allDay bool, err error) {
+	if prop.Params["VALUE"] == "DATE" || len(prop.Value) == len("20060102") {
+		t, err = time.Parse("20060102", prop.Value)
+		return t, true, err
+	}
+
+	if strings.HasSuffix(prop.Value, "Z") {
+		t, err = time.Parse("20060102T150405Z", prop.Value)
+		return t, false, err
+	}
+
+	location := time.UTC
+	if tzid := prop.Params["TZID"]; tzid != "" {
+		if loaded, err := time.LoadLocation(tzid); err == nil {
+			location = loaded
+		}
+	}
+	t, err = time.ParseInLocation("20060102T150405", prop.Value, location)
+	return t.UTC(), false, err
+}
+
+// ParseDuration - a DURATION value such as P1D, PT1H30M or -P1W
+func ParseDuration(value string) (time.Duration, error) {
+	sign := time.Duration(1)
+	switch {
+	case strings.HasPrefix(value, "-"):
+		sign, value = -1, value[1:]
+	case strings.HasPrefix(value, "+"):
+		value = value[1:]
+	}
+	if !strings.HasPrefix(value, "P") || len(value) < 3 {
+		return 0, fmt.Errorf("%w: duration %q", ErrInvalid, value)
+	}
+
+	var total time.Duration
+	number := ""
+	inTime := false
+	for _, r := range value[1:] {
+		switch {
+		case r >= '0' && r <= '9':
+			number += string(r)
+			continue
+		case r == 'T':
+			inTime = true
+			continue
+		}
+
+		n, err := strconv.Atoi(number)
+		if err != nil {
+			return 0, fmt.Errorf("%w: duration %q", ErrInvalid, value)
+		}
+		number = ""
+
+		switch {
+		case r == 'W' && !inTime:
+			total += time.Duration(n) * 7 * 24 * time.Hour
+		case r == 'D' && !inTime:
+			total += time.Duration(n) * 24 * time.Hour
+		case r == 'H' && inTime:
+			total += time.Duration(n) * time.Hour
+		case r == 'M' && inTime:
+			total += time.Duration(n) * time.Minute
+		case r == 'S' && inTime:
+			total += time.Duration(n) * time.Second
+		default:
+			return 0, fmt.Errorf("%w: duration %q", ErrInvalid, value)
+		}
+	}
+	if number != "" {
+		return 0, fmt.Errorf("%w: duration %q", ErrInvalid, value)
+	}
+	return sign * total, nil
+}
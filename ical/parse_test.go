@@ -0,0 +1,227 @@
+package ical
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	input := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"BEGIN:VTODO",
+		"UID:1",
+		`SUMMARY:Buy milk\, eggs`,
+		"DESCRIPTION:A long description which the client folded onto",
+		"  a second line",
+		`X-CUSTOM;LANGUAGE=en;X-NOTE="a:b;c":value:with:colons`,
+		"BEGIN:VALARM",
+		"TRIGGER:-PT15M",
+		"END:VALARM",
+		"CATEGORIES:home",
+		"CATEGORIES:errands",
+		"END:VTODO",
+		"END:VCALENDAR",
+		"",
+	}, "\r\n")
+
+	cal, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	todo, ok := cal.Find(KindTodo)
+	if !ok {
+		t.Fatalf("Parse() = %+v has no VTODO", cal)
+	}
+	alarm, _ := todo.Find("VALARM")
+	trigger, _ := alarm.Get("TRIGGER")
+	summary, _ := todo.Get("SUMMARY")
+	description, _ := todo.Get("DESCRIPTION")
+	custom, _ := todo.Get("X-CUSTOM")
+	_, missing := todo.Get("DUE")
+
+	tests := []struct {
+		name string
+		got  interface{}
+		want interface{}
+	}{
+		{name: "calendar properties", got: cal.Props, want: []Property{{Name: "VERSION", Params: map[string]string{}, Value: "2.0"}}},
+		{name: "escaped text", got: Unescape(summary.Value), want: "Buy milk, eggs"},
+		{name: "folded line", got: description.Value, want: "A long description which the client folded onto a second line"},
+		{name: "quoted parameters", got: custom.Params, want: map[string]string{"LANGUAGE": "en", "X-NOTE": "a:b;c"}},
+		{name: "value with colons", got: custom.Value, want: "value:with:colons"},
+		{name: "nested component", got: trigger.Value, want: "-PT15M"},
+		{name: "repeated property", got: len(todo.All("CATEGORIES")), want: 2},
+		{name: "missing property", got: missing, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !reflect.DeepEqual(tt.got, tt.want) {
+				t.Errorf("got %+v, want %+v", tt.got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{name: "empty", input: ""},
+		{name: "no END", input: "BEGIN:VCALENDAR\r\nVERSION:2.0\r\n"},
+		{name: "wrong END", input: "BEGIN:VCALENDAR\r\nBEGIN:VTODO\r\nEND:VCALENDAR\r\n"},
+		{name: "not a calendar", input: "BEGIN:VCARD\r\nEND:VCARD\r\n"},
+		{name: "property outside of a component", input: "VERSION:2.0\r\nBEGIN:VCALENDAR\r\nEND:VCALENDAR\r\n"},
+		{name: "line without a value", input: "BEGIN:VCALENDAR\r\nVERSION\r\nEND:VCALENDAR\r\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(strings.NewReader(tt.input)); !errors.Is(err, ErrInvalid) {
+				t.Errorf("Parse() error = %v, want ErrInvalid", err)
+			}
+		})
+	}
+}
+
+func TestParseWritten(t *testing.T) {
+	due := time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)
+	var buf bytes.Buffer
+	err := Write(&buf, Calendar{ProdID: "-//Test//EN", Components: []Component{{
+		Kind: KindTodo, UID: "1", Summary: strings.Repeat("Buy milk, eggs; bread\n", 5), Start: due, Categories: []string{"a,b", "c"},
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cal, err := Parse(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	todo, _ := cal.Find(KindTodo)
+	summary, _ := todo.Get("SUMMARY")
+	if got := Unescape(summary.Value); got != strings.Repeat("Buy milk, eggs; bread\n", 5) {
+		t.Errorf("summary = %q", got)
+	}
+	categories, _ := todo.Get("CATEGORIES")
+	if got := SplitList(categories.Value); !reflect.DeepEqual(got, []string{"a,b", "c"}) {
+		t.Errorf("categories = %q", got)
+	}
+	dueProp, _ := todo.Get("DUE")
+	if got, allDay, err := ParseTime(dueProp); err != nil || allDay || !got.Equal(due) {
+		t.Errorf("due = %v, %v, %v", got, allDay, err)
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	tests := []struct {
+		name       string
+		prop       Property
+		want       time.Time
+		wantAllDay bool
+		wantErr    bool
+	}{
+		{
+			name:       "date",
+			prop:       Property{Params: map[string]string{"VALUE": "DATE"}, Value: "20240301"},
+			want:       time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+			wantAllDay: true,
+		},
+		{
+			name:       "date without VALUE",
+			prop:       Property{Params: map[string]string{}, Value: "20240301"},
+			want:       time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+			wantAllDay: true,
+		},
+		{
+			name: "UTC",
+			prop: Property{Params: map[string]string{}, Value: "20240301T093000Z"},
+			want: time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC),
+		},
+		{
+			name: "in a time zone",
+			prop: Property{Params: map[string]string{"TZID": "Europe/Berlin"}, Value: "20240301T093000"},
+			want: time.Date(2024, 3, 1, 8, 30, 0, 0, time.UTC),
+		},
+		{
+			name: "unknown time zone is UTC",
+			prop: Property{Params: map[string]string{"TZID": "W. Europe Standard Time"}, Value: "20240301T093000"},
+			want: time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC),
+		},
+		{
+			name: "floating",
+			prop: Property{Params: map[string]string{}, Value: "20240301T093000"},
+			want: time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC),
+		},
+		{name: "invalid", prop: Property{Params: map[string]string{}, Value: "2024-03-01T09:30"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, allDay, err := ParseTime(tt.prop)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseTime() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (!got.Equal(tt.want) || allDay != tt.wantAllDay) {
+				t.Errorf("ParseTime() = %v, %v, want %v, %v", got, allDay, tt.want, tt.wantAllDay)
+			}
+		})
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{value: "P1D", want: 24 * time.Hour},
+		{value: "PT1H30M", want: 90 * time.Minute},
+		{value: "P1DT12H", want: 36 * time.Hour},
+		{value: "-P1W", want: -7 * 24 * time.Hour},
+		{value: "+PT15S", want: 15 * time.Second},
+		{value: "PT", wantErr: true},
+		{value: "1D", wantErr: true},
+		{value: "P1H", wantErr: true},
+		{value: "PT1D", wantErr: true},
+		{value: "P1", wantErr: true},
+		{value: "PTM", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseDuration(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseDuration(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseDuration(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitList(t *testing.T) {
+	tests := []struct {
+		value string
+		want  []string
+	}{
+		{value: "home", want: []string{"home"}},
+		{value: "home,errands", want: []string{"home", "errands"}},
+		{value: `a\,b,c\;d`, want: []string{"a,b", "c;d"}},
+		{value: "", want: []string{""}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			if got := SplitList(tt.value); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SplitList(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,231 @@
+// Package inbound reads emails sent to the secret addresses which turn them into tasks. Parse takes a raw
+// RFC 5322 message, as posted by mail providers' inbound webhooks, and returns its subject, the text of its
+// body and its attachments, decoded. It knows nothing about tasks or storage.
+package inbound
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxDepth - how deep multiparts may nest
+const maxDepth = 10
+
+var ErrTooLarge = errors.New("inbound: attachment too large")
+
+// headers naming the recipients, the first ones are set by the receiving server and survive forwarding
+var recipientHeaders = []string{"Delivered-To", "X-Original-To", "X-Forwarded-To", "To", "Cc"}
+
+type Email struct {
+	MessageID   string
+	From        string   // Address of the sender
+	Recipients  []string // Addresses from the recipient headers, lower case
+	Subject     string   // Without reply and forward prefixes
+	Date        time.Time
+	Text        string // The plain text body, or the HTML body as text when there is none
+	Attachments []Attachment
+}
+
+type Attachment struct {
+	FileName    string
+	ContentType string // As declared by the sender
+	Content     []byte
+}
+
+// Parse - reads the message. Attachments larger than maxAttachmentSize fail it with ErrTooLarge.
+func Parse(r io.Reader, maxAttachmentSize int64) (*Email, error) {
+	message, err := mail.ReadMessage(r)
+	if err != nil {
+		return nil, fmt.Errorf("inbound: %w", err)
+	}
+
+	decoder := mime.WordDecoder{CharsetReader: charsetReader}
+	subject, err := decoder.DecodeHeader(message.Header.Get("Subject"))
+	if err != nil {
+		subject = message.Header.Get("Subject")
+	}
+
+	email := &Email{
+		MessageID: strings.Trim(message.Header.Get("Message-Id"), "<> "),
+		Subject:   trimSubjectPrefixes(subject),
+	}
+	if from, err := mail.ParseAddress(message.Header.Get("From")); err == nil {
+		email.From = strings.ToLower(from.Address)
+	}
+	if date, err := message.Header.Date(); err == nil {
+		email.Date = date
+	}
+	for _, header := range recipientHeaders {
+		for _, value := range message.Header[header] {
+			addresses, err := mail.ParseAddressList(value)
+			if err != nil {
+				continue
+			}
+			for _, address := range addresses {
+				email.Recipients = append(email.Recipients, strings.ToLower(address.Address))
+			}
+		}
+	}
+
+	var body parts
+	if err := body.read(message.Header, message.Body, maxAttachmentSize, 0); err != nil {
+		return nil, err
+	}
+	email.Text = body.text
+	if email.Text == "" && body.html != "" {
+		email.Text = htmlToText(body.html)
+	}
+	email.Text = strings.TrimSpace(email.Text)
+	email.Attachments = body.attachments
+	return email, nil
+}
+
+// header - the headers of the message or of one of its parts
+type header interface {
+	Get(key string) string
+}
+
+// parts - the first text and HTML bodies and all attachments found walking the message
+type parts struct {
+	text        string
+	html        string
+	attachments []Attachment
+}
+
+func (p *parts) read(h header, body io.Reader, maxAttachmentSize int64, depth int) error {
+	mediaType, params, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", map[string]string{}
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") && depth < maxDepth {
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := reader.NextRawPart()
+			if err == io.EOF {
+				return nil
+			} else if err != nil {
+				return fmt.Errorf("inbound: %w", err)
+			}
+			if err := p.read(part.Header, part, maxAttachmentSize, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+
+	disposition, dispositionParams, _ := mime.ParseMediaType(h.Get("Content-Disposition"))
+	fileName := dispositionParams["filename"]
+	if fileName == "" {
+		fileName = params["name"]
+	}
+
+	content, err := io.ReadAll(io.LimitReader(decodeTransfer(h.Get("Content-Transfer-Encoding"), body), maxAttachmentSize+1))
+	if err != nil {
+		return fmt.Errorf("inbound: %w", err)
+	}
+
+	isBody := disposition != "attachment" && fileName == ""
+	switch {
+	case isBody && mediaType == "text/plain" && p.text == "":
+		p.text = decodeCharset(params["charset"], content)
+	case isBody && mediaType == "text/html" && p.html == "":
+		p.html = decodeCharset(params["charset"], content)
+	case !isBody:
+		if int64(len(content)) > maxAttachmentSize {
+			return ErrTooLarge
+		}
+		decoder := mime.WordDecoder{CharsetReader: charsetReader}
+		if decoded, err := decoder.DecodeHeader(fileName); err == nil {
+			fileName = decoded
+		}
+		p.attachments = append(p.attachments, Attachment{
+			FileName:    filepath.Base(fileName),
+			ContentType: mediaType,
+			Content:     content,
+		})
+	}
+	return nil
+}
+
+func decodeTransfer(encoding string, body io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		return quotedprintable.NewReader(body)
+	}
+	return body
+}
+
+// decodeCharset - the text as UTF-8. Latin-1 is converted, other charsets are kept if they happen to be UTF-8.
+func decodeCharset(charset string, content []byte) string {
+	switch strings.ToLower(charset) {
+	case "iso-8859-1", "latin1", "windows-1252":
+		return latin1(content)
+	}
+	return strings.ToValidUTF8(string(content), "�")
+}
+
+func latin1(content []byte) string {
+	buf := make([]byte, 0, len(content))
+	for _, b := range content {
+		buf = utf8.AppendRune(buf, rune(b))
+	}
+	return string(buf)
+}
+
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	content, err := io.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader([]byte(decodeCharset(charset, content))), nil
+}
+
+var subjectPrefix = regexp.MustCompile(`(?i)^\s*(re|fw|fwd|aw|wg|tr)\s*:\s*`)
+
+// trimSubjectPrefixes - "Fwd: Re: Invoice" is "Invoice"
+func trimSubjectPrefixes(subject string) string {
+	for {
+		trimmed := subjectPrefix.ReplaceAllString(subject, "")
+		if trimmed == subject {
+			return strings.TrimSpace(subject)
+		}
+		subject = trimmed
+	}
+}
+
+var (
+	invisibleElements = regexp.MustCompile(`(?is)<(script|style|head)\b.*?</(script|style|head)\s*>`)
+	lineBreaks        = regexp.MustCompile(`(?i)<br\s*/?>|</(p|div|li|tr|h[1-6])\s*>`)
+	tags              = regexp.MustCompile(`(?s)<[^>]*>`)
+	blankLines        = regexp.MustCompile(`\n\s*\n(\s*\n)+`)
+	spaces            = regexp.MustCompile(`[ \t]+`)
+)
+
+// htmlToText - the text of an HTML body, good enough for a task comment
+func htmlToText(src string) string {
+	text := invisibleElements.ReplaceAllString(src, "")
+	text = lineBreaks.ReplaceAllString(text, "\n")
+	text = tags.ReplaceAllString(text, "")
+	text = html.UnescapeString(text)
+	text = spaces.ReplaceAllString(text, " ")
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+	return blankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+}
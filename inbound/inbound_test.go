@@ -0,0 +1,209 @@
+package inbound
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// message - joins the lines of a raw message with CRLF
+func message(lines ...string) string {
+	return strings.Join(lines, "\r\n")
+}
+
+// maxSize - the attachment size limit of the tests
+const maxSize = 1024
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		want    Email
+		wantErr error
+	}{
+		{
+			name: "plain text",
+			raw: message(
+				"Message-Id: <abc@example.com>",
+				"From: Alice <Alice@Example.com>",
+				"To: tasks+secret@tracker.example, Bob <bob@example.com>",
+				"Delivered-To: Tasks+Secret@tracker.example",
+				"Date: Fri, 01 Mar 2024 09:30:00 +0100",
+				"Subject: Fwd: RE: Buy milk",
+				"",
+				"  Whole milk, please.  ",
+			),
+			want: Email{
+				MessageID:  "abc@example.com",
+				From:       "alice@example.com",
+				Recipients: []string{"tasks+secret@tracker.example", "tasks+secret@tracker.example", "bob@example.com"},
+				Subject:    "Buy milk",
+				Date:       time.Date(2024, 3, 1, 8, 30, 0, 0, time.UTC),
+				Text:       "Whole milk, please.",
+			},
+		},
+		{
+			name: "encoded subject and latin-1 quoted-printable body",
+			raw: message(
+				"From: alice@example.com",
+				"Subject: =?utf-8?q?Caf=C3=A9_bestellen?=",
+				"Content-Type: text/plain; charset=iso-8859-1",
+				"Content-Transfer-Encoding: quoted-printable",
+				"",
+				"Gr=FC=DFe",
+			),
+			want: Email{From: "alice@example.com", Subject: "Café bestellen", Text: "Grüße"},
+		},
+		{
+			name: "text is preferred to HTML",
+			raw: message(
+				"Subject: Report",
+				`Content-Type: multipart/alternative; boundary="alt"`,
+				"",
+				"--alt",
+				"Content-Type: text/html",
+				"",
+				"<p>HTML</p>",
+				"--alt",
+				"Content-Type: text/plain",
+				"",
+				"Text",
+				"--alt--",
+			),
+			want: Email{Subject: "Report", Text: "Text"},
+		},
+		{
+			name: "HTML only",
+			raw: message(
+				"Subject: Report",
+				"Content-Type: text/html; charset=utf-8",
+				"",
+				"<html><head><style>p { color: red }</style></head><body>",
+				"<p>Hello <b>Bob</b> &amp; Carol,</p><p>see   below</p><script>alert(1)</script>",
+				"<ul><li>one</li><li>two</li></ul></body></html>",
+			),
+			want: Email{Subject: "Report", Text: "Hello Bob & Carol,\nsee below\n\none\ntwo"},
+		},
+		{
+			name: "nested multipart with attachments",
+			raw: message(
+				"Subject: Invoice",
+				`Content-Type: multipart/mixed; boundary="outer"`,
+				"",
+				"--outer",
+				`Content-Type: multipart/alternative; boundary="inner"`,
+				"",
+				"--inner",
+				"Content-Type: text/plain",
+				"",
+				"See attached",
+				"--inner--",
+				"--outer",
+				`Content-Type: application/pdf; name="ignored.pdf"`,
+				`Content-Disposition: attachment; filename="../invoice.pdf"`,
+				"Content-Transfer-Encoding: base64",
+				"",
+				"JVBERi0=",
+				"--outer",
+				`Content-Type: text/plain; name="=?utf-8?q?notiz_=C3=A4.txt?="`,
+				"",
+				"note",
+				"--outer--",
+			),
+			want: Email{
+				Subject: "Invoice",
+				Text:    "See attached",
+				Attachments: []Attachment{
+					{FileName: "invoice.pdf", ContentType: "application/pdf", Content: []byte("%PDF-")},
+					{FileName: "notiz ä.txt", ContentType: "text/plain", Content: []byte("note")},
+				},
+			},
+		},
+		{
+			name: "attachment too large",
+			raw: message(
+				"Subject: Invoice",
+				`Content-Type: multipart/mixed; boundary="b"`,
+				"",
+				"--b",
+				`Content-Disposition: attachment; filename="big.bin"`,
+				"",
+				strings.Repeat("x", maxSize+1),
+				"--b--",
+			),
+			wantErr: ErrTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			email, err := Parse(strings.NewReader(tt.raw), maxSize)
+			if tt.wantErr != nil || err != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Parse() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if !email.Date.IsZero() || !tt.want.Date.IsZero() {
+				if !email.Date.Equal(tt.want.Date) {
+					t.Errorf("Parse() date = %v, want %v", email.Date, tt.want.Date)
+				}
+				email.Date = tt.want.Date
+			}
+			if !reflect.DeepEqual(*email, tt.want) {
+				t.Errorf("Parse() = %+v, want %+v", *email, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	if _, err := Parse(strings.NewReader("not a message"), maxSize); err == nil {
+		t.Error("Parse() error = nil")
+	}
+}
+
+func TestTrimSubjectPrefixes(t *testing.T) {
+	tests := []struct {
+		subject string
+		want    string
+	}{
+		{subject: "Invoice", want: "Invoice"},
+		{subject: "Re: Invoice", want: "Invoice"},
+		{subject: "Fwd: RE:  Invoice ", want: "Invoice"},
+		{subject: "AW: WG: TR: fw: Invoice", want: "Invoice"},
+		{subject: "Reminder: Invoice", want: "Reminder: Invoice"},
+		{subject: "Re:", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.subject, func(t *testing.T) {
+			if got := trimSubjectPrefixes(tt.subject); got != tt.want {
+				t.Errorf("trimSubjectPrefixes(%q) = %q, want %q", tt.subject, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeCharset(t *testing.T) {
+	tests := []struct {
+		name    string
+		charset string
+		content []byte
+		want    string
+	}{
+		{name: "UTF-8", charset: "utf-8", content: []byte("Grüße"), want: "Grüße"},
+		{name: "latin-1", charset: "ISO-8859-1", content: []byte{'G', 'r', 0xfc, 0xdf, 'e'}, want: "Grüße"},
+		{name: "invalid UTF-8 is replaced", charset: "", content: []byte{'a', 0xff, 'b'}, want: "a�b"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := decodeCharset(tt.charset, tt.content); got != tt.want {
+				t.Errorf("decodeCharset() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
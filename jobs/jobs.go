@@ -0,0 +1,48 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"github.com/utpal74/track-my-tasks-backend/logger"
+	"go.uber.org/zap"
+)
+
+// Every - runs fn on every tick of interval for the lifetime of the process.
+// Each run gets its own context (bounded by the interval) carrying the logger of ctx, failures are logged.
+func Every(ctx context.Context, name string, interval time.Duration, fn func(context.Context) error) {
+	log := logger.FromCtx(ctx)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		runCtx, cancel := context.WithTimeout(context.Background(), interval)
+		runCtx = logger.WithLogger(runCtx, log)
+
+		start := time.Now()
+		if err := fn(runCtx); err != nil {
+			log.Error("background job failed", zap.String("job", name), zap.Error(err))
+		} else {
+			log.Info("background job finished", zap.String("job", name), zap.Duration("took", time.Since(start)))
+		}
+		cancel()
+	}
+}
+
+// Go - runs fn once in the background, for work started by a request which outlives it.
+// The run keeps the values of ctx (logger, workspace) but not its cancellation, and is bounded by timeout.
+func Go(ctx context.Context, name string, timeout time.Duration, fn func(context.Context) error) {
+	log := logger.FromCtx(ctx)
+	runCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+
+	go func() {
+		defer cancel()
+
+		start := time.Now()
+		if err := fn(runCtx); err != nil {
+			log.Error("background job failed", zap.String("job", name), zap.Error(err))
+		} else {
+			log.Info("background job finished", zap.String("job", name), zap.Duration("took", time.Since(start)))
+		}
+	}()
+}
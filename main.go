@@ -12,12 +12,18 @@ import (
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
+	"github.com/utpal74/track-my-tasks-backend/blobstore"
 	"github.com/utpal74/track-my-tasks-backend/cacheutils"
 	"github.com/utpal74/track-my-tasks-backend/common"
 	"github.com/utpal74/track-my-tasks-backend/db"
+	"github.com/utpal74/track-my-tasks-backend/domain"
 	"github.com/utpal74/track-my-tasks-backend/handlers"
+	"github.com/utpal74/track-my-tasks-backend/jobs"
 	"github.com/utpal74/track-my-tasks-backend/logger"
+	"github.com/utpal74/track-my-tasks-backend/outbox"
+	"github.com/utpal74/track-my-tasks-backend/realtime"
 	"github.com/utpal74/track-my-tasks-backend/routes"
+	"github.com/utpal74/track-my-tasks-backend/tenant"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
@@ -51,21 +57,74 @@ func main() {
 	ctx = logger.WithLogger(ctx, zapLogger)
 	client, err := db.Connect(ctx)
 	common.FailOnError(ctx, "error connecting DB", err)
+	err = db.EnsureIndexes(ctx, client.Database(os.Getenv("MONGO_DATABASE")))
+	common.FailOnError(ctx, "error creating indexes", err)
 
 	usersCollection := client.Database(os.Getenv("MONGO_DATABASE")).Collection("users")
-	tasksCollection := client.Database(os.Getenv("MONGO_DATABASE")).Collection("tasks")
+	workspacesCollection := client.Database(os.Getenv("MONGO_DATABASE")).Collection("workspaces")
+	tasksCollection := tenant.NewCollection(client.Database(os.Getenv("MONGO_DATABASE")).Collection("tasks"))
+	projectsCollection := tenant.NewCollection(client.Database(os.Getenv("MONGO_DATABASE")).Collection("projects"))
+	taskEventsCollection := client.Database(os.Getenv("MONGO_DATABASE")).Collection("task_events")
+	commentsCollection := client.Database(os.Getenv("MONGO_DATABASE")).Collection("comments")
+	attachmentsCollection := client.Database(os.Getenv("MONGO_DATABASE")).Collection("attachments")
+	invitationsCollection := client.Database(os.Getenv("MONGO_DATABASE")).Collection("invitations")
+	timeEntriesCollection := tenant.NewCollection(client.Database(os.Getenv("MONGO_DATABASE")).Collection("time_entries"))
+	pomodorosCollection := tenant.NewCollection(client.Database(os.Getenv("MONGO_DATABASE")).Collection("pomodoros"))
+	templatesCollection := tenant.NewCollection(client.Database(os.Getenv("MONGO_DATABASE")).Collection("templates"))
+	notificationsCollection := client.Database(os.Getenv("MONGO_DATABASE")).Collection("notifications")
+	importsCollection := client.Database(os.Getenv("MONGO_DATABASE")).Collection("imports")
+	calendarFeedsCollection := client.Database(os.Getenv("MONGO_DATABASE")).Collection("calendar_feeds")
+	accessTokensCollection := client.Database(os.Getenv("MONGO_DATABASE")).Collection("access_tokens")
+	webhooksCollection := client.Database(os.Getenv("MONGO_DATABASE")).Collection("webhooks")
+	webhookDeliveriesCollection := client.Database(os.Getenv("MONGO_DATABASE")).Collection("webhook_deliveries")
+	tombstonesCollection := tenant.NewCollection(client.Database(os.Getenv("MONGO_DATABASE")).Collection("task_tombstones"))
+	outboxCollection := client.Database(os.Getenv("MONGO_DATABASE")).Collection("outbox")
+	inboundAddressesCollection := client.Database(os.Getenv("MONGO_DATABASE")).Collection("inbound_addresses")
 
 	redisClient, err := cacheutils.Connect(ctx)
 	common.FailOnError(ctx, "not able to connect to redis client", err)
 
-	taskHandler := handlers.NewTasksHandler(ctx, tasksCollection, usersCollection, redisClient)
-	authHandler := handlers.NewAuthHandler(ctx, usersCollection, redisClient)
+	blobStore, err := blobstore.FromEnv()
+	common.FailOnError(ctx, "error configuring blob store", err)
+
+	domainEvents, err := outbox.New(ctx, outboxCollection)
+	common.FailOnError(ctx, "error setting up the outbox", err)
+
+	taskHandler := handlers.NewTasksHandler(ctx, tasksCollection, usersCollection, projectsCollection, taskEventsCollection, notificationsCollection, templatesCollection, tombstonesCollection, domainEvents, redisClient)
+	authHandler := handlers.NewAuthHandler(ctx, usersCollection, accessTokensCollection, redisClient)
+	projectHandler := handlers.NewProjectsHandler(ctx, projectsCollection, tasksCollection, usersCollection, redisClient)
+	commentHandler := handlers.NewCommentsHandler(ctx, commentsCollection, tasksCollection, projectsCollection, usersCollection, redisClient)
+	attachmentHandler := handlers.NewAttachmentsHandler(ctx, attachmentsCollection, tasksCollection, projectsCollection, usersCollection, blobStore)
+	sharingHandler := handlers.NewSharingHandler(ctx, invitationsCollection, tasksCollection, projectsCollection, usersCollection, redisClient)
+	notificationHandler := handlers.NewNotificationsHandler(ctx, notificationsCollection, usersCollection)
+	workspaceHandler := handlers.NewWorkspacesHandler(ctx, workspacesCollection, tasksCollection, projectsCollection, usersCollection, redisClient)
+	timeHandler := handlers.NewTimeHandler(ctx, timeEntriesCollection, tasksCollection, projectsCollection, usersCollection, redisClient)
+	pomodoroHandler := handlers.NewPomodoroHandler(ctx, pomodorosCollection, tasksCollection, projectsCollection, usersCollection, redisClient)
+	transferHandler := handlers.NewTransferHandler(ctx, tasksCollection, projectsCollection, usersCollection, commentsCollection, importsCollection, redisClient, taskHandler)
+	calendarHandler := handlers.NewCalendarHandler(ctx, calendarFeedsCollection, workspacesCollection, tasksCollection, projectsCollection, usersCollection)
+	broker := realtime.NewBroker(redisClient)
+	eventsHandler := handlers.NewEventsHandler(ctx, broker, usersCollection, projectsCollection)
+	webhooksHandler := handlers.NewWebhooksHandler(ctx, webhooksCollection, webhookDeliveriesCollection, usersCollection, projectsCollection, redisClient)
+	inboundHandler := handlers.NewInboundEmailHandler(ctx, inboundAddressesCollection, workspacesCollection, usersCollection, taskHandler, attachmentHandler)
+	taskHandler.OnPurge(commentHandler.DeleteTaskComments)
+	taskHandler.OnPurge(attachmentHandler.DeleteTaskAttachments)
+	taskHandler.OnPurge(timeHandler.DeleteTaskTimeEntries)
+	taskHandler.OnPurge(pomodoroHandler.DeleteTaskPomodoros)
+	go broker.Run(context.WithoutCancel(ctx))
+	go domainEvents.Relay(context.WithoutCancel(ctx), redisClient)
+	go domain.Subscribe(context.WithoutCancel(ctx), redisClient, "realtime", domain.Consumer(), eventsHandler.PublishDomainEvent)
+	go domain.Subscribe(context.WithoutCancel(ctx), redisClient, "webhooks", domain.Consumer(), webhooksHandler.DeliverDomainEvent)
+	go webhooksHandler.RunDeliveries(context.WithoutCancel(ctx))
+	go jobs.Every(ctx, "webhook deliveries maintenance", time.Hour, webhooksHandler.MaintainDeliveries)
+	go jobs.Every(ctx, "rank rebalance", time.Hour, taskHandler.RebalanceRanks)
+	go jobs.Every(ctx, "trash purge", time.Hour, taskHandler.PurgeTrash)
+	go jobs.Every(ctx, "outbox prune", time.Hour, domainEvents.Prune)
 	go handleShutdown(ctx, cancel, client)
-	router := setupRouter(taskHandler, authHandler)
+	router := setupRouter(taskHandler, authHandler, projectHandler, commentHandler, attachmentHandler, sharingHandler, workspaceHandler, notificationHandler, timeHandler, pomodoroHandler, transferHandler, calendarHandler, eventsHandler, webhooksHandler, inboundHandler)
 	startServer(ctx, router)
 }
 
-func setupRouter(taskHandler *handlers.TasksHandler, authHandler *handlers.AuthHandler) *gin.Engine {
+func setupRouter(taskHandler *handlers.TasksHandler, authHandler *handlers.AuthHandler, projectHandler *handlers.ProjectsHandler, commentHandler *handlers.CommentsHandler, attachmentHandler *handlers.AttachmentsHandler, sharingHandler *handlers.SharingHandler, workspaceHandler *handlers.WorkspacesHandler, notificationHandler *handlers.NotificationsHandler, timeHandler *handlers.TimeHandler, pomodoroHandler *handlers.PomodoroHandler, transferHandler *handlers.TransferHandler, calendarHandler *handlers.CalendarHandler, eventsHandler *handlers.EventsHandler, webhooksHandler *handlers.WebhooksHandler, inboundHandler *handlers.InboundEmailHandler) *gin.Engine {
 	router := gin.Default()
 	allowedOrigins := strings.Split(os.Getenv("ALLOWED_ORIGINS"), ",")
 
@@ -76,7 +135,7 @@ func setupRouter(taskHandler *handlers.TasksHandler, authHandler *handlers.AuthH
 		AllowCredentials: true,
 	}))
 
-	routes.SetupRoutes(router, taskHandler, authHandler)
+	routes.SetupRoutes(router, taskHandler, authHandler, projectHandler, commentHandler, attachmentHandler, sharingHandler, workspaceHandler, notificationHandler, timeHandler, pomodoroHandler, transferHandler, calendarHandler, eventsHandler, webhooksHandler, inboundHandler)
 	return router
 }
 
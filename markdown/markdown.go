@@ -0,0 +1,166 @@
+// Package markdown renders the small subset of Markdown used in task comments.
+// Input is HTML-escaped before any formatting is applied, so the only markup in the
+// output is the one produced here: the result is safe to embed without further sanitizing.
+package markdown
+
+import (
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var (
+	linkPattern    = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	boldPattern    = regexp.MustCompile(`\*\*([^*]+)\*\*`)
+	italicPattern  = regexp.MustCompile(`\*([^*]+)\*`)
+	mentionPattern = regexp.MustCompile(`(^|[^\w@])@([A-Za-z0-9_.-]+)`)
+	headingPattern = regexp.MustCompile(`^(#{1,3})\s+(.*)$`)
+	listPattern    = regexp.MustCompile(`^[-*]\s+(.*)$`)
+)
+
+// link schemes allowed in rendered anchors, anything else is rendered as plain text
+var allowedSchemes = map[string]bool{"http": true, "https": true, "mailto": true}
+
+// Render - converts Markdown to HTML. Supported: paragraphs, line breaks, headings (#, ##, ###),
+// unordered lists, fenced code blocks, inline code, bold, italic and http(s)/mailto links.
+func Render(src string) string {
+	lines := strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n")
+
+	var out strings.Builder
+	var paragraph []string
+	inList, inCode := false, false
+
+	flushParagraph := func() {
+		if len(paragraph) > 0 {
+			out.WriteString("<p>" + strings.Join(paragraph, "<br>") + "</p>")
+			paragraph = nil
+		}
+	}
+	closeList := func() {
+		if inList {
+			out.WriteString("</ul>")
+			inList = false
+		}
+	}
+
+	for _, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			if inCode {
+				out.WriteString("</code></pre>")
+			} else {
+				flushParagraph()
+				closeList()
+				out.WriteString("<pre><code>")
+			}
+			inCode = !inCode
+			continue
+		}
+
+		if inCode {
+			out.WriteString(html.EscapeString(line) + "\n")
+			continue
+		}
+
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+			flushParagraph()
+			closeList()
+		case headingPattern.MatchString(trimmed):
+			flushParagraph()
+			closeList()
+			match := headingPattern.FindStringSubmatch(trimmed)
+			level := string(rune('0' + len(match[1])))
+			out.WriteString("<h" + level + ">" + renderInline(match[2]) + "</h" + level + ">")
+		case listPattern.MatchString(trimmed):
+			flushParagraph()
+			if !inList {
+				out.WriteString("<ul>")
+				inList = true
+			}
+			out.WriteString("<li>" + renderInline(listPattern.FindStringSubmatch(trimmed)[1]) + "</li>")
+		default:
+			closeList()
+			paragraph = append(paragraph, renderInline(trimmed))
+		}
+	}
+
+	if inCode {
+		out.WriteString("</code></pre>")
+	}
+	flushParagraph()
+	closeList()
+	return out.String()
+}
+
+// Mentions - returns the distinct usernames mentioned as @username outside of code, in order of appearance
+func Mentions(src string) []string {
+	seen := make(map[string]bool)
+	mentions := make([]string, 0)
+
+	inCode := false
+	for _, line := range strings.Split(src, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inCode = !inCode
+			continue
+		}
+		if inCode {
+			continue
+		}
+
+		// Odd segments are inline code spans
+		for i, segment := range strings.Split(line, "`") {
+			if i%2 == 1 {
+				continue
+			}
+			for _, match := range mentionPattern.FindAllStringSubmatch(segment, -1) {
+				name := strings.TrimRight(match[2], ".-")
+				if name != "" && !seen[name] {
+					seen[name] = true
+					mentions = append(mentions, name)
+				}
+			}
+		}
+	}
+	return mentions
+}
+
+// renderInline - escapes a line of text and applies the inline formatting
+func renderInline(text string) string {
+	segments := strings.Split(text, "`")
+
+	var out strings.Builder
+	for i, segment := range segments {
+		escaped := html.EscapeString(segment)
+
+		// Odd segments are inline code, an unmatched trailing backtick is kept literally
+		if i%2 == 1 && i < len(segments)-1 {
+			out.WriteString("<code>" + escaped + "</code>")
+			continue
+		}
+		if i%2 == 1 {
+			out.WriteString("`")
+		}
+
+		escaped = linkPattern.ReplaceAllStringFunc(escaped, renderLink)
+		escaped = boldPattern.ReplaceAllString(escaped, "<strong>$1</strong>")
+		escaped = italicPattern.ReplaceAllString(escaped, "<em>$1</em>")
+		out.WriteString(escaped)
+	}
+	return out.String()
+}
+
+// renderLink - turns an (already escaped) [text](url) into an anchor when the URL scheme is allowed
+func renderLink(match string) string {
+	parts := linkPattern.FindStringSubmatch(match)
+	text, href := parts[1], parts[2]
+
+	parsed, err := url.Parse(html.UnescapeString(href))
+	if err != nil || !allowedSchemes[strings.ToLower(parsed.Scheme)] {
+		return text
+	}
+	// Asterisks are encoded so bold and italic, applied after links, can't match inside the URL
+	href = strings.ReplaceAll(href, "*", "&#42;")
+	return `<a href="` + href + `" rel="nofollow noopener" target="_blank">` + text + `</a>`
+}
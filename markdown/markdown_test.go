@@ -0,0 +1,86 @@
+package markdown
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	anchor := func(href, text string) string {
+		return `<a href="` + href + `" rel="nofollow noopener" target="_blank">` + text + `</a>`
+	}
+
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{name: "plain text", input: "Buy milk", want: "<p>Buy milk</p>"},
+		{name: "html is escaped", input: "<script>alert(1)</script>", want: "<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>"},
+		{name: "entities are escaped", input: "a & b < c > d", want: "<p>a &amp; b &lt; c &gt; d</p>"},
+		{name: "quotes are escaped", input: `say "hi" it's`, want: "<p>say &#34;hi&#34; it&#39;s</p>"},
+		{name: "line breaks and paragraphs", input: "one\ntwo\n\nthree", want: "<p>one<br>two</p><p>three</p>"},
+		{name: "windows line endings", input: "one\r\ntwo", want: "<p>one<br>two</p>"},
+		{name: "headings", input: "# One\n## Two\n### Three\n#### Four", want: "<h1>One</h1><h2>Two</h2><h3>Three</h3><p>#### Four</p>"},
+		{name: "list", input: "- one\n* two\n\nafter", want: "<ul><li>one</li><li>two</li></ul><p>after</p>"},
+		{name: "bold and italic", input: "**bold** and *italic*", want: "<p><strong>bold</strong> and <em>italic</em></p>"},
+		{name: "inline code is escaped and not formatted", input: "run `<b>**x**</b>`", want: "<p>run <code>&lt;b&gt;**x**&lt;/b&gt;</code></p>"},
+		{name: "unmatched backtick", input: "a ` b", want: "<p>a ` b</p>"},
+		{name: "code block is escaped", input: "```\n<b>**x**</b>\n```", want: "<pre><code>&lt;b&gt;**x**&lt;/b&gt;\n</code></pre>"},
+		{name: "unclosed code block", input: "```\nx", want: "<pre><code>x\n</code></pre>"},
+		{name: "https link", input: "[docs](https://example.com/a_b?q=1&r=2)", want: "<p>" + anchor("https://example.com/a_b?q=1&amp;r=2", "docs") + "</p>"},
+		{name: "mailto link", input: "[mail](mailto:alice@example.com)", want: "<p>" + anchor("mailto:alice@example.com", "mail") + "</p>"},
+		{name: "formatted link text", input: "[**docs**](http://example.com)", want: "<p>" + anchor("http://example.com", "<strong>docs</strong>") + "</p>"},
+		{name: "bold around a link", input: "**see [docs](http://example.com)**", want: "<p><strong>see " + anchor("http://example.com", "docs") + "</strong></p>"},
+		{name: "link in inline code", input: "`[docs](http://example.com)`", want: "<p><code>[docs](http://example.com)</code></p>"},
+		{name: "quotes in the href", input: `[x](http://example.com/"onmouseover="alert(1))`, want: "<p>" + anchor("http://example.com/&#34;onmouseover=&#34;alert(1", "x") + ")</p>"},
+		{name: "single quotes in the href", input: "[x](http://example.com/'a)", want: "<p>" + anchor("http://example.com/&#39;a", "x") + "</p>"},
+		{name: "asterisks in the href", input: "[x](http://example.com/*a*b) *c*", want: "<p>" + anchor("http://example.com/&#42;a&#42;b", "x") + " <em>c</em></p>"},
+		{name: "javascript scheme", input: "[x](javascript:alert(1))", want: "<p>x)</p>"},
+		{name: "javascript scheme in capitals", input: "[x](JaVaScRiPt:alert(1))", want: "<p>x)</p>"},
+		{name: "hex entity encoded scheme", input: "[x](jav&#x61;script:alert(1))", want: "<p>x)</p>"},
+		{name: "decimal entity encoded scheme", input: "[x](&#106;avascript:alert(1))", want: "<p>x)</p>"},
+		{name: "entity encoded tab in the scheme", input: "[x](java&#09;script:alert)", want: "<p>x</p>"},
+		{name: "data scheme", input: "[x](data:text/html,hi)", want: "<p>x</p>"},
+		{name: "vbscript scheme", input: "[x](vbscript:msgbox)", want: "<p>x</p>"},
+		{name: "relative link", input: "[x](/tasks)", want: "<p>x</p>"},
+		{name: "protocol relative link", input: "[x](//evil.example.com)", want: "<p>x</p>"},
+		{name: "whitespace before the url", input: "[x]( javascript:alert(1))", want: "<p>[x]( javascript:alert(1))</p>"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := Render(test.input); got != test.want {
+				t.Errorf("Render(%q) =\n%s\nwant\n%s", test.input, got, test.want)
+			}
+		})
+	}
+}
+
+func TestMentions(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{name: "none", input: "Buy milk", want: []string{}},
+		{name: "in order", input: "@bob ask @alice", want: []string{"bob", "alice"}},
+		{name: "distinct", input: "@alice and @alice", want: []string{"alice"}},
+		{name: "trailing punctuation", input: "thanks @alice. and @bob-", want: []string{"alice", "bob"}},
+		{name: "dots and underscores", input: "@j.doe @j_doe", want: []string{"j.doe", "j_doe"}},
+		{name: "after punctuation", input: "(@alice), cc:@bob", want: []string{"alice", "bob"}},
+		{name: "email addresses", input: "mail alice@example.com", want: []string{}},
+		{name: "double at", input: "@@alice", want: []string{}},
+		{name: "inline code", input: "`@alice` @bob", want: []string{"bob"}},
+		{name: "code block", input: "```\n@alice\n```\n@bob", want: []string{"bob"}},
+		{name: "at the start of lines", input: "@alice\n@bob", want: []string{"alice", "bob"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := Mentions(test.input); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Mentions(%q) = %q, want %q", test.input, got, test.want)
+			}
+		})
+	}
+}
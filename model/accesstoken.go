@@ -0,0 +1,20 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AccessToken - a personal access token, for clients which can't sign in, such as CalDAV apps. Only a hash of
+// the token is kept, it is shown once when it is created.
+type AccessToken struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id"`
+	UserID      primitive.ObjectID `json:"user_id" bson:"user_id"`
+	WorkspaceID primitive.ObjectID `json:"workspace_id" bson:"workspace_id"` // Requests with the token work in this workspace
+	Name        string             `json:"name" bson:"name"`
+	Prefix      string             `json:"prefix" bson:"prefix"` // Start of the token, to tell tokens apart
+	TokenHash   string             `json:"-" bson:"token_hash"`  // Hex SHA-256 of the token
+	CreatedAt   time.Time          `json:"created_at" bson:"created_at"`
+	LastUsedAt  *time.Time         `json:"last_used_at,omitempty" bson:"last_used_at,omitempty"`
+}
@@ -0,0 +1,18 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Attachment struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id"`
+	TaskID      primitive.ObjectID `json:"task_id" bson:"task_id"`
+	UserID      primitive.ObjectID `json:"user_id" bson:"user_id"` // Uploader
+	FileName    string             `json:"file_name" bson:"file_name"`
+	ContentType string             `json:"content_type" bson:"content_type"`
+	Size        int64              `json:"size" bson:"size"`
+	Hash        string             `json:"hash" bson:"hash"` // SHA-256 of the content, also the blob key
+	CreatedAt   time.Time          `json:"created_at" bson:"created_at"`
+}
@@ -0,0 +1,17 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CalendarFeed - the secret iCalendar feed of a user's tasks in a workspace. Only a hash of the token is kept,
+// the feed URL is shown once, when the token is created.
+type CalendarFeed struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id"`
+	UserID      primitive.ObjectID `json:"user_id" bson:"user_id"`
+	WorkspaceID primitive.ObjectID `json:"workspace_id" bson:"workspace_id"`
+	TokenHash   string             `json:"-" bson:"token_hash"` // Hex SHA-256 of the token in the URL
+	CreatedAt   time.Time          `json:"created_at" bson:"created_at"`
+}
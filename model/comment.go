@@ -0,0 +1,20 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Comment struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id"`
+	TaskID    primitive.ObjectID `json:"task_id" bson:"task_id"`
+	AuthorID  primitive.ObjectID `json:"author_id" bson:"author_id"`
+	Author    string             `json:"author" bson:"author"`     // Username of the author
+	Body      string             `json:"body" bson:"body"`         // Markdown source
+	HTML      string             `json:"html" bson:"html"`         // Rendered body, safe to display
+	Mentions  []string           `json:"mentions" bson:"mentions"` // Mentioned usernames who have access to the task
+	Edited    bool               `json:"edited" bson:"edited"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt time.Time          `json:"updated_at" bson:"updated_at"`
+}
@@ -0,0 +1,39 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// task history actions
+const (
+	TaskActionCreated    = "created"
+	TaskActionUpdated    = "updated"
+	TaskActionDeleted    = "deleted"
+	TaskActionRestored   = "restored"
+	TaskActionMoved      = "moved"
+	TaskActionStatus     = "status_changed"
+	TaskActionDependency = "dependency_changed"
+	TaskActionAssigned   = "assignees_changed"
+	TaskActionUndo       = "undo"
+	TaskActionPurged     = "purged" // Only in domain events, the history goes along with the task
+)
+
+// TaskEvent - one entry of a task's activity history, stored in the task_events collection
+type TaskEvent struct {
+	ID            primitive.ObjectID `json:"id" bson:"_id"`
+	TaskID        primitive.ObjectID `json:"task_id" bson:"task_id"`
+	UserID        primitive.ObjectID `json:"user_id" bson:"user_id"` // Owner of the task
+	Actor         string             `json:"actor" bson:"actor"`     // Username of whoever made the change
+	Action        string             `json:"action" bson:"action"`   // One of the TaskAction* constants
+	Changes       []FieldChange      `json:"changes" bson:"changes"`
+	TaskUpdatedAt time.Time          `json:"task_updated_at" bson:"task_updated_at"` // updated_at of the task right after the change, used by undo
+	CreatedAt     time.Time          `json:"created_at" bson:"created_at"`
+}
+
+type FieldChange struct {
+	Field string      `json:"field" bson:"field"`
+	Old   interface{} `json:"old" bson:"old"` // nil when the field was not set
+	New   interface{} `json:"new" bson:"new"` // nil when the field was removed
+}
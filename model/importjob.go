@@ -0,0 +1,53 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// import job states
+const (
+	ImportQueued  = "queued"
+	ImportRunning = "running"
+	ImportDone    = "done"
+	ImportFailed  = "failed"
+)
+
+// ImportJob - the progress and outcome of an import. Small imports answer with it directly, large ones store it
+// and run in the background.
+type ImportJob struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id"`
+	UserID      primitive.ObjectID `json:"user_id" bson:"user_id"`
+	WorkspaceID primitive.ObjectID `json:"workspace_id" bson:"workspace_id"`
+	Format      string             `json:"format" bson:"format"`
+	DryRun      bool               `json:"dry_run,omitempty" bson:"dry_run,omitempty"` // Nothing is stored, Created counts the tasks an import would create
+	Status      string             `json:"status" bson:"status"`                       // One of the Import* constants
+	Total       int                `json:"total" bson:"total"`                         // Rows in the file
+	Processed   int                `json:"processed" bson:"processed"`
+	Created     int                `json:"created" bson:"created"`
+	Skipped     int                `json:"skipped" bson:"skipped"` // Rows imported before, by external ID
+	Failed      int                `json:"failed" bson:"failed"`
+	Errors      []ImportError      `json:"errors" bson:"errors"`                       // The first failed rows
+	Mapping     []ImportMapping    `json:"mapping,omitempty" bson:"mapping,omitempty"` // How the items of another tool's export were imported
+	NewProjects []string           `json:"new_projects,omitempty" bson:"new_projects,omitempty"`
+	Error       string             `json:"error,omitempty" bson:"error,omitempty"` // Why the whole job failed
+	CreatedAt   time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt   time.Time          `json:"updated_at" bson:"updated_at"`
+	FinishedAt  *time.Time         `json:"finished_at,omitempty" bson:"finished_at,omitempty"`
+}
+
+// ImportError - a row which wasn't imported
+type ImportError struct {
+	Row        int    `json:"row" bson:"row"`
+	ExternalID string `json:"external_id,omitempty" bson:"external_id,omitempty"`
+	Error      string `json:"error" bson:"error"`
+}
+
+// ImportMapping - what one kind of item of the source became, e.g. 12 Trello lists as labels.
+// Target is "not imported" for items which are left out.
+type ImportMapping struct {
+	Source string `json:"source" bson:"source"`
+	Target string `json:"target" bson:"target"`
+	Count  int    `json:"count" bson:"count"`
+}
@@ -0,0 +1,18 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// InboundAddress - the secret email address turning the emails sent to it into tasks of a user in a workspace.
+// Only a hash of the token in the address is kept, the address is shown once, when the token is created.
+type InboundAddress struct {
+	ID             primitive.ObjectID `json:"id" bson:"_id"`
+	UserID         primitive.ObjectID `json:"user_id" bson:"user_id"`
+	WorkspaceID    primitive.ObjectID `json:"workspace_id" bson:"workspace_id"`
+	TokenHash      string             `json:"-" bson:"token_hash"` // Hex SHA-256 of the local part of the address
+	CreatedAt      time.Time          `json:"created_at" bson:"created_at"`
+	LastReceivedAt *time.Time         `json:"last_received_at,omitempty" bson:"last_received_at,omitempty"`
+}
@@ -0,0 +1,25 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// notification kinds
+const (
+	NotificationAssigned = "assigned"
+)
+
+// Notification - something that happened to a user, listed until they read it
+type Notification struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id"`
+	UserID      primitive.ObjectID `json:"user_id" bson:"user_id"` // Recipient
+	WorkspaceID primitive.ObjectID `json:"workspace_id" bson:"workspace_id"`
+	Kind        string             `json:"kind" bson:"kind"` // One of the Notification* constants
+	TaskID      primitive.ObjectID `json:"task_id" bson:"task_id"`
+	Actor       string             `json:"actor" bson:"actor"` // Username of whoever caused it
+	Message     string             `json:"message" bson:"message"`
+	Read        bool               `json:"read" bson:"read"`
+	CreatedAt   time.Time          `json:"created_at" bson:"created_at"`
+}
@@ -0,0 +1,18 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// OutboxEntry - a domain event, stored in the transaction of the change it describes and relayed to the domain
+// event stream afterwards
+type OutboxEntry struct {
+	ID          primitive.ObjectID `bson:"_id"` // Orders the entries
+	Type        string             `bson:"type"`
+	Data        string             `bson:"data"` // The JSON of the event
+	CreatedAt   time.Time          `bson:"created_at"`
+	PublishedAt *time.Time         `bson:"published_at,omitempty"`
+	StreamID    string             `bson:"stream_id,omitempty"` // ID of the stream entry it was published as
+}
@@ -0,0 +1,47 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// pomodoro session phases
+const (
+	PomodoroWork       = "work"
+	PomodoroShortBreak = "short_break"
+	PomodoroLongBreak  = "long_break"
+	PomodoroIdle       = "idle" // After a break, until the next work phase is started
+)
+
+// Pomodoro - a finished work phase of a pomodoro session, interrupted when it was stopped early
+type Pomodoro struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id"`
+	TaskID      primitive.ObjectID `json:"task_id" bson:"task_id"`
+	UserID      primitive.ObjectID `json:"user_id" bson:"user_id"`
+	WorkspaceID primitive.ObjectID `json:"workspace_id" bson:"workspace_id"`
+	Start       time.Time          `json:"start" bson:"start"`
+	End         time.Time          `json:"end" bson:"end"`
+	Minutes     int                `json:"minutes" bson:"minutes"` // Planned length of the work phase
+	Completed   bool               `json:"completed" bson:"completed"`
+	CreatedAt   time.Time          `json:"created_at" bson:"created_at"`
+}
+
+// PomodoroSettings - phase lengths in minutes, a long break replaces every LongBreakEvery-th short break
+type PomodoroSettings struct {
+	Work           int `json:"work_minutes"`
+	ShortBreak     int `json:"break_minutes"`
+	LongBreak      int `json:"long_break_minutes"`
+	LongBreakEvery int `json:"long_break_every"`
+}
+
+// PomodoroSession - the pomodoro session of a user, kept in Redis so it survives reloads
+type PomodoroSession struct {
+	TaskID         primitive.ObjectID `json:"task_id"`
+	WorkspaceID    primitive.ObjectID `json:"workspace_id"`
+	Settings       PomodoroSettings   `json:"settings"`
+	Phase          string             `json:"phase"`     // One of the Pomodoro* phase constants
+	Completed      int                `json:"completed"` // Work phases completed in this session
+	PhaseStartedAt time.Time          `json:"phase_started_at"`
+	PhaseEndsAt    *time.Time         `json:"phase_ends_at,omitempty"` // Unset while idle
+}
@@ -0,0 +1,31 @@
+package model
+
+// task priorities, from lowest to highest
+const (
+	PriorityNone   = "none"
+	PriorityLow    = "low"
+	PriorityMedium = "medium"
+	PriorityHigh   = "high"
+	PriorityUrgent = "urgent"
+)
+
+var priorities = []string{PriorityNone, PriorityLow, PriorityMedium, PriorityHigh, PriorityUrgent}
+
+// ValidPriority - reports whether p is one of the known priorities
+func ValidPriority(p string) bool {
+	return PriorityWeight(p) >= 0
+}
+
+// PriorityWeight - returns the rank of the priority (0 for none, higher is more pressing), -1 if unknown.
+// An empty priority counts as none, for tasks stored before priorities existed.
+func PriorityWeight(p string) int {
+	if p == "" {
+		return 0
+	}
+	for i, priority := range priorities {
+		if priority == p {
+			return i
+		}
+	}
+	return -1
+}
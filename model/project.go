@@ -0,0 +1,113 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// status categories, every status column maps to one of them
+const (
+	StatusCategoryOpen   = "open"
+	StatusCategoryClosed = "closed"
+)
+
+type Project struct {
+	ID            primitive.ObjectID `json:"id" bson:"_id"`
+	UserID        primitive.ObjectID `json:"user_id" bson:"user_id"`
+	WorkspaceID   primitive.ObjectID `json:"workspace_id" bson:"workspace_id,omitempty"`
+	Name          string             `json:"name" bson:"name"`
+	Statuses      []StatusColumn     `json:"statuses" bson:"statuses"`                               // Kanban columns, in board order
+	Collaborators []Collaborator     `json:"collaborators,omitempty" bson:"collaborators,omitempty"` // Users the project, and so all its tasks, is shared with
+	CreatedAt     time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt     time.Time          `json:"updated_at" bson:"updated_at"`
+}
+
+type StatusColumn struct {
+	Key      string `json:"key" bson:"key"`                                 // e.g. "in_progress", stored on Task.Status
+	Name     string `json:"name" bson:"name"`                               // Display name, e.g. "In progress"
+	Category string `json:"category" bson:"category"`                       // StatusCategoryOpen or StatusCategoryClosed
+	WIPLimit int    `json:"wip_limit,omitempty" bson:"wip_limit,omitempty"` // Max tasks in the column, 0 means unlimited
+}
+
+// DefaultStatuses - the workflow used by tasks outside of a project and by projects without custom columns
+func DefaultStatuses() []StatusColumn {
+	return []StatusColumn{
+		{Key: "backlog", Name: "Backlog", Category: StatusCategoryOpen},
+		{Key: "in_progress", Name: "In progress", Category: StatusCategoryOpen},
+		{Key: "review", Name: "Review", Category: StatusCategoryOpen},
+		{Key: "done", Name: "Done", Category: StatusCategoryClosed},
+	}
+}
+
+// Workflow - returns the status columns of the project, falling back to the defaults
+func (p *Project) Workflow() []StatusColumn {
+	if p == nil || len(p.Statuses) == 0 {
+		return DefaultStatuses()
+	}
+	return p.Statuses
+}
+
+// FindStatus - looks up a column by key
+func FindStatus(columns []StatusColumn, key string) (StatusColumn, bool) {
+	for _, column := range columns {
+		if column.Key == key {
+			return column, true
+		}
+	}
+	return StatusColumn{}, false
+}
+
+// FirstStatus - returns the first column of the given category
+func FirstStatus(columns []StatusColumn, category string) StatusColumn {
+	for _, column := range columns {
+		if column.Category == category {
+			return column
+		}
+	}
+	return StatusColumn{}
+}
+
+// LegacyStatus - derives a status for tasks stored before statuses existed, from the Done flag
+func LegacyStatus(done bool) string {
+	if done {
+		return FirstStatus(DefaultStatuses(), StatusCategoryClosed).Key
+	}
+	return FirstStatus(DefaultStatuses(), StatusCategoryOpen).Key
+}
+
+// ValidateStatuses - checks that the columns have unique keys, known categories and at least one open and one closed column
+func ValidateStatuses(columns []StatusColumn) error {
+	seen := make(map[string]bool, len(columns))
+	hasOpen, hasClosed := false, false
+
+	for _, column := range columns {
+		if column.Key == "" {
+			return errors.New("status key is required")
+		}
+		if seen[column.Key] {
+			return fmt.Errorf("duplicate status key %q", column.Key)
+		}
+		seen[column.Key] = true
+
+		switch column.Category {
+		case StatusCategoryOpen:
+			hasOpen = true
+		case StatusCategoryClosed:
+			hasClosed = true
+		default:
+			return fmt.Errorf("status %q has unknown category %q", column.Key, column.Category)
+		}
+
+		if column.WIPLimit < 0 {
+			return fmt.Errorf("status %q has a negative wip limit", column.Key)
+		}
+	}
+
+	if !hasOpen || !hasClosed {
+		return errors.New("at least one open and one closed status is required")
+	}
+	return nil
+}
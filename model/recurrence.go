@@ -0,0 +1,115 @@
+package model
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// recurrence frequencies
+const (
+	RecurrenceDaily   = "daily"
+	RecurrenceWeekly  = "weekly"
+	RecurrenceMonthly = "monthly"
+	RecurrenceYearly  = "yearly"
+)
+
+// weekdayCodes - RFC 5545 weekday codes, indexed by time.Weekday
+var weekdayCodes = []string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+// Recurrence - how a task repeats, modelled on the RRULE of RFC 5545
+type Recurrence struct {
+	Frequency string   `json:"frequency" bson:"frequency"`                     // One of the Recurrence* constants
+	Interval  int      `json:"interval" bson:"interval"`                       // Every Interval days/weeks/..., 0 counts as 1
+	Weekdays  []string `json:"weekdays,omitempty" bson:"weekdays,omitempty"`   // Weekly only, "MO" to "SU"
+	MonthDay  int      `json:"month_day,omitempty" bson:"month_day,omitempty"` // Monthly only, 1 to 31
+}
+
+// WeekdayCode - the RFC 5545 code of a weekday
+func WeekdayCode(day time.Weekday) string {
+	return weekdayCodes[day]
+}
+
+// ValidRecurrence - reports whether the rule can be used for a task
+func ValidRecurrence(r Recurrence) bool {
+	switch r.Frequency {
+	case RecurrenceDaily, RecurrenceYearly:
+		if len(r.Weekdays) > 0 || r.MonthDay != 0 {
+			return false
+		}
+	case RecurrenceWeekly:
+		if r.MonthDay != 0 {
+			return false
+		}
+		for _, code := range r.Weekdays {
+			found := false
+			for _, known := range weekdayCodes {
+				found = found || code == known
+			}
+			if !found {
+				return false
+			}
+		}
+	case RecurrenceMonthly:
+		if len(r.Weekdays) > 0 || r.MonthDay < 0 || r.MonthDay > 31 {
+			return false
+		}
+	default:
+		return false
+	}
+	return r.Interval >= 0
+}
+
+// RRule - the rule as the value of an RFC 5545 RRULE property, e.g. "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH"
+func (r Recurrence) RRule() string {
+	parts := []string{"FREQ=" + strings.ToUpper(r.Frequency)}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if len(r.Weekdays) > 0 {
+		parts = append(parts, "BYDAY="+strings.Join(r.Weekdays, ","))
+	}
+	if r.MonthDay > 0 {
+		parts = append(parts, "BYMONTHDAY="+strconv.Itoa(r.MonthDay))
+	}
+	return strings.Join(parts, ";")
+}
+
+// ParseRRule - reads the value of an RRULE property. Rules using parts the model can't represent (COUNT, UNTIL,
+// BYSETPOS, numbered weekdays, ...) are refused rather than changed into different ones.
+func ParseRRule(value string) (Recurrence, error) {
+	var r Recurrence
+	for _, part := range strings.Split(value, ";") {
+		name, val, _ := strings.Cut(part, "=")
+		switch strings.ToUpper(name) {
+		case "FREQ":
+			r.Frequency = strings.ToLower(val)
+		case "INTERVAL":
+			interval, err := strconv.Atoi(val)
+			if err != nil || interval < 1 {
+				return r, fmt.Errorf("invalid INTERVAL: %q", val)
+			}
+			r.Interval = interval
+		case "BYDAY":
+			r.Weekdays = strings.Split(strings.ToUpper(val), ",")
+		case "BYMONTHDAY":
+			day, err := strconv.Atoi(val)
+			if err != nil || day < 1 {
+				return r, fmt.Errorf("unsupported BYMONTHDAY: %q", val)
+			}
+			r.MonthDay = day
+		case "WKST", "":
+		default:
+			return r, fmt.Errorf("unsupported RRULE part: %s", name)
+		}
+	}
+
+	if r.Interval == 1 {
+		r.Interval = 0
+	}
+	if !ValidRecurrence(r) {
+		return r, fmt.Errorf("unsupported RRULE: %s", value)
+	}
+	return r, nil
+}
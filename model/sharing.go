@@ -0,0 +1,54 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// collaborator roles, RoleOwner is never stored but reported for the owner of a resource
+const (
+	RoleOwner  = "owner"
+	RoleViewer = "viewer"
+	RoleEditor = "editor"
+)
+
+// invitation states
+const (
+	InvitationPending  = "pending"
+	InvitationAccepted = "accepted"
+	InvitationDeclined = "declined"
+)
+
+// kinds of shared resources
+const (
+	ShareTask    = "task"
+	ShareProject = "project"
+)
+
+type Collaborator struct {
+	UserID   primitive.ObjectID `json:"user_id" bson:"user_id"`
+	Username string             `json:"username" bson:"username"`
+	Role     string             `json:"role" bson:"role"` // RoleViewer or RoleEditor
+}
+
+type Invitation struct {
+	ID           primitive.ObjectID `json:"id" bson:"_id"`
+	Kind         string             `json:"kind" bson:"kind"` // ShareTask or ShareProject
+	ResourceID   primitive.ObjectID `json:"resource_id" bson:"resource_id"`
+	ResourceName string             `json:"resource_name" bson:"resource_name"` // Task title or project name, for display
+	WorkspaceID  primitive.ObjectID `json:"workspace_id" bson:"workspace_id"`
+	InviterID    primitive.ObjectID `json:"inviter_id" bson:"inviter_id"`
+	Inviter      string             `json:"inviter" bson:"inviter"`
+	InviteeID    primitive.ObjectID `json:"invitee_id" bson:"invitee_id"`
+	Invitee      string             `json:"invitee" bson:"invitee"`
+	Role         string             `json:"role" bson:"role"`
+	Status       string             `json:"status" bson:"status"`
+	CreatedAt    time.Time          `json:"created_at" bson:"created_at"`
+	RespondedAt  *time.Time         `json:"responded_at,omitempty" bson:"responded_at,omitempty"`
+}
+
+// ValidRole - reports whether role is a known collaborator role
+func ValidRole(role string) bool {
+	return role == RoleViewer || role == RoleEditor
+}
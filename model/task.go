@@ -18,13 +18,53 @@ type User struct {
 }
 
 type Task struct {
-	ID        primitive.ObjectID `json:"id" bson:"_id"`
-	UserID    primitive.ObjectID `json:"user_id" bson:"user_id"`
-	Title     string             `json:"title" bson:"title"`
-	Comment   string             `json:"comment" bson:"comment"`
-	Done      bool               `json:"done" bson:"done"`
-	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
-	UpdatedAt time.Time          `json:"updated_at" bson:"updated_at"`
+	ID            primitive.ObjectID   `json:"id" bson:"_id"`
+	ExternalID    string               `json:"external_id,omitempty" bson:"external_id,omitempty"` // ID in the system the task was imported from
+	UserID        primitive.ObjectID   `json:"user_id" bson:"user_id"`
+	WorkspaceID   primitive.ObjectID   `json:"workspace_id" bson:"workspace_id,omitempty"`
+	Title         string               `json:"title" bson:"title"`
+	Comment       string               `json:"comment" bson:"comment"`
+	Done          bool                 `json:"done" bson:"done"` // Kept in sync with the category of Status
+	ProjectID     *primitive.ObjectID  `json:"project_id,omitempty" bson:"project_id,omitempty"`
+	ParentID      *primitive.ObjectID  `json:"parent_id,omitempty" bson:"parent_id,omitempty"` // Set on subtasks
+	Status        string               `json:"status" bson:"status,omitempty"`                 // Key of a StatusColumn in the project's workflow
+	Rank          string               `json:"rank,omitempty" bson:"rank,omitempty"`           // Fractional index for manual ordering, see package rank
+	Priority      string               `json:"priority" bson:"priority,omitempty"`             // One of the Priority* constants
+	Important     bool                 `json:"important" bson:"important"`
+	DueDate       *time.Time           `json:"due_date,omitempty" bson:"due_date,omitempty"`
+	Recurrence    *Recurrence          `json:"recurrence,omitempty" bson:"recurrence,omitempty"`
+	Labels        []string             `json:"labels,omitempty" bson:"labels,omitempty"`
+	Checklist     []ChecklistItem      `json:"checklist,omitempty" bson:"checklist,omitempty"`
+	Estimate      int                  `json:"estimate_minutes,omitempty" bson:"estimate_minutes,omitempty"` // Expected effort
+	TrackedTime   int64                `json:"tracked_seconds" bson:"tracked_seconds"`                       // Sum of the task's time entries
+	Pomodoros     int                  `json:"pomodoros" bson:"pomodoros"`                                   // Number of completed pomodoros
+	CommentCount  int                  `json:"comment_count" bson:"comment_count"`                           // Number of entries in the comments collection
+	Collaborators []Collaborator       `json:"collaborators,omitempty" bson:"collaborators,omitempty"`       // Users the task is shared with
+	Assignees     []Assignee           `json:"assignees,omitempty" bson:"assignees,omitempty"`               // Workspace members working on the task
+	BlockedBy     []primitive.ObjectID `json:"blocked_by,omitempty" bson:"blocked_by,omitempty"`             // Tasks that must be done before this one
+	CalDAV        *CalDAVResource      `json:"caldav,omitempty" bson:"caldav,omitempty"`                     // Set on tasks created by CalDAV clients
+	Blocked       bool                 `json:"blocked" bson:"-"`                                             // Computed: true while any blocker is still open
+	CreatedAt     time.Time            `json:"created_at" bson:"created_at"`
+	UpdatedAt     time.Time            `json:"updated_at" bson:"updated_at"`
+	DeletedAt     *time.Time           `json:"deleted_at,omitempty" bson:"deleted_at,omitempty"` // Set while the task is in the trash
+}
+
+type ChecklistItem struct {
+	ID   primitive.ObjectID `json:"id" bson:"_id"`
+	Text string             `json:"text" bson:"text"`
+	Done bool               `json:"done" bson:"done"`
+}
+
+// CalDAVResource - the names a CalDAV client gave a task it created, tasks created otherwise use their ID
+type CalDAVResource struct {
+	UID  string `json:"uid" bson:"uid"`   // UID of the VTODO
+	Name string `json:"name" bson:"name"` // Last segment of the resource's URL
+}
+
+type Assignee struct {
+	UserID     primitive.ObjectID `json:"user_id" bson:"user_id"`
+	Username   string             `json:"username" bson:"username"`
+	AssignedAt time.Time          `json:"assigned_at" bson:"assigned_at"`
 }
 
 type OAuthProvider struct {
@@ -0,0 +1,33 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Template - a reusable tree of tasks, shared with the members of its workspace.
+// Texts may contain {{variable}} placeholders which are filled in when the template is instantiated.
+type Template struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id"`
+	UserID      primitive.ObjectID `json:"user_id" bson:"user_id"` // Creator, the only one who can change the template
+	WorkspaceID primitive.ObjectID `json:"workspace_id" bson:"workspace_id,omitempty"`
+	Name        string             `json:"name" bson:"name"`
+	Description string             `json:"description,omitempty" bson:"description,omitempty"`
+	Tasks       []TemplateTask     `json:"tasks" bson:"tasks"`
+	Variables   []string           `json:"variables" bson:"-"` // Computed: placeholders used by the tasks
+	CreatedAt   time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt   time.Time          `json:"updated_at" bson:"updated_at"`
+}
+
+type TemplateTask struct {
+	Title     string         `json:"title" bson:"title"`
+	Comment   string         `json:"comment,omitempty" bson:"comment,omitempty"`
+	Priority  string         `json:"priority,omitempty" bson:"priority,omitempty"`
+	Important bool           `json:"important,omitempty" bson:"important,omitempty"`
+	DueOffset *int           `json:"due_offset_days,omitempty" bson:"due_offset_days,omitempty"` // Days after the start date of the instance
+	Estimate  int            `json:"estimate_minutes,omitempty" bson:"estimate_minutes,omitempty"`
+	Labels    []string       `json:"labels,omitempty" bson:"labels,omitempty"`
+	Checklist []string       `json:"checklist,omitempty" bson:"checklist,omitempty"`
+	Subtasks  []TemplateTask `json:"subtasks,omitempty" bson:"subtasks,omitempty"`
+}
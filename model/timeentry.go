@@ -0,0 +1,30 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TimeEntry - time a user spent on a task, from a stopped timer or entered by hand
+type TimeEntry struct {
+	ID          primitive.ObjectID  `json:"id" bson:"_id"`
+	TaskID      primitive.ObjectID  `json:"task_id" bson:"task_id"`
+	UserID      primitive.ObjectID  `json:"user_id" bson:"user_id"`
+	Username    string              `json:"username" bson:"username"`
+	WorkspaceID primitive.ObjectID  `json:"workspace_id" bson:"workspace_id"`
+	ProjectID   *primitive.ObjectID `json:"project_id,omitempty" bson:"project_id,omitempty"` // Project of the task when the time was logged
+	Start       time.Time           `json:"start" bson:"start"`
+	End         time.Time           `json:"end" bson:"end"`
+	Duration    int64               `json:"duration_seconds" bson:"duration_seconds"`
+	Note        string              `json:"note,omitempty" bson:"note,omitempty"`
+	Manual      bool                `json:"manual" bson:"manual"`
+	CreatedAt   time.Time           `json:"created_at" bson:"created_at"`
+}
+
+// Timer - the running timer of a user, kept in Redis until it is stopped
+type Timer struct {
+	TaskID      primitive.ObjectID `json:"task_id"`
+	WorkspaceID primitive.ObjectID `json:"workspace_id"`
+	StartedAt   time.Time          `json:"started_at"`
+}
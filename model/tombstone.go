@@ -0,0 +1,19 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Tombstone - what is left of a task deleted for good, so clients syncing since before that learn it is gone.
+// Keeps the fields deciding who could see the task, under the same names as on the task.
+type Tombstone struct {
+	ID            primitive.ObjectID  `json:"id" bson:"_id"` // ID of the task
+	UserID        primitive.ObjectID  `json:"user_id" bson:"user_id"`
+	WorkspaceID   primitive.ObjectID  `json:"workspace_id" bson:"workspace_id,omitempty"`
+	ProjectID     *primitive.ObjectID `json:"project_id,omitempty" bson:"project_id,omitempty"`
+	Collaborators []Collaborator      `json:"collaborators,omitempty" bson:"collaborators,omitempty"`
+	Assignees     []Assignee          `json:"assignees,omitempty" bson:"assignees,omitempty"`
+	DeletedAt     time.Time           `json:"deleted_at" bson:"deleted_at"`
+}
@@ -0,0 +1,63 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// webhook delivery states
+const (
+	DeliveryPending   = "pending" // Waiting for its first attempt or a retry
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed" // Given up, or dropped because the webhook was disabled or deleted
+)
+
+// Webhook - a user's subscription to the task events of a workspace, POSTed as JSON to URL and signed with Secret
+type Webhook struct {
+	ID             primitive.ObjectID `json:"id" bson:"_id"`
+	UserID         primitive.ObjectID `json:"user_id" bson:"user_id"`
+	WorkspaceID    primitive.ObjectID `json:"workspace_id" bson:"workspace_id"`
+	URL            string             `json:"url" bson:"url"`
+	Secret         string             `json:"-" bson:"secret"`      // Shown once, when the webhook is created
+	Events         []string           `json:"events" bson:"events"` // Event types to send, all of them when empty
+	Active         bool               `json:"active" bson:"active"`
+	Failures       int                `json:"failures" bson:"failures"` // Failed attempts in a row
+	DisabledReason string             `json:"disabled_reason,omitempty" bson:"disabled_reason,omitempty"`
+	CreatedAt      time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt      time.Time          `json:"updated_at" bson:"updated_at"`
+}
+
+// Subscribed - reports whether the webhook sends the event type
+func (webhook Webhook) Subscribed(eventType string) bool {
+	if len(webhook.Events) == 0 {
+		return true
+	}
+	for _, event := range webhook.Events {
+		if event == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookDelivery - one event sent to a webhook, with every attempt made to send it
+type WebhookDelivery struct {
+	ID            primitive.ObjectID  `json:"id" bson:"_id"`
+	WebhookID     primitive.ObjectID  `json:"webhook_id" bson:"webhook_id"`
+	ChangeID      *primitive.ObjectID `json:"change_id,omitempty" bson:"change_id,omitempty"` // Of the task change the event reports
+	UserID        primitive.ObjectID  `json:"user_id" bson:"user_id"`
+	Event         string              `json:"event" bson:"event"`
+	Payload       string              `json:"payload" bson:"payload"` // The JSON body, the same for every attempt
+	Status        string              `json:"status" bson:"status"`   // One of the Delivery* states
+	Attempts      []DeliveryAttempt   `json:"attempts" bson:"attempts"`
+	NextAttemptAt *time.Time          `json:"next_attempt_at,omitempty" bson:"next_attempt_at,omitempty"`
+	CreatedAt     time.Time           `json:"created_at" bson:"created_at"`
+}
+
+type DeliveryAttempt struct {
+	At         time.Time `json:"at" bson:"at"`
+	StatusCode int       `json:"status_code,omitempty" bson:"status_code,omitempty"` // Of the response, 0 without one
+	Error      string    `json:"error,omitempty" bson:"error,omitempty"`
+	DurationMS int64     `json:"duration_ms" bson:"duration_ms"`
+}
@@ -0,0 +1,65 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// workspace member roles
+const (
+	WorkspaceRoleOwner  = "owner"
+	WorkspaceRoleAdmin  = "admin"
+	WorkspaceRoleMember = "member"
+)
+
+type Workspace struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id"`
+	Name      string             `json:"name" bson:"name"`
+	OwnerID   primitive.ObjectID `json:"owner_id" bson:"owner_id"`
+	Personal  bool               `json:"personal" bson:"personal"` // Created for every user on first use, can't have other members
+	Members   []WorkspaceMember  `json:"members" bson:"members"`
+	Quota     WorkspaceQuota     `json:"quota" bson:"quota"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt time.Time          `json:"updated_at" bson:"updated_at"`
+}
+
+type WorkspaceMember struct {
+	UserID   primitive.ObjectID `json:"user_id" bson:"user_id"`
+	Username string             `json:"username" bson:"username"`
+	Role     string             `json:"role" bson:"role"` // WorkspaceRoleOwner, WorkspaceRoleAdmin or WorkspaceRoleMember
+	JoinedAt time.Time          `json:"joined_at" bson:"joined_at"`
+}
+
+// WorkspaceQuota - usage limits of a workspace, 0 means unlimited
+type WorkspaceQuota struct {
+	MaxTasks    int `json:"max_tasks" bson:"max_tasks"` // Tasks in the trash count too
+	MaxProjects int `json:"max_projects" bson:"max_projects"`
+	MaxMembers  int `json:"max_members" bson:"max_members"`
+}
+
+// Limit - returns the quota for documents of the named collection, 0 when it isn't limited
+func (q WorkspaceQuota) Limit(collection string) int {
+	switch collection {
+	case "tasks":
+		return q.MaxTasks
+	case "projects":
+		return q.MaxProjects
+	}
+	return 0
+}
+
+// Member - looks up the membership of a user
+func (w Workspace) Member(userID primitive.ObjectID) (WorkspaceMember, bool) {
+	for _, member := range w.Members {
+		if member.UserID == userID {
+			return member, true
+		}
+	}
+	return WorkspaceMember{}, false
+}
+
+// ValidWorkspaceRole - reports whether role can be given to a member, there is only one owner
+func ValidWorkspaceRole(role string) bool {
+	return role == WorkspaceRoleAdmin || role == WorkspaceRoleMember
+}
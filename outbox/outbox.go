@@ -0,0 +1,251 @@
+// Package outbox makes domain events as reliable as the changes they describe. Add stores events in the outbox
+// collection, within the transaction Transact runs a change in, so either both are stored or neither. Relay
+// then publishes the stored events to the domain event stream, in the order they were added, and marks them
+// published.
+//
+// Transactions need MongoDB to run as a replica set or a sharded cluster. On a standalone server Transact runs
+// the change without one, the outbox is then written right after the change.
+package outbox
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/utpal74/track-my-tasks-backend/domain"
+	"github.com/utpal74/track-my-tasks-backend/logger"
+	"github.com/utpal74/track-my-tasks-backend/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+const (
+	// Retention - how long published entries are kept
+	Retention = 24 * time.Hour
+
+	relayInterval = 500 * time.Millisecond
+	relayBatch    = 100
+	lockKey       = "outbox:relay"
+	lockTTL       = 30 * time.Second
+)
+
+// Outbox - the outbox collection
+type Outbox struct {
+	coll         *mongo.Collection
+	transactions bool
+}
+
+// New - the outbox stored in coll, finds out whether the deployment supports transactions
+func New(ctx context.Context, coll *mongo.Collection) (*Outbox, error) {
+	var hello bson.M
+	if err := coll.Database().RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello); err != nil {
+		return nil, err
+	}
+	_, replicaSet := hello["setName"]
+	transactions := replicaSet || hello["msg"] == "isdbgrid"
+	if !transactions {
+		logger.FromCtx(ctx).Warn("MongoDB runs standalone, domain events are stored without transactions")
+	}
+
+	_, err := coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "published_at", Value: 1}, {Key: "_id", Value: 1}},
+		Options: options.Index().SetName("published_at_id"),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Outbox{coll: coll, transactions: transactions}, nil
+}
+
+// Transact - runs fn in a transaction, fn gets the context of the transaction to pass to every write which is
+// part of it. fn runs again when the transaction has to be retried, so it must not have other effects; its
+// error aborts the transaction and is returned as is.
+func (outbox *Outbox) Transact(ctx context.Context, fn func(ctx context.Context) error) error {
+	if !outbox.transactions {
+		return fn(ctx)
+	}
+
+	session, err := outbox.coll.Database().Client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sessionCtx mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sessionCtx)
+	})
+	return err
+}
+
+// Transactional - whether Transact runs changes in transactions, rather than one write after the other
+func (outbox *Outbox) Transactional() bool {
+	return outbox.transactions
+}
+
+// Add - stores the events, with the context of a transaction they are stored when it commits
+func (outbox *Outbox) Add(ctx context.Context, events ...domain.Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	entries := make([]interface{}, 0, len(events))
+	for _, event := range events {
+		data, err := domain.Encode(event)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, model.OutboxEntry{
+			ID:        primitive.NewObjectID(),
+			Type:      event.EventType(),
+			Data:      string(data),
+			CreatedAt: now,
+		})
+	}
+
+	_, err := outbox.coll.InsertMany(ctx, entries)
+	return err
+}
+
+// Relay - publishes the entries until ctx is done. Every instance runs it, a Redis lock lets one of them relay
+// at a time; each entry is published together with a check that the lock is still held, so an instance which
+// stalled past lockTTL can't publish after another took over. Entries are published one after the other and
+// marked right after; the only entry which can have been published without being marked, because the relay
+// stopped in between, is the last one in the stream, so that is checked before publishing more and no entry is
+// published twice.
+func (outbox *Outbox) Relay(ctx context.Context, redisClient *redis.Client) {
+	log := logger.FromCtx(ctx)
+	instance := domain.Consumer()
+	ticker := time.NewTicker(relayInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for {
+			locked, err := lock(ctx, redisClient, instance)
+			if err != nil {
+				log.Error("unable to take the outbox relay lock", zap.Error(err))
+			}
+			if !locked {
+				break
+			}
+
+			published, err := outbox.relayBatch(ctx, redisClient, instance)
+			if err != nil && ctx.Err() == nil {
+				log.Error("unable to relay the outbox", zap.Error(err))
+			}
+			if err != nil || published < relayBatch {
+				break
+			}
+		}
+	}
+}
+
+// lockScript - takes the lock or extends it when the instance holds it. KEYS[1] the lock, ARGV instance, TTL.
+var lockScript = redis.NewScript(`
+local holder = redis.call('GET', KEYS[1])
+if holder == false then
+	redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+	return 1
+end
+if holder == ARGV[1] then
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+	return 1
+end
+return 0
+`)
+
+func lock(ctx context.Context, redisClient *redis.Client, instance string) (bool, error) {
+	locked, err := lockScript.Run(ctx, redisClient, []string{lockKey}, instance, lockTTL.Milliseconds()).Int()
+	return locked == 1, err
+}
+
+// publishScript - adds an entry to the stream while the instance holds the lock, extending it, and returns its
+// stream ID; returns nil when the lock was lost. KEYS[1] the lock, KEYS[2] the stream, ARGV instance, TTL, stream
+// length, then the fields and values of the entry.
+var publishScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) ~= ARGV[1] then
+	return false
+end
+redis.call('PEXPIRE', KEYS[1], ARGV[2])
+return redis.call('XADD', KEYS[2], 'MAXLEN', '~', ARGV[3], '*', unpack(ARGV, 4))
+`)
+
+// errLockLost - the relay lock expired while publishing, another instance may hold it now
+var errLockLost = errors.New("outbox: the relay lock was lost")
+
+// relayBatch - publishes up to relayBatch entries, returns how many
+func (outbox *Outbox) relayBatch(ctx context.Context, redisClient *redis.Client, instance string) (int, error) {
+	if err := outbox.reconcile(ctx, redisClient); err != nil {
+		return 0, err
+	}
+
+	cur, err := outbox.coll.Find(ctx,
+		bson.M{"published_at": bson.M{"$exists": false}},
+		options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetLimit(relayBatch),
+	)
+	if err != nil {
+		return 0, err
+	}
+	var entries []model.OutboxEntry
+	if err := cur.All(ctx, &entries); err != nil {
+		return 0, err
+	}
+
+	for i, entry := range entries {
+		streamID, err := publishScript.Run(ctx, redisClient, []string{lockKey, domain.Stream},
+			instance, lockTTL.Milliseconds(), domain.StreamLength,
+			domain.FieldType, entry.Type,
+			domain.FieldData, entry.Data,
+			domain.FieldOutboxID, entry.ID.Hex(),
+		).Text()
+		if errors.Is(err, redis.Nil) {
+			return i, errLockLost
+		} else if err != nil {
+			return i, err
+		}
+		if err := outbox.markPublished(ctx, entry.ID, streamID); err != nil {
+			return i, err
+		}
+	}
+	return len(entries), nil
+}
+
+// reconcile - marks the entry of the last stream entry published, in case the relay stopped before it did
+func (outbox *Outbox) reconcile(ctx context.Context, redisClient *redis.Client) error {
+	messages, err := redisClient.XRevRangeN(ctx, domain.Stream, "+", "-", 1).Result()
+	if err != nil || len(messages) == 0 {
+		return err
+	}
+
+	hex, _ := messages[0].Values[domain.FieldOutboxID].(string)
+	entryID, err := primitive.ObjectIDFromHex(hex)
+	if err != nil {
+		return nil
+	}
+	return outbox.markPublished(ctx, entryID, messages[0].ID)
+}
+
+func (outbox *Outbox) markPublished(ctx context.Context, entryID primitive.ObjectID, streamID string) error {
+	_, err := outbox.coll.UpdateOne(ctx,
+		bson.M{"_id": entryID, "published_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"published_at": time.Now(), "stream_id": streamID}},
+	)
+	return err
+}
+
+// Prune - deletes the entries published longer than Retention ago
+func (outbox *Outbox) Prune(ctx context.Context) error {
+	_, err := outbox.coll.DeleteMany(ctx, bson.M{"published_at": bson.M{"$lt": time.Now().Add(-Retention)}})
+	return err
+}
@@ -0,0 +1,187 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/utpal74/track-my-tasks-backend/domain"
+	"github.com/utpal74/track-my-tasks-backend/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestAdd(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	base := domain.TaskEvent{ChangeID: primitive.NewObjectID(), TaskID: primitive.NewObjectID(), Action: model.TaskActionUpdated}
+
+	tests := []struct {
+		name   string
+		events []domain.Event
+	}{
+		{name: "no events"},
+		{name: "one event", events: []domain.Event{domain.TaskCreated{TaskEvent: base}}},
+		{name: "events of one change", events: domain.FromChange(base, nil)},
+		{name: "completed", events: []domain.Event{domain.TaskUpdated{TaskEvent: base}, domain.TaskCompleted{TaskEvent: base}}},
+	}
+
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			outbox := &Outbox{coll: mt.Coll}
+			mt.AddMockResponses(mtest.CreateSuccessResponse())
+			if err := outbox.Add(context.Background(), tt.events...); err != nil {
+				mt.Fatal(err)
+			}
+
+			started := mt.GetAllStartedEvents()
+			if len(tt.events) == 0 {
+				if len(started) != 0 {
+					mt.Errorf("Add() sent %d commands without events", len(started))
+				}
+				return
+			}
+			if len(started) != 1 || started[0].CommandName != "insert" {
+				mt.Fatalf("Add() sent %d commands, want one insert", len(started))
+			}
+
+			docs, _ := started[0].Command.Lookup("documents").Array().Values()
+			if len(docs) != len(tt.events) {
+				mt.Fatalf("Add() inserted %d entries, want %d", len(docs), len(tt.events))
+			}
+			for i, doc := range docs {
+				var entry model.OutboxEntry
+				if err := bson.Unmarshal(doc.Document(), &entry); err != nil {
+					mt.Fatal(err)
+				}
+				if entry.Type != tt.events[i].EventType() || entry.PublishedAt != nil {
+					mt.Errorf("entry %d = %s published %v, want %s unpublished", i, entry.Type, entry.PublishedAt, tt.events[i].EventType())
+				}
+				event, err := domain.Decode(entry.Type, []byte(entry.Data))
+				if err != nil {
+					mt.Fatal(err)
+				}
+				if got, _ := domain.TaskOf(event); got.ChangeID != base.ChangeID {
+					mt.Errorf("entry %d is of change %s, want %s", i, got.ChangeID.Hex(), base.ChangeID.Hex())
+				}
+			}
+		})
+	}
+}
+
+func TestTransactWithoutTransactions(t *testing.T) {
+	outbox := &Outbox{}
+	if outbox.Transactional() {
+		t.Fatal("Transactional() = true")
+	}
+
+	errFailed := errors.New("failed")
+	calls := 0
+	err := outbox.Transact(context.Background(), func(ctx context.Context) error {
+		calls++
+		return errFailed
+	})
+	if calls != 1 || !errors.Is(err, errFailed) {
+		t.Errorf("Transact() ran fn %d times, error = %v, want once and %v", calls, err, errFailed)
+	}
+}
+
+func TestRelayBatch(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	const instance = "relay-1"
+	entries := []model.OutboxEntry{
+		{ID: primitive.NewObjectID(), Type: domain.TypeTaskUpdated, Data: `{"task_id":"1"}`},
+		{ID: primitive.NewObjectID(), Type: domain.TypeTaskCompleted, Data: `{"task_id":"1"}`},
+	}
+	entryDocs := make([]bson.D, 0, len(entries))
+	for _, entry := range entries {
+		entryDocs = append(entryDocs, bson.D{{Key: "_id", Value: entry.ID}, {Key: "type", Value: entry.Type}, {Key: "data", Value: entry.Data}})
+	}
+	unpublished := mtest.CreateCursorResponse(0, "db.outbox", mtest.FirstBatch, entryDocs...)
+	updated := mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1})
+
+	tests := []struct {
+		name          string
+		holder        string // holds the lock, none when empty
+		published     string // outbox ID of an entry already in the stream
+		responses     []bson.D
+		wantErr       error
+		wantPublished int
+		wantMarked    int
+	}{
+		{
+			name:          "publishes in order and marks the entries",
+			holder:        instance,
+			responses:     []bson.D{unpublished, updated, updated},
+			wantPublished: 2,
+			wantMarked:    2,
+		},
+		{
+			name:          "marks the last entry in the stream first",
+			holder:        instance,
+			published:     primitive.NewObjectID().Hex(),
+			responses:     []bson.D{updated, unpublished, updated, updated},
+			wantPublished: 2,
+			wantMarked:    3,
+		},
+		{
+			name:      "stops when the lock was lost",
+			holder:    "relay-2",
+			responses: []bson.D{unpublished},
+			wantErr:   errLockLost,
+		},
+		{
+			name:      "stops without the lock",
+			responses: []bson.D{unpublished},
+			wantErr:   errLockLost,
+		},
+	}
+
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			server := miniredis.RunT(mt)
+			redisClient := redis.NewClient(&redis.Options{Addr: server.Addr()})
+			if tt.holder != "" {
+				server.Set(lockKey, tt.holder)
+			}
+			if tt.published != "" {
+				server.XAdd(domain.Stream, "*", []string{domain.FieldOutboxID, tt.published})
+			}
+			mt.AddMockResponses(tt.responses...)
+
+			outbox := &Outbox{coll: mt.Coll}
+			published, err := outbox.relayBatch(context.Background(), redisClient, instance)
+			if !errors.Is(err, tt.wantErr) || published != tt.wantPublished {
+				mt.Fatalf("relayBatch() = %d, %v, want %d, %v", published, err, tt.wantPublished, tt.wantErr)
+			}
+
+			stream, _ := redisClient.XRange(context.Background(), domain.Stream, "-", "+").Result()
+			var relayed []string
+			for _, message := range stream {
+				if entryType, ok := message.Values[domain.FieldType].(string); ok {
+					relayed = append(relayed, entryType)
+				}
+			}
+			if len(relayed) != tt.wantPublished {
+				mt.Fatalf("stream has %d entries, want %d", len(relayed), tt.wantPublished)
+			}
+			for i, entryType := range relayed {
+				if entryType != entries[i].Type {
+					mt.Errorf("stream entry %d = %s, want %s", i, entryType, entries[i].Type)
+				}
+			}
+
+			marked := 0
+			for _, event := range mt.GetAllStartedEvents() {
+				if event.CommandName == "update" {
+					marked++
+				}
+			}
+			if marked != tt.wantMarked {
+				mt.Errorf("relayBatch() marked %d entries, want %d", marked, tt.wantMarked)
+			}
+		})
+	}
+}
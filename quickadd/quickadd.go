@@ -0,0 +1,661 @@
+// Package quickadd parses one-line task descriptions such as
+//
+//	Pay rent every month on the 1st #finance !high tomorrow 9am
+//
+// into a title and the attributes written around it. Recognised words are removed from the title,
+// everything else is kept as written:
+//
+//   - #label adds a label, it has to start with a letter so "issue #12" stays in the title
+//   - !low, !medium, !high, !urgent (or !4 to !1) set the priority
+//   - dates: today, tomorrow, weekday names, next week/month/year, in N days/weeks/months/years,
+//     "mar 5", "5th march", 2026-03-05, optionally preceded by on, by or due
+//   - times: 9am, 9:30pm, 9 am, 21:00, noon, midnight, optionally preceded by at;
+//     in N minutes/hours sets both the date and the time
+//   - recurrence: daily, weekly, monthly, yearly, every [N|other] day/week/month/year, every weekday,
+//     every monday and thursday, every 15th, followed by "on the 1st" or "on monday" where it makes sense
+//
+// Dates are interpreted in the location of the reference time passed to Parse.
+package quickadd
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// recurrence frequencies
+const (
+	Daily   = "daily"
+	Weekly  = "weekly"
+	Monthly = "monthly"
+	Yearly  = "yearly"
+)
+
+// priorities, named as in the task model
+const (
+	PriorityLow    = "low"
+	PriorityMedium = "medium"
+	PriorityHigh   = "high"
+	PriorityUrgent = "urgent"
+)
+
+var (
+	ErrEmptyTitle     = errors.New("quickadd: nothing left for the title")
+	ErrDateOutOfRange = errors.New("quickadd: the date is past the year 9999")
+)
+
+const (
+	maxYear = 9999
+	// maxOffset - the largest count of "in N ...", small enough for N hours not to overflow a time.Duration
+	maxOffset = 1000000
+)
+
+type Recurrence struct {
+	Frequency string         `json:"frequency"`          // Daily, Weekly, Monthly or Yearly
+	Interval  int            `json:"interval"`           // Repeats every Interval days/weeks/..., at least 1
+	Weekdays  []time.Weekday `json:"weekdays,omitempty"` // Weekly only
+	MonthDay  int            `json:"month_day,omitempty"`
+}
+
+type Result struct {
+	Title      string      `json:"title"`
+	Due        *time.Time  `json:"due,omitempty"`
+	AllDay     bool        `json:"all_day"` // Due is a date, its time of day is meaningless
+	Recurrence *Recurrence `json:"recurrence,omitempty"`
+	Labels     []string    `json:"labels,omitempty"`
+	Priority   string      `json:"priority,omitempty"` // Empty when not given
+}
+
+// date - a calendar date without a location
+type date struct {
+	year  int
+	month time.Month
+	day   int
+}
+
+type clock struct {
+	hour   int
+	minute int
+}
+
+// parser - the state of one Parse call
+type parser struct {
+	now        time.Time
+	words      []string
+	lower      []string
+	title      []string
+	date       *date
+	clock      *clock
+	exact      *time.Time // Set by "in N hours", overrides date and clock
+	recurrence *Recurrence
+	labels     []string
+	priority   string
+	err        error
+}
+
+// Parse - parses input relative to now, which also supplies the time zone.
+// Fails with ErrEmptyTitle when nothing but attributes were given,
+// and with ErrDateOutOfRange when the due date is past the year 9999.
+func Parse(input string, now time.Time) (Result, error) {
+	p := &parser{now: now, words: strings.Fields(input)}
+	for _, word := range p.words {
+		p.lower = append(p.lower, strings.ToLower(word))
+	}
+
+	for i := 0; i < len(p.words); {
+		if n := p.match(i); n > 0 {
+			i += n
+			continue
+		}
+		p.title = append(p.title, p.words[i])
+		i++
+	}
+
+	result := Result{
+		Title:      strings.Join(p.title, " "),
+		Recurrence: p.recurrence,
+		Labels:     p.labels,
+		Priority:   p.priority,
+	}
+	if p.err != nil {
+		return result, p.err
+	}
+	if result.Title == "" {
+		return result, ErrEmptyTitle
+	}
+	result.Due, result.AllDay = p.due()
+	return result, nil
+}
+
+// match - tries every kind of attribute at word i, returning the number of words it consumed
+func (p *parser) match(i int) int {
+	word := p.lower[i]
+
+	if strings.HasPrefix(word, "#") {
+		label := p.words[i][1:]
+		if label != "" && unicode.IsLetter([]rune(label)[0]) && !strings.Contains(label, "#") {
+			p.addLabel(label)
+			return 1
+		}
+		return 0
+	}
+
+	if strings.HasPrefix(word, "!") {
+		if priority, ok := priorities[word[1:]]; ok && p.priority == "" {
+			p.priority = priority
+			return 1
+		}
+		return 0
+	}
+
+	if p.recurrence == nil {
+		if recurrence, n := p.parseRecurrence(i); n > 0 {
+			p.recurrence = &recurrence
+			return n
+		}
+	}
+
+	// Connectors only go with the phrase they introduce
+	offset := 0
+	if word == "on" || word == "by" || word == "due" || word == "at" {
+		offset = 1
+		if i+1 >= len(p.words) {
+			return 0
+		}
+	}
+
+	if p.date == nil && p.exact == nil && word != "at" {
+		if d, exact, n := p.parseDate(i + offset); n > 0 {
+			if exact != nil {
+				p.exact = exact
+			} else {
+				p.date = &d
+			}
+			return offset + n
+		}
+	}
+
+	if p.clock == nil && p.exact == nil && word != "on" {
+		if c, n := p.parseClock(i + offset); n > 0 {
+			p.clock = &c
+			return offset + n
+		}
+	}
+	return 0
+}
+
+func (p *parser) addLabel(label string) {
+	for _, existing := range p.labels {
+		if strings.EqualFold(existing, label) {
+			return
+		}
+	}
+	p.labels = append(p.labels, label)
+}
+
+// word - the lower-cased word at i, empty past the end
+func (p *parser) word(i int) string {
+	if i < 0 || i >= len(p.lower) {
+		return ""
+	}
+	return p.lower[i]
+}
+
+// parseRecurrence - "daily", "every 2 weeks on monday", "every month on the 1st", ...
+func (p *parser) parseRecurrence(i int) (Recurrence, int) {
+	recurrence := Recurrence{Interval: 1}
+	n := 0
+
+	switch p.word(i) {
+	case "daily":
+		recurrence.Frequency, n = Daily, 1
+	case "weekly":
+		recurrence.Frequency, n = Weekly, 1
+	case "monthly":
+		recurrence.Frequency, n = Monthly, 1
+	case "yearly", "annually":
+		recurrence.Frequency, n = Yearly, 1
+	case "every":
+		n = 1
+		next := p.word(i + n)
+		if next == "other" {
+			recurrence.Interval = 2
+			n++
+		} else if interval, err := strconv.Atoi(next); err == nil && interval > 0 {
+			recurrence.Interval = interval
+			n++
+		}
+
+		unit := p.word(i + n)
+		if frequency, ok := units[unit]; ok {
+			recurrence.Frequency = frequency
+			n++
+		} else if recurrence.Interval == 1 && (unit == "weekday" || unit == "weekdays") {
+			recurrence.Frequency = Weekly
+			recurrence.Weekdays = []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}
+			return recurrence, n + 1
+		} else if weekdays, m := p.parseWeekdays(i + n); m > 0 {
+			recurrence.Frequency = Weekly
+			recurrence.Weekdays = weekdays
+			return recurrence, n + m
+		} else if day, ok := ordinal(unit); ok && recurrence.Interval == 1 {
+			recurrence.Frequency = Monthly
+			recurrence.MonthDay = day
+			return recurrence, n + 1
+		} else {
+			return recurrence, 0
+		}
+	default:
+		return recurrence, 0
+	}
+
+	// Optional anchor: "on monday", "on the 1st", "the 1st"
+	switch recurrence.Frequency {
+	case Weekly:
+		if p.word(i+n) == "on" {
+			if weekdays, m := p.parseWeekdays(i + n + 1); m > 0 {
+				recurrence.Weekdays = weekdays
+				n += 1 + m
+			}
+		}
+	case Monthly:
+		m := 0
+		if p.word(i+n) == "on" {
+			m++
+		}
+		if p.word(i+n+m) == "the" {
+			m++
+		}
+		if day, ok := ordinal(p.word(i + n + m)); ok && m > 0 {
+			recurrence.MonthDay = day
+			n += m + 1
+		}
+	}
+	return recurrence, n
+}
+
+// parseWeekdays - "monday", "mon and thu", "mon,wed,fri", "monday, wednesday and friday"
+func (p *parser) parseWeekdays(i int) ([]time.Weekday, int) {
+	var found []time.Weekday
+	n := 0
+	for {
+		word := strings.TrimSuffix(p.word(i+n), ",")
+		parts := strings.Split(word, ",")
+		var days []time.Weekday
+		for _, part := range parts {
+			day, ok := weekdays[part]
+			if !ok {
+				days = nil
+				break
+			}
+			days = append(days, day)
+		}
+		if len(days) == 0 {
+			break
+		}
+		found = appendWeekdays(found, days...)
+		n++
+
+		if p.word(i+n) == "and" {
+			if _, ok := weekdays[strings.Split(strings.TrimSuffix(p.word(i+n+1), ","), ",")[0]]; ok {
+				n++
+				continue
+			}
+			break
+		}
+		if !strings.HasSuffix(p.word(i+n-1), ",") {
+			break
+		}
+	}
+	return found, n
+}
+
+// parseDate - a date phrase at word i, or a point in time for "in N hours"
+func (p *parser) parseDate(i int) (date, *time.Time, int) {
+	today := civil(p.now)
+	word := p.word(i)
+
+	switch word {
+	case "today":
+		return today, nil, 1
+	case "tomorrow", "tmrw", "tmr":
+		return today.addDays(1), nil, 1
+	case "next":
+		switch next := p.word(i + 1); next {
+		case "week":
+			days := (int(time.Monday) - int(p.now.Weekday()) + 7) % 7
+			if days == 0 {
+				days = 7
+			}
+			return today.addDays(days), nil, 2
+		case "month":
+			return date{today.year, today.month + 1, 1}.normalize(), nil, 2
+		case "year":
+			return date{today.year + 1, time.January, 1}, nil, 2
+		default:
+			if day, ok := weekdays[next]; ok {
+				return nextWeekday(today, p.now.Weekday(), day), nil, 2
+			}
+		}
+		return date{}, nil, 0
+	case "in":
+		count, unit := 0, ""
+		if p.word(i+1) == "a" || p.word(i+1) == "an" {
+			count, unit = 1, p.word(i+2)
+		} else if parsed, err := strconv.Atoi(p.word(i + 1)); err == nil && parsed > 0 {
+			count, unit = parsed, p.word(i+2)
+		} else {
+			return date{}, nil, 0
+		}
+		tooFar := count > maxOffset
+		count = min(count, maxOffset)
+
+		var d date
+		var exact *time.Time
+		switch strings.TrimSuffix(unit, "s") {
+		case "minute", "min":
+			t := p.now.Add(time.Duration(count) * time.Minute)
+			exact, d = &t, civil(t)
+		case "hour", "hr":
+			t := p.now.Add(time.Duration(count) * time.Hour)
+			exact, d = &t, civil(t)
+		case "day":
+			d = today.addDays(count)
+		case "week":
+			d = today.addDays(7 * count)
+		case "month":
+			d = date{today.year, today.month + time.Month(count), today.day}.normalize()
+		case "year":
+			d = date{today.year + count, today.month, today.day}.normalize()
+		default:
+			return date{}, nil, 0
+		}
+		if tooFar || d.year > maxYear {
+			p.err = ErrDateOutOfRange
+		}
+		return d, exact, 3
+	}
+
+	if day, ok := weekdays[word]; ok {
+		return nextWeekday(today, p.now.Weekday(), day), nil, 1
+	}
+
+	if parsed, err := time.ParseInLocation("2006-01-02", word, p.now.Location()); err == nil {
+		return civil(parsed), nil, 1
+	}
+
+	// "mar 5", "march 5th 2027", "5 mar", "5th of march"
+	if month, ok := months[word]; ok {
+		if day, ok := ordinal(p.word(i + 1)); ok {
+			d, n := p.withYear(date{today.year, month, day}, i+2)
+			return d, nil, 2 + n
+		}
+	}
+	if day, ok := ordinal(word); ok {
+		n := 1
+		if p.word(i+n) == "of" {
+			n++
+		}
+		if month, ok := months[p.word(i+n)]; ok {
+			d, m := p.withYear(date{today.year, month, day}, i+n+1)
+			return d, nil, n + 1 + m
+		}
+	}
+	return date{}, nil, 0
+}
+
+// withYear - applies an explicit year at word i, otherwise moves dates which have passed to next year
+func (p *parser) withYear(d date, i int) (date, int) {
+	if year, err := strconv.Atoi(p.word(i)); err == nil && year >= 1970 && year <= maxYear {
+		d.year = year
+		return d, 1
+	}
+	if d.before(civil(p.now)) {
+		d.year++
+	}
+	return d, 0
+}
+
+// parseClock - "9am", "9:30 pm", "21:00", "noon", "midnight"
+func (p *parser) parseClock(i int) (clock, int) {
+	word := p.word(i)
+	switch word {
+	case "noon", "midday":
+		return clock{12, 0}, 1
+	case "midnight":
+		return clock{0, 0}, 1
+	}
+
+	n := 1
+	suffix := ""
+	for _, meridiem := range []string{"am", "pm", "a.m.", "p.m."} {
+		if strings.HasSuffix(word, meridiem) {
+			suffix, word = meridiem[:1], strings.TrimSuffix(word, meridiem)
+			break
+		}
+	}
+	if suffix == "" {
+		switch p.word(i + 1) {
+		case "am", "a.m.":
+			suffix, n = "a", 2
+		case "pm", "p.m.":
+			suffix, n = "p", 2
+		}
+	}
+
+	hourText, minuteText, hasMinutes := strings.Cut(word, ":")
+	hour, err := strconv.Atoi(hourText)
+	if err != nil || hourText == "" {
+		return clock{}, 0
+	}
+	minute := 0
+	if hasMinutes {
+		if len(minuteText) != 2 {
+			return clock{}, 0
+		}
+		if minute, err = strconv.Atoi(minuteText); err != nil || minute > 59 {
+			return clock{}, 0
+		}
+	}
+
+	switch {
+	case suffix != "":
+		if hour < 1 || hour > 12 {
+			return clock{}, 0
+		}
+		hour %= 12
+		if suffix == "p" {
+			hour += 12
+		}
+	case hasMinutes:
+		// 24 hour clock
+		if hour > 23 {
+			return clock{}, 0
+		}
+	default:
+		// A bare number is not a time
+		return clock{}, 0
+	}
+	return clock{hour, minute}, n
+}
+
+// due - combines the parsed date, time and recurrence into the due date
+func (p *parser) due() (*time.Time, bool) {
+	if p.exact != nil {
+		return p.exact, false
+	}
+
+	d := p.date
+	if d == nil && p.recurrence != nil {
+		first := firstOccurrence(*p.recurrence, civil(p.now), p.now.Weekday())
+		// Today's occurrence is missed once its time has passed
+		if p.clock != nil && first.at(*p.clock, p.now.Location()).Before(p.now) {
+			tomorrow := p.now.AddDate(0, 0, 1)
+			first = firstOccurrence(*p.recurrence, civil(tomorrow), tomorrow.Weekday())
+		}
+		d = &first
+	}
+
+	if d == nil {
+		if p.clock == nil {
+			return nil, false
+		}
+		// A time alone means the next time the clock shows it
+		due := civil(p.now).at(*p.clock, p.now.Location())
+		if due.Before(p.now) {
+			due = civil(p.now).addDays(1).at(*p.clock, p.now.Location())
+		}
+		return &due, false
+	}
+
+	if p.clock == nil {
+		due := d.at(clock{}, p.now.Location())
+		return &due, true
+	}
+	due := d.at(*p.clock, p.now.Location())
+	return &due, false
+}
+
+// firstOccurrence - the first day on or after today matching the recurrence
+func firstOccurrence(recurrence Recurrence, today date, weekday time.Weekday) date {
+	switch {
+	case recurrence.Frequency == Weekly && len(recurrence.Weekdays) > 0:
+		for days := 0; days < 7; days++ {
+			for _, day := range recurrence.Weekdays {
+				if (weekday+time.Weekday(days))%7 == day {
+					return today.addDays(days)
+				}
+			}
+		}
+	case recurrence.Frequency == Monthly && recurrence.MonthDay > 0:
+		d := date{today.year, today.month, recurrence.MonthDay}
+		if d.day < today.day {
+			d.month++
+		}
+		// Months without the day fall back to their last day
+		for !d.valid() {
+			d.day--
+		}
+		return d.normalize()
+	}
+	return today
+}
+
+func nextWeekday(today date, weekday, wanted time.Weekday) date {
+	days := (int(wanted) - int(weekday) + 7) % 7
+	if days == 0 {
+		days = 7
+	}
+	return today.addDays(days)
+}
+
+func civil(t time.Time) date {
+	year, month, day := t.Date()
+	return date{year, month, day}
+}
+
+func (d date) addDays(days int) date {
+	return date{d.year, d.month, d.day + days}.normalize()
+}
+
+// normalize - carries overflowing days and months, like time.Date
+func (d date) normalize() date {
+	return civil(time.Date(d.year, d.month, d.day, 0, 0, 0, 0, time.UTC))
+}
+
+// valid - reports whether the day exists in the month
+func (d date) valid() bool {
+	return d.normalize() == date{d.year + int(d.month-1)/12, (d.month-1)%12 + 1, d.day}
+}
+
+func (d date) before(other date) bool {
+	if d.year != other.year {
+		return d.year < other.year
+	}
+	if d.month != other.month {
+		return d.month < other.month
+	}
+	return d.day < other.day
+}
+
+func (d date) at(c clock, location *time.Location) time.Time {
+	return time.Date(d.year, d.month, d.day, c.hour, c.minute, 0, 0, location)
+}
+
+// ordinal - "1st", "22nd", "3rd", "15th" or a bare "15", as a day of the month
+func ordinal(word string) (int, bool) {
+	for _, suffix := range []string{"st", "nd", "rd", "th"} {
+		if strings.HasSuffix(word, suffix) {
+			word = strings.TrimSuffix(word, suffix)
+			break
+		}
+	}
+	day, err := strconv.Atoi(word)
+	if err != nil || day < 1 || day > 31 {
+		return 0, false
+	}
+	return day, true
+}
+
+func appendWeekdays(days []time.Weekday, more ...time.Weekday) []time.Weekday {
+	for _, day := range more {
+		found := false
+		for _, existing := range days {
+			found = found || existing == day
+		}
+		if !found {
+			days = append(days, day)
+		}
+	}
+	return days
+}
+
+var priorities = map[string]string{
+	"low":    PriorityLow,
+	"medium": PriorityMedium,
+	"med":    PriorityMedium,
+	"high":   PriorityHigh,
+	"urgent": PriorityUrgent,
+	"4":      PriorityLow,
+	"3":      PriorityMedium,
+	"2":      PriorityHigh,
+	"1":      PriorityUrgent,
+}
+
+var units = map[string]string{
+	"day":    Daily,
+	"days":   Daily,
+	"week":   Weekly,
+	"weeks":  Weekly,
+	"month":  Monthly,
+	"months": Monthly,
+	"year":   Yearly,
+	"years":  Yearly,
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "sunday": time.Sunday,
+	"mon": time.Monday, "monday": time.Monday,
+	"tue": time.Tuesday, "tues": time.Tuesday, "tuesday": time.Tuesday,
+	"wed": time.Wednesday, "weds": time.Wednesday, "wednesday": time.Wednesday,
+	"thu": time.Thursday, "thur": time.Thursday, "thurs": time.Thursday, "thursday": time.Thursday,
+	"fri": time.Friday, "friday": time.Friday,
+	"sat": time.Saturday, "saturday": time.Saturday,
+}
+
+var months = map[string]time.Month{
+	"jan": time.January, "january": time.January,
+	"feb": time.February, "february": time.February,
+	"mar": time.March, "march": time.March,
+	"apr": time.April, "april": time.April,
+	"may": time.May,
+	"jun": time.June, "june": time.June,
+	"jul": time.July, "july": time.July,
+	"aug": time.August, "august": time.August,
+	"sep": time.September, "sept": time.September, "september": time.September,
+	"oct": time.October, "october": time.October,
+	"nov": time.November, "november": time.November,
+	"dec": time.December, "december": time.December,
+}
@@ -0,0 +1,418 @@
+package quickadd
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+var zone = time.FixedZone("UTC-5", -5*60*60)
+
+// now - Wednesday 11 March 2026, 10:00
+var now = time.Date(2026, time.March, 11, 10, 0, 0, 0, zone)
+
+func at(year int, month time.Month, day, hour, minute int) *time.Time {
+	t := time.Date(year, month, day, hour, minute, 0, 0, zone)
+	return &t
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  Result
+	}{
+		{
+			name:  "example from the docs",
+			input: "Pay rent every month on the 1st #finance !high tomorrow 9am",
+			want: Result{
+				Title:      "Pay rent",
+				Due:        at(2026, time.March, 12, 9, 0),
+				Recurrence: &Recurrence{Frequency: Monthly, Interval: 1, MonthDay: 1},
+				Labels:     []string{"finance"},
+				Priority:   PriorityHigh,
+			},
+		},
+		{
+			name:  "plain title",
+			input: "Buy milk",
+			want:  Result{Title: "Buy milk"},
+		},
+		{
+			name:  "extra spaces are collapsed",
+			input: "  Buy   milk ",
+			want:  Result{Title: "Buy milk"},
+		},
+		{
+			name:  "today is an all day date",
+			input: "Call mom today",
+			want:  Result{Title: "Call mom", Due: at(2026, time.March, 11, 0, 0), AllDay: true},
+		},
+		{
+			name:  "tomorrow at a time",
+			input: "Call mom tomorrow at 5pm",
+			want:  Result{Title: "Call mom", Due: at(2026, time.March, 12, 17, 0)},
+		},
+		{
+			name:  "matching is case insensitive",
+			input: "Meeting TOMORROW 9AM",
+			want:  Result{Title: "Meeting", Due: at(2026, time.March, 12, 9, 0)},
+		},
+		{
+			name:  "time with minutes and a separate meridiem",
+			input: "Dinner tomorrow 7:30 pm",
+			want:  Result{Title: "Dinner", Due: at(2026, time.March, 12, 19, 30)},
+		},
+		{
+			name:  "upcoming weekday",
+			input: "Submit report friday",
+			want:  Result{Title: "Submit report", Due: at(2026, time.March, 13, 0, 0), AllDay: true},
+		},
+		{
+			name:  "weekday of today means next week",
+			input: "Team sync on wednesday",
+			want:  Result{Title: "Team sync", Due: at(2026, time.March, 18, 0, 0), AllDay: true},
+		},
+		{
+			name:  "next weekday",
+			input: "Retro next tue",
+			want:  Result{Title: "Retro", Due: at(2026, time.March, 17, 0, 0), AllDay: true},
+		},
+		{
+			name:  "next week starts on monday",
+			input: "Review next week",
+			want:  Result{Title: "Review", Due: at(2026, time.March, 16, 0, 0), AllDay: true},
+		},
+		{
+			name:  "next month starts on the 1st",
+			input: "Plan next month",
+			want:  Result{Title: "Plan", Due: at(2026, time.April, 1, 0, 0), AllDay: true},
+		},
+		{
+			name:  "next year",
+			input: "Taxes next year",
+			want:  Result{Title: "Taxes", Due: at(2027, time.January, 1, 0, 0), AllDay: true},
+		},
+		{
+			name:  "in weeks",
+			input: "Renew passport in 3 weeks",
+			want:  Result{Title: "Renew passport", Due: at(2026, time.April, 1, 0, 0), AllDay: true},
+		},
+		{
+			name:  "in a unit",
+			input: "Ship in a week",
+			want:  Result{Title: "Ship", Due: at(2026, time.March, 18, 0, 0), AllDay: true},
+		},
+		{
+			name:  "in months",
+			input: "Checkup in 2 months",
+			want:  Result{Title: "Checkup", Due: at(2026, time.May, 11, 0, 0), AllDay: true},
+		},
+		{
+			name:  "in minutes is a point in time",
+			input: "Take a break in 30 minutes",
+			want:  Result{Title: "Take a break", Due: at(2026, time.March, 11, 10, 30)},
+		},
+		{
+			name:  "in hours is a point in time",
+			input: "Check oven in 2 hours",
+			want:  Result{Title: "Check oven", Due: at(2026, time.March, 11, 12, 0)},
+		},
+		{
+			name:  "in years up to 9999",
+			input: "Open time capsule in 7973 years",
+			want:  Result{Title: "Open time capsule", Due: at(9999, time.March, 11, 0, 0), AllDay: true},
+		},
+		{
+			name:  "in the most hours",
+			input: "Check oven in 1000000 hours",
+			want:  Result{Title: "Check oven", Due: at(2140, time.April, 9, 2, 0)},
+		},
+		{
+			name:  "in without a unit stays in the title",
+			input: "Put keys in a drawer",
+			want:  Result{Title: "Put keys in a drawer"},
+		},
+		{
+			name:  "month and day",
+			input: "Dentist mar 20 2pm",
+			want:  Result{Title: "Dentist", Due: at(2026, time.March, 20, 14, 0)},
+		},
+		{
+			name:  "day of month that has passed is next year",
+			input: "Birthday party 5th of january",
+			want:  Result{Title: "Birthday party", Due: at(2027, time.January, 5, 0, 0), AllDay: true},
+		},
+		{
+			name:  "explicit year",
+			input: "Conference september 21st 2027",
+			want:  Result{Title: "Conference", Due: at(2027, time.September, 21, 0, 0), AllDay: true},
+		},
+		{
+			name:  "iso date",
+			input: "Launch 2026-06-01 !urgent",
+			want:  Result{Title: "Launch", Due: at(2026, time.June, 1, 0, 0), AllDay: true, Priority: PriorityUrgent},
+		},
+		{
+			name:  "24 hour clock",
+			input: "Deploy 21:00",
+			want:  Result{Title: "Deploy", Due: at(2026, time.March, 11, 21, 0)},
+		},
+		{
+			name:  "noon",
+			input: "Lunch at noon",
+			want:  Result{Title: "Lunch", Due: at(2026, time.March, 11, 12, 0)},
+		},
+		{
+			name:  "time which has passed today is tomorrow",
+			input: "Call at 9am",
+			want:  Result{Title: "Call", Due: at(2026, time.March, 12, 9, 0)},
+		},
+		{
+			name:  "invalid time stays in the title",
+			input: "Call at 13pm",
+			want:  Result{Title: "Call at 13pm"},
+		},
+		{
+			name:  "bare number is not a time",
+			input: "Read chapter 5",
+			want:  Result{Title: "Read chapter 5"},
+		},
+		{
+			name:  "dangling connector stays in the title",
+			input: "Meet on",
+			want:  Result{Title: "Meet on"},
+		},
+		{
+			name:  "connector without a phrase stays in the title",
+			input: "Report due by friday",
+			want:  Result{Title: "Report due", Due: at(2026, time.March, 13, 0, 0), AllDay: true},
+		},
+		{
+			name:  "every other day",
+			input: "Water plants every other day",
+			want: Result{
+				Title:      "Water plants",
+				Due:        at(2026, time.March, 11, 0, 0),
+				AllDay:     true,
+				Recurrence: &Recurrence{Frequency: Daily, Interval: 2},
+			},
+		},
+		{
+			name:  "daily keyword",
+			input: "Journal daily",
+			want: Result{
+				Title:      "Journal",
+				Due:        at(2026, time.March, 11, 0, 0),
+				AllDay:     true,
+				Recurrence: &Recurrence{Frequency: Daily, Interval: 1},
+			},
+		},
+		{
+			name:  "every weekday",
+			input: "Standup every weekday 11am",
+			want: Result{
+				Title: "Standup",
+				Due:   at(2026, time.March, 11, 11, 0),
+				Recurrence: &Recurrence{Frequency: Weekly, Interval: 1,
+					Weekdays: []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}},
+			},
+		},
+		{
+			name:  "list of weekdays, today's occurrence has passed",
+			input: "Gym every mon, wed and fri at 7am",
+			want: Result{
+				Title:      "Gym",
+				Due:        at(2026, time.March, 13, 7, 0),
+				Recurrence: &Recurrence{Frequency: Weekly, Interval: 1, Weekdays: []time.Weekday{time.Monday, time.Wednesday, time.Friday}},
+			},
+		},
+		{
+			name:  "comma separated weekdays",
+			input: "Class every tue,thu",
+			want: Result{
+				Title:      "Class",
+				Due:        at(2026, time.March, 12, 0, 0),
+				AllDay:     true,
+				Recurrence: &Recurrence{Frequency: Weekly, Interval: 1, Weekdays: []time.Weekday{time.Tuesday, time.Thursday}},
+			},
+		},
+		{
+			name:  "interval with a weekday anchor",
+			input: "Sprint planning every 2 weeks on monday",
+			want: Result{
+				Title:      "Sprint planning",
+				Due:        at(2026, time.March, 16, 0, 0),
+				AllDay:     true,
+				Recurrence: &Recurrence{Frequency: Weekly, Interval: 2, Weekdays: []time.Weekday{time.Monday}},
+			},
+		},
+		{
+			name:  "day of the month",
+			input: "Pay invoice every 15th",
+			want: Result{
+				Title:      "Pay invoice",
+				Due:        at(2026, time.March, 15, 0, 0),
+				AllDay:     true,
+				Recurrence: &Recurrence{Frequency: Monthly, Interval: 1, MonthDay: 15},
+			},
+		},
+		{
+			name:  "day of the month which has passed",
+			input: "Pay card monthly on the 2nd",
+			want: Result{
+				Title:      "Pay card",
+				Due:        at(2026, time.April, 2, 0, 0),
+				AllDay:     true,
+				Recurrence: &Recurrence{Frequency: Monthly, Interval: 1, MonthDay: 2},
+			},
+		},
+		{
+			name:  "day missing from the month falls back to its last day",
+			input: "Close books every month on the 31st",
+			want: Result{
+				Title:      "Close books",
+				Due:        at(2026, time.March, 31, 0, 0),
+				AllDay:     true,
+				Recurrence: &Recurrence{Frequency: Monthly, Interval: 1, MonthDay: 31},
+			},
+		},
+		{
+			name:  "yearly",
+			input: "Anniversary yearly",
+			want: Result{
+				Title:      "Anniversary",
+				Due:        at(2026, time.March, 11, 0, 0),
+				AllDay:     true,
+				Recurrence: &Recurrence{Frequency: Yearly, Interval: 1},
+			},
+		},
+		{
+			name:  "every without a unit stays in the title",
+			input: "Read every page",
+			want:  Result{Title: "Read every page"},
+		},
+		{
+			name:  "labels have to start with a letter",
+			input: "Fix issue #12 #backend",
+			want:  Result{Title: "Fix issue #12", Labels: []string{"backend"}},
+		},
+		{
+			name:  "duplicate labels are dropped",
+			input: "Read #books #Books #work",
+			want:  Result{Title: "Read", Labels: []string{"books", "work"}},
+		},
+		{
+			name:  "numbered priority",
+			input: "Patch server !1",
+			want:  Result{Title: "Patch server", Priority: PriorityUrgent},
+		},
+		{
+			name:  "only the first priority counts",
+			input: "!high !low Task",
+			want:  Result{Title: "!low Task", Priority: PriorityHigh},
+		},
+		{
+			name:  "unknown priority stays in the title",
+			input: "Wow !amazing",
+			want:  Result{Title: "Wow !amazing"},
+		},
+		{
+			name:  "only the first date counts",
+			input: "Move meeting from monday to friday",
+			want:  Result{Title: "Move meeting from to friday", Due: at(2026, time.March, 16, 0, 0), AllDay: true},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := Parse(test.input, now)
+			if err != nil {
+				t.Fatalf("Parse(%q) returned error %v", test.input, err)
+			}
+
+			if (got.Due == nil) != (test.want.Due == nil) || got.Due != nil && !got.Due.Equal(*test.want.Due) {
+				t.Errorf("Parse(%q) due = %v, want %v", test.input, got.Due, test.want.Due)
+			}
+			got.Due, test.want.Due = nil, nil
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Parse(%q) = %+v, want %+v", test.input, got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseEmptyTitle(t *testing.T) {
+	tests := []string{
+		"",
+		"   ",
+		"!high #work",
+		"tomorrow 9am",
+		"every day",
+	}
+
+	for _, input := range tests {
+		if _, err := Parse(input, now); err != ErrEmptyTitle {
+			t.Errorf("Parse(%q) error = %v, want ErrEmptyTitle", input, err)
+		}
+	}
+}
+
+func TestParseDateOutOfRange(t *testing.T) {
+	tests := []string{
+		"Open time capsule in 7974 years",
+		"Open time capsule in 99999999999 years",
+		"Open time capsule in 100000 months",
+		"Open time capsule in 99999999999 days",
+		"Take a break in 99999999999 minutes",
+		"Check oven in 1000001 hours",
+	}
+
+	for _, input := range tests {
+		if _, err := Parse(input, now); err != ErrDateOutOfRange {
+			t.Errorf("Parse(%q) error = %v, want ErrDateOutOfRange", input, err)
+		}
+	}
+}
+
+func TestParseUsesLocationOfNow(t *testing.T) {
+	tokyo := time.FixedZone("UTC+9", 9*60*60)
+	// Still Wednesday in UTC-5, already Thursday in UTC+9
+	reference := time.Date(2026, time.March, 11, 20, 0, 0, 0, zone).In(tokyo)
+
+	got, err := Parse("Call tomorrow 9am", reference)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := time.Date(2026, time.March, 13, 9, 0, 0, 0, tokyo)
+	if got.Due == nil || !got.Due.Equal(want) || got.Due.Location() != tokyo {
+		t.Errorf("due = %v, want %v", got.Due, want)
+	}
+}
+
+func TestFirstOccurrence(t *testing.T) {
+	tests := []struct {
+		name       string
+		recurrence Recurrence
+		today      date
+		want       date
+	}{
+		{"daily is today", Recurrence{Frequency: Daily, Interval: 1}, date{2026, time.March, 11}, date{2026, time.March, 11}},
+		{"weekday later this week", Recurrence{Frequency: Weekly, Weekdays: []time.Weekday{time.Saturday}}, date{2026, time.March, 11}, date{2026, time.March, 14}},
+		{"weekday wraps into next week", Recurrence{Frequency: Weekly, Weekdays: []time.Weekday{time.Monday}}, date{2026, time.March, 11}, date{2026, time.March, 16}},
+		{"month day today", Recurrence{Frequency: Monthly, MonthDay: 11}, date{2026, time.March, 11}, date{2026, time.March, 11}},
+		{"month day wraps into next year", Recurrence{Frequency: Monthly, MonthDay: 1}, date{2026, time.December, 11}, date{2027, time.January, 1}},
+		{"short february", Recurrence{Frequency: Monthly, MonthDay: 30}, date{2026, time.February, 3}, date{2026, time.February, 28}},
+		{"leap february", Recurrence{Frequency: Monthly, MonthDay: 31}, date{2028, time.February, 3}, date{2028, time.February, 29}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			weekday := test.today.at(clock{}, time.UTC).Weekday()
+			if got := firstOccurrence(test.recurrence, test.today, weekday); got != test.want {
+				t.Errorf("firstOccurrence() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
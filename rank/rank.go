@@ -0,0 +1,142 @@
+// Package rank implements lexicographic fractional indexing: string keys which sort in the
+// desired order and between which a new key can always be generated without touching the others.
+package rank
+
+import (
+	"errors"
+	"strings"
+)
+
+// digits are in ASCII order so that ranks compare correctly as plain strings (e.g. in MongoDB)
+const digits = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+var (
+	ErrInvalidRank = errors.New("rank: invalid rank")
+	ErrOutOfOrder  = errors.New("rank: lower bound must sort before upper bound")
+)
+
+// Between - returns a rank sorting strictly between a and b.
+// An empty a means "before everything", an empty b means "after everything".
+func Between(a, b string) (string, error) {
+	if !valid(a) || !valid(b) {
+		return "", ErrInvalidRank
+	}
+	if a != "" && b != "" && a >= b {
+		return "", ErrOutOfOrder
+	}
+	return midpoint(a, b), nil
+}
+
+// After - returns a rank sorting after a, for appending. Unlike Between(a, "") it increments a instead of
+// splitting the room left above it, so a run of appends only grows the rank by a digit every 61 keys.
+func After(a string) (string, error) {
+	if !valid(a) {
+		return "", ErrInvalidRank
+	}
+	if a == "" {
+		return midpoint("", ""), nil
+	}
+
+	buf := []byte(a)
+	for i := len(buf) - 1; i >= 0; i-- {
+		if next := strings.IndexByte(digits, buf[i]) + 1; next < len(digits) {
+			buf[i] = digits[next]
+			// The digits after i carried over to zeros, which ranks leave out
+			return string(buf[:i+1]), nil
+		}
+	}
+	// Every digit is the last one, nothing of the same length sorts after a
+	return a + digits[1:2], nil
+}
+
+// Spread - returns n ranks evenly spaced over the key space, all of the same small length
+// (trailing zeros trimmed). Used to rebalance ranks which have grown long.
+func Spread(n int) []string {
+	base := uint64(len(digits))
+	length, space := 1, base
+	for space <= uint64(n) {
+		length++
+		space *= base
+	}
+
+	ranks := make([]string, n)
+	for i := 0; i < n; i++ {
+		ranks[i] = encode(uint64(i+1)*space/uint64(n+1), length)
+	}
+	return ranks
+}
+
+// midpoint - a and b are valid ranks with a < b, b == "" meaning no upper bound
+func midpoint(a, b string) string {
+	if b != "" {
+		// Keep the common prefix, treating a as padded with zeros
+		n := 0
+		for n < len(b) && digitAt(a, n) == b[n] {
+			n++
+		}
+		if n > 0 {
+			rest := ""
+			if n < len(a) {
+				rest = a[n:]
+			}
+			return b[:n] + midpoint(rest, b[n:])
+		}
+	}
+
+	low := 0
+	if a != "" {
+		low = strings.IndexByte(digits, a[0])
+	}
+	high := len(digits)
+	if b != "" {
+		high = strings.IndexByte(digits, b[0])
+	}
+
+	if high-low > 1 {
+		return string(digits[(low+high+1)/2])
+	}
+
+	// The first digits are consecutive
+	if b != "" && len(b) > 1 {
+		return b[:1]
+	}
+
+	rest := ""
+	if len(a) > 1 {
+		rest = a[1:]
+	}
+	return string(digits[low]) + midpoint(rest, "")
+}
+
+func digitAt(s string, i int) byte {
+	if i < len(s) {
+		return s[i]
+	}
+	return digits[0]
+}
+
+// valid - ranks only contain known digits and never end in the zero digit, which keeps room below every key
+func valid(s string) bool {
+	if s == "" {
+		return true
+	}
+	if s[len(s)-1] == digits[0] {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if strings.IndexByte(digits, s[i]) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func encode(value uint64, length int) string {
+	base := uint64(len(digits))
+	buf := make([]byte, length)
+	for i := length - 1; i >= 0; i-- {
+		buf[i] = digits[value%base]
+		value /= base
+	}
+	return strings.TrimRight(string(buf), digits[:1])
+}
@@ -0,0 +1,240 @@
+package rank
+
+import (
+	"math/rand"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// randomRank - a valid rank of up to 6 digits, empty one time in ten
+func randomRank(r *rand.Rand) string {
+	if r.Intn(10) == 0 {
+		return ""
+	}
+	buf := make([]byte, 1+r.Intn(6))
+	for i := range buf {
+		buf[i] = digits[r.Intn(len(digits))]
+	}
+	// Small digits often, to exercise the neighbours of the zero digit
+	if r.Intn(3) == 0 {
+		buf[len(buf)-1] = digits[1+r.Intn(2)]
+	}
+	return strings.TrimRight(string(buf), digits[:1])
+}
+
+// assertBetween - checks that got is a valid rank strictly between a and b
+func assertBetween(t *testing.T, a, b, got string) {
+	t.Helper()
+	if !valid(got) || got == "" {
+		t.Fatalf("Between(%q, %q) = %q, which isn't a valid rank", a, b, got)
+	}
+	if got <= a || b != "" && got >= b {
+		t.Fatalf("Between(%q, %q) = %q, which doesn't sort between them", a, b, got)
+	}
+}
+
+func TestBetween(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want string
+	}{
+		{"", "", "V"},
+		{"", "V", "G"},
+		{"V", "", "l"},
+		{"A", "C", "B"},
+		{"A", "B", "AV"},
+		{"A1", "B", "AW"},
+		{"Az", "B", "AzV"},
+		{"z", "", "zV"},
+		{"", "1", "0V"},
+		{"0V", "1", "0l"},
+		{"AB1", "AB2", "AB1V"},
+	}
+
+	for _, test := range tests {
+		got, err := Between(test.a, test.b)
+		if err != nil {
+			t.Fatalf("Between(%q, %q) error = %v", test.a, test.b, err)
+		}
+		if got != test.want {
+			t.Errorf("Between(%q, %q) = %q, want %q", test.a, test.b, got, test.want)
+		}
+		assertBetween(t, test.a, test.b, got)
+	}
+}
+
+func TestBetweenErrors(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want error
+	}{
+		{"B", "A", ErrOutOfOrder},
+		{"A", "A", ErrOutOfOrder},
+		{"A0", "B", ErrInvalidRank},
+		{"A", "B-", ErrInvalidRank},
+		{"A b", "", ErrInvalidRank},
+		{"", "é", ErrInvalidRank},
+	}
+
+	for _, test := range tests {
+		if _, err := Between(test.a, test.b); err != test.want {
+			t.Errorf("Between(%q, %q) error = %v, want %v", test.a, test.b, err, test.want)
+		}
+	}
+}
+
+func TestBetweenRandomBounds(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 100000; i++ {
+		a, b := randomRank(r), randomRank(r)
+		if a != "" && b != "" && a >= b {
+			a, b = b, a
+		}
+		if a == b && a != "" {
+			continue
+		}
+
+		got, err := Between(a, b)
+		if err != nil {
+			t.Fatalf("Between(%q, %q) error = %v", a, b, err)
+		}
+		assertBetween(t, a, b, got)
+	}
+}
+
+// TestBetweenKeepsOrder - inserting at random positions of a list keeps it sorted, whatever the order of the inserts
+func TestBetweenKeepsOrder(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	ranks := []string{}
+	for i := 0; i < 5000; i++ {
+		at := r.Intn(len(ranks) + 1)
+		lower, upper := "", ""
+		if at > 0 {
+			lower = ranks[at-1]
+		}
+		if at < len(ranks) {
+			upper = ranks[at]
+		}
+
+		got, err := Between(lower, upper)
+		if err != nil {
+			t.Fatalf("Between(%q, %q) error = %v", lower, upper, err)
+		}
+		assertBetween(t, lower, upper, got)
+		ranks = slices.Insert(ranks, at, got)
+	}
+
+	if !slices.IsSorted(ranks) {
+		t.Fatal("the ranks aren't sorted")
+	}
+	if len(slices.Compact(slices.Clone(ranks))) != len(ranks) {
+		t.Fatal("the ranks aren't distinct")
+	}
+}
+
+// TestBetweenSameGap - inserting again and again into the same gap only grows ranks by about a digit per six inserts
+func TestBetweenSameGap(t *testing.T) {
+	lower, upper := "A", "B"
+	for i := 0; i < 600; i++ {
+		got, err := Between(lower, upper)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertBetween(t, lower, upper, got)
+		if i%2 == 0 {
+			lower = got
+		} else {
+			upper = got
+		}
+	}
+	if len(lower) > 110 || len(upper) > 110 {
+		t.Errorf("ranks grew to %d and %d digits", len(lower), len(upper))
+	}
+}
+
+func TestAfter(t *testing.T) {
+	tests := []struct {
+		a, want string
+	}{
+		{"", "V"},
+		{"V", "W"},
+		{"y", "z"},
+		{"z", "z1"},
+		{"A1", "A2"},
+		{"Az", "B"},
+		{"Azz", "B"},
+		{"zz", "zz1"},
+		{"z1", "z2"},
+	}
+
+	for _, test := range tests {
+		got, err := After(test.a)
+		if err != nil {
+			t.Fatalf("After(%q) error = %v", test.a, err)
+		}
+		if got != test.want {
+			t.Errorf("After(%q) = %q, want %q", test.a, got, test.want)
+		}
+	}
+
+	if _, err := After("A0"); err != ErrInvalidRank {
+		t.Errorf("After(%q) error = %v, want ErrInvalidRank", "A0", err)
+	}
+}
+
+func TestAfterRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(3))
+	for i := 0; i < 100000; i++ {
+		a := randomRank(r)
+		got, err := After(a)
+		if err != nil {
+			t.Fatalf("After(%q) error = %v", a, err)
+		}
+		assertBetween(t, a, "", got)
+	}
+}
+
+// TestAfterAppends - appending only grows ranks by a digit every 61 keys, instead of every few with Between
+func TestAfterAppends(t *testing.T) {
+	last := ""
+	for i := 0; i < 10000; i++ {
+		got, err := After(last)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertBetween(t, last, "", got)
+		last = got
+	}
+	if len(last) > 10000/61+2 {
+		t.Errorf("10000 appends grew the rank to %d digits", len(last))
+	}
+
+}
+
+func TestSpread(t *testing.T) {
+	for _, n := range []int{0, 1, 2, 61, 62, 63, 1000, 3843, 3844, 20000} {
+		ranks := Spread(n)
+		if len(ranks) != n {
+			t.Fatalf("Spread(%d) returned %d ranks", n, len(ranks))
+		}
+		for i, r := range ranks {
+			if !valid(r) || r == "" {
+				t.Fatalf("Spread(%d)[%d] = %q, which isn't a valid rank", n, i, r)
+			}
+			if i > 0 && ranks[i-1] >= r {
+				t.Fatalf("Spread(%d) isn't strictly increasing at %d: %q, %q", n, i, ranks[i-1], r)
+			}
+		}
+
+		maxLength := 1
+		for space := len(digits); space <= n; space *= len(digits) {
+			maxLength++
+		}
+		for _, r := range ranks {
+			if len(r) > maxLength {
+				t.Fatalf("Spread(%d) has rank %q longer than %d digits", n, r, maxLength)
+			}
+		}
+	}
+}
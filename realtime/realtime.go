@@ -0,0 +1,215 @@
+// Package realtime delivers events to the connected sessions of users across server instances.
+// Publish appends an event to a Redis stream of each recipient, which keeps it for Retention so
+// reconnecting clients can replay what they missed, and announces it on the recipient's Redis channel.
+// Every instance runs a Broker listening to all those channels and hands the events to its local
+// subscriptions.
+package realtime
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/utpal74/track-my-tasks-backend/logger"
+	"go.uber.org/zap"
+)
+
+const (
+	// Retention - how long events can be replayed
+	Retention = 24 * time.Hour
+	// maxReplay - events replayed at most, clients which missed more start over
+	maxReplay = 1000
+	// subscriptionBuffer - events queued for a slow subscription before it is dropped
+	subscriptionBuffer = 64
+
+	channelPrefix = "realtime:"
+	streamPrefix  = "realtime-stream:"
+)
+
+// Event - ID is the ID of the stream entry, ordered in time, Type and Data are up to the publisher
+type Event struct {
+	ID   string          `json:"id,omitempty"`
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+// Broker - publishes events and hands the events of this and the other instances to local subscriptions
+type Broker struct {
+	redisClient   *redis.Client
+	mutex         sync.Mutex
+	subscriptions map[string]map[*Subscription]struct{} // By recipient
+}
+
+// Subscription - the events of one recipient. Events is closed when the subscription is closed, or dropped
+// because it fell behind; the client then reconnects and replays.
+type Subscription struct {
+	Events    <-chan Event
+	events    chan Event
+	recipient string
+	broker    *Broker
+}
+
+func NewBroker(redisClient *redis.Client) *Broker {
+	return &Broker{
+		redisClient:   redisClient,
+		subscriptions: make(map[string]map[*Subscription]struct{}),
+	}
+}
+
+// Publish - stores the event for each recipient and announces it, setting its ID per recipient
+func (broker *Broker) Publish(ctx context.Context, recipients []string, eventType string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	minID := strconv.FormatInt(time.Now().Add(-Retention).UnixMilli(), 10)
+	for _, recipient := range recipients {
+		id, err := broker.redisClient.XAdd(ctx, &redis.XAddArgs{
+			Stream: streamPrefix + recipient,
+			MinID:  minID,
+			Approx: true,
+			Values: map[string]interface{}{"type": eventType, "data": string(payload)},
+		}).Result()
+		if err != nil {
+			return fmt.Errorf("failed to store event for %s: %w", recipient, err)
+		}
+		broker.redisClient.Expire(ctx, streamPrefix+recipient, Retention)
+
+		message, err := json.Marshal(Event{ID: id, Type: eventType, Data: payload})
+		if err != nil {
+			return err
+		}
+		if err := broker.redisClient.Publish(ctx, channelPrefix+recipient, message).Err(); err != nil {
+			return fmt.Errorf("failed to announce event for %s: %w", recipient, err)
+		}
+	}
+	return nil
+}
+
+// Run - listens to the events of all recipients until ctx is done, go-redis reconnects when the connection drops
+func (broker *Broker) Run(ctx context.Context) {
+	log := logger.FromCtx(ctx)
+	pubsub := broker.redisClient.PSubscribe(ctx, channelPrefix+"*")
+	defer pubsub.Close()
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case message, ok := <-messages:
+			if !ok {
+				return
+			}
+			var event Event
+			if err := json.Unmarshal([]byte(message.Payload), &event); err != nil {
+				log.Error("invalid realtime event", zap.String("channel", message.Channel), zap.Error(err))
+				continue
+			}
+			broker.dispatch(strings.TrimPrefix(message.Channel, channelPrefix), event)
+		}
+	}
+}
+
+func (broker *Broker) dispatch(recipient string, event Event) {
+	broker.mutex.Lock()
+	defer broker.mutex.Unlock()
+
+	for subscription := range broker.subscriptions[recipient] {
+		select {
+		case subscription.events <- event:
+		default:
+			broker.remove(subscription)
+		}
+	}
+}
+
+// Subscribe - the events of the recipient from now on, the subscription must be closed
+func (broker *Broker) Subscribe(recipient string) *Subscription {
+	events := make(chan Event, subscriptionBuffer)
+	subscription := &Subscription{Events: events, events: events, recipient: recipient, broker: broker}
+
+	broker.mutex.Lock()
+	defer broker.mutex.Unlock()
+	if broker.subscriptions[recipient] == nil {
+		broker.subscriptions[recipient] = make(map[*Subscription]struct{})
+	}
+	broker.subscriptions[recipient][subscription] = struct{}{}
+	return subscription
+}
+
+func (subscription *Subscription) Close() {
+	subscription.broker.mutex.Lock()
+	defer subscription.broker.mutex.Unlock()
+	subscription.broker.remove(subscription)
+}
+
+// remove - the caller holds the mutex
+func (broker *Broker) remove(subscription *Subscription) {
+	subscriptions := broker.subscriptions[subscription.recipient]
+	if _, ok := subscriptions[subscription]; !ok {
+		return
+	}
+	delete(subscriptions, subscription)
+	if len(subscriptions) == 0 {
+		delete(broker.subscriptions, subscription.recipient)
+	}
+	close(subscription.events)
+}
+
+// Replay - the events of the recipient after lastID. complete is false when some of them can't be replayed any
+// more (or lastID isn't an event ID), the client has to reload instead.
+func (broker *Broker) Replay(ctx context.Context, recipient, lastID string) (events []Event, complete bool, err error) {
+	millis, _, ok := parseID(lastID)
+	if !ok || time.Since(time.UnixMilli(millis)) > Retention {
+		return nil, false, nil
+	}
+
+	entries, err := broker.redisClient.XRangeN(ctx, streamPrefix+recipient, "("+lastID, "+", maxReplay+1).Result()
+	if err != nil {
+		return nil, false, err
+	}
+	if len(entries) > maxReplay {
+		return nil, false, nil
+	}
+
+	for _, entry := range entries {
+		eventType, _ := entry.Values["type"].(string)
+		data, _ := entry.Values["data"].(string)
+		events = append(events, Event{ID: entry.ID, Type: eventType, Data: json.RawMessage(data)})
+	}
+	return events, true, nil
+}
+
+// After - reports whether the event ID a is later than b
+func After(a, b string) bool {
+	aMillis, aSeq, aOK := parseID(a)
+	bMillis, bSeq, bOK := parseID(b)
+	if !aOK || !bOK {
+		return aOK
+	}
+	return aMillis > bMillis || (aMillis == bMillis && aSeq > bSeq)
+}
+
+// parseID - the parts of a stream entry ID, milliseconds-sequence
+func parseID(id string) (millis, seq int64, ok bool) {
+	first, second, found := strings.Cut(id, "-")
+	if !found {
+		return 0, 0, false
+	}
+	millis, err := strconv.ParseInt(first, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	seq, err = strconv.ParseInt(second, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return millis, seq, true
+}
@@ -5,22 +5,120 @@ import (
 	"github.com/utpal74/track-my-tasks-backend/handlers"
 )
 
-func SetupRoutes(router *gin.Engine, taskHandler *handlers.TasksHandler, authHandler *handlers.AuthHandler) {
+func SetupRoutes(router *gin.Engine, taskHandler *handlers.TasksHandler, authHandler *handlers.AuthHandler, projectHandler *handlers.ProjectsHandler, commentHandler *handlers.CommentsHandler, attachmentHandler *handlers.AttachmentsHandler, sharingHandler *handlers.SharingHandler, workspaceHandler *handlers.WorkspacesHandler, notificationHandler *handlers.NotificationsHandler, timeHandler *handlers.TimeHandler, pomodoroHandler *handlers.PomodoroHandler, transferHandler *handlers.TransferHandler, calendarHandler *handlers.CalendarHandler, eventsHandler *handlers.EventsHandler, webhooksHandler *handlers.WebhooksHandler, inboundHandler *handlers.InboundEmailHandler) {
 	router.GET("/", taskHandler.StatusHandler)
 	router.POST("/signin", authHandler.SignInHandler)
 	router.POST("/signup", authHandler.SignUpHandler)
 	router.POST("/signout", authHandler.SignOutHandler)
+	router.GET("/attachments/:attachmentId/download", attachmentHandler.DownloadAttachmentHandler)
+	router.GET("/ical/:token", calendarHandler.CalendarFeedHandler)
+	router.POST("/inbound/email", inboundHandler.ReceiveEmailHandler)
+	router.GET("/.well-known/caldav", taskHandler.DAVWellKnownHandler)
+	// Browsers can't set the Authorization header on EventSource and WebSocket connections, they pass a ticket
+	router.GET("/events", authHandler.StreamTicketMiddleware(), eventsHandler.StreamHandler)
+
+	// CalDAV clients authenticate with basic auth or personal access tokens
+	dav := router.Group("/dav")
+	dav.Use(authHandler.TokenAuthMiddleware(), workspaceHandler.WorkspaceMiddleware())
+	{
+		dav.OPTIONS("/*path", taskHandler.DAVOptionsHandler)
+		dav.Handle("PROPFIND", "/*path", taskHandler.DAVPropfindHandler)
+		dav.Handle("REPORT", "/*path", taskHandler.DAVReportHandler)
+		dav.GET("/*path", taskHandler.DAVGetHandler)
+		dav.PUT("/*path", taskHandler.DAVPutHandler)
+		dav.DELETE("/*path", taskHandler.DAVDeleteHandler)
+	}
 
 	auth := router.Group("/")
-	auth.Use(authHandler.AuthMiddleware())
+	auth.Use(authHandler.AuthMiddleware(), workspaceHandler.WorkspaceMiddleware())
 
 	// authenticated api request
 	{
 		auth.GET("/tasks", taskHandler.GetAllTasksHandler)
 		auth.POST("/tasks/create", taskHandler.NewTaskHandler)
+		auth.POST("/tasks/quick", taskHandler.QuickAddHandler)
+		auth.POST("/tasks/bulk", taskHandler.BulkTasksHandler)
+		auth.GET("/sync", taskHandler.SyncHandler)
+		auth.POST("/sync", taskHandler.SyncMutationsHandler)
 		auth.PUT("/tasks/update/:id", taskHandler.UpdateTaskHandler)
 		auth.DELETE("/tasks/delete/:id", taskHandler.DeleteTaskHandler)
 		auth.GET("/tasks/search/:id", taskHandler.SearchTaskHandler)
+		auth.GET("/tasks/plan", taskHandler.PlanHandler)
+		auth.GET("/tasks/matrix", taskHandler.MatrixHandler)
+		auth.GET("/tasks/trash", taskHandler.GetTrashHandler)
+		auth.GET("/tasks/assigned", taskHandler.AssignedToMeHandler)
+		auth.POST("/tasks/trash/:id/restore", taskHandler.RestoreTaskHandler)
+		auth.DELETE("/tasks/trash/:id", taskHandler.PermanentDeleteHandler)
+		auth.POST("/tasks/:id/dependencies", taskHandler.AddDependencyHandler)
+		auth.DELETE("/tasks/:id/dependencies/:blockerId", taskHandler.RemoveDependencyHandler)
+		auth.POST("/tasks/:id/status", taskHandler.TransitionStatusHandler)
+		auth.POST("/tasks/:id/move", taskHandler.MoveTaskHandler)
+		auth.PUT("/tasks/:id/assignees", taskHandler.SetAssigneesHandler)
+		auth.GET("/tasks/:id/history", taskHandler.TaskHistoryHandler)
+		auth.POST("/tasks/:id/undo", taskHandler.UndoTaskHandler)
+		auth.GET("/tasks/:id/comments", commentHandler.GetCommentsHandler)
+		auth.POST("/tasks/:id/comments", commentHandler.NewCommentHandler)
+		auth.PUT("/tasks/:id/comments/:commentId", commentHandler.UpdateCommentHandler)
+		auth.DELETE("/tasks/:id/comments/:commentId", commentHandler.DeleteCommentHandler)
+		auth.GET("/tasks/:id/attachments", attachmentHandler.GetAttachmentsHandler)
+		auth.POST("/tasks/:id/attachments", attachmentHandler.UploadAttachmentHandler)
+		auth.GET("/tasks/:id/attachments/:attachmentId/url", attachmentHandler.AttachmentURLHandler)
+		auth.DELETE("/tasks/:id/attachments/:attachmentId", attachmentHandler.DeleteAttachmentHandler)
+		auth.POST("/tasks/:id/share", sharingHandler.ShareTaskHandler)
+		auth.DELETE("/tasks/:id/collaborators/:userId", sharingHandler.RemoveTaskCollaboratorHandler)
+		auth.POST("/tasks/:id/timer/start", timeHandler.StartTimerHandler)
+		auth.GET("/tasks/:id/time", timeHandler.GetTimeEntriesHandler)
+		auth.POST("/tasks/:id/time", timeHandler.NewTimeEntryHandler)
+		auth.DELETE("/tasks/:id/time/:entryId", timeHandler.DeleteTimeEntryHandler)
+		auth.GET("/timer", timeHandler.GetTimerHandler)
+		auth.POST("/timer/stop", timeHandler.StopTimerHandler)
+		auth.GET("/reports/time", timeHandler.TimeReportHandler)
+		auth.POST("/tasks/:id/pomodoro", pomodoroHandler.StartPomodoroHandler)
+		auth.GET("/tasks/:id/pomodoros", pomodoroHandler.GetTaskPomodorosHandler)
+		auth.GET("/pomodoro", pomodoroHandler.GetPomodoroHandler)
+		auth.POST("/pomodoro/stop", pomodoroHandler.StopPomodoroHandler)
+		auth.GET("/pomodoros/stats", pomodoroHandler.PomodoroStatsHandler)
+		auth.GET("/templates", taskHandler.GetTemplatesHandler)
+		auth.POST("/templates", taskHandler.NewTemplateHandler)
+		auth.GET("/templates/:id", taskHandler.GetTemplateHandler)
+		auth.PUT("/templates/:id", taskHandler.UpdateTemplateHandler)
+		auth.DELETE("/templates/:id", taskHandler.DeleteTemplateHandler)
+		auth.POST("/templates/:id/instantiate", taskHandler.InstantiateTemplateHandler)
+		auth.GET("/export", transferHandler.ExportHandler)
+		auth.POST("/import", transferHandler.ImportHandler)
+		auth.GET("/imports/:id", transferHandler.GetImportHandler)
+		auth.GET("/tokens", authHandler.GetAccessTokensHandler)
+		auth.POST("/tokens", authHandler.NewAccessTokenHandler)
+		auth.DELETE("/tokens/:id", authHandler.DeleteAccessTokenHandler)
+		auth.GET("/calendar/feed", calendarHandler.GetCalendarFeedHandler)
+		auth.POST("/calendar/feed", calendarHandler.RotateCalendarFeedHandler)
+		auth.DELETE("/calendar/feed", calendarHandler.DeleteCalendarFeedHandler)
+		auth.GET("/inbound/address", inboundHandler.GetInboundAddressHandler)
+		auth.POST("/inbound/address", inboundHandler.RotateInboundAddressHandler)
+		auth.DELETE("/inbound/address", inboundHandler.DeleteInboundAddressHandler)
+		auth.GET("/webhooks", webhooksHandler.ListWebhooksHandler)
+		auth.POST("/webhooks", webhooksHandler.CreateWebhookHandler)
+		auth.PUT("/webhooks/:id", webhooksHandler.UpdateWebhookHandler)
+		auth.DELETE("/webhooks/:id", webhooksHandler.DeleteWebhookHandler)
+		auth.GET("/webhooks/:id/deliveries", webhooksHandler.WebhookDeliveriesHandler)
+		auth.POST("/webhooks/:id/test", webhooksHandler.TestWebhookHandler)
+		auth.GET("/projects", projectHandler.GetAllProjectsHandler)
+		auth.POST("/projects", projectHandler.NewProjectHandler)
+		auth.PUT("/projects/:id/statuses", projectHandler.UpdateStatusesHandler)
+		auth.POST("/projects/:id/share", sharingHandler.ShareProjectHandler)
+		auth.DELETE("/projects/:id/collaborators/:userId", sharingHandler.RemoveProjectCollaboratorHandler)
+		auth.GET("/invitations", sharingHandler.GetInvitationsHandler)
+		auth.POST("/invitations/:id/accept", sharingHandler.AcceptInvitationHandler)
+		auth.POST("/invitations/:id/decline", sharingHandler.DeclineInvitationHandler)
+		auth.GET("/workspaces", workspaceHandler.GetWorkspacesHandler)
+		auth.POST("/workspaces", workspaceHandler.NewWorkspaceHandler)
+		auth.GET("/workspaces/current", workspaceHandler.CurrentWorkspaceHandler)
+		auth.POST("/workspaces/current/members", workspaceHandler.AddMemberHandler)
+		auth.DELETE("/workspaces/current/members/:userId", workspaceHandler.RemoveMemberHandler)
+		auth.POST("/workspaces/:id/switch", workspaceHandler.SwitchWorkspaceHandler)
+		auth.GET("/notifications", notificationHandler.GetNotificationsHandler)
+		auth.POST("/notifications/:id/read", notificationHandler.MarkNotificationReadHandler)
 		auth.POST("/refresh", authHandler.RefreshHandler)
+		auth.POST("/events/ticket", authHandler.StreamTicketHandler)
 	}
 }
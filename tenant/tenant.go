@@ -0,0 +1,278 @@
+// Package tenant isolates workspaces from each other. Collections holding workspace owned
+// documents are wrapped in a Collection, which scopes every query to the workspace carried
+// by the context, so handlers can't forget to.
+package tenant
+
+import (
+	"context"
+	"errors"
+
+	"github.com/utpal74/track-my-tasks-backend/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// field holding the workspace on every scoped document
+const field = "workspace_id"
+
+var (
+	ErrNoWorkspace   = errors.New("tenant: no workspace in context")
+	ErrQuotaExceeded = errors.New("tenant: workspace quota exceeded")
+)
+
+type workspaceKey struct{}
+type unscopedKey struct{}
+
+// WithWorkspace - returns a context whose queries are scoped to the workspace
+func WithWorkspace(ctx context.Context, workspace model.Workspace) context.Context {
+	return context.WithValue(ctx, workspaceKey{}, workspace)
+}
+
+// Workspace - returns the workspace set by WithWorkspace
+func Workspace(ctx context.Context) (model.Workspace, bool) {
+	workspace, ok := ctx.Value(workspaceKey{}).(model.Workspace)
+	return workspace, ok
+}
+
+// Unscoped - returns a context whose queries span all workspaces, for background jobs and
+// for the few lookups that have to cross workspaces. Queries without a workspace fail otherwise.
+func Unscoped(ctx context.Context) context.Context {
+	return context.WithValue(ctx, unscopedKey{}, true)
+}
+
+// Collection - a *mongo.Collection whose queries are restricted to the workspace of the context
+type Collection struct {
+	coll *mongo.Collection
+}
+
+func NewCollection(coll *mongo.Collection) *Collection {
+	return &Collection{coll: coll}
+}
+
+func (c *Collection) Name() string {
+	return c.coll.Name()
+}
+
+// scope - adds the workspace of the context to filter, which is returned unchanged for unscoped contexts
+func (c *Collection) scope(ctx context.Context, filter interface{}) (interface{}, error) {
+	if unscoped, _ := ctx.Value(unscopedKey{}).(bool); unscoped {
+		return filter, nil
+	}
+
+	workspace, ok := Workspace(ctx)
+	if !ok {
+		return nil, ErrNoWorkspace
+	}
+
+	if m, ok := filter.(bson.M); ok {
+		scoped := make(bson.M, len(m)+1)
+		for key, value := range m {
+			scoped[key] = value
+		}
+		scoped[field] = workspace.ID
+		return scoped, nil
+	}
+	return bson.M{"$and": bson.A{filter, bson.M{field: workspace.ID}}}, nil
+}
+
+// stamp - sets the workspace of the context on documents about to be inserted, after checking the quota
+func (c *Collection) stamp(ctx context.Context, documents []interface{}) ([]interface{}, error) {
+	if unscoped, _ := ctx.Value(unscopedKey{}).(bool); unscoped {
+		return documents, nil
+	}
+
+	workspace, ok := Workspace(ctx)
+	if !ok {
+		return nil, ErrNoWorkspace
+	}
+
+	if limit := workspace.Quota.Limit(c.coll.Name()); limit > 0 {
+		count, err := c.coll.CountDocuments(ctx, bson.M{field: workspace.ID})
+		if err != nil {
+			return nil, err
+		}
+		if count+int64(len(documents)) > int64(limit) {
+			return nil, ErrQuotaExceeded
+		}
+	}
+
+	stamped := make([]interface{}, 0, len(documents))
+	for _, document := range documents {
+		raw, err := bson.Marshal(document)
+		if err != nil {
+			return nil, err
+		}
+
+		var doc bson.D
+		if err := bson.Unmarshal(raw, &doc); err != nil {
+			return nil, err
+		}
+
+		found := false
+		for i := range doc {
+			if doc[i].Key == field {
+				doc[i].Value = workspace.ID
+				found = true
+			}
+		}
+		if !found {
+			doc = append(doc, bson.E{Key: field, Value: workspace.ID})
+		}
+		stamped = append(stamped, doc)
+	}
+	return stamped, nil
+}
+
+func (c *Collection) Find(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (*mongo.Cursor, error) {
+	scoped, err := c.scope(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	return c.coll.Find(ctx, scoped, opts...)
+}
+
+func (c *Collection) FindOne(ctx context.Context, filter interface{}, opts ...*options.FindOneOptions) *mongo.SingleResult {
+	scoped, err := c.scope(ctx, filter)
+	if err != nil {
+		return mongo.NewSingleResultFromDocument(bson.D{}, err, nil)
+	}
+	return c.coll.FindOne(ctx, scoped, opts...)
+}
+
+func (c *Collection) FindOneAndUpdate(ctx context.Context, filter interface{}, update interface{}, opts ...*options.FindOneAndUpdateOptions) *mongo.SingleResult {
+	scoped, err := c.scope(ctx, filter)
+	if err != nil {
+		return mongo.NewSingleResultFromDocument(bson.D{}, err, nil)
+	}
+	return c.coll.FindOneAndUpdate(ctx, scoped, update, opts...)
+}
+
+func (c *Collection) FindOneAndDelete(ctx context.Context, filter interface{}, opts ...*options.FindOneAndDeleteOptions) *mongo.SingleResult {
+	scoped, err := c.scope(ctx, filter)
+	if err != nil {
+		return mongo.NewSingleResultFromDocument(bson.D{}, err, nil)
+	}
+	return c.coll.FindOneAndDelete(ctx, scoped, opts...)
+}
+
+func (c *Collection) CountDocuments(ctx context.Context, filter interface{}, opts ...*options.CountOptions) (int64, error) {
+	scoped, err := c.scope(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	return c.coll.CountDocuments(ctx, scoped, opts...)
+}
+
+func (c *Collection) Distinct(ctx context.Context, fieldName string, filter interface{}, opts ...*options.DistinctOptions) ([]interface{}, error) {
+	scoped, err := c.scope(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	return c.coll.Distinct(ctx, fieldName, scoped, opts...)
+}
+
+// InsertOne - inserts the document into the workspace of the context, failing with ErrQuotaExceeded when it is full
+func (c *Collection) InsertOne(ctx context.Context, document interface{}, opts ...*options.InsertOneOptions) (*mongo.InsertOneResult, error) {
+	stamped, err := c.stamp(ctx, []interface{}{document})
+	if err != nil {
+		return nil, err
+	}
+	return c.coll.InsertOne(ctx, stamped[0], opts...)
+}
+
+// InsertMany - inserts the documents into the workspace of the context, failing with ErrQuotaExceeded unless all of them fit
+func (c *Collection) InsertMany(ctx context.Context, documents []interface{}, opts ...*options.InsertManyOptions) (*mongo.InsertManyResult, error) {
+	stamped, err := c.stamp(ctx, documents)
+	if err != nil {
+		return nil, err
+	}
+	return c.coll.InsertMany(ctx, stamped, opts...)
+}
+
+func (c *Collection) UpdateOne(ctx context.Context, filter interface{}, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
+	scoped, err := c.scope(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	return c.coll.UpdateOne(ctx, scoped, update, opts...)
+}
+
+func (c *Collection) UpdateMany(ctx context.Context, filter interface{}, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
+	scoped, err := c.scope(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	return c.coll.UpdateMany(ctx, scoped, update, opts...)
+}
+
+func (c *Collection) DeleteOne(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error) {
+	scoped, err := c.scope(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	return c.coll.DeleteOne(ctx, scoped, opts...)
+}
+
+func (c *Collection) DeleteMany(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error) {
+	scoped, err := c.scope(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	return c.coll.DeleteMany(ctx, scoped, opts...)
+}
+
+// BulkWrite - scopes the filter of every update and delete model and stamps inserted documents, the quota is checked
+// for all inserts of the batch together. Replacements aren't supported in scoped contexts.
+func (c *Collection) BulkWrite(ctx context.Context, models []mongo.WriteModel, opts ...*options.BulkWriteOptions) (*mongo.BulkWriteResult, error) {
+	var documents []interface{}
+	for _, writeModel := range models {
+		if m, ok := writeModel.(*mongo.InsertOneModel); ok {
+			documents = append(documents, m.Document)
+		}
+	}
+
+	var stamped []interface{}
+	if len(documents) > 0 {
+		var err error
+		if stamped, err = c.stamp(ctx, documents); err != nil {
+			return nil, err
+		}
+	}
+
+	scopedModels := make([]mongo.WriteModel, 0, len(models))
+	for _, writeModel := range models {
+		var err error
+		switch m := writeModel.(type) {
+		case *mongo.InsertOneModel:
+			copied := *m
+			copied.Document, stamped = stamped[0], stamped[1:]
+			writeModel = &copied
+		case *mongo.UpdateOneModel:
+			copied := *m
+			copied.Filter, err = c.scope(ctx, m.Filter)
+			writeModel = &copied
+		case *mongo.UpdateManyModel:
+			copied := *m
+			copied.Filter, err = c.scope(ctx, m.Filter)
+			writeModel = &copied
+		case *mongo.DeleteOneModel:
+			copied := *m
+			copied.Filter, err = c.scope(ctx, m.Filter)
+			writeModel = &copied
+		case *mongo.DeleteManyModel:
+			copied := *m
+			copied.Filter, err = c.scope(ctx, m.Filter)
+			writeModel = &copied
+		default:
+			if unscoped, _ := ctx.Value(unscopedKey{}).(bool); !unscoped {
+				return nil, errors.New("tenant: unsupported write model in scoped bulk write")
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		scopedModels = append(scopedModels, writeModel)
+	}
+	return c.coll.BulkWrite(ctx, scopedModels, opts...)
+}
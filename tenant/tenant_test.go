@@ -0,0 +1,236 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/utpal74/track-my-tasks-backend/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+var workspace = model.Workspace{ID: primitive.NewObjectID(), Quota: model.WorkspaceQuota{MaxTasks: 3}}
+
+func TestScope(t *testing.T) {
+	other := primitive.NewObjectID()
+	scoped := WithWorkspace(context.Background(), workspace)
+
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		filter interface{}
+		want   interface{}
+	}{
+		{
+			name:   "map filter gets the workspace",
+			ctx:    scoped,
+			filter: bson.M{"title": "Buy milk"},
+			want:   bson.M{"title": "Buy milk", field: workspace.ID},
+		},
+		{
+			name:   "workspace in the filter is overridden",
+			ctx:    scoped,
+			filter: bson.M{field: other},
+			want:   bson.M{field: workspace.ID},
+		},
+		{
+			name:   "other filters are combined with $and",
+			ctx:    scoped,
+			filter: bson.D{{Key: field, Value: other}},
+			want:   bson.M{"$and": bson.A{bson.D{{Key: field, Value: other}}, bson.M{field: workspace.ID}}},
+		},
+		{
+			name:   "unscoped contexts keep the filter",
+			ctx:    Unscoped(context.Background()),
+			filter: bson.M{field: other},
+			want:   bson.M{field: other},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			before := fmt.Sprint(test.filter)
+			got, err := (&Collection{}).scope(test.ctx, test.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("scope() = %v, want %v", got, test.want)
+			}
+			if after := fmt.Sprint(test.filter); after != before {
+				t.Errorf("scope() modified the filter to %v", after)
+			}
+		})
+	}
+}
+
+func TestNoWorkspace(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	mt.Run("fails", func(mt *mtest.T) {
+		coll := NewCollection(mt.Coll)
+		ctx := context.Background()
+
+		if _, err := coll.Find(ctx, bson.M{}); !errors.Is(err, ErrNoWorkspace) {
+			mt.Errorf("Find() error = %v, want ErrNoWorkspace", err)
+		}
+		if err := coll.FindOne(ctx, bson.M{}).Err(); !errors.Is(err, ErrNoWorkspace) {
+			mt.Errorf("FindOne() error = %v, want ErrNoWorkspace", err)
+		}
+		if _, err := coll.InsertOne(ctx, bson.M{}); !errors.Is(err, ErrNoWorkspace) {
+			mt.Errorf("InsertOne() error = %v, want ErrNoWorkspace", err)
+		}
+		if _, err := coll.BulkWrite(ctx, []mongo.WriteModel{mongo.NewDeleteOneModel().SetFilter(bson.M{})}); !errors.Is(err, ErrNoWorkspace) {
+			mt.Errorf("BulkWrite() error = %v, want ErrNoWorkspace", err)
+		}
+		if events := mt.GetAllStartedEvents(); len(events) != 0 {
+			mt.Errorf("sent %d commands without a workspace", len(events))
+		}
+	})
+}
+
+func TestStamp(t *testing.T) {
+	type task struct {
+		Title       string             `bson:"title"`
+		WorkspaceID primitive.ObjectID `bson:"workspace_id"`
+	}
+	other := primitive.NewObjectID()
+
+	stamped, err := (&Collection{coll: &mongo.Collection{}}).stamp(WithWorkspace(context.Background(), model.Workspace{ID: workspace.ID}), []interface{}{
+		task{Title: "Buy milk", WorkspaceID: other},
+		bson.M{"title": "Call mom"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []interface{}{
+		bson.D{{Key: "title", Value: "Buy milk"}, {Key: field, Value: workspace.ID}},
+		bson.D{{Key: "title", Value: "Call mom"}, {Key: field, Value: workspace.ID}},
+	}
+	if !reflect.DeepEqual(stamped, want) {
+		t.Errorf("stamp() = %v, want %v", stamped, want)
+	}
+
+	unscoped, err := (&Collection{}).stamp(Unscoped(context.Background()), []interface{}{task{WorkspaceID: other}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unscoped[0].(task).WorkspaceID != other {
+		t.Errorf("stamp() changed the workspace of an unscoped insert")
+	}
+}
+
+func TestQuota(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	ctx := WithWorkspace(context.Background(), workspace)
+	count := func(n int) bson.D {
+		return mtest.CreateCursorResponse(0, "db.tasks", mtest.FirstBatch, bson.D{{Key: "n", Value: n}})
+	}
+
+	mt.Run("fits", func(mt *mtest.T) {
+		coll := NewCollection(mt.DB.Collection("tasks"))
+		mt.AddMockResponses(count(2), mtest.CreateSuccessResponse())
+		if _, err := coll.InsertOne(ctx, bson.M{"title": "Buy milk"}); err != nil {
+			mt.Fatalf("InsertOne() error = %v", err)
+		}
+	})
+
+	mt.Run("full", func(mt *mtest.T) {
+		coll := NewCollection(mt.DB.Collection("tasks"))
+		mt.AddMockResponses(count(3))
+		if _, err := coll.InsertOne(ctx, bson.M{"title": "Buy milk"}); !errors.Is(err, ErrQuotaExceeded) {
+			mt.Fatalf("InsertOne() error = %v, want ErrQuotaExceeded", err)
+		}
+		if started := mt.GetAllStartedEvents(); len(started) != 1 || started[0].CommandName != "aggregate" {
+			mt.Errorf("sent %v, want only the count", started)
+		}
+	})
+
+	mt.Run("checked for all inserts together", func(mt *mtest.T) {
+		coll := NewCollection(mt.DB.Collection("tasks"))
+		mt.AddMockResponses(count(2))
+		_, err := coll.BulkWrite(ctx, []mongo.WriteModel{
+			mongo.NewInsertOneModel().SetDocument(bson.M{"title": "Buy milk"}),
+			mongo.NewInsertOneModel().SetDocument(bson.M{"title": "Call mom"}),
+		})
+		if !errors.Is(err, ErrQuotaExceeded) {
+			mt.Fatalf("BulkWrite() error = %v, want ErrQuotaExceeded", err)
+		}
+	})
+
+	mt.Run("not counted in unlimited collections", func(mt *mtest.T) {
+		coll := NewCollection(mt.DB.Collection("comments"))
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+		if _, err := coll.InsertOne(ctx, bson.M{"body": "Hi"}); err != nil {
+			mt.Fatalf("InsertOne() error = %v", err)
+		}
+		if started := mt.GetAllStartedEvents(); len(started) != 1 || started[0].CommandName != "insert" {
+			mt.Errorf("sent %v, want only the insert", started)
+		}
+	})
+}
+
+func TestBulkWrite(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	other := primitive.NewObjectID()
+
+	mt.Run("scoped", func(mt *mtest.T) {
+		coll := NewCollection(mt.Coll)
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}),
+		)
+		_, err := coll.BulkWrite(WithWorkspace(context.Background(), workspace), []mongo.WriteModel{
+			mongo.NewInsertOneModel().SetDocument(bson.M{"title": "Buy milk", field: other}),
+			mongo.NewUpdateOneModel().SetFilter(bson.M{"title": "Buy milk"}).SetUpdate(bson.M{"$set": bson.M{"done": true}}),
+			mongo.NewDeleteManyModel().SetFilter(bson.M{field: other}),
+		})
+		if err != nil {
+			mt.Fatal(err)
+		}
+
+		inserted := mt.GetStartedEvent().Command.Lookup("documents", "0", field)
+		if id, _ := inserted.ObjectIDOK(); id != workspace.ID {
+			mt.Errorf("inserted into workspace %v, want %v", inserted, workspace.ID)
+		}
+		updated := mt.GetStartedEvent().Command.Lookup("updates", "0", "q", field)
+		if id, _ := updated.ObjectIDOK(); id != workspace.ID {
+			mt.Errorf("updated in workspace %v, want %v", updated, workspace.ID)
+		}
+		deleted := mt.GetStartedEvent().Command.Lookup("deletes", "0", "q", field)
+		if id, _ := deleted.ObjectIDOK(); id != workspace.ID {
+			mt.Errorf("deleted in workspace %v, want %v", deleted, workspace.ID)
+		}
+	})
+
+	mt.Run("replacements are refused", func(mt *mtest.T) {
+		coll := NewCollection(mt.Coll)
+		_, err := coll.BulkWrite(WithWorkspace(context.Background(), workspace), []mongo.WriteModel{
+			mongo.NewReplaceOneModel().SetFilter(bson.M{}).SetReplacement(bson.M{"title": "Buy milk"}),
+		})
+		if err == nil {
+			mt.Error("BulkWrite() replaced a document across workspaces")
+		}
+	})
+
+	mt.Run("unscoped", func(mt *mtest.T) {
+		coll := NewCollection(mt.Coll)
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}))
+		_, err := coll.BulkWrite(Unscoped(context.Background()), []mongo.WriteModel{
+			mongo.NewDeleteOneModel().SetFilter(bson.M{field: other}),
+		})
+		if err != nil {
+			mt.Fatal(err)
+		}
+		deleted := mt.GetStartedEvent().Command.Lookup("deletes", "0", "q", field)
+		if id, _ := deleted.ObjectIDOK(); id != other {
+			mt.Errorf("deleted in workspace %v, want %v", deleted, other)
+		}
+	})
+}
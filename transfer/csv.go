@@ -0,0 +1,208 @@
+package transfer
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// csvColumns - comments are a JSON array in one column so they survive a round trip
+var csvColumns = []string{
+	"id", "parent_id", "title", "comment", "done", "status", "priority", "important", "due_date",
+	"project", "labels", "estimate_minutes", "checklist", "comments", "created_at",
+}
+
+// labelSeparator - labels and checklist items are joined in one column
+const labelSeparator = ";"
+
+func writeCSV(w io.Writer, doc Document) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(csvColumns); err != nil {
+		return err
+	}
+
+	for _, task := range doc.Tasks {
+		var checklist []string
+		for _, item := range task.Checklist {
+			mark := "[ ] "
+			if item.Done {
+				mark = "[x] "
+			}
+			checklist = append(checklist, mark+item.Text)
+		}
+
+		comments := ""
+		if len(task.Comments) > 0 {
+			encoded, err := json.Marshal(task.Comments)
+			if err != nil {
+				return err
+			}
+			comments = string(encoded)
+		}
+
+		record := []string{
+			task.ID,
+			task.ParentID,
+			task.Title,
+			task.Comment,
+			strconv.FormatBool(task.Done),
+			task.Status,
+			task.Priority,
+			strconv.FormatBool(task.Important),
+			formatTime(task.DueDate),
+			task.Project,
+			strings.Join(task.Labels, labelSeparator),
+			formatEstimate(task.Estimate),
+			strings.Join(checklist, labelSeparator),
+			comments,
+			formatTime(task.CreatedAt),
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// parseCSV - columns are found by the header, only title is required and unknown columns are ignored
+func parseCSV(r io.Reader) ([]Row, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.New("the file is empty")
+	} else if err != nil {
+		return nil, err
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	if _, ok := columns["title"]; !ok {
+		return nil, errors.New("the header has no title column")
+	}
+
+	var rows []Row
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		row := Row{Line: line}
+		row.Task, row.Err = csvTask(field)
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func csvTask(field func(string) string) (Task, error) {
+	task := Task{
+		ID:       field("id"),
+		ParentID: field("parent_id"),
+		Title:    field("title"),
+		Comment:  field("comment"),
+		Status:   field("status"),
+		Priority: strings.ToLower(field("priority")),
+		Project:  field("project"),
+	}
+
+	var err error
+	if task.Done, err = parseBool(field("done")); err != nil {
+		return task, rowError("invalid done: %q", field("done"))
+	}
+	if task.Important, err = parseBool(field("important")); err != nil {
+		return task, rowError("invalid important: %q", field("important"))
+	}
+	if task.DueDate, err = parseTime(field("due_date")); err != nil {
+		return task, rowError("invalid due_date: %q", field("due_date"))
+	}
+	if task.CreatedAt, err = parseTime(field("created_at")); err != nil {
+		return task, rowError("invalid created_at: %q", field("created_at"))
+	}
+	if value := field("estimate_minutes"); value != "" {
+		if task.Estimate, err = strconv.Atoi(value); err != nil || task.Estimate < 0 {
+			return task, rowError("invalid estimate_minutes: %q", value)
+		}
+	}
+
+	for _, label := range strings.Split(field("labels"), labelSeparator) {
+		if label = strings.TrimSpace(label); label != "" {
+			task.Labels = append(task.Labels, label)
+		}
+	}
+
+	for _, item := range strings.Split(field("checklist"), labelSeparator) {
+		item = strings.TrimSpace(item)
+		done := strings.HasPrefix(item, "[x] ") || strings.HasPrefix(item, "[X] ")
+		item = strings.TrimSpace(strings.TrimPrefix(strings.TrimPrefix(strings.TrimPrefix(item, "[ ] "), "[x] "), "[X] "))
+		if item != "" {
+			task.Checklist = append(task.Checklist, ChecklistItem{Text: item, Done: done})
+		}
+	}
+
+	if value := field("comments"); value != "" {
+		if err := json.Unmarshal([]byte(value), &task.Comments); err != nil {
+			return task, rowError("invalid comments: %v", err)
+		}
+	}
+
+	return task, nil
+}
+
+func parseBool(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "", "0", "false", "no":
+		return false, nil
+	case "1", "true", "yes", "x":
+		return true, nil
+	}
+	return false, errors.New("not a boolean")
+}
+
+// parseTime - RFC 3339 or a plain date, which is read as midnight UTC
+func parseTime(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func formatEstimate(minutes int) string {
+	if minutes == 0 {
+		return ""
+	}
+	return strconv.Itoa(minutes)
+}
@@ -0,0 +1,42 @@
+package transfer
+
+import (
+	"encoding/json"
+	"io"
+)
+
+func writeJSON(w io.Writer, doc Document) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(doc)
+}
+
+// parseJSON - accepts an exported document or a plain array of tasks. Tasks are read one by one so a task with a
+// wrong type in it fails alone.
+func parseJSON(r io.Reader) ([]Row, error) {
+	var raw json.RawMessage
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, err
+	}
+
+	var items []json.RawMessage
+	if err := json.Unmarshal(raw, &items); err != nil {
+		var doc struct {
+			Tasks []json.RawMessage `json:"tasks"`
+		}
+		if err := json.Unmarshal(raw, &doc); err != nil {
+			return nil, err
+		}
+		items = doc.Tasks
+	}
+
+	rows := make([]Row, 0, len(items))
+	for i, item := range items {
+		row := Row{Line: i + 1}
+		if err := json.Unmarshal(item, &row.Task); err != nil {
+			row.Err = rowError("invalid task: %v", err)
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
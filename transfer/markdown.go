@@ -0,0 +1,265 @@
+package transfer
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// The Markdown checklist keeps titles, done, subtasks, projects (as headings), descriptions, comments (as quotes),
+// labels (#label), priority (!high), important (!!) and the due date; checklists, estimates and statuses are lost.
+//
+//	## Project
+//	- [ ] Title #label !high !! (due 2026-03-01)
+//	  A description line
+//	  > **alice** (2026-02-01T10:00:00Z): a comment
+//	  - [x] Subtask
+
+var (
+	markdownItem    = regexp.MustCompile(`^([ \t]*)[-*+] \[([ xX])\] (.*)$`)
+	markdownHeading = regexp.MustCompile(`^(#{1,6}) +(.*?) *#*$`)
+	markdownDue     = regexp.MustCompile(` *\(due ([0-9][^)]*)\)$`)
+	markdownComment = regexp.MustCompile(`^\*\*(.+?)\*\* \(([^)]+)\):? ?(.*)$`)
+)
+
+func writeMarkdown(w io.Writer, doc Document) error {
+	out := bufio.NewWriter(w)
+	fmt.Fprintln(out, "# Tasks")
+
+	children := make(map[string][]Task)
+	ids := make(map[string]bool, len(doc.Tasks))
+	for _, task := range doc.Tasks {
+		ids[task.ID] = true
+	}
+
+	byProject := make(map[string][]Task)
+	var projects []string
+	for _, project := range doc.Projects {
+		projects = append(projects, project.Name)
+	}
+	for _, task := range doc.Tasks {
+		if task.ParentID != "" && ids[task.ParentID] {
+			children[task.ParentID] = append(children[task.ParentID], task)
+			continue
+		}
+		if _, ok := byProject[task.Project]; !ok && task.Project != "" && !containsString(projects, task.Project) {
+			projects = append(projects, task.Project)
+		}
+		byProject[task.Project] = append(byProject[task.Project], task)
+	}
+
+	var write func(task Task, depth int)
+	write = func(task Task, depth int) {
+		indent := strings.Repeat("  ", depth)
+		mark := " "
+		if task.Done {
+			mark = "x"
+		}
+		fmt.Fprintf(out, "%s- [%s] %s\n", indent, mark, markdownTitle(task))
+
+		for _, line := range strings.Split(strings.TrimSpace(task.Comment), "\n") {
+			if line = strings.TrimRight(line, " \r"); line != "" {
+				fmt.Fprintf(out, "%s  %s\n", indent, line)
+			}
+		}
+		for _, comment := range task.Comments {
+			lines := strings.Split(strings.TrimSpace(comment.Body), "\n")
+			fmt.Fprintf(out, "%s  > **%s** (%s): %s\n", indent, comment.Author, comment.CreatedAt.UTC().Format(time.RFC3339), lines[0])
+			for _, line := range lines[1:] {
+				fmt.Fprintf(out, "%s  > %s\n", indent, strings.TrimRight(line, " \r"))
+			}
+		}
+		for _, child := range children[task.ID] {
+			write(child, depth+1)
+		}
+	}
+
+	if tasks := byProject[""]; len(tasks) > 0 {
+		fmt.Fprintln(out)
+		for _, task := range tasks {
+			write(task, 0)
+		}
+	}
+	for _, project := range projects {
+		fmt.Fprintf(out, "\n## %s\n\n", project)
+		for _, task := range byProject[project] {
+			write(task, 0)
+		}
+	}
+
+	return out.Flush()
+}
+
+func markdownTitle(task Task) string {
+	title := strings.ReplaceAll(task.Title, "\n", " ")
+	for _, label := range task.Labels {
+		title += " #" + label
+	}
+	if task.Priority != "" && task.Priority != "none" {
+		title += " !" + task.Priority
+	}
+	if task.Important {
+		title += " !!"
+	}
+	if task.DueDate != nil {
+		due := task.DueDate.UTC()
+		if due.Equal(due.Truncate(24 * time.Hour)) {
+			title += " (due " + due.Format("2006-01-02") + ")"
+		} else {
+			title += " (due " + due.Format(time.RFC3339) + ")"
+		}
+	}
+	return title
+}
+
+type markdownParent struct {
+	indent int
+	id     string
+	path   string
+}
+
+// parseMarkdown - Markdown has no IDs, a task's ID is a hash of its project, its parents' titles and its own title
+// (counting repeats), so importing the same file again finds the same tasks
+func parseMarkdown(r io.Reader) ([]Row, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var rows []Row
+	var stack []markdownParent
+	project := ""
+	seen := make(map[string]int)
+
+	current := -1 // row the description and comment lines below belong to
+	currentIndent := 0
+	inComment := false
+
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimRight(scanner.Text(), " \r")
+
+		if match := markdownHeading.FindStringSubmatch(text); match != nil {
+			project = ""
+			if len(match[1]) > 1 {
+				project = match[2]
+			}
+			stack, current = nil, -1
+			continue
+		}
+
+		if match := markdownItem.FindStringSubmatch(text); match != nil {
+			indent := indentWidth(match[1])
+			for len(stack) > 0 && stack[len(stack)-1].indent >= indent {
+				stack = stack[:len(stack)-1]
+			}
+
+			row := Row{Line: line, Task: Task{Done: match[2] != " ", Project: project}}
+			row.Task.Title, row.Err = parseMarkdownTitle(match[3], &row.Task)
+
+			path := project
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				row.Task.ParentID = parent.id
+				path = parent.path
+			}
+			path += "\x00" + row.Task.Title
+			seen[path]++
+			row.Task.ID = hashedID("md", fmt.Sprintf("%s\x00%d", path, seen[path]))
+
+			stack = append(stack, markdownParent{indent: indent, id: row.Task.ID, path: path})
+			rows = append(rows, row)
+			current, currentIndent, inComment = len(rows)-1, indent, false
+			continue
+		}
+
+		trimmed := strings.TrimSpace(text)
+		if trimmed == "" {
+			inComment = false
+			continue
+		}
+		if current < 0 || indentWidth(text[:len(text)-len(strings.TrimLeft(text, " \t"))]) <= currentIndent {
+			current = -1
+			continue
+		}
+
+		task := &rows[current].Task
+		if strings.HasPrefix(trimmed, ">") {
+			quoted := strings.TrimPrefix(strings.TrimPrefix(trimmed, ">"), " ")
+			if match := markdownComment.FindStringSubmatch(quoted); match != nil {
+				comment := Comment{Author: match[1], Body: match[3]}
+				if created, err := time.Parse(time.RFC3339, match[2]); err == nil {
+					comment.CreatedAt = created
+				}
+				task.Comments = append(task.Comments, comment)
+			} else if inComment {
+				last := &task.Comments[len(task.Comments)-1]
+				last.Body += "\n" + quoted
+			} else {
+				task.Comments = append(task.Comments, Comment{Body: quoted})
+			}
+			inComment = true
+			continue
+		}
+
+		inComment = false
+		if task.Comment != "" {
+			task.Comment += "\n"
+		}
+		task.Comment += trimmed
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// parseMarkdownTitle - takes the due date, labels, priority and important mark off the end of the title
+func parseMarkdownTitle(text string, task *Task) (string, error) {
+	var err error
+	if match := markdownDue.FindStringSubmatch(text); match != nil {
+		if task.DueDate, err = parseTime(match[1]); err != nil {
+			err = rowError("invalid due date: %q", match[1])
+		}
+		text = text[:len(text)-len(match[0])]
+	}
+
+	fields := strings.Fields(text)
+	for len(fields) > 1 {
+		last := fields[len(fields)-1]
+		switch {
+		case last == "!!":
+			task.Important = true
+		case len(last) > 1 && last[0] == '#' && last[1] != '#':
+			task.Labels = append([]string{last[1:]}, task.Labels...)
+		case len(last) > 1 && last[0] == '!' && last[1] != '!':
+			task.Priority = strings.ToLower(last[1:])
+		default:
+			return strings.Join(fields, " "), err
+		}
+		fields = fields[:len(fields)-1]
+	}
+	return strings.Join(fields, " "), err
+}
+
+func indentWidth(indent string) int {
+	return len(strings.ReplaceAll(indent, "\t", "    "))
+}
+
+// hashedID - an ID for sources without IDs, e.g. hashedID("md", key) is "md:" and a hash of key
+func hashedID(prefix, key string) string {
+	sum := sha1.Sum([]byte(key))
+	return prefix + ":" + hex.EncodeToString(sum[:8])
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
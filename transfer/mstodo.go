@@ -0,0 +1,167 @@
+package transfer
+
+import (
+	"encoding/json"
+	"errors"
+	"html"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Microsoft To Do and Outlook tasks are read as Microsoft Graph returns them, lists with their tasks:
+//
+//	{"value": [{"id": "...", "displayName": "Groceries", "wellknownListName": "none", "tasks": [
+//	    {"id": "...", "title": "Milk", "status": "notStarted", "importance": "high",
+//	     "body": {"content": "...", "contentType": "text"}, "categories": ["Errand"],
+//	     "dueDateTime": {"dateTime": "2026-03-01T00:00:00.0000000", "timeZone": "UTC"},
+//	     "checklistItems": [{"displayName": "Oat", "isChecked": false}]}
+//	]}]}
+//
+// "lists" is accepted in place of "value". Lists become projects, except the default "Tasks" list whose tasks
+// stay outside of projects, categories become labels and checklist items the checklist. Recurrences,
+// reminders and linked resources are left out.
+
+type msTodoExport struct {
+	Value []msTodoList `json:"value"`
+	Lists []msTodoList `json:"lists"`
+}
+
+type msTodoList struct {
+	ID                string `json:"id"`
+	DisplayName       string `json:"displayName"`
+	WellknownListName string `json:"wellknownListName"`
+	Tasks             []struct {
+		ID         string `json:"id"`
+		Title      string `json:"title"`
+		Status     string `json:"status"`
+		Importance string `json:"importance"`
+		Body       struct {
+			Content     string `json:"content"`
+			ContentType string `json:"contentType"`
+		} `json:"body"`
+		Categories      []string        `json:"categories"`
+		DueDateTime     *msTodoDateTime `json:"dueDateTime"`
+		CreatedDateTime string          `json:"createdDateTime"`
+		ChecklistItems  []struct {
+			DisplayName string `json:"displayName"`
+			IsChecked   bool   `json:"isChecked"`
+		} `json:"checklistItems"`
+		Recurrence      json.RawMessage   `json:"recurrence"`
+		IsReminderOn    bool              `json:"isReminderOn"`
+		LinkedResources []json.RawMessage `json:"linkedResources"`
+	} `json:"tasks"`
+}
+
+type msTodoDateTime struct {
+	DateTime string `json:"dateTime"`
+	TimeZone string `json:"timeZone"`
+}
+
+var (
+	msTodoBreak = regexp.MustCompile(`(?i)<br\s*/?>|</p>|</div>|</li>`)
+	msTodoTag   = regexp.MustCompile(`<[^>]*>`)
+)
+
+func parseMSTodo(r io.Reader) (Import, error) {
+	var imported Import
+	var m mappings
+
+	var export msTodoExport
+	if err := json.NewDecoder(r).Decode(&export); err != nil {
+		return imported, err
+	}
+	lists := append(export.Value, export.Lists...)
+	if len(lists) == 0 {
+		return imported, errors.New("not a Microsoft To Do export: it has no lists")
+	}
+
+	line := 0
+	for _, list := range lists {
+		project := strings.TrimSpace(list.DisplayName)
+		if list.WellknownListName == "defaultList" {
+			project = ""
+		} else {
+			m.add("To Do list", "project", 1)
+		}
+
+		for _, item := range list.Tasks {
+			line++
+			row := Row{Line: line, Task: Task{
+				ID:       "mstodo:" + item.ID,
+				Title:    item.Title,
+				Comment:  msTodoBody(item.Body.Content, item.Body.ContentType),
+				Done:     item.Status == "completed",
+				Priority: msTodoPriority(item.Importance),
+				Project:  project,
+				Labels:   item.Categories,
+			}}
+			for _, checklistItem := range item.ChecklistItems {
+				row.Task.Checklist = append(row.Task.Checklist, ChecklistItem{Text: checklistItem.DisplayName, Done: checklistItem.IsChecked})
+			}
+
+			if item.DueDateTime != nil {
+				if due, err := msTodoTime(*item.DueDateTime); err == nil {
+					row.Task.DueDate = &due
+				} else {
+					row.Err = rowError("invalid dueDateTime: %q", item.DueDateTime.DateTime)
+				}
+			}
+			if created, err := time.Parse(time.RFC3339Nano, item.CreatedDateTime); err == nil {
+				row.Task.CreatedAt = &created
+			}
+
+			m.add("To Do task", "task", 1)
+			m.add("To Do category", "label", len(item.Categories))
+			m.add("To Do step", "checklist item", len(item.ChecklistItems))
+			if len(item.Recurrence) > 0 && string(item.Recurrence) != "null" {
+				m.add("To Do recurrence", MappedNotImported, 1)
+			}
+			if item.IsReminderOn {
+				m.add("To Do reminder", MappedNotImported, 1)
+			}
+			m.add("To Do linked resource", MappedNotImported, len(item.LinkedResources))
+			imported.Rows = append(imported.Rows, row)
+		}
+	}
+
+	imported.Mappings = m
+	return imported, nil
+}
+
+// msTodoBody - the text of a task body, HTML bodies lose their markup
+func msTodoBody(content, contentType string) string {
+	if strings.EqualFold(contentType, "html") {
+		content = msTodoBreak.ReplaceAllString(content, "\n")
+		content = html.UnescapeString(msTodoTag.ReplaceAllString(content, ""))
+	}
+	return strings.TrimSpace(content)
+}
+
+func msTodoPriority(importance string) string {
+	switch importance {
+	case "high":
+		return "high"
+	case "low":
+		return "low"
+	}
+	return "none"
+}
+
+// msTodoTime - a Graph dateTimeTimeZone. To Do stores due dates as midnight, which become dates; time zones Go
+// doesn't know (Windows names such as "Pacific Standard Time") are read as UTC.
+func msTodoTime(value msTodoDateTime) (time.Time, error) {
+	location := time.UTC
+	if loaded, err := time.LoadLocation(value.TimeZone); err == nil && value.TimeZone != "" {
+		location = loaded
+	}
+	t, err := time.ParseInLocation("2006-01-02T15:04:05.9999999", value.DateTime, location)
+	if err != nil {
+		return t, err
+	}
+	if t.Hour() == 0 && t.Minute() == 0 && t.Second() == 0 {
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC), nil
+	}
+	return t.UTC(), nil
+}
@@ -0,0 +1,117 @@
+package transfer
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseMSTodo(t *testing.T) {
+	input := `{"value": [
+		{"id": "l1", "displayName": "Tasks", "wellknownListName": "defaultList", "tasks": [
+			{"id": "1", "title": "Call mom", "status": "notStarted", "importance": "normal",
+			 "body": {"content": "<p>Ask about<br/>Sunday &amp; Monday</p>", "contentType": "html"},
+			 "dueDateTime": {"dateTime": "2024-03-01T00:00:00.0000000", "timeZone": "Europe/Berlin"},
+			 "recurrence": {"pattern": {"type": "weekly"}}, "isReminderOn": true}
+		]},
+		{"id": "l2", "displayName": " Groceries ", "wellknownListName": "none", "tasks": [
+			{"id": "2", "title": "Milk", "status": "completed", "importance": "high",
+			 "body": {"content": " Whole ", "contentType": "text"}, "categories": ["Errand"],
+			 "createdDateTime": "2024-02-01T08:00:00.1234567Z", "recurrence": null,
+			 "dueDateTime": {"dateTime": "2024-03-01T09:30:00.0000000", "timeZone": "Pacific Standard Time"},
+			 "checklistItems": [{"displayName": "Oat", "isChecked": true}, {"displayName": "Soy"}],
+			 "linkedResources": [{"webUrl": "https://example.com"}]},
+			{"id": "3", "title": "Bread", "importance": "low", "dueDateTime": {"dateTime": "tomorrow", "timeZone": "UTC"}}
+		]}
+	]}`
+
+	imported, err := ParseImport(FormatMSTodo, strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	due := time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)
+	created := time.Date(2024, 2, 1, 8, 0, 0, 123456700, time.UTC)
+	want := []Row{
+		{Line: 1, Task: Task{ID: "mstodo:1", Title: "Call mom", Comment: "Ask about\nSunday & Monday", Priority: "none", DueDate: date(2024, 3, 1)}},
+		{Line: 2, Task: Task{
+			ID: "mstodo:2", Title: "Milk", Comment: "Whole", Done: true, Priority: "high", Project: "Groceries", Labels: []string{"Errand"},
+			DueDate: &due, CreatedAt: &created, Checklist: []ChecklistItem{{Text: "Oat", Done: true}, {Text: "Soy"}},
+		}},
+		{Line: 3, Task: Task{ID: "mstodo:3", Title: "Bread", Priority: "low", Project: "Groceries"}, Err: rowError("invalid dueDateTime: %q", "tomorrow")},
+	}
+	if !reflect.DeepEqual(imported.Rows, want) {
+		t.Errorf("ParseImport() = %+v, want %+v", imported.Rows, want)
+	}
+
+	wantMappings := []Mapping{
+		{Source: "To Do task", Target: "task", Count: 3},
+		{Source: "To Do recurrence", Target: MappedNotImported, Count: 1},
+		{Source: "To Do reminder", Target: MappedNotImported, Count: 1},
+		{Source: "To Do list", Target: "project", Count: 1},
+		{Source: "To Do category", Target: "label", Count: 1},
+		{Source: "To Do step", Target: "checklist item", Count: 2},
+		{Source: "To Do linked resource", Target: MappedNotImported, Count: 1},
+	}
+	if !reflect.DeepEqual(imported.Mappings, wantMappings) {
+		t.Errorf("ParseImport() mappings = %+v, want %+v", imported.Mappings, wantMappings)
+	}
+}
+
+func TestParseMSTodoInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{name: "no lists", input: `{"value": []}`},
+		{name: "other JSON", input: `{"items": []}`},
+		{name: "broken JSON", input: `{"value": [`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseImport(FormatMSTodo, strings.NewReader(tt.input)); err == nil {
+				t.Error("ParseImport() error = nil")
+			}
+		})
+	}
+}
+
+func TestMSTodoTime(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   msTodoDateTime
+		want    time.Time
+		wantErr bool
+	}{
+		{
+			name:  "midnight is a date",
+			value: msTodoDateTime{DateTime: "2024-03-01T00:00:00.0000000", TimeZone: "America/New_York"},
+			want:  time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:  "time in its time zone",
+			value: msTodoDateTime{DateTime: "2024-03-01T09:30:00.0000000", TimeZone: "America/New_York"},
+			want:  time.Date(2024, 3, 1, 14, 30, 0, 0, time.UTC),
+		},
+		{
+			name:  "unknown time zone is UTC",
+			value: msTodoDateTime{DateTime: "2024-03-01T09:30:00", TimeZone: "Pacific Standard Time"},
+			want:  time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC),
+		},
+		{name: "not a date", value: msTodoDateTime{DateTime: "2024-03-01"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := msTodoTime(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("msTodoTime() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !got.Equal(tt.want) {
+				t.Errorf("msTodoTime() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
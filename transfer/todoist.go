@@ -0,0 +1,370 @@
+package transfer
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Todoist exports a project as a CSV template:
+//
+//	TYPE,CONTENT,DESCRIPTION,PRIORITY,INDENT,AUTHOR,RESPONSIBLE,DATE,DATE_LANG,TIMEZONE,DURATION,DURATION_UNIT
+//	section,Errands,,,,,,,,,,
+//	task,Buy milk @shop,Semi-skimmed,1,1,Alice (1234),,2026-03-01,en,Europe/Berlin,15,minute
+//	note,Get two,,,,Alice (1234),,,,,,
+//	task,Check the date,,4,2,Alice (1234),,,,,,
+//
+// and a full backup as the JSON of its sync API. Projects become projects, sections labels, @labels labels,
+// notes comments and deeper INDENTs subtasks. The CSV has no IDs and no project name, its tasks get IDs hashed
+// from their place in the file. Due dates written in words ("every monday") are left out.
+
+var todoistLabel = regexp.MustCompile(`(^|\s)@([^\s@]+)`)
+
+func parseTodoist(r io.Reader) (Import, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return Import{}, err
+	}
+	data = bytes.TrimSpace(bytes.TrimPrefix(data, []byte("\ufeff")))
+	if len(data) == 0 {
+		return Import{}, errors.New("the file is empty")
+	}
+	if data[0] == '{' {
+		return parseTodoistJSON(bytes.NewReader(data))
+	}
+	return parseTodoistCSV(bytes.NewReader(data))
+}
+
+func parseTodoistCSV(r io.Reader) (Import, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	var imported Import
+	var m mappings
+
+	header, err := reader.Read()
+	if err != nil {
+		return imported, err
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToUpper(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["TYPE"]; !ok {
+		return imported, errors.New("not a Todoist CSV file: the header has no TYPE column")
+	}
+	if _, ok := columns["CONTENT"]; !ok {
+		return imported, errors.New("not a Todoist CSV file: the header has no CONTENT column")
+	}
+
+	type parent struct {
+		indent int
+		id     string
+		path   string
+	}
+	var stack []parent
+	section := ""
+	seen := make(map[string]int)
+	current := -1 // row the notes below belong to
+
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return imported, err
+		}
+
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		switch strings.ToLower(field("TYPE")) {
+		case "section":
+			section = field("CONTENT")
+			stack, current = nil, -1
+			m.add("Todoist section", "label", 1)
+
+		case "note":
+			if current < 0 {
+				m.add("Todoist project comment", MappedNotImported, 1)
+				continue
+			}
+			imported.Rows[current].Task.Comments = append(imported.Rows[current].Task.Comments, Comment{
+				Author: todoistAuthor(field("AUTHOR")),
+				Body:   field("CONTENT"),
+			})
+			m.add("Todoist comment", "comment", 1)
+
+		case "task":
+			indent, _ := strconv.Atoi(field("INDENT"))
+			for len(stack) > 0 && stack[len(stack)-1].indent >= indent {
+				stack = stack[:len(stack)-1]
+			}
+
+			row := Row{Line: line}
+			row.Task.Title, row.Task.Labels = todoistContent(field("CONTENT"))
+			row.Task.Comment = field("DESCRIPTION")
+			m.add("Todoist label", "label", len(row.Task.Labels))
+			if section != "" {
+				row.Task.Labels = append(row.Task.Labels, section)
+			}
+
+			if value := field("PRIORITY"); value != "" {
+				// p1 is the highest
+				n, err := strconv.Atoi(value)
+				if err != nil || n < 1 || n > 4 {
+					row.Err = rowError("invalid PRIORITY: %q", value)
+				}
+				row.Task.Priority = todoistPriority(5 - n)
+			}
+
+			if date := field("DATE"); date != "" {
+				if due, ok := todoistDate(date, field("TIMEZONE")); ok {
+					row.Task.DueDate = due
+				} else {
+					m.add("Todoist due date in words", MappedNotImported, 1)
+				}
+			}
+			row.Task.Estimate = todoistDuration(field("DURATION"), field("DURATION_UNIT"))
+			if field("RESPONSIBLE") != "" {
+				m.add("Todoist assignee", MappedNotImported, 1)
+			}
+
+			path := section
+			if len(stack) > 0 {
+				row.Task.ParentID = stack[len(stack)-1].id
+				path = stack[len(stack)-1].path
+			}
+			path += "\x00" + row.Task.Title
+			seen[path]++
+			row.Task.ID = hashedID("todoist", fmt.Sprintf("%s\x00%d", path, seen[path]))
+
+			stack = append(stack, parent{indent: indent, id: row.Task.ID, path: path})
+			imported.Rows = append(imported.Rows, row)
+			current = len(imported.Rows) - 1
+			m.add("Todoist task", "task", 1)
+		}
+	}
+
+	imported.Mappings = m
+	return imported, nil
+}
+
+type todoistBackup struct {
+	Projects []struct {
+		ID           string `json:"id"`
+		Name         string `json:"name"`
+		InboxProject bool   `json:"inbox_project"`
+	} `json:"projects"`
+	Sections []struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"sections"`
+	Items []struct {
+		ID             string   `json:"id"`
+		ParentID       string   `json:"parent_id"`
+		ProjectID      string   `json:"project_id"`
+		SectionID      string   `json:"section_id"`
+		Content        string   `json:"content"`
+		Description    string   `json:"description"`
+		Priority       int      `json:"priority"` // 4 is the highest
+		Labels         []string `json:"labels"`
+		Checked        bool     `json:"checked"`
+		AddedAt        string   `json:"added_at"`
+		ResponsibleUID string   `json:"responsible_uid"`
+		Due            *struct {
+			Date        string `json:"date"`
+			Timezone    string `json:"timezone"`
+			IsRecurring bool   `json:"is_recurring"`
+		} `json:"due"`
+		Duration *struct {
+			Amount int    `json:"amount"`
+			Unit   string `json:"unit"`
+		} `json:"duration"`
+	} `json:"items"`
+	Notes []struct {
+		ItemID    string `json:"item_id"`
+		Content   string `json:"content"`
+		PostedAt  string `json:"posted_at"`
+		PostedUID string `json:"posted_uid"`
+	} `json:"notes"`
+	Collaborators []struct {
+		ID       string `json:"id"`
+		FullName string `json:"full_name"`
+	} `json:"collaborators"`
+}
+
+func parseTodoistJSON(r io.Reader) (Import, error) {
+	var imported Import
+	var m mappings
+
+	var backup todoistBackup
+	if err := json.NewDecoder(r).Decode(&backup); err != nil {
+		return imported, err
+	}
+	if backup.Items == nil {
+		return imported, errors.New("not a Todoist backup: it has no items")
+	}
+
+	projects := make(map[string]string, len(backup.Projects))
+	for _, project := range backup.Projects {
+		// Tasks of the inbox stay outside of projects
+		if !project.InboxProject {
+			projects[project.ID] = project.Name
+		}
+	}
+	sections := make(map[string]string, len(backup.Sections))
+	for _, section := range backup.Sections {
+		sections[section.ID] = section.Name
+	}
+	people := make(map[string]string, len(backup.Collaborators))
+	for _, collaborator := range backup.Collaborators {
+		people[collaborator.ID] = collaborator.FullName
+	}
+
+	index := make(map[string]int, len(backup.Items))
+	usedProjects := make(map[string]bool)
+	for i, item := range backup.Items {
+		row := Row{Line: i + 1, Task: Task{
+			ID:       "todoist:" + item.ID,
+			Title:    item.Content,
+			Comment:  item.Description,
+			Done:     item.Checked,
+			Priority: todoistPriority(item.Priority),
+			Project:  projects[item.ProjectID],
+			Labels:   item.Labels,
+		}}
+		m.add("Todoist label", "label", len(item.Labels))
+		if item.ParentID != "" {
+			row.Task.ParentID = "todoist:" + item.ParentID
+		}
+		if name := sections[item.SectionID]; name != "" {
+			row.Task.Labels = append(row.Task.Labels, name)
+			m.add("Todoist section", "label", 1)
+		}
+		if row.Task.Project != "" && !usedProjects[item.ProjectID] {
+			usedProjects[item.ProjectID] = true
+			m.add("Todoist project", "project", 1)
+		}
+
+		if item.Due != nil {
+			if due, ok := todoistDate(item.Due.Date, item.Due.Timezone); ok {
+				row.Task.DueDate = due
+			} else {
+				row.Err = rowError("invalid due date: %q", item.Due.Date)
+			}
+			if item.Due.IsRecurring {
+				m.add("Todoist recurring due date", MappedNotImported, 1)
+			}
+		}
+		if item.Duration != nil {
+			row.Task.Estimate = todoistDuration(strconv.Itoa(item.Duration.Amount), item.Duration.Unit)
+		}
+		if created, err := time.Parse(time.RFC3339Nano, item.AddedAt); err == nil {
+			row.Task.CreatedAt = &created
+		}
+		if item.ResponsibleUID != "" {
+			m.add("Todoist assignee", MappedNotImported, 1)
+		}
+
+		index[item.ID] = len(imported.Rows)
+		imported.Rows = append(imported.Rows, row)
+		m.add("Todoist task", "task", 1)
+	}
+
+	for _, note := range backup.Notes {
+		i, ok := index[note.ItemID]
+		if !ok {
+			m.add("Todoist project comment", MappedNotImported, 1)
+			continue
+		}
+		comment := Comment{Author: people[note.PostedUID], Body: note.Content}
+		if posted, err := time.Parse(time.RFC3339Nano, note.PostedAt); err == nil {
+			comment.CreatedAt = posted
+		}
+		imported.Rows[i].Task.Comments = append(imported.Rows[i].Task.Comments, comment)
+		m.add("Todoist comment", "comment", 1)
+	}
+
+	imported.Mappings = m
+	return imported, nil
+}
+
+// todoistContent - the title without the @labels in it, and the labels
+func todoistContent(content string) (string, []string) {
+	var labels []string
+	for _, match := range todoistLabel.FindAllStringSubmatch(content, -1) {
+		labels = append(labels, match[2])
+	}
+	title := strings.Join(strings.Fields(todoistLabel.ReplaceAllString(content, "$1")), " ")
+	return title, labels
+}
+
+// todoistAuthor - the name of "Alice (1234)"
+func todoistAuthor(author string) string {
+	if i := strings.LastIndex(author, " ("); i > 0 && strings.HasSuffix(author, ")") {
+		return author[:i]
+	}
+	return author
+}
+
+// todoistPriority - maps the priority of the API, where 4 (p1 in the apps) is the highest
+func todoistPriority(n int) string {
+	switch n {
+	case 4:
+		return "urgent"
+	case 3:
+		return "high"
+	case 2:
+		return "medium"
+	}
+	return "none"
+}
+
+// todoistDate - a date, or a date and time in the time zone (local times without one are read as UTC).
+// Dates in words can't be read.
+func todoistDate(value, timezone string) (*time.Time, bool) {
+	location := time.UTC
+	if timezone != "" {
+		if loaded, err := time.LoadLocation(timezone); err == nil {
+			location = loaded
+		}
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, true
+	}
+	for _, layout := range []string{"2006-01-02T15:04:05", "2006-01-02 15:04"} {
+		if t, err := time.ParseInLocation(layout, value, location); err == nil {
+			t = t.UTC()
+			return &t, true
+		}
+	}
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return &t, true
+	}
+	return nil, false
+}
+
+// todoistDuration - the estimate in minutes of a duration in minutes or days (of eight working hours)
+func todoistDuration(amount, unit string) int {
+	n, err := strconv.Atoi(amount)
+	if err != nil || n <= 0 {
+		return 0
+	}
+	if unit == "day" {
+		return n * 8 * 60
+	}
+	return n
+}
@@ -0,0 +1,142 @@
+package transfer
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTodoistCSV(t *testing.T) {
+	input := strings.Join([]string{
+		"\ufeffTYPE,CONTENT,DESCRIPTION,PRIORITY,INDENT,AUTHOR,RESPONSIBLE,DATE,DATE_LANG,TIMEZONE,DURATION,DURATION_UNIT",
+		"note,Project note,,,,Alice (1234),,,,,,",
+		"section,Errands,,,,,,,,,,",
+		"task,Buy milk @shop @today,Semi-skimmed,1,1,Alice (1234),,2024-03-01,en,,2,day",
+		"note,Get two,,,,Alice (1234),,,,,,",
+		"task,Check the date,,4,2,Alice (1234),Bob (5678),every monday,en,,,",
+		"task,Pay,,7,1,Alice (1234),,2024-03-01T09:30:00,en,Europe/Berlin,15,minute",
+	}, "\n")
+
+	imported, err := ParseImport(FormatTodoist, strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := imported.Rows
+	if len(rows) != 3 {
+		t.Fatalf("ParseImport() read %d rows, want 3: %+v", len(rows), rows)
+	}
+
+	tests := []struct {
+		name string
+		got  interface{}
+		want interface{}
+	}{
+		{name: "title without labels", got: rows[0].Task.Title, want: "Buy milk"},
+		{name: "labels and section", got: rows[0].Task.Labels, want: []string{"shop", "today", "Errands"}},
+		{name: "description", got: rows[0].Task.Comment, want: "Semi-skimmed"},
+		{name: "p1 is urgent", got: rows[0].Task.Priority, want: "urgent"},
+		{name: "p4 is none", got: rows[1].Task.Priority, want: "none"},
+		{name: "due date", got: rows[0].Task.DueDate, want: date(2024, 3, 1)},
+		{name: "estimate in days", got: rows[0].Task.Estimate, want: 2 * 8 * 60},
+		{name: "note becomes comment", got: rows[0].Task.Comments, want: []Comment{{Author: "Alice", Body: "Get two"}}},
+		{name: "indent makes a subtask", got: rows[1].Task.ParentID, want: rows[0].Task.ID},
+		{name: "due date in words", got: rows[1].Task.DueDate, want: (*time.Time)(nil)},
+		{name: "local time in its time zone", got: rows[2].Task.DueDate.Format(time.RFC3339), want: "2024-03-01T08:30:00Z"},
+		{name: "unknown priority", got: rows[2].Err, want: rowError("invalid PRIORITY: %q", "7")},
+		{name: "sibling of the parent", got: rows[2].Task.ParentID, want: ""},
+		{name: "mapping report", got: imported.Mappings, want: []Mapping{
+			{Source: "Todoist project comment", Target: MappedNotImported, Count: 1},
+			{Source: "Todoist section", Target: "label", Count: 1},
+			{Source: "Todoist label", Target: "label", Count: 2},
+			{Source: "Todoist task", Target: "task", Count: 3},
+			{Source: "Todoist comment", Target: "comment", Count: 1},
+			{Source: "Todoist due date in words", Target: MappedNotImported, Count: 1},
+			{Source: "Todoist assignee", Target: MappedNotImported, Count: 1},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !reflect.DeepEqual(tt.got, tt.want) {
+				t.Errorf("got %+v, want %+v", tt.got, tt.want)
+			}
+		})
+	}
+
+	again, _ := ParseImport(FormatTodoist, strings.NewReader(input))
+	if again.Rows[0].Task.ID != rows[0].Task.ID {
+		t.Error("the same file got other IDs on the second import")
+	}
+}
+
+func TestParseTodoistJSON(t *testing.T) {
+	input := `{
+		"projects": [{"id": "p1", "name": "Inbox", "inbox_project": true}, {"id": "p2", "name": "Home"}],
+		"sections": [{"id": "s1", "name": "Kitchen"}],
+		"collaborators": [{"id": "u1", "full_name": "Alice"}],
+		"items": [
+			{"id": "1", "project_id": "p2", "section_id": "s1", "content": "Buy milk", "priority": 3, "labels": ["shop"],
+			 "added_at": "2024-02-01T08:00:00.000000Z", "due": {"date": "2024-03-01", "is_recurring": true},
+			 "duration": {"amount": 30, "unit": "minute"}},
+			{"id": "2", "parent_id": "1", "project_id": "p2", "content": "Find a shop", "checked": true, "priority": 1},
+			{"id": "3", "project_id": "p1", "content": "Call mom", "priority": 1, "due": {"date": "tomorrow"}}
+		],
+		"notes": [
+			{"item_id": "1", "content": "Oat?", "posted_uid": "u1", "posted_at": "2024-02-02T08:00:00Z"},
+			{"item_id": "p2", "content": "Project note"}
+		]
+	}`
+
+	imported, err := ParseImport(FormatTodoist, strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	created := time.Date(2024, 2, 1, 8, 0, 0, 0, time.UTC)
+	want := []Row{
+		{Line: 1, Task: Task{
+			ID: "todoist:1", Title: "Buy milk", Priority: "high", Project: "Home", Labels: []string{"shop", "Kitchen"},
+			DueDate: date(2024, 3, 1), Estimate: 30, CreatedAt: &created,
+			Comments: []Comment{{Author: "Alice", Body: "Oat?", CreatedAt: time.Date(2024, 2, 2, 8, 0, 0, 0, time.UTC)}},
+		}},
+		{Line: 2, Task: Task{ID: "todoist:2", ParentID: "todoist:1", Title: "Find a shop", Done: true, Priority: "none", Project: "Home"}},
+		{Line: 3, Task: Task{ID: "todoist:3", Title: "Call mom", Priority: "none"}, Err: rowError("invalid due date: %q", "tomorrow")},
+	}
+	if !reflect.DeepEqual(imported.Rows, want) {
+		t.Errorf("ParseImport() = %+v, want %+v", imported.Rows, want)
+	}
+
+	wantMappings := []Mapping{
+		{Source: "Todoist label", Target: "label", Count: 1},
+		{Source: "Todoist section", Target: "label", Count: 1},
+		{Source: "Todoist project", Target: "project", Count: 1},
+		{Source: "Todoist recurring due date", Target: MappedNotImported, Count: 1},
+		{Source: "Todoist task", Target: "task", Count: 3},
+		{Source: "Todoist comment", Target: "comment", Count: 1},
+		{Source: "Todoist project comment", Target: MappedNotImported, Count: 1},
+	}
+	if !reflect.DeepEqual(imported.Mappings, wantMappings) {
+		t.Errorf("ParseImport() mappings = %+v, want %+v", imported.Mappings, wantMappings)
+	}
+}
+
+func TestParseTodoistInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{name: "empty", input: " \n"},
+		{name: "CSV without TYPE", input: "CONTENT,PRIORITY\nBuy milk,1\n"},
+		{name: "CSV without CONTENT", input: "TYPE,PRIORITY\ntask,1\n"},
+		{name: "JSON without items", input: `{"projects": []}`},
+		{name: "broken JSON", input: `{"items": [`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseImport(FormatTodoist, strings.NewReader(tt.input)); err == nil {
+				t.Error("ParseImport() error = nil")
+			}
+		})
+	}
+}
@@ -0,0 +1,184 @@
+// Package transfer converts tasks to and from the formats of the import and export endpoints:
+// JSON, CSV and Markdown checklists, plus the export files of Todoist, Trello and Microsoft To Do
+// which can only be imported. It knows nothing about storage, tasks are identified by the string
+// IDs of the source, which become external IDs when they are imported.
+package transfer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// formats
+const (
+	FormatJSON     = "json"
+	FormatCSV      = "csv"
+	FormatMarkdown = "markdown"
+	// Import only
+	FormatTodoist = "todoist"
+	FormatTrello  = "trello"
+	FormatMSTodo  = "mstodo"
+)
+
+// Version of the JSON document written by Write
+const Version = 1
+
+var ErrUnknownFormat = errors.New("transfer: unknown format")
+
+// Document - everything exported for a user
+type Document struct {
+	Version    int       `json:"version"`
+	ExportedAt time.Time `json:"exported_at"`
+	Projects   []Project `json:"projects"`
+	Tasks      []Task    `json:"tasks"`
+}
+
+type Project struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type Task struct {
+	ID        string          `json:"id,omitempty"`        // ID in the source, used to recognise tasks imported before
+	ParentID  string          `json:"parent_id,omitempty"` // ID of the parent task in the source
+	Title     string          `json:"title"`
+	Comment   string          `json:"comment,omitempty"`
+	Done      bool            `json:"done"`
+	Status    string          `json:"status,omitempty"`
+	Priority  string          `json:"priority,omitempty"`
+	Important bool            `json:"important,omitempty"`
+	DueDate   *time.Time      `json:"due_date,omitempty"`
+	Project   string          `json:"project,omitempty"` // Project name
+	Labels    []string        `json:"labels,omitempty"`
+	Estimate  int             `json:"estimate_minutes,omitempty"`
+	Checklist []ChecklistItem `json:"checklist,omitempty"`
+	Comments  []Comment       `json:"comments,omitempty"`
+	CreatedAt *time.Time      `json:"created_at,omitempty"`
+}
+
+type ChecklistItem struct {
+	Text string `json:"text"`
+	Done bool   `json:"done"`
+}
+
+type Comment struct {
+	Author    string    `json:"author"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Row - a task read from an import, Err is set when only this row couldn't be read
+type Row struct {
+	Line int // Row of a CSV file (the header is row 1), line of a Markdown file, position in a JSON document
+	Task Task
+	Err  error
+}
+
+// Mapping - how one kind of item of the source was imported, e.g. Trello lists as statuses
+type Mapping struct {
+	Source string `json:"source"`
+	Target string `json:"target"` // MappedNotImported for items which are left out
+	Count  int    `json:"count"`
+}
+
+// MappedNotImported - the target of items an import leaves out
+const MappedNotImported = "not imported"
+
+// Import - the rows read from a file, with the mapping report of the formats of other tools
+type Import struct {
+	Rows     []Row
+	Mappings []Mapping
+}
+
+// mappings - counts the items of a source by what they became, in the order first seen
+type mappings []Mapping
+
+func (m *mappings) add(source, target string, count int) {
+	if count == 0 {
+		return
+	}
+	for i := range *m {
+		if (*m)[i].Source == source && (*m)[i].Target == target {
+			(*m)[i].Count += count
+			return
+		}
+	}
+	*m = append(*m, Mapping{Source: source, Target: target, Count: count})
+}
+
+// Parse - reads the tasks of an import. The error is for input which can't be read at all, problems with single
+// rows are reported on the rows.
+func Parse(format string, r io.Reader) ([]Row, error) {
+	imported, err := ParseImport(format, r)
+	return imported.Rows, err
+}
+
+// ParseImport - reads an import as Parse does, along with how the items of the source were mapped
+func ParseImport(format string, r io.Reader) (Import, error) {
+	var imported Import
+	var err error
+	switch format {
+	case FormatJSON:
+		imported.Rows, err = parseJSON(r)
+	case FormatCSV:
+		imported.Rows, err = parseCSV(r)
+	case FormatMarkdown:
+		imported.Rows, err = parseMarkdown(r)
+	case FormatTodoist:
+		return parseTodoist(r)
+	case FormatTrello:
+		return parseTrello(r)
+	case FormatMSTodo:
+		return parseMSTodo(r)
+	default:
+		err = ErrUnknownFormat
+	}
+	return imported, err
+}
+
+// Importable - reports whether files of the format can be imported
+func Importable(format string) bool {
+	switch format {
+	case FormatJSON, FormatCSV, FormatMarkdown, FormatTodoist, FormatTrello, FormatMSTodo:
+		return true
+	}
+	return false
+}
+
+// Write - writes the document in the format
+func Write(format string, w io.Writer, doc Document) error {
+	switch format {
+	case FormatJSON:
+		return writeJSON(w, doc)
+	case FormatCSV:
+		return writeCSV(w, doc)
+	case FormatMarkdown:
+		return writeMarkdown(w, doc)
+	}
+	return ErrUnknownFormat
+}
+
+// ContentType - the media type of the format
+func ContentType(format string) string {
+	switch format {
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatMarkdown:
+		return "text/markdown; charset=utf-8"
+	}
+	return "application/json; charset=utf-8"
+}
+
+// Extension - the file name extension of the format
+func Extension(format string) string {
+	if format == FormatMarkdown {
+		return "md"
+	}
+	return format
+}
+
+func rowError(format string, args ...interface{}) error {
+	return fmt.Errorf(format, args...)
+}
@@ -0,0 +1,252 @@
+package transfer
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func date(year int, month time.Month, day int) *time.Time {
+	t := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	return &t
+}
+
+func TestParseCSV(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []Row
+		wantErr bool
+	}{
+		{
+			name:  "columns are found by the header",
+			input: "\ufeffTitle, Done ,priority,labels,due_date\nBuy milk,yes,HIGH,home; errands,2024-03-01\n",
+			want: []Row{{Line: 2, Task: Task{
+				Title: "Buy milk", Done: true, Priority: "high", Labels: []string{"home", "errands"}, DueDate: date(2024, 3, 1),
+			}}},
+		},
+		{
+			name:  "checklist and comments",
+			input: "title,checklist,comments\nPack,[x] Socks;[ ] Shoes,\"[{\"\"author\"\":\"\"alice\"\",\"\"body\"\":\"\"Hi\"\",\"\"created_at\"\":\"\"2024-03-01T10:00:00Z\"\"}]\"\n",
+			want: []Row{{Line: 2, Task: Task{
+				Title:     "Pack",
+				Checklist: []ChecklistItem{{Text: "Socks", Done: true}, {Text: "Shoes"}},
+				Comments:  []Comment{{Author: "alice", Body: "Hi", CreatedAt: time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)}},
+			}}},
+		},
+		{
+			name:  "a bad row fails alone",
+			input: "title,done,estimate_minutes\nBuy milk,maybe,\nCall mom,,-5\nWalk,,30\n",
+			want: []Row{
+				{Line: 2, Task: Task{Title: "Buy milk"}, Err: rowError("invalid done: %q", "maybe")},
+				{Line: 3, Task: Task{Title: "Call mom", Estimate: -5}, Err: rowError("invalid estimate_minutes: %q", "-5")},
+				{Line: 4, Task: Task{Title: "Walk", Estimate: 30}},
+			},
+		},
+		{
+			name:  "short rows",
+			input: "title,project\nBuy milk\n",
+			want:  []Row{{Line: 2, Task: Task{Title: "Buy milk"}}},
+		},
+		{name: "empty file", input: "", wantErr: true},
+		{name: "no title column", input: "name,done\nBuy milk,no\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := Parse(FormatCSV, strings.NewReader(tt.input))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(rows, tt.want) {
+				t.Errorf("Parse() = %+v, want %+v", rows, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		want     []Task
+		badLines []int
+		wantErr  bool
+	}{
+		{
+			name:  "exported document",
+			input: `{"version":1,"tasks":[{"id":"1","title":"Buy milk","done":true}]}`,
+			want:  []Task{{ID: "1", Title: "Buy milk", Done: true}},
+		},
+		{
+			name:  "array of tasks",
+			input: `[{"title":"Buy milk"},{"title":"Call mom","estimate_minutes":15}]`,
+			want:  []Task{{Title: "Buy milk"}, {Title: "Call mom", Estimate: 15}},
+		},
+		{
+			name:     "a task with a wrong type fails alone",
+			input:    `[{"title":"Buy milk","done":"yes"},{"title":"Call mom"}]`,
+			want:     []Task{{Title: "Buy milk"}, {Title: "Call mom"}},
+			badLines: []int{1},
+		},
+		{name: "not JSON", input: `title: Buy milk`, wantErr: true},
+		{name: "neither a document nor an array", input: `"Buy milk"`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := Parse(FormatJSON, strings.NewReader(tt.input))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(rows) != len(tt.want) {
+				t.Fatalf("Parse() = %+v, want %+v", rows, tt.want)
+			}
+
+			var badLines []int
+			for i, row := range rows {
+				if row.Line != i+1 || !reflect.DeepEqual(row.Task, tt.want[i]) {
+					t.Errorf("row %d = %+v, want %+v", i, row, tt.want[i])
+				}
+				if row.Err != nil {
+					badLines = append(badLines, row.Line)
+				}
+			}
+			if !reflect.DeepEqual(badLines, tt.badLines) {
+				t.Errorf("rows %v failed, want %v", badLines, tt.badLines)
+			}
+		})
+	}
+}
+
+func TestParseMarkdown(t *testing.T) {
+	input := strings.Join([]string{
+		"# Tasks",
+		"",
+		"- [ ] Buy milk #home #errands !high !! (due 2024-03-01)",
+		"  Whole milk",
+		"  > **alice** (2024-03-01T10:00:00Z): Oat milk?",
+		"  > Or soy",
+		"  - [x] Find a shop",
+		"- [ ] Call mom (due 2024-02-30)",
+		"",
+		"## Work",
+		"",
+		"- [X] Write report",
+		"- [ ] Write report",
+	}, "\n")
+
+	rows, err := Parse(FormatMarkdown, strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		title     string
+		line      int
+		done      bool
+		project   string
+		labels    []string
+		priority  string
+		important bool
+		due       *time.Time
+		comment   string
+		comments  []Comment
+		parent    int // index of the parent row, -1 for none
+		wantErr   bool
+	}{
+		{
+			title: "Buy milk", line: 3, labels: []string{"home", "errands"}, priority: "high", important: true,
+			due: date(2024, 3, 1), comment: "Whole milk", parent: -1,
+			comments: []Comment{{Author: "alice", Body: "Oat milk?\nOr soy", CreatedAt: time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)}},
+		},
+		{title: "Find a shop", line: 7, done: true, parent: 0},
+		{title: "Call mom", line: 8, parent: -1, wantErr: true},
+		{title: "Write report", line: 12, done: true, project: "Work", parent: -1},
+		{title: "Write report", line: 13, project: "Work", parent: -1},
+	}
+	if len(rows) != len(tests) {
+		t.Fatalf("Parse() read %d rows, want %d: %+v", len(rows), len(tests), rows)
+	}
+
+	for i, tt := range tests {
+		row, task := rows[i], rows[i].Task
+		if row.Line != tt.line || task.Title != tt.title || task.Done != tt.done || task.Project != tt.project ||
+			task.Priority != tt.priority || task.Important != tt.important || task.Comment != tt.comment {
+			t.Errorf("row %d = %+v", i, row)
+		}
+		if !reflect.DeepEqual(task.Labels, tt.labels) || !reflect.DeepEqual(task.DueDate, tt.due) || !reflect.DeepEqual(task.Comments, tt.comments) {
+			t.Errorf("row %d labels %v, due %v, comments %+v", i, task.Labels, task.DueDate, task.Comments)
+		}
+		if (row.Err != nil) != tt.wantErr {
+			t.Errorf("row %d error = %v, wantErr %v", i, row.Err, tt.wantErr)
+		}
+		if tt.parent >= 0 && task.ParentID != rows[tt.parent].Task.ID || tt.parent < 0 && task.ParentID != "" {
+			t.Errorf("row %d parent = %q", i, task.ParentID)
+		}
+	}
+
+	if rows[3].Task.ID == rows[4].Task.ID {
+		t.Error("repeated titles got the same ID")
+	}
+	again, _ := Parse(FormatMarkdown, strings.NewReader(input))
+	for i := range rows {
+		if again[i].Task.ID != rows[i].Task.ID {
+			t.Errorf("row %d got ID %q on the second import, want %q", i, again[i].Task.ID, rows[i].Task.ID)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	created := time.Date(2024, 2, 1, 8, 30, 0, 0, time.UTC)
+	doc := Document{
+		Version:  Version,
+		Projects: []Project{{ID: "p1", Name: "Home"}},
+		Tasks: []Task{
+			{
+				ID: "1", Title: "Buy milk", Comment: "Whole milk", Priority: "high", Important: true, DueDate: date(2024, 3, 1),
+				Project: "Home", Labels: []string{"errands"}, Comments: []Comment{{Author: "alice", Body: "Oat?", CreatedAt: created}},
+			},
+			{ID: "2", ParentID: "1", Title: "Find a shop", Done: true, Project: "Home"},
+		},
+	}
+
+	tests := []struct {
+		format string
+		same   func(got, want Task) bool
+	}{
+		{format: FormatJSON, same: func(got, want Task) bool { return reflect.DeepEqual(got, want) }},
+		{format: FormatCSV, same: func(got, want Task) bool { return reflect.DeepEqual(got, want) }},
+		{
+			// Markdown has no IDs, so the parent is compared by title
+			format: FormatMarkdown,
+			same: func(got, want Task) bool {
+				got.ID, got.ParentID, want.ID, want.ParentID = "", "", "", ""
+				return reflect.DeepEqual(got, want)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := Write(tt.format, &buf, doc); err != nil {
+				t.Fatal(err)
+			}
+			rows, err := Parse(tt.format, &buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rows) != len(doc.Tasks) {
+				t.Fatalf("read %d tasks, want %d", len(rows), len(doc.Tasks))
+			}
+			for i, row := range rows {
+				if row.Err != nil || !tt.same(row.Task, doc.Tasks[i]) {
+					t.Errorf("task %d = %+v, %v, want %+v", i, row.Task, row.Err, doc.Tasks[i])
+				}
+			}
+		})
+	}
+}
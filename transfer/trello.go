@@ -0,0 +1,216 @@
+package transfer
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A Trello board export (Menu > Print and export > Export as JSON) becomes a project named after the board.
+// Cards become tasks, lists statuses when a status of the same name exists and labels otherwise, checklists
+// the task's checklist and comments comments. Archived cards and cards of archived lists are left out.
+
+type trelloBoard struct {
+	Name  string `json:"name"`
+	Lists []struct {
+		ID     string `json:"id"`
+		Name   string `json:"name"`
+		Closed bool   `json:"closed"`
+	} `json:"lists"`
+	Labels []struct {
+		ID    string `json:"id"`
+		Name  string `json:"name"`
+		Color string `json:"color"`
+	} `json:"labels"`
+	Cards []struct {
+		ID          string   `json:"id"`
+		Name        string   `json:"name"`
+		Desc        string   `json:"desc"`
+		Closed      bool     `json:"closed"`
+		IDList      string   `json:"idList"`
+		IDLabels    []string `json:"idLabels"`
+		IDMembers   []string `json:"idMembers"`
+		Due         string   `json:"due"`
+		DueComplete bool     `json:"dueComplete"`
+		Pos         float64  `json:"pos"`
+		Attachments []struct {
+			ID string `json:"id"`
+		} `json:"attachments"`
+	} `json:"cards"`
+	Checklists []struct {
+		IDCard     string  `json:"idCard"`
+		Name       string  `json:"name"`
+		Pos        float64 `json:"pos"`
+		CheckItems []struct {
+			Name  string  `json:"name"`
+			State string  `json:"state"`
+			Pos   float64 `json:"pos"`
+		} `json:"checkItems"`
+	} `json:"checklists"`
+	Actions []struct {
+		Type string `json:"type"`
+		Date string `json:"date"`
+		Data struct {
+			Text string `json:"text"`
+			Card struct {
+				ID string `json:"id"`
+			} `json:"card"`
+		} `json:"data"`
+		MemberCreator struct {
+			FullName string `json:"fullName"`
+			Username string `json:"username"`
+		} `json:"memberCreator"`
+	} `json:"actions"`
+}
+
+// trelloDoneLists - names of lists whose cards are done, compared in lower case
+var trelloDoneLists = map[string]bool{"done": true, "complete": true, "completed": true, "finished": true}
+
+func parseTrello(r io.Reader) (Import, error) {
+	var imported Import
+	var m mappings
+
+	var board trelloBoard
+	if err := json.NewDecoder(r).Decode(&board); err != nil {
+		return imported, err
+	}
+	if board.Cards == nil || board.Lists == nil {
+		return imported, errors.New("not a Trello board export: it has no cards or lists")
+	}
+	project := strings.TrimSpace(board.Name)
+	if project == "" {
+		project = "Trello"
+	}
+	m.add("Trello board", "project", 1)
+
+	type list struct {
+		name   string
+		status string
+		closed bool
+	}
+	lists := make(map[string]list, len(board.Lists))
+	for _, l := range board.Lists {
+		name := strings.TrimSpace(l.Name)
+		target := list{name: name, closed: l.Closed}
+		// Lists named like the default statuses keep their cards in that column, e.g. "In Progress"
+		key := strings.ReplaceAll(strings.ToLower(name), " ", "_")
+		switch {
+		case l.Closed:
+			m.add("Trello archived list", MappedNotImported, 1)
+		case trelloDoneLists[strings.ToLower(name)]:
+			target.status = "done"
+			m.add("Trello list", "status", 1)
+		case key == "backlog" || key == "in_progress" || key == "review":
+			target.status = key
+			m.add("Trello list", "status", 1)
+		default:
+			m.add("Trello list", "label", 1)
+		}
+		lists[l.ID] = target
+	}
+
+	labels := make(map[string]string, len(board.Labels))
+	for _, label := range board.Labels {
+		name := strings.TrimSpace(label.Name)
+		if name == "" {
+			name = label.Color
+		}
+		labels[label.ID] = name
+	}
+
+	checklists := make(map[string][]ChecklistItem)
+	sort.SliceStable(board.Checklists, func(i, j int) bool { return board.Checklists[i].Pos < board.Checklists[j].Pos })
+	for _, checklist := range board.Checklists {
+		items := checklist.CheckItems
+		sort.SliceStable(items, func(i, j int) bool { return items[i].Pos < items[j].Pos })
+		for _, item := range items {
+			checklists[checklist.IDCard] = append(checklists[checklist.IDCard], ChecklistItem{
+				Text: item.Name,
+				Done: item.State == "complete",
+			})
+		}
+	}
+
+	comments := make(map[string][]Comment)
+	for _, action := range board.Actions {
+		if action.Type != "commentCard" {
+			continue
+		}
+		author := action.MemberCreator.FullName
+		if author == "" {
+			author = action.MemberCreator.Username
+		}
+		comment := Comment{Author: author, Body: action.Data.Text}
+		if created, err := time.Parse(time.RFC3339Nano, action.Date); err == nil {
+			comment.CreatedAt = created
+		}
+		// Actions are newest first
+		comments[action.Data.Card.ID] = append([]Comment{comment}, comments[action.Data.Card.ID]...)
+	}
+
+	sort.SliceStable(board.Cards, func(i, j int) bool { return board.Cards[i].Pos < board.Cards[j].Pos })
+	for i, card := range board.Cards {
+		l := lists[card.IDList]
+		if card.Closed || l.closed {
+			m.add("Trello archived card", MappedNotImported, 1)
+			continue
+		}
+
+		row := Row{Line: i + 1, Task: Task{
+			ID:        "trello:" + card.ID,
+			Title:     card.Name,
+			Comment:   card.Desc,
+			Status:    l.status,
+			Done:      l.status == "done" || card.DueComplete,
+			Project:   project,
+			Checklist: checklists[card.ID],
+			Comments:  comments[card.ID],
+		}}
+		if l.status == "" && l.name != "" {
+			row.Task.Labels = append(row.Task.Labels, l.name)
+		}
+		for _, id := range card.IDLabels {
+			if name := labels[id]; name != "" {
+				row.Task.Labels = append(row.Task.Labels, name)
+				m.add("Trello label", "label", 1)
+			}
+		}
+		if card.Due != "" {
+			if due, err := time.Parse(time.RFC3339Nano, card.Due); err == nil {
+				row.Task.DueDate = &due
+			} else {
+				row.Err = rowError("invalid due date: %q", card.Due)
+			}
+		}
+		// Card IDs start with the time they were created at
+		if created, ok := trelloCreatedAt(card.ID); ok {
+			row.Task.CreatedAt = &created
+		}
+
+		m.add("Trello card", "task", 1)
+		m.add("Trello checklist item", "checklist item", len(row.Task.Checklist))
+		m.add("Trello comment", "comment", len(row.Task.Comments))
+		m.add("Trello member", MappedNotImported, len(card.IDMembers))
+		m.add("Trello attachment", MappedNotImported, len(card.Attachments))
+		imported.Rows = append(imported.Rows, row)
+	}
+
+	imported.Mappings = m
+	return imported, nil
+}
+
+// trelloCreatedAt - the creation time in the first 4 bytes of a card ID, which is a MongoDB object ID
+func trelloCreatedAt(id string) (time.Time, bool) {
+	if len(id) != 24 {
+		return time.Time{}, false
+	}
+	seconds, err := strconv.ParseInt(id[:8], 16, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(seconds, 0).UTC(), true
+}
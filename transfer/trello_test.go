@@ -0,0 +1,125 @@
+package transfer
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTrello(t *testing.T) {
+	input := `{
+		"name": "Home",
+		"lists": [
+			{"id": "l1", "name": "In Progress"},
+			{"id": "l2", "name": "Done"},
+			{"id": "l3", "name": "Ideas"},
+			{"id": "l4", "name": "Old", "closed": true}
+		],
+		"labels": [{"id": "b1", "name": "Errands"}, {"id": "b2", "name": "", "color": "green"}],
+		"cards": [
+			{"id": "65e1a4000000000000000001", "name": "Paint", "idList": "l3", "pos": 3, "dueComplete": true},
+			{"id": "65e1a4000000000000000002", "name": "Buy milk", "desc": "Whole", "idList": "l1", "pos": 1,
+			 "idLabels": ["b1", "b2", "unknown"], "idMembers": ["m1"], "due": "2024-03-01T12:00:00.000Z", "attachments": [{"id": "a1"}]},
+			{"id": "c3", "name": "Fixed", "idList": "l2", "pos": 2, "due": "soon"},
+			{"id": "c4", "name": "Archived", "idList": "l1", "pos": 4, "closed": true},
+			{"id": "c5", "name": "In an archived list", "idList": "l4", "pos": 5}
+		],
+		"checklists": [
+			{"idCard": "65e1a4000000000000000002", "pos": 2, "checkItems": [{"name": "Oat", "state": "complete", "pos": 1}]},
+			{"idCard": "65e1a4000000000000000002", "pos": 1, "checkItems": [
+				{"name": "Shop", "state": "incomplete", "pos": 2}, {"name": "Wallet", "state": "complete", "pos": 1}
+			]}
+		],
+		"actions": [
+			{"type": "commentCard", "date": "2024-03-02T10:00:00.000Z", "data": {"text": "Got it", "card": {"id": "65e1a4000000000000000002"}},
+			 "memberCreator": {"username": "bob"}},
+			{"type": "updateCard", "data": {"card": {"id": "65e1a4000000000000000002"}}},
+			{"type": "commentCard", "date": "2024-03-01T10:00:00.000Z", "data": {"text": "Which one?", "card": {"id": "65e1a4000000000000000002"}},
+			 "memberCreator": {"fullName": "Alice", "username": "alice"}}
+		]
+	}`
+
+	imported, err := ParseImport(FormatTrello, strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	due := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	created := time.Unix(0x65e1a400, 0).UTC()
+	want := []Row{
+		{Line: 1, Task: Task{
+			ID: "trello:65e1a4000000000000000002", Title: "Buy milk", Comment: "Whole", Status: "in_progress", Project: "Home",
+			Labels: []string{"Errands", "green"}, DueDate: &due, CreatedAt: &created,
+			Checklist: []ChecklistItem{{Text: "Wallet", Done: true}, {Text: "Shop"}, {Text: "Oat", Done: true}},
+			Comments: []Comment{
+				{Author: "Alice", Body: "Which one?", CreatedAt: time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)},
+				{Author: "bob", Body: "Got it", CreatedAt: time.Date(2024, 3, 2, 10, 0, 0, 0, time.UTC)},
+			},
+		}},
+		{Line: 2, Task: Task{ID: "trello:c3", Title: "Fixed", Status: "done", Done: true, Project: "Home"}, Err: rowError("invalid due date: %q", "soon")},
+		{Line: 3, Task: Task{
+			ID: "trello:65e1a4000000000000000001", Title: "Paint", Done: true, Project: "Home", Labels: []string{"Ideas"}, CreatedAt: &created,
+		}},
+	}
+	if !reflect.DeepEqual(imported.Rows, want) {
+		t.Errorf("ParseImport() = %+v, want %+v", imported.Rows, want)
+	}
+
+	wantMappings := []Mapping{
+		{Source: "Trello board", Target: "project", Count: 1},
+		{Source: "Trello list", Target: "status", Count: 2},
+		{Source: "Trello list", Target: "label", Count: 1},
+		{Source: "Trello archived list", Target: MappedNotImported, Count: 1},
+		{Source: "Trello label", Target: "label", Count: 2},
+		{Source: "Trello card", Target: "task", Count: 3},
+		{Source: "Trello checklist item", Target: "checklist item", Count: 3},
+		{Source: "Trello comment", Target: "comment", Count: 2},
+		{Source: "Trello member", Target: MappedNotImported, Count: 1},
+		{Source: "Trello attachment", Target: MappedNotImported, Count: 1},
+		{Source: "Trello archived card", Target: MappedNotImported, Count: 2},
+	}
+	if !reflect.DeepEqual(imported.Mappings, wantMappings) {
+		t.Errorf("ParseImport() mappings = %+v, want %+v", imported.Mappings, wantMappings)
+	}
+}
+
+func TestParseTrelloInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{name: "no cards", input: `{"name": "Home", "lists": []}`},
+		{name: "no lists", input: `{"name": "Home", "cards": []}`},
+		{name: "broken JSON", input: `{"cards": [`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseImport(FormatTrello, strings.NewReader(tt.input)); err == nil {
+				t.Error("ParseImport() error = nil")
+			}
+		})
+	}
+}
+
+func TestTrelloCreatedAt(t *testing.T) {
+	tests := []struct {
+		id     string
+		want   time.Time
+		wantOK bool
+	}{
+		{id: "65e1a4000000000000000001", want: time.Unix(0x65e1a400, 0).UTC(), wantOK: true},
+		{id: "c3"},
+		{id: "zze1a4000000000000000001"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			got, ok := trelloCreatedAt(tt.id)
+			if !got.Equal(tt.want) || ok != tt.wantOK {
+				t.Errorf("trelloCreatedAt(%q) = %v, %v, want %v, %v", tt.id, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
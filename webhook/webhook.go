@@ -0,0 +1,145 @@
+// Package webhook signs, sends and queues the requests of outgoing webhooks.
+//
+// Deliveries wait in a Redis sorted set scored by the time of their next attempt. Claiming a delivery moves its
+// score a lease ahead instead of removing it, so a delivery whose worker died is attempted again once the lease
+// runs out; it leaves the queue when its worker is done with it.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// request headers
+const (
+	SignatureHeader = "X-Webhook-Signature" // "sha256=" and the hex signature, see Sign
+	TimestampHeader = "X-Webhook-Timestamp" // Unix time the request was signed at
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery" // The same for every attempt of a delivery
+)
+
+const (
+	// MaxAttempts - attempts of a delivery before it is given up
+	MaxAttempts = 8
+	firstDelay  = 30 * time.Second
+	maxDelay    = 6 * time.Hour
+	timeout     = 10 * time.Second
+)
+
+// ErrForbiddenAddress - webhooks may not call into private networks unless WEBHOOK_ALLOW_PRIVATE_NETWORKS is set
+var ErrForbiddenAddress = errors.New("webhook: address not allowed")
+
+// Sign - the hex HMAC-SHA256, keyed with the secret, of the Unix timestamp, a dot and the body.
+// Receivers compute it again and reject requests with an old timestamp.
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp.Unix(), 10) + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Backoff - how long to wait after the attempt failed: 30s, doubling with every attempt up to 6h
+func Backoff(attempt int) time.Duration {
+	delay := firstDelay
+	for i := 1; i < attempt && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxDelay)
+}
+
+// NewRequest - a signed POST of the JSON body
+func NewRequest(ctx context.Context, url, secret, event, deliveryID string, body []byte) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "track-my-tasks-webhooks")
+	req.Header.Set(EventHeader, event)
+	req.Header.Set(DeliveryHeader, deliveryID)
+	req.Header.Set(TimestampHeader, strconv.FormatInt(now.Unix(), 10))
+	req.Header.Set(SignatureHeader, "sha256="+Sign(secret, now, body))
+	return req, nil
+}
+
+// NewClient - the HTTP client for webhook requests. Redirects aren't followed, and loopback, private and
+// link-local addresses are refused unless WEBHOOK_ALLOW_PRIVATE_NETWORKS is "true", e.g. to test against a
+// receiver running locally.
+func NewClient() *http.Client {
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	if os.Getenv("WEBHOOK_ALLOW_PRIVATE_NETWORKS") != "true" {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+				ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast() {
+				return ErrForbiddenAddress
+			}
+			return nil
+		}
+	}
+
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 5 * time.Second,
+			MaxIdleConnsPerHost: 2,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// Queue - the IDs of deliveries by the time of their next attempt
+type Queue struct {
+	redisClient *redis.Client
+	key         string
+}
+
+// claimScript - takes the due IDs and moves them a lease ahead. KEYS[1] the queue, ARGV now, lease end, count.
+var claimScript = redis.NewScript(`
+local ids = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, tonumber(ARGV[3]))
+for _, id in ipairs(ids) do
+	redis.call('ZADD', KEYS[1], ARGV[2], id)
+end
+return ids
+`)
+
+func NewQueue(redisClient *redis.Client, key string) *Queue {
+	return &Queue{redisClient: redisClient, key: key}
+}
+
+// Schedule - queues the delivery for an attempt at the time, or moves it there when it is queued already
+func (queue *Queue) Schedule(ctx context.Context, id string, at time.Time) error {
+	return queue.redisClient.ZAdd(ctx, queue.key, redis.Z{Score: float64(at.UnixMilli()), Member: id}).Err()
+}
+
+// Claim - up to count deliveries due now, which no other worker gets before the lease ends
+func (queue *Queue) Claim(ctx context.Context, lease time.Duration, count int) ([]string, error) {
+	now := time.Now()
+	return claimScript.Run(ctx, queue.redisClient, []string{queue.key},
+		now.UnixMilli(), now.Add(lease).UnixMilli(), count).StringSlice()
+}
+
+// Done - removes the delivery from the queue
+func (queue *Queue) Done(ctx context.Context, id string) error {
+	return queue.redisClient.ZRem(ctx, queue.key, id).Err()
+}
@@ -0,0 +1,197 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{attempt: 1, want: 30 * time.Second},
+		{attempt: 2, want: time.Minute},
+		{attempt: 3, want: 2 * time.Minute},
+		{attempt: 7, want: 32 * time.Minute},
+		{attempt: 10, want: 4*time.Hour + 16*time.Minute},
+		{attempt: 11, want: 6 * time.Hour},
+		{attempt: 100, want: 6 * time.Hour},
+	}
+	for _, tt := range tests {
+		if got := Backoff(tt.attempt); got != tt.want {
+			t.Errorf("Backoff(%d) = %v, want %v", tt.attempt, got, tt.want)
+		}
+	}
+
+	total := time.Duration(0)
+	for attempt := 1; attempt < MaxAttempts; attempt++ {
+		total += Backoff(attempt)
+	}
+	if total > 24*time.Hour {
+		t.Errorf("the attempts of a delivery are spread over %v, more than a day", total)
+	}
+}
+
+func TestSignedRequest(t *testing.T) {
+	t.Setenv("WEBHOOK_ALLOW_PRIVATE_NETWORKS", "true")
+	secret := "0123456789abcdef"
+	body := []byte(`{"event":"task.created"}`)
+
+	received := make(chan *http.Request, 1)
+	receivedBody := make(chan []byte, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		received <- r
+		receivedBody <- b
+	}))
+	defer server.Close()
+
+	req, err := NewRequest(context.Background(), server.URL, secret, "task.created", "delivery-1", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := NewClient().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	r, b := <-received, <-receivedBody
+	if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("got %s with content type %q, want a JSON POST", r.Method, r.Header.Get("Content-Type"))
+	}
+	if r.Header.Get(EventHeader) != "task.created" || r.Header.Get(DeliveryHeader) != "delivery-1" {
+		t.Errorf("event %q delivery %q", r.Header.Get(EventHeader), r.Header.Get(DeliveryHeader))
+	}
+	if string(b) != string(body) {
+		t.Errorf("body = %s, want %s", b, body)
+	}
+
+	unix, err := strconv.ParseInt(r.Header.Get(TimestampHeader), 10, 64)
+	if err != nil {
+		t.Fatalf("invalid timestamp %q", r.Header.Get(TimestampHeader))
+	}
+	want := "sha256=" + Sign(secret, time.Unix(unix, 0), b)
+	if got := r.Header.Get(SignatureHeader); got != want {
+		t.Errorf("signature = %q, want %q", got, want)
+	}
+	if Sign("another secret of 16", time.Unix(unix, 0), b) == Sign(secret, time.Unix(unix, 0), b) {
+		t.Error("the signature doesn't depend on the secret")
+	}
+	if Sign(secret, time.Unix(unix+1, 0), b) == Sign(secret, time.Unix(unix, 0), b) {
+		t.Error("the signature doesn't depend on the timestamp")
+	}
+}
+
+func TestClientRefusesPrivateNetworks(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("the request reached a loopback address")
+	}))
+	defer server.Close()
+
+	_, err := NewClient().Get(server.URL)
+	if !errors.Is(err, ErrForbiddenAddress) {
+		t.Errorf("got %v, want ErrForbiddenAddress", err)
+	}
+
+	t.Setenv("WEBHOOK_ALLOW_PRIVATE_NETWORKS", "true")
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	resp, err := NewClient().Get(server.URL)
+	if err != nil {
+		t.Fatalf("with private networks allowed: %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestClientDoesNotFollowRedirects(t *testing.T) {
+	t.Setenv("WEBHOOK_ALLOW_PRIVATE_NETWORKS", "true")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			t.Error("the redirect was followed")
+		}
+		http.Redirect(w, r, "/elsewhere", http.StatusFound)
+	}))
+	defer server.Close()
+
+	resp, err := NewClient().Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusFound)
+	}
+}
+
+func TestQueueLease(t *testing.T) {
+	ctx := context.Background()
+	queue := NewQueue(redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()}), "deliveries")
+
+	now := time.Now()
+	if err := queue.Schedule(ctx, "due", now.Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if err := queue.Schedule(ctx, "later", now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	lease := 200 * time.Millisecond
+	claimed, err := queue.Claim(ctx, lease, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(claimed) != 1 || claimed[0] != "due" {
+		t.Fatalf("claimed %v, want [due]", claimed)
+	}
+
+	// Leased to the first worker
+	if claimed, _ := queue.Claim(ctx, lease, 10); len(claimed) != 0 {
+		t.Fatalf("claimed %v during the lease, want nothing", claimed)
+	}
+
+	// The worker died, the delivery is claimed again once the lease ran out
+	time.Sleep(lease + 50*time.Millisecond)
+	if claimed, _ := queue.Claim(ctx, lease, 10); len(claimed) != 1 || claimed[0] != "due" {
+		t.Fatalf("claimed %v after the lease, want [due]", claimed)
+	}
+
+	if err := queue.Done(ctx, "due"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(lease + 50*time.Millisecond)
+	if claimed, _ := queue.Claim(ctx, lease, 10); len(claimed) != 0 {
+		t.Fatalf("claimed %v after Done, want nothing", claimed)
+	}
+}
+
+func TestQueueClaimCount(t *testing.T) {
+	ctx := context.Background()
+	queue := NewQueue(redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()}), "deliveries")
+
+	for i := 0; i < 5; i++ {
+		if err := queue.Schedule(ctx, strconv.Itoa(i), time.Now().Add(-time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	first, err := queue.Claim(ctx, time.Minute, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := queue.Claim(ctx, time.Minute, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first) != 3 || len(second) != 2 {
+		t.Errorf("claimed %v then %v, want 3 then the other 2", first, second)
+	}
+}